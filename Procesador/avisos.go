@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+/*
+Estructura de datos tipo JSON que representa un aviso para un usuario, por ejemplo el vencimiento pròximo de una MV
+@Id Representa el identificador ùnico del aviso
+@Persona_email Representa el email del usuario que recibe el aviso
+@Maquina_virtual_uuid Representa el uuid de la MV relacionada con el aviso. Puede estar vacìo
+@Mensaje Representa el texto del aviso
+@Leido Representa si el usuario ya consultò el aviso
+@Fecha_creacion Representa la fecha en la que se generò el aviso
+*/
+type Aviso struct {
+	Id                   int
+	Persona_email        string
+	Maquina_virtual_uuid string
+	Mensaje              string
+	Leido                bool
+	Fecha_creacion       time.Time
+}
+
+/*
+Funciòn que configura el endpoint para consultar los avisos de un usuario
+*/
+func manejarAvisos() {
+
+	//Endpoint para consultar los avisos del usuario. Los avisos consultados quedan marcados como leìdos
+	http.HandleFunc("/json/consultNotices", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Se requiere una solicitud POST", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var datos struct {
+			Email      string
+			SoloNuevos bool
+		}
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&datos); err != nil {
+			http.Error(w, "Error al decodificar JSON de la solicitud", http.StatusBadRequest)
+			return
+		}
+		if _, err := getUser(datos.Email); err != nil {
+			http.Error(w, "No se encontró el usuario", http.StatusNotFound)
+			return
+		}
+
+		query := "SELECT id, persona_email, maquina_virtual_uuid, mensaje, leido, fecha_creacion FROM aviso WHERE persona_email = ?"
+		if datos.SoloNuevos {
+			query += " AND leido = FALSE"
+		}
+		rows, err := db.Query(query+" ORDER BY fecha_creacion DESC, id DESC LIMIT 100", datos.Email)
+		if err != nil {
+			log.Println("Error al consultar los avisos:", err)
+			http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		avisos := []Aviso{}
+		var noLeidos []interface{}
+		for rows.Next() {
+			var aviso Aviso
+			var fecha string
+			if err := rows.Scan(&aviso.Id, &aviso.Persona_email, &aviso.Maquina_virtual_uuid, &aviso.Mensaje, &aviso.Leido, &fecha); err != nil {
+				log.Println("Error al obtener la fila")
+				continue
+			}
+			aviso.Fecha_creacion, _ = time.Parse("2006-01-02 15:04:05", fecha)
+			avisos = append(avisos, aviso)
+			if !aviso.Leido {
+				noLeidos = append(noLeidos, aviso.Id)
+			}
+		}
+		//Solo se marcan como leìdos los avisos retornados, no los que quedaron fuera del lìmite ni los registrados despuès
+		if len(noLeidos) > 0 {
+			marcadores := strings.TrimSuffix(strings.Repeat("?, ", len(noLeidos)), ", ")
+			if _, err := db.Exec("UPDATE aviso SET leido = TRUE WHERE id IN ("+marcadores+")", noLeidos...); err != nil {
+				log.Println("Error al marcar los avisos como leìdos:", err)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(avisos)
+	})
+}
+
+/*
+Funciòn que registra un aviso para un usuario
+@email Paràmetro que contiene el email del usuario
+@uuidVM Paràmetro que contiene el uuid de la MV relacionada. Puede estar vacìo
+@mensaje Paràmetro que contiene el texto del aviso
+*/
+func registrarAviso(email string, uuidVM string, mensaje string) {
+	fmt.Println("Aviso para " + email + ": " + mensaje)
+	_, err := db.Exec("INSERT INTO aviso (persona_email, maquina_virtual_uuid, mensaje, leido, fecha_creacion) VALUES (?, ?, ?, FALSE, ?)",
+		email, uuidVM, recortarTexto(mensaje, 255), time.Now().UTC().Format("2006-01-02 15:04:05"))
+	if err != nil {
+		log.Println("Error al registrar el aviso:", err)
+	}
+}
@@ -0,0 +1,433 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+Estructura de datos tipo JSON que representa la relaciòn entre una MV clonada y la MV de la cual se clonò
+@Maquina_virtual_uuid Representa el uuid de la MV creada con el clon
+@Origen_uuid Representa el uuid de la MV de origen
+@Modo Representa el tipo de clon: linked (enlazado a una instantànea del origen) ò full (copia completa del disco). Las MV con disco propio sin origen se registran con el modo import (archivo OVA) ò iso (imagen ISO)
+@Snapshot_id Representa la instantànea del origen sobre la que se crea un clon enlazado. Es 0 en los clones completos
+@Tamanio Representa el espacio en mb que ocupa en el host el disco de un clon completo
+*/
+type Clon struct {
+	Maquina_virtual_uuid string
+	Origen_uuid          string
+	Modo                 string
+	Snapshot_id          int
+	Tamanio              int
+}
+
+/*
+Funciòn que configura los endpoints para clonar màquinas virtuales y publicarlas en el catàlogo.
+Las solicitudes se encolan en la cola de gestiòn
+*/
+func manejarClones() {
+
+	//Endpoint para clonar una màquina virtual para el solicitante o para una lista de estudiantes
+	http.HandleFunc("/json/cloneVM", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Se requiere una solicitud POST", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var datos map[string]interface{}
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&datos); err != nil {
+			http.Error(w, "Error al decodificar JSON de la solicitud", http.StatusBadRequest)
+			return
+		}
+
+		tipoSolicitud, _ := datos["tipo_solicitud"].(string)
+		if tipoSolicitud != "clone" {
+			http.Error(w, "El campo 'tipo_solicitud' debe ser 'clone'", http.StatusBadRequest)
+			return
+		}
+
+		nombreVM, _ := datos["nombreVM"].(string)
+		email, _ := datos["email"].(string)
+		if nombreVM == "" || email == "" {
+			http.Error(w, "El nombre de la máquina virtual y el email del solicitante son obligatorios", http.StatusBadRequest)
+			return
+		}
+		if err := validarNombre(nombreVM); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if nombre, _ := datos["nombre"].(string); nombre != "" {
+			if err := validarNombre(nombre); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if modo, _ := datos["modo"].(string); modo != "" && modo != "linked" && modo != "full" {
+			http.Error(w, "El campo 'modo' debe ser 'linked' o 'full'", http.StatusBadRequest)
+			return
+		}
+
+		if mensaje, estado := validarPropietarioOAdministrador(nombreVM, email); estado != http.StatusOK {
+			http.Error(w, mensaje, estado)
+			return
+		}
+		if persona, _ := getUser(email); persona.Rol == "Invitado" {
+			http.Error(w, "Los usuarios invitados no pueden clonar máquinas virtuales", http.StatusForbidden)
+			return
+		}
+
+		// Verifica la cuota de cada propietario de los clones
+		if origen, err := getVM(nombreVM); err == nil {
+			propietarios := []string{email}
+			if lista, ok := datos["propietarios"].([]interface{}); ok && len(lista) > 0 {
+				propietarios = nil
+				for _, propietario := range lista {
+					if emailPropietario, ok := propietario.(string); ok && emailPropietario != "" {
+						propietarios = append(propietarios, emailPropietario)
+					}
+				}
+			}
+			for _, propietario := range propietarios {
+				if err := validarCuotaMV(propietario, 1, origen.Ram, origen.Cpu); err != nil {
+					http.Error(w, propietario+": "+err.Error(), http.StatusForbidden)
+					return
+				}
+			}
+		}
+
+		// Encola las peticiones.
+		identificarMV(datos)
+		mu.Lock()
+		managementQueue.Queue.PushBack(datos)
+		mu.Unlock()
+
+		// Envía una respuesta al cliente.
+		response := map[string]string{"mensaje": "Mensaje JSON para clonar MV recibido correctamente"}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(response)
+	})
+
+	//Endpoint para publicar una màquina virtual preparada como una nueva entrada del catàlogo
+	http.HandleFunc("/json/publishVM", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Se requiere una solicitud POST", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var datos map[string]interface{}
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&datos); err != nil {
+			http.Error(w, "Error al decodificar JSON de la solicitud", http.StatusBadRequest)
+			return
+		}
+
+		tipoSolicitud, _ := datos["tipo_solicitud"].(string)
+		if tipoSolicitud != "publish" {
+			http.Error(w, "El campo 'tipo_solicitud' debe ser 'publish'", http.StatusBadRequest)
+			return
+		}
+
+		nombreVM, _ := datos["nombreVM"].(string)
+		nombreCatalogo, _ := datos["nombreCatalogo"].(string)
+		email, _ := datos["email"].(string)
+		if err := validarNombre(nombreVM); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := validarNombre(nombreCatalogo); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if mensaje, estado := validarPropietarioOAdministrador(nombreVM, email); estado != http.StatusOK {
+			http.Error(w, mensaje, estado)
+			return
+		}
+
+		// Encola las peticiones.
+		identificarMV(datos)
+		mu.Lock()
+		managementQueue.Queue.PushBack(datos)
+		mu.Unlock()
+
+		// Envía una respuesta al cliente.
+		response := map[string]string{"mensaje": "Mensaje JSON para publicar MV en el catálogo recibido correctamente"}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(response)
+	})
+}
+
+/*
+Funciòn que verifica que el solicitante sea el propietario de la MV o un administrador
+@nombreVM Paràmetro que contiene el nombre de la màquina virtual
+@email Paràmetro que contiene el email del solicitante
+@return Retorna el mensaje de error y el còdigo HTTP correspondiente, o http.StatusOK si la solicitud està autorizada
+*/
+func validarPropietarioOAdministrador(nombreVM string, email string) (string, int) {
+	maquinaVirtual, err := getVM(nombreVM)
+	if err != nil {
+		return "No se encontró la máquina virtual", http.StatusNotFound
+	}
+	solicitante, err := getUser(email)
+	if err != nil {
+		return "No se encontró el usuario solicitante", http.StatusNotFound
+	}
+	if maquinaVirtual.Persona_email != solicitante.Email && solicitante.Rol != "Administrador" {
+		return "Solo el propietario de la máquina virtual o un administrador pueden realizar esta operación", http.StatusForbidden
+	}
+	return "", http.StatusOK
+}
+
+/*
+Funciòn que clona una màquina virtual una vez por cada propietario. Los clones se crean apagados en el mismo host que la MV de origen,
+ya que VirtualBox solo puede clonar màquinas registradas en el host, y reservan su RAM y CPU igual que las MV creadas con crateVM
+@nameVM Paràmetro que contiene el nombre de la màquina virtual de origen
+@modo Paràmetro que contiene el tipo de clon: linked ò full
+@nombre Paràmetro que contiene el nombre base de los clones. Si està vacìo se usa el nombre de la MV de origen
+@propietarios Paràmetro que contiene los emails de los usuarios que reciben un clon
+*/
+func clonarMV(nameVM string, modo string, nombre string, propietarios []string) string {
+
+	origen, err := getVM(nameVM)
+	if err != nil {
+		log.Println("Error al obtener la MV:", err)
+		return "Error al obtener la MV"
+	}
+
+	host, err := getHost(origen.Host_id)
+	if err != nil {
+		log.Println("Error al obtener el host:", err)
+		return "Error al obtener el host"
+	}
+
+	config, err := configurarSSH(host.Hostname, *privateKeyPath)
+	if err != nil {
+		log.Println("Error al configurar SSH:", err)
+		return "Error al configurar SSH"
+	}
+
+	if nombre == "" {
+		//Quita el sufijo aleatorio que crateVM agrega al nombre de la MV
+		nombre = origen.Nombre
+		if i := strings.LastIndex(nombre, "_"); i > 0 {
+			nombre = nombre[:i]
+		}
+	}
+
+	//Los clones enlazados comparten el disco de una instantànea de la MV de origen, que se toma una sola vez para todos los clones
+	var base Snapshot
+	if modo == "linked" {
+		var mensaje string
+		base, mensaje = registrarSnapshot(origen, host, config, "clon_"+time.Now().UTC().Format("20060102150405"), "Base de clones enlazados", true)
+		if mensaje != "" {
+			return mensaje
+		}
+	} else {
+		modo = "full"
+	}
+
+	creados := 0
+	for _, email := range propietarios {
+		if _, err := getUser(email); err != nil {
+			log.Println("No se creò el clon para " + email + ": el usuario no existe")
+			continue
+		}
+		nameClon, mensaje := generarNombreMV(nombre)
+		if nameClon == "" {
+			log.Println(mensaje)
+			continue
+		}
+		if err := reservarCuotaMV(nameClon, email, origen.Ram, origen.Cpu); err != nil {
+			log.Println("No se creò el clon para " + email + ": " + err.Error())
+			continue
+		}
+
+		//Vuelve a consultar el host para validar los recursos con las reservas de los clones anteriores
+		host, err = getHost(origen.Host_id)
+		if err != nil {
+			log.Println("Error al obtener el host:", err)
+			liberarCuotaMV(nameClon)
+			break
+		}
+		if !validarDisponibilidadRecursosHost(origen.Cpu, origen.Ram, host) {
+			log.Println("No hay recursos disponibles en el host para màs clones")
+			liberarCuotaMV(nameClon)
+			break
+		}
+
+		argumentos := []string{"clonevm", origen.Nombre, "--name", nameClon, "--register"}
+		if modo == "linked" {
+			argumentos = append(argumentos, "--snapshot", instantaneaVBox(base), "--options", "link")
+		}
+		salida, err := ejecutarVBoxManage(host, config, argumentos...)
+		if err != nil {
+			log.Println("Error al clonar la MV:", err)
+			liberarCuotaMV(nameClon)
+			return "Error al clonar la MV: " + describirErrorSSH(err)
+		}
+
+		//Los clones completos tienen un disco propio que ocupa almacenamiento en el host
+		tamanio := 0
+		if modo == "full" {
+			if info, err := obtenerInfoMV(host, config, nameClon); err == nil {
+				if medio, conectado := info.medioEn("hardisk", 0, 0); conectado {
+					if disco, err := obtenerInfoMedio(host, config, medio.Uuid); err == nil {
+						tamanio = disco.Tamanio
+					}
+				}
+			}
+		}
+
+		clon := Maquina_virtual{
+			Uuid:           parsearUUIDCreacion(salida),
+			Nombre:         nameClon,
+			Ram:            origen.Ram,
+			Cpu:            origen.Cpu,
+			Estado:         estadoApagado,
+			Hostname:       origen.Hostname,
+			Persona_email:  email,
+			Fecha_creacion: time.Now().UTC(),
+		}
+		if mensaje := registrarMVCreada(clon, host, origen.Disco_id); mensaje != "" {
+			liberarCuotaMV(nameClon)
+			descartarMVCreada(host, config, clon, false)
+			return mensaje
+		}
+		copiarRedClon(host, config, origen, clon)
+		copiarRedesPrivadasClon(origen, clon)
+		copiarMetadatosMV(origen.Uuid, clon.Uuid)
+
+		_, err = db.Exec("INSERT INTO clon (maquina_virtual_uuid, origen_uuid, modo, snapshot_id, tamanio) VALUES (?, ?, ?, ?, ?)",
+			clon.Uuid, origen.Uuid, modo, base.Id, tamanio)
+		if err != nil {
+			log.Println("Error al registrar el clon en la base de datos:", err)
+		}
+		if tamanio > 0 {
+			if _, err := db.Exec("UPDATE host SET almacenamiento_usado = almacenamiento_usado + ? WHERE id = ?", tamanio, host.Id); err != nil {
+				log.Println("Error al actualizar el almacenamiento usado del host:", err)
+			}
+		}
+		creados++
+	}
+
+	mensaje := "Se crearon " + strconv.Itoa(creados) + " de " + strconv.Itoa(len(propietarios)) + " clones"
+	fmt.Println(mensaje)
+	return mensaje
+}
+
+/*
+Funciòn que publica una MV preparada como una nueva entrada del catàlogo. Copia el disco de la MV como un disco multiconexiòn
+en la carpeta de discos del host y lo registra en las tablas disco, catalogo y catalogo_disco. La MV debe estar apagada
+@nameVM Paràmetro que contiene el nombre de la màquina virtual a publicar
+@nombreCatalogo Paràmetro que contiene el nombre de la nueva entrada del catàlogo
+*/
+func publicarMV(nameVM string, nombreCatalogo string) string {
+
+	maquinaVirtual, err := getVM(nameVM)
+	if err != nil {
+		log.Println("Error al obtener la MV:", err)
+		return "Error al obtener la MV"
+	}
+
+	discoOrigen, err := getDiskById(maquinaVirtual.Disco_id)
+	if err != nil {
+		return "Error al obtener el disco de la MV"
+	}
+
+	host, err := getHost(maquinaVirtual.Host_id)
+	if err != nil {
+		log.Println("Error al obtener el host:", err)
+		return "Error al obtener el host"
+	}
+
+	config, err := configurarSSH(host.Hostname, *privateKeyPath)
+	if err != nil {
+		log.Println("Error al configurar SSH:", err)
+		return "Error al configurar SSH"
+	}
+
+	info, err := obtenerInfoMV(host, config, nameVM)
+	if err != nil {
+		log.Println("Error al obtener la informaciòn de la MV:", err)
+		return "Error al obtener la informaciòn de la MV"
+	}
+	if info.encendida() {
+		return "Debe apagar la màquina para publicarla en el catàlogo"
+	}
+	medio, conectado := info.medioEn("hardisk", 0, 0)
+	if !conectado {
+		return "La MV no tiene un disco conectado"
+	}
+
+	dialecto := dialectoDeHost(host)
+	ruta := dialecto.unirRuta(dialecto.directorioDe(discoOrigen.Ruta_ubicacion), nombreCatalogo+".vdi")
+
+	//Copia el estado actual del disco (incluyendo los discos diferenciales) en un disco independiente
+	if _, err := ejecutarVBoxManage(host, config, "clonemedium", "disk", medio.Uuid, ruta, "--format", "VDI"); err != nil {
+		log.Println("Error al copiar el disco de la MV:", err)
+		return "Error al copiar el disco de la MV: " + describirErrorSSH(err)
+	}
+	if _, err := ejecutarVBoxManage(host, config, "modifymedium", "disk", ruta, "--type", "multiattach"); err != nil {
+		log.Println("Error al configurar el disco como multiconexiòn:", err)
+		return "Error al configurar el disco como multiconexiòn"
+	}
+
+	if disco, err := obtenerInfoMedio(host, config, ruta); err == nil && disco.Tamanio > 0 {
+		if _, err := db.Exec("UPDATE host SET almacenamiento_usado = almacenamiento_usado + ? WHERE id = ?", disco.Tamanio, host.Id); err != nil {
+			log.Println("Error al actualizar el almacenamiento usado del host:", err)
+		}
+	}
+
+	resultado, err := db.Exec("insert into disco (nombre, ruta_ubicacion, sistema_operativo, distribucion_sistema_operativo, arquitectura, host_id) values (?, ?, ?, ?, ?, ?)",
+		nombreCatalogo, ruta, discoOrigen.Sistema_operativo, discoOrigen.Distribucion_sistema_operativo, discoOrigen.arquitectura, host.Id)
+	if err != nil {
+		log.Println("Error al registrar el disco:", err)
+		return "Error al registrar el disco"
+	}
+	discoId, _ := resultado.LastInsertId()
+
+	resultado, err = db.Exec("INSERT INTO catalogo (nombre, ram, cpu) VALUES (?, ?, ?)", nombreCatalogo, maquinaVirtual.Ram, maquinaVirtual.Cpu)
+	if err != nil {
+		log.Println("Error al registrar la entrada del catàlogo:", err)
+		return "Error al registrar la entrada del catàlogo"
+	}
+	catalogoId, _ := resultado.LastInsertId()
+
+	if _, err := db.Exec("INSERT INTO catalogo_disco (catalogo_id, disco_id) VALUES (?, ?)", catalogoId, discoId); err != nil {
+		log.Println("Error al asociar el disco a la entrada del catàlogo:", err)
+		return "Error al asociar el disco a la entrada del catàlogo"
+	}
+
+	fmt.Println("MV publicada en el catàlogo correctamente")
+	return "MV publicada en el catàlogo correctamente"
+}
+
+/*
+Funciòn que obtiene el registro de clon de una MV
+@uuidVM Paràmetro que contiene el uuid de la MV
+@return Retorna el clon y true si la MV fue creada como clon de otra
+*/
+func getClon(uuidVM string) (Clon, bool) {
+	var clon Clon
+	err := db.QueryRow("SELECT maquina_virtual_uuid, origen_uuid, modo, snapshot_id, tamanio FROM clon WHERE maquina_virtual_uuid = ?", uuidVM).Scan(
+		&clon.Maquina_virtual_uuid, &clon.Origen_uuid, &clon.Modo, &clon.Snapshot_id, &clon.Tamanio)
+	return clon, err == nil
+}
+
+/*
+Funciòn que cuenta los clones enlazados que dependen de las instantàneas de una MV
+@uuidVM Paràmetro que contiene el uuid de la MV de origen
+*/
+func contarClonesEnlazados(uuidVM string) int {
+	var cantidad int
+	db.QueryRow("SELECT COUNT(*) FROM clon WHERE origen_uuid = ? AND modo = 'linked'", uuidVM).Scan(&cantidad)
+	return cantidad
+}
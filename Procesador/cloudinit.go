@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+/*
+Estructura de datos tipo JSON que contiene la configuraciòn de primer encendido (cloud-init) de una MV.
+Puede enviarse en la solicitud de creaciòn o definirse en una plantilla; los valores de la solicitud se suman a los de la plantilla
+@Hostname Representa el nombre de equipo de la MV. Si està vacìo se usa el nombre de la MV
+@Llave_ssh Representa la llave pùblica SSH autorizada para la cuenta del propietario
+@Paquetes Representa los paquetes que se instalan en el primer encendido
+@Comandos Representa los comandos que se ejecutan al final del primer encendido (runcmd)
+*/
+type ConfiguracionInicial struct {
+	Hostname  string
+	Llave_ssh string
+	Paquetes  []string
+	Comandos  []string
+}
+
+// Puerto del controlador "optico" en el que se conecta la semilla de cloud-init. El puerto 0 queda libre para otras imàgenes ISO
+const puertoSemillaCloudInit = "1"
+
+// Tiempo que se espera para retirar la semilla de cloud-init cuando el primer encendido no reportò direcciòn IP. La semilla
+// contiene el hash de la contraseña del propietario, por lo que no se deja conectada a la MV
+const esperaRetiroSemillaCloudInit = 10 * time.Minute
+
+var (
+	patronHostname   = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+	patronLlaveSSH   = regexp.MustCompile(`^(ssh-(rsa|ed25519|dss)|ecdsa-sha2-nistp(256|384|521)|sk-(ssh-ed25519|ecdsa-sha2-nistp256)@openssh\.com) [A-Za-z0-9+/=]+( [^\r\n]*)?$`)
+	patronPaquete    = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9.+_:=~-]{0,127}$`)
+	caracteresCuenta = regexp.MustCompile(`[^a-z0-9_-]`)
+)
+
+/*
+Funciòn que valida la configuraciòn de primer encendido recibida en una solicitud
+@configuracion Paràmetro que contiene la configuraciòn a validar
+*/
+func validarConfiguracionInicial(configuracion *ConfiguracionInicial) error {
+	if configuracion.Hostname != "" && !patronHostname.MatchString(configuracion.Hostname) {
+		return errors.New("el hostname solo puede contener letras minùsculas, nùmeros y '-'")
+	}
+	if configuracion.Llave_ssh != "" && !patronLlaveSSH.MatchString(strings.TrimSpace(configuracion.Llave_ssh)) {
+		return errors.New("la llave pùblica SSH no es vàlida")
+	}
+	for _, paquete := range configuracion.Paquetes {
+		if !patronPaquete.MatchString(paquete) {
+			return errors.New("el paquete '" + paquete + "' no es vàlido")
+		}
+	}
+	return nil
+}
+
+/*
+Funciòn que combina la configuraciòn de primer encendido de la plantilla con la de la solicitud
+@return Retorna nil si ninguna de las dos tiene configuraciòn
+*/
+func combinarConfiguracionInicial(plantilla *ConfiguracionInicial, solicitud *ConfiguracionInicial) *ConfiguracionInicial {
+	if plantilla == nil && solicitud == nil {
+		return nil
+	}
+	combinada := &ConfiguracionInicial{}
+	for _, configuracion := range []*ConfiguracionInicial{plantilla, solicitud} {
+		if configuracion == nil {
+			continue
+		}
+		if configuracion.Hostname != "" {
+			combinada.Hostname = configuracion.Hostname
+		}
+		if configuracion.Llave_ssh != "" {
+			combinada.Llave_ssh = configuracion.Llave_ssh
+		}
+		combinada.Paquetes = append(combinada.Paquetes, configuracion.Paquetes...)
+		combinada.Comandos = append(combinada.Comandos, configuracion.Comandos...)
+	}
+	return combinada
+}
+
+/*
+Funciòn que obtiene el nombre de la cuenta del sistema operativo de un usuario a partir de su email
+Por ejemplo: juan.perez@uqvirtual.edu.co se convierte en juan_perez
+*/
+func nombreCuentaPersona(email string) string {
+	cuenta := strings.ToLower(strings.SplitN(email, "@", 2)[0])
+	cuenta = caracteresCuenta.ReplaceAllString(strings.ReplaceAll(cuenta, ".", "_"), "")
+	if cuenta == "" || !(cuenta[0] >= 'a' && cuenta[0] <= 'z') {
+		cuenta = "u" + cuenta
+	}
+	if len(cuenta) > 32 {
+		cuenta = cuenta[:32]
+	}
+	return cuenta
+}
+
+/*
+Funciòn que genera los archivos meta-data y user-data de la semilla NoCloud.
+Ambos se generan como JSON, que cloud-init acepta porque es un subconjunto de YAML
+@maquinaVirtual Paràmetro que contiene la MV
+@persona Paràmetro que contiene el propietario de la MV, para el cual se crea la cuenta
+@configuracion Paràmetro que contiene la configuraciòn de primer encendido
+*/
+func generarSemillaCloudInit(maquinaVirtual Maquina_virtual, persona Persona, configuracion ConfiguracionInicial) (map[string][]byte, error) {
+
+	hostname := configuracion.Hostname
+	if hostname == "" {
+		hostname = strings.Trim(caracteresCuenta.ReplaceAllString(strings.ToLower(strings.ReplaceAll(maquinaVirtual.Nombre, "_", "-")), ""), "-_")
+	}
+
+	metaData, err := json.Marshal(map[string]string{
+		"instance-id":    maquinaVirtual.Uuid,
+		"local-hostname": hostname,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	//La contraseña del usuario se guarda con bcrypt, formato que reconoce libxcrypt en las distribuciones actuales
+	usuario := map[string]interface{}{
+		"name":        nombreCuentaPersona(persona.Email),
+		"gecos":       strings.TrimSpace(persona.Nombre + " " + persona.Apellido),
+		"groups":      []string{"sudo"},
+		"shell":       "/bin/bash",
+		"sudo":        "ALL=(ALL) NOPASSWD:ALL",
+		"lock_passwd": false,
+		"passwd":      persona.Contrasenia,
+	}
+	if configuracion.Llave_ssh != "" {
+		usuario["ssh_authorized_keys"] = []string{strings.TrimSpace(configuracion.Llave_ssh)}
+	}
+
+	cloudConfig := map[string]interface{}{
+		"hostname":          hostname,
+		"preserve_hostname": false,
+		//"default" conserva la cuenta de la imagen base (uqcloud) que usa la plataforma para conectarse a la MV
+		"users": []interface{}{"default", usuario},
+	}
+	if len(configuracion.Paquetes) > 0 {
+		cloudConfig["package_update"] = true
+		cloudConfig["packages"] = configuracion.Paquetes
+	}
+	if len(configuracion.Comandos) > 0 {
+		cloudConfig["runcmd"] = configuracion.Comandos
+	}
+
+	userData, err := json.Marshal(cloudConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string][]byte{
+		"meta-data": metaData,
+		"user-data": append([]byte("#cloud-config\n"), userData...),
+	}, nil
+}
+
+/*
+Funciòn que genera la imagen ISO de cloud-init de una MV, la copia a la carpeta de discos del host y la conecta a la MV
+@maquinaVirtual Paràmetro que contiene la MV reciè creada
+@host Paràmetro que contiene el host en el cual està la MV
+@config Paràmetro que contiene la configuraciòn SSH
+@disco Paràmetro que contiene el disco base de la MV. La imagen se guarda en la misma carpeta
+@configuracion Paràmetro que contiene la configuraciòn de primer encendido
+@return Retorna la ruta de la imagen en el host, o un mensaje de error
+*/
+func adjuntarSemillaCloudInit(maquinaVirtual Maquina_virtual, host Host, config *ssh.ClientConfig, disco Disco, configuracion ConfiguracionInicial) (string, string) {
+
+	persona, err := getUser(maquinaVirtual.Persona_email)
+	if err != nil {
+		return "", "Error al obtener el propietario de la MV"
+	}
+
+	archivos, err := generarSemillaCloudInit(maquinaVirtual, persona, configuracion)
+	if err != nil {
+		log.Println("Error al generar la configuraciòn de cloud-init:", err)
+		return "", "Error al generar la configuraciòn de cloud-init"
+	}
+
+	dialecto := dialectoDeHost(host)
+	ruta := dialecto.unirRuta(dialecto.directorioDe(disco.Ruta_ubicacion), maquinaVirtual.Nombre+"_cloudinit.iso")
+
+	if err := copiarArchivoAHost(host, config, ruta, crearISO("CIDATA", archivos)); err != nil {
+		log.Println("Error al copiar la imagen de cloud-init al host:", err)
+		return "", "Error al copiar la imagen de cloud-init al host"
+	}
+
+	if err := asegurarControladorOptico(host, config, maquinaVirtual.Nombre); err != nil {
+		log.Println("Error al agregar el controlador de la unidad òptica:", err)
+		return "", "Error al agregar el controlador de la unidad òptica"
+	}
+
+	if _, err := ejecutarVBoxManage(host, config, "storageattach", maquinaVirtual.Nombre, "--storagectl", "optico", "--port", puertoSemillaCloudInit, "--device", "0", "--type", "dvddrive", "--medium", ruta); err != nil {
+		log.Println("Error al conectar la imagen de cloud-init:", err)
+		return "", "Error al conectar la imagen de cloud-init"
+	}
+
+	return ruta, ""
+}
+
+/*
+Funciòn que desconecta la imagen de cloud-init despuès del primer encendido y la elimina del host.
+cloud-init guarda la configuraciòn en la MV, por lo que no la necesita en los siguientes encendidos
+@nameVM Paràmetro que contiene el nombre de la MV
+@ruta Paràmetro que contiene la ruta de la imagen en el host
+*/
+func retirarSemillaCloudInit(host Host, config *ssh.ClientConfig, nameVM string, ruta string) {
+	if _, err := ejecutarVBoxManage(host, config, "storageattach", nameVM, "--storagectl", "optico", "--port", puertoSemillaCloudInit, "--device", "0", "--type", "dvddrive", "--medium", "emptydrive"); err != nil {
+		log.Println("Error al desconectar la imagen de cloud-init:", err)
+		return
+	}
+	if _, err := ejecutarVBoxManage(host, config, "closemedium", "dvd", ruta, "--delete"); err != nil {
+		log.Println("Error al eliminar la imagen de cloud-init:", err)
+	}
+}
+
+/*
+Funciòn que agrega a la MV el controlador IDE "optico" para las unidades de DVD, si aùn no lo tiene
+@nameVM Paràmetro que contiene el nombre de la MV
+*/
+func asegurarControladorOptico(host Host, config *ssh.ClientConfig, nameVM string) error {
+	info, err := obtenerInfoMV(host, config, nameVM)
+	if err != nil {
+		return err
+	}
+	for clave, valor := range info.Valores {
+		if strings.HasPrefix(clave, "storagecontrollername") && valor == "optico" {
+			return nil
+		}
+	}
+	_, err = ejecutarVBoxManage(host, config, "storagectl", nameVM, "--name", "optico", "--add", "ide")
+	return err
+}
+
+/*
+Funciòn que retira la semilla de cloud-init despuès del tiempo de espera, para dar tiempo a que el primer encendido la lea
+aunque la MV no haya reportado su direcciòn IP
+@nameVM Paràmetro que contiene el nombre de la MV
+@ruta Paràmetro que contiene la ruta de la imagen en el host
+*/
+func retirarSemillaCloudInitDespues(host Host, config *ssh.ClientConfig, nameVM string, ruta string) {
+	time.Sleep(esperaRetiroSemillaCloudInit)
+	retirarSemillaCloudInit(host, config, nameVM, ruta)
+}
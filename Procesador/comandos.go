@@ -0,0 +1,201 @@
+package main
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Tipos de intèrprete de comandos que pueden tener los hosts a los que se envìan los comandos por SSH
+type tipoShell int
+
+const (
+	shellPOSIX      tipoShell = iota // sh, bash (Linux, Mac)
+	shellCmd                         // cmd.exe, intèrprete por defecto de OpenSSH en Windows
+	shellPowerShell                  // PowerShell
+)
+
+var errArgumentoNoSeguro = errors.New("el argumento contiene caracteres que no se pueden citar de forma segura")
+
+// Patrones de la lista de caracteres permitidos para los valores ingresados por los usuarios
+var (
+	patronNombre        = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,99}$`)
+	patronImagenDocker  = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.:/@-]{0,254}$`)
+	patronArchivo       = regexp.MustCompile(`^[A-Za-z0-9_./-]{1,255}$`)
+	patronSeguroPOSIX   = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+	patronSeguroWindows = regexp.MustCompile(`^[A-Za-z0-9_.:/\\-]+$`)
+)
+
+/*
+Estructura que representa un comando remoto como un programa y su lista de argumentos.
+El comando solo se convierte en texto al momento de enviarlo, aplicando las reglas de citado del intèrprete del host
+@Programa Representa el ejecutable a invocar. Por ejemplo: VBoxManage o docker
+@Argumentos Representa los argumentos del programa, sin citar
+*/
+type comandoRemoto struct {
+	Programa   string
+	Argumentos []string
+}
+
+func nuevoComando(programa string, argumentos ...string) comandoRemoto {
+	return comandoRemoto{Programa: programa, Argumentos: argumentos}
+}
+
+func vboxManage(argumentos ...string) comandoRemoto {
+	return nuevoComando("VBoxManage", argumentos...)
+}
+
+func docker(argumentos ...string) comandoRemoto {
+	return nuevoComando("docker", argumentos...)
+}
+
+/*
+Funciòn que convierte el comando en el texto que se envìa por SSH, citando cada argumento segùn el intèrprete
+@shell Paràmetro que contiene el tipo de intèrprete del host
+@return Retorna el comando listo para enviarse, o un error si algùn argumento no se puede citar de forma segura
+*/
+func (c comandoRemoto) construir(shell tipoShell) (string, error) {
+	partes := make([]string, 0, len(c.Argumentos)+2)
+
+	programa, err := citarArgumento(c.Programa, shell)
+	if err != nil {
+		return "", err
+	}
+	if shell == shellPowerShell {
+		partes = append(partes, "&")
+	}
+	partes = append(partes, programa)
+
+	for _, argumento := range c.Argumentos {
+		citado, err := citarArgumento(argumento, shell)
+		if err != nil {
+			return "", err
+		}
+		partes = append(partes, citado)
+	}
+
+	return strings.Join(partes, " "), nil
+}
+
+/*
+Funciòn que cita un argumento para que el intèrprete lo entregue literalmente al programa
+@argumento Paràmetro que contiene el valor a citar
+@shell Paràmetro que contiene el tipo de intèrprete del host
+*/
+func citarArgumento(argumento string, shell tipoShell) (string, error) {
+	if strings.ContainsAny(argumento, "\x00\r\n") {
+		return "", errArgumentoNoSeguro
+	}
+
+	switch shell {
+	case shellCmd:
+		if patronSeguroWindows.MatchString(argumento) {
+			return argumento, nil
+		}
+		//cmd.exe expande %VAR% y !VAR! incluso dentro de comillas y las comillas internas cambian su estado de citado
+		if strings.ContainsAny(argumento, "\"%!") {
+			return "", errArgumentoNoSeguro
+		}
+		return "\"" + duplicarBarrasFinales(argumento) + "\"", nil
+
+	case shellPowerShell:
+		if patronSeguroWindows.MatchString(argumento) {
+			return "'" + argumento + "'", nil
+		}
+		//Las comillas dobles se pierden al pasar argumentos a programas nativos en Windows PowerShell
+		if strings.Contains(argumento, "\"") {
+			return "", errArgumentoNoSeguro
+		}
+		reemplazo := strings.NewReplacer("'", "''", "\u2018", "\u2018\u2018", "\u2019", "\u2019\u2019", "\u201a", "\u201a\u201a", "\u201b", "\u201b\u201b")
+		return "'" + reemplazo.Replace(argumento) + "'", nil
+
+	default:
+		if patronSeguroPOSIX.MatchString(argumento) {
+			return argumento, nil
+		}
+		return "'" + strings.ReplaceAll(argumento, "'", `'\''`) + "'", nil
+	}
+}
+
+/*
+Funciòn que duplica las barras invertidas al final de un argumento de Windows para que no escapen la comilla de cierre.
+Por ejemplo: C:\Discos\ se convierte en C:\Discos\\ dentro de las comillas
+*/
+func duplicarBarrasFinales(argumento string) string {
+	barras := len(argumento) - len(strings.TrimRight(argumento, "\\"))
+	return argumento + strings.Repeat("\\", barras)
+}
+
+/*
+Funciòn que valida un nombre ingresado por el usuario (màquina virtual, contenedor, imagen construida)
+contra la lista de caracteres permitidos
+@nombre Paràmetro que contiene el nombre a validar
+*/
+func validarNombre(nombre string) error {
+	if !patronNombre.MatchString(nombre) {
+		return errors.New("el nombre '" + nombre + "' solo puede contener letras, nùmeros, '.', '_' y '-'")
+	}
+	return nil
+}
+
+/*
+Funciòn que valida una referencia a una imagen Docker. Por ejemplo: ubuntu, library/nginx:1.25 o registro:5000/app
+@imagen Paràmetro que contiene la referencia a validar
+*/
+func validarImagenDocker(imagen string) error {
+	if !patronImagenDocker.MatchString(imagen) {
+		return errors.New("la imagen '" + imagen + "' no es una referencia vàlida")
+	}
+	return nil
+}
+
+/*
+Funciòn que valida una ruta de archivo ingresada por el usuario. No se permiten rutas que suban de directorio
+@archivo Paràmetro que contiene la ruta a validar
+*/
+func validarArchivo(archivo string) error {
+	if !patronArchivo.MatchString(archivo) || strings.Contains(archivo, "..") {
+		return errors.New("la ruta '" + archivo + "' no es vàlida")
+	}
+	return nil
+}
+
+/*
+Funciòn que construye y envìa un comando a un host con un tiempo màximo especìfico
+@ip Paràmetro que contiene la direcciòn IP del host
+@shell Paràmetro que contiene el tipo de intèrprete del host
+@comando Paràmetro que contiene el comando a ejecutar
+@config Paràmetro que contiene la configuraciòn SSH
+@tiempo Paràmetro que contiene el tiempo màximo que puede tardar el comando
+*/
+func ejecutarComandoConTiempo(ip string, shell tipoShell, comando comandoRemoto, config *ssh.ClientConfig, tiempo time.Duration) (string, error) {
+	texto, err := comando.construir(shell)
+	if err != nil {
+		return "", err
+	}
+	return enviarComandoSSHConTiempo(ip, texto, config, tiempo)
+}
+
+/*
+Funciòn que ejecuta VBoxManage con los argumentos recibidos en el host indicado
+@host Paràmetro que contiene el host en el cual se ejecuta el comando
+@config Paràmetro que contiene la configuraciòn SSH
+@argumentos Paràmetro que contiene los argumentos de VBoxManage
+*/
+func ejecutarVBoxManage(host Host, config *ssh.ClientConfig, argumentos ...string) (string, error) {
+	return ejecutarEnHost(host, config, vboxManage(argumentos...))
+}
+
+/*
+Funciòn que ejecuta docker con los argumentos recibidos en la màquina indicada
+@ip Paràmetro que contiene la direcciòn IP de la màquina que ejecuta Docker
+@config Paràmetro que contiene la configuraciòn SSH
+@tiempo Paràmetro que contiene el tiempo màximo que puede tardar el comando
+@argumentos Paràmetro que contiene los argumentos de docker
+*/
+func ejecutarDocker(ip string, config *ssh.ClientConfig, tiempo time.Duration, argumentos ...string) (string, error) {
+	return dialectoDeMaquina(ip).ejecutar(ip, docker(argumentos...), config, tiempo)
+}
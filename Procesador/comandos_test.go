@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCitarArgumento(t *testing.T) {
+	casos := []struct {
+		nombre    string
+		shell     tipoShell
+		argumento string
+		esperado  string
+	}{
+		//POSIX: los valores seguros van sin comillas y el resto entre comillas simples
+		{"POSIX seguro", shellPOSIX, "disco-1.vdi", "disco-1.vdi"},
+		{"POSIX ruta", shellPOSIX, "/home/user/VirtualBox VMs", "'/home/user/VirtualBox VMs'"},
+		{"POSIX vacìo", shellPOSIX, "", "''"},
+		{"POSIX comilla simple", shellPOSIX, "it's", `'it'\''s'`},
+		{"POSIX comillas dobles", shellPOSIX, `"hola"`, `'"hola"'`},
+		{"POSIX sustituciòn", shellPOSIX, "$(rm -rf /)", "'$(rm -rf /)'"},
+		{"POSIX comillas invertidas", shellPOSIX, "`id`", "'`id`'"},
+		{"POSIX metacaracteres", shellPOSIX, "a;b|c&d>e<f*", "'a;b|c&d>e<f*'"},
+		{"POSIX barra invertida", shellPOSIX, `a\b`, `'a\b'`},
+		//cmd: los valores seguros van sin comillas y el resto entre comillas dobles
+		{"cmd seguro", shellCmd, `C:\VMs\disco.vdi`, `C:\VMs\disco.vdi`},
+		{"cmd espacios", shellCmd, `C:\Users\user\VirtualBox VMs`, `"C:\Users\user\VirtualBox VMs"`},
+		{"cmd vacìo", shellCmd, "", `""`},
+		{"cmd barra final", shellCmd, `C:\Mis Discos\`, `"C:\Mis Discos\\"`},
+		{"cmd varias barras finales", shellCmd, `C:\Mis Discos\\`, `"C:\Mis Discos\\\\"`},
+		{"cmd metacaracteres", shellCmd, "a&b|c>d<e^f", `"a&b|c>d<e^f"`},
+		{"cmd comilla simple", shellCmd, "it's", `"it's"`},
+		//PowerShell: todo va entre comillas simples, duplicando las comillas simples internas
+		{"PowerShell seguro", shellPowerShell, `C:\VMs\disco.vdi`, `'C:\VMs\disco.vdi'`},
+		{"PowerShell espacios", shellPowerShell, "Mi VM", "'Mi VM'"},
+		{"PowerShell vacìo", shellPowerShell, "", "''"},
+		{"PowerShell comilla simple", shellPowerShell, "it's", "'it''s'"},
+		{"PowerShell comillas tipogràficas", shellPowerShell, "it\u2019s \u2018x\u2019", "'it\u2019\u2019s \u2018\u2018x\u2019\u2019'"},
+		{"PowerShell variables", shellPowerShell, "$env:PATH; Remove-Item", "'$env:PATH; Remove-Item'"},
+		{"PowerShell metacaracteres", shellPowerShell, "a&b|c>d`e@(f)", "'a&b|c>d`e@(f)'"},
+	}
+	for _, caso := range casos {
+		t.Run(caso.nombre, func(t *testing.T) {
+			citado, err := citarArgumento(caso.argumento, caso.shell)
+			if err != nil {
+				t.Fatalf("citarArgumento(%q) retornò el error %v", caso.argumento, err)
+			}
+			if citado != caso.esperado {
+				t.Errorf("citarArgumento(%q) = %s, se esperaba %s", caso.argumento, citado, caso.esperado)
+			}
+		})
+	}
+}
+
+func TestCitarArgumentoNoSeguro(t *testing.T) {
+	casos := []struct {
+		nombre    string
+		shell     tipoShell
+		argumento string
+	}{
+		{"POSIX salto de lìnea", shellPOSIX, "a\nb"},
+		{"POSIX retorno de carro", shellPOSIX, "a\rb"},
+		{"POSIX byte nulo", shellPOSIX, "a\x00b"},
+		{"cmd salto de lìnea", shellCmd, "a\nb"},
+		{"cmd comillas dobles", shellCmd, `a "b" c`},
+		{"cmd variable", shellCmd, "%PATH%"},
+		{"cmd expansiòn retardada", shellCmd, "!PATH!"},
+		{"PowerShell salto de lìnea", shellPowerShell, "a\nb"},
+		{"PowerShell comillas dobles", shellPowerShell, `a "b" c`},
+	}
+	for _, caso := range casos {
+		t.Run(caso.nombre, func(t *testing.T) {
+			if citado, err := citarArgumento(caso.argumento, caso.shell); !errors.Is(err, errArgumentoNoSeguro) {
+				t.Errorf("citarArgumento(%q) = %q, %v, se esperaba errArgumentoNoSeguro", caso.argumento, citado, err)
+			}
+		})
+	}
+}
+
+func TestConstruirComando(t *testing.T) {
+	comando := vboxManage("startvm", "Mi VM", "--type", "headless")
+	casos := []struct {
+		nombre   string
+		shell    tipoShell
+		esperado string
+	}{
+		{"POSIX", shellPOSIX, "VBoxManage startvm 'Mi VM' --type headless"},
+		{"cmd", shellCmd, `VBoxManage startvm "Mi VM" --type headless`},
+		{"PowerShell", shellPowerShell, "& 'VBoxManage' 'startvm' 'Mi VM' '--type' 'headless'"},
+	}
+	for _, caso := range casos {
+		texto, err := comando.construir(caso.shell)
+		if err != nil {
+			t.Fatalf("construir(%s) retornò el error %v", caso.nombre, err)
+		}
+		if texto != caso.esperado {
+			t.Errorf("construir(%s) = %s, se esperaba %s", caso.nombre, texto, caso.esperado)
+		}
+	}
+
+	//Un solo argumento inseguro invalida todo el comando
+	for _, shell := range []tipoShell{shellPOSIX, shellCmd, shellPowerShell} {
+		if texto, err := vboxManage("startvm", "a\nreboot").construir(shell); err == nil {
+			t.Errorf("construir con un salto de lìnea retornò %q sin error", texto)
+		}
+	}
+}
@@ -0,0 +1,582 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+/*
+Estructura que contiene la polìtica de concesiòn de las MV de un rol
+@Duracion Representa el tiempo que dura la concesiòn de una MV nueva. Si es 0 las MV no vencen
+@Extension Representa el tiempo que se agrega en cada extensiòn
+@MaxExtensiones Representa la cantidad de extensiones que puede solicitar el propietario
+@Aviso Representa el tiempo antes del vencimiento en el que se avisa al propietario
+@Gracia Representa el tiempo que pasa entre el apagado de la MV vencida y su eliminaciòn
+*/
+type politicaConcesion struct {
+	Duracion       time.Duration
+	Extension      time.Duration
+	MaxExtensiones int
+	Aviso          time.Duration
+	Gracia         time.Duration
+}
+
+/*
+Estructura de datos tipo JSON que representa la polìtica de concesiòn configurada para un rol, con los tiempos en minutos
+@Rol Representa el rol
+@Duracion Representa los minutos que dura la concesiòn de una MV nueva. Si es 0 las MV no vencen
+@Extension Representa los minutos que se agregan en cada extensiòn
+@MaxExtensiones Representa la cantidad de extensiones que puede solicitar el propietario
+@Aviso Representa los minutos antes del vencimiento en los que se avisa al propietario
+@Gracia Representa los minutos que pasan entre el apagado de la MV vencida y su eliminaciòn
+*/
+type PoliticaConcesionRol struct {
+	Rol            string
+	Duracion       int
+	Extension      int
+	MaxExtensiones int
+	Aviso          int
+	Gracia         int
+}
+
+/*
+Estructura de datos tipo JSON que representa la concesiòn de una MV, es decir, el tiempo durante el cual puede existir
+@Maquina_virtual_uuid Representa el uuid de la MV
+@Fecha_expiracion Representa el momento en el que vence la concesiòn. Si es la fecha cero la MV no vence
+@Extensiones Representa la cantidad de extensiones solicitadas
+@Extensiones_restantes Representa la cantidad de extensiones que aùn se pueden solicitar
+@Estado Representa el estado de la concesiòn: vigente, avisada (ya se avisò el vencimiento), detenida (vencida y apagada) ò eliminando
+@Fecha_detencion Representa el momento en el que se apagò la MV por vencimiento
+@Fecha_eliminacion Representa el momento a partir del cual se elimina la MV vencida
+*/
+type Concesion struct {
+	Maquina_virtual_uuid  string
+	Fecha_expiracion      time.Time
+	Extensiones           int
+	Extensiones_restantes int
+	Estado                string
+	Fecha_detencion       time.Time
+	Fecha_eliminacion     time.Time
+}
+
+// Estados de una concesiòn
+const (
+	concesionVigente    = "vigente"
+	concesionAvisada    = "avisada"
+	concesionDetenida   = "detenida"
+	concesionEliminando = "eliminando"
+)
+
+// Intervalo con el que se revisan las concesiones
+const intervaloConcesiones = time.Minute
+
+var (
+	//Polìtica de concesiòn inicial de las MV segùn el rol del propietario. Se registra en la tabla concesion_rol para los roles
+	//que aùn no tienen polìtica; desde ahì la configuran los administradores. Las MV de los invitados duran 2 horas y 20 minutos
+	politicaConcesionInicialPorRol = map[string]politicaConcesion{
+		"Administrador": {},
+		"Estudiante": {
+			Duracion:       30 * 24 * time.Hour,
+			Extension:      7 * 24 * time.Hour,
+			MaxExtensiones: 4,
+			Aviso:          48 * time.Hour,
+			Gracia:         7 * 24 * time.Hour,
+		},
+		"Invitado": {
+			Duracion: 2*time.Hour + 20*time.Minute,
+			Aviso:    15 * time.Minute,
+		},
+	}
+
+	muConcesiones sync.Mutex
+)
+
+/*
+Funciòn que obtiene la polìtica de concesiòn configurada de un rol. Los roles sin polìtica usan la de los estudiantes y,
+si la base de datos no responde, se usa la polìtica inicial
+*/
+func politicaConcesionRol(rol string) politicaConcesion {
+	var configurada PoliticaConcesionRol
+	err := db.QueryRow("SELECT duracion, extension, max_extensiones, aviso, gracia FROM concesion_rol WHERE rol IN (?, 'Estudiante') ORDER BY rol = ? DESC LIMIT 1",
+		rol, rol).Scan(&configurada.Duracion, &configurada.Extension, &configurada.MaxExtensiones, &configurada.Aviso, &configurada.Gracia)
+	if err == nil {
+		return configurada.politica()
+	}
+	if err != sql.ErrNoRows {
+		log.Println("Error al consultar la polìtica de concesiòn del rol:", err)
+	}
+	if politica, existe := politicaConcesionInicialPorRol[rol]; existe {
+		return politica
+	}
+	return politicaConcesionInicialPorRol["Estudiante"]
+}
+
+/*
+Funciòn que convierte la polìtica configurada de un rol, en minutos, en una polìtica de concesiòn
+*/
+func (configurada PoliticaConcesionRol) politica() politicaConcesion {
+	return politicaConcesion{
+		Duracion:       time.Duration(configurada.Duracion) * time.Minute,
+		Extension:      time.Duration(configurada.Extension) * time.Minute,
+		MaxExtensiones: configurada.MaxExtensiones,
+		Aviso:          time.Duration(configurada.Aviso) * time.Minute,
+		Gracia:         time.Duration(configurada.Gracia) * time.Minute,
+	}
+}
+
+/*
+Funciòn que registra la polìtica de concesiòn inicial de los roles que aùn no tienen polìtica en la tabla concesion_rol
+*/
+func inicializarPoliticasConcesion() {
+	for rol, politica := range politicaConcesionInicialPorRol {
+		_, err := db.Exec("INSERT IGNORE INTO concesion_rol (rol, duracion, extension, max_extensiones, aviso, gracia) VALUES (?, ?, ?, ?, ?, ?)",
+			rol, int(politica.Duracion.Minutes()), int(politica.Extension.Minutes()), politica.MaxExtensiones,
+			int(politica.Aviso.Minutes()), int(politica.Gracia.Minutes()))
+		if err != nil {
+			log.Println("Error al registrar la polìtica de concesiòn inicial del rol "+rol+":", err)
+		}
+	}
+}
+
+/*
+Funciòn que consulta la polìtica de concesiòn configurada de cada rol
+*/
+func consultPoliticasConcesion() ([]PoliticaConcesionRol, error) {
+	rows, err := db.Query("SELECT rol, duracion, extension, max_extensiones, aviso, gracia FROM concesion_rol ORDER BY rol")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	politicas := []PoliticaConcesionRol{}
+	for rows.Next() {
+		var politica PoliticaConcesionRol
+		if err := rows.Scan(&politica.Rol, &politica.Duracion, &politica.Extension, &politica.MaxExtensiones, &politica.Aviso, &politica.Gracia); err != nil {
+			return nil, err
+		}
+		politicas = append(politicas, politica)
+	}
+	return politicas, rows.Err()
+}
+
+/*
+Funciòn que verifica y guarda la polìtica de concesiòn de un rol. Las concesiones ya asignadas mantienen su vencimiento
+*/
+func guardarPoliticaConcesion(politica PoliticaConcesionRol) error {
+	if politica.Rol == "" || len(politica.Rol) > 50 {
+		return fmt.Errorf("el rol debe tener entre 1 y 50 caracteres")
+	}
+	if politica.Duracion < 0 || politica.Extension < 0 || politica.MaxExtensiones < 0 || politica.Aviso < 0 || politica.Gracia < 0 {
+		return fmt.Errorf("los tiempos y la cantidad de extensiones no pueden ser negativos")
+	}
+	if politica.Duracion > 0 && politica.Aviso >= politica.Duracion {
+		return fmt.Errorf("el aviso debe ser menor que la duración de la concesión")
+	}
+	_, err := db.Exec(`INSERT INTO concesion_rol (rol, duracion, extension, max_extensiones, aviso, gracia) VALUES (?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE duracion = VALUES(duracion), extension = VALUES(extension), max_extensiones = VALUES(max_extensiones),
+		aviso = VALUES(aviso), gracia = VALUES(gracia)`,
+		politica.Rol, politica.Duracion, politica.Extension, politica.MaxExtensiones, politica.Aviso, politica.Gracia)
+	if err != nil {
+		log.Println("Error al guardar la polìtica de concesiòn:", err)
+		return fmt.Errorf("no se pudo guardar la política de concesión")
+	}
+	return nil
+}
+
+/*
+Funciòn que configura los endpoints para consultar y extender la concesiòn de una MV y para configurar la polìtica de concesiòn de los roles
+*/
+func manejarConcesiones() {
+
+	//Endpoint para que un administrador consulte la polìtica de concesiòn de cada rol
+	http.HandleFunc("/json/consultLeasePolicies", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Se requiere una solicitud Get", http.StatusMethodNotAllowed)
+			return
+		}
+		if !esAdministrador(r.URL.Query().Get("email")) {
+			http.Error(w, "Solo los administradores pueden consultar las políticas de concesión", http.StatusForbidden)
+			return
+		}
+
+		politicas, err := consultPoliticasConcesion()
+		if err != nil {
+			log.Println("Error al consultar las polìticas de concesiòn:", err)
+			http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(politicas)
+	})
+
+	//Endpoint para que un administrador configure la polìtica de concesiòn de un rol. Se aplica a las MV nuevas y a las extensiones
+	http.HandleFunc("/json/setLeasePolicy", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Se requiere una solicitud POST", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var datos struct {
+			Email    string
+			Politica PoliticaConcesionRol
+		}
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&datos); err != nil {
+			http.Error(w, "Error al decodificar JSON de la solicitud", http.StatusBadRequest)
+			return
+		}
+		if !esAdministrador(datos.Email) {
+			http.Error(w, "Solo los administradores pueden configurar las políticas de concesión", http.StatusForbidden)
+			return
+		}
+		if err := guardarPoliticaConcesion(datos.Politica); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		response := map[string]string{"mensaje": "Política de concesión guardada correctamente"}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(response)
+	})
+
+	//Endpoint para consultar la concesiòn de una MV
+	http.HandleFunc("/json/consultLease", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Se requiere una solicitud POST", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var datos struct {
+			Email    string
+			NombreVM string
+		}
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&datos); err != nil {
+			http.Error(w, "Error al decodificar JSON de la solicitud", http.StatusBadRequest)
+			return
+		}
+		if err := validarNombre(datos.NombreVM); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if mensaje, estado := validarPropietarioOAdministrador(datos.NombreVM, datos.Email); estado != http.StatusOK {
+			http.Error(w, mensaje, estado)
+			return
+		}
+		maquinaVirtual, _ := getVM(datos.NombreVM)
+		concesion, err := getConcesionMV(maquinaVirtual)
+		if err != nil {
+			http.Error(w, "La máquina virtual no tiene concesión", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(concesion)
+	})
+
+	//Endpoint para extender la concesiòn de una MV. Las MV vencidas que aùn no se han eliminado vuelven a estar vigentes
+	http.HandleFunc("/json/extendLease", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Se requiere una solicitud POST", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var datos struct {
+			Email    string
+			NombreVM string
+		}
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&datos); err != nil {
+			http.Error(w, "Error al decodificar JSON de la solicitud", http.StatusBadRequest)
+			return
+		}
+		if err := validarNombre(datos.NombreVM); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if mensaje, estado := validarPropietarioOAdministrador(datos.NombreVM, datos.Email); estado != http.StatusOK {
+			http.Error(w, mensaje, estado)
+			return
+		}
+		solicitante, _ := getUser(datos.Email)
+		maquinaVirtual, _ := getVM(datos.NombreVM)
+
+		concesion, mensaje, estado := extenderConcesionMV(maquinaVirtual, solicitante.Rol == "Administrador")
+		if estado != http.StatusOK {
+			http.Error(w, mensaje, estado)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(concesion)
+	})
+}
+
+/*
+Funciòn que asigna la concesiòn a una MV reciè creada segùn el rol de su propietario
+@maquinaVirtual Paràmetro que contiene la MV. Se usan su uuid y el email del propietario
+*/
+func asignarConcesionMV(maquinaVirtual Maquina_virtual) {
+
+	var expiracion interface{}
+	if propietario, err := getUser(maquinaVirtual.Persona_email); err == nil {
+		if politica := politicaConcesionRol(propietario.Rol); politica.Duracion > 0 {
+			expiracion = time.Now().UTC().Add(politica.Duracion).Format("2006-01-02 15:04:05")
+		}
+	}
+	_, err := db.Exec("INSERT IGNORE INTO concesion (maquina_virtual_uuid, fecha_expiracion, extensiones, estado) VALUES (?, ?, 0, ?)",
+		maquinaVirtual.Uuid, expiracion, concesionVigente)
+	if err != nil {
+		log.Println("Error al registrar la concesiòn de la MV:", err)
+	}
+}
+
+/*
+Funciòn que consulta la concesiòn de una MV y calcula sus extensiones restantes y su fecha de eliminaciòn
+@maquinaVirtual Paràmetro que contiene la MV. Se usan su uuid y el email del propietario
+*/
+func getConcesionMV(maquinaVirtual Maquina_virtual) (Concesion, error) {
+
+	var concesion Concesion
+	var expiracion, detencion sql.NullString
+	err := db.QueryRow("SELECT maquina_virtual_uuid, fecha_expiracion, extensiones, estado, fecha_detencion FROM concesion WHERE maquina_virtual_uuid = ?", maquinaVirtual.Uuid).Scan(
+		&concesion.Maquina_virtual_uuid, &expiracion, &concesion.Extensiones, &concesion.Estado, &detencion)
+	if err != nil {
+		return concesion, err
+	}
+	concesion.Fecha_expiracion, _ = time.Parse("2006-01-02 15:04:05", expiracion.String)
+	concesion.Fecha_detencion, _ = time.Parse("2006-01-02 15:04:05", detencion.String)
+
+	var politica politicaConcesion
+	if propietario, err := getUser(maquinaVirtual.Persona_email); err == nil {
+		politica = politicaConcesionRol(propietario.Rol)
+	}
+	if concesion.Extensiones_restantes = politica.MaxExtensiones - concesion.Extensiones; concesion.Extensiones_restantes < 0 {
+		concesion.Extensiones_restantes = 0
+	}
+	if !concesion.Fecha_expiracion.IsZero() {
+		concesion.Fecha_eliminacion = concesion.Fecha_expiracion.Add(politica.Gracia)
+		if concesion.Fecha_detencion.After(concesion.Fecha_expiracion) {
+			concesion.Fecha_eliminacion = concesion.Fecha_detencion.Add(politica.Gracia)
+		}
+	}
+	return concesion, nil
+}
+
+/*
+Funciòn que extiende la concesiòn de una MV con el tiempo de extensiòn del rol del propietario. La extensiòn se cuenta
+desde el vencimiento, ò desde el momento actual si la concesiòn ya venciò
+@administrador Paràmetro que indica si la solicita un administrador, que no tiene lìmite de extensiones
+@return Retorna la concesiòn extendida, un mensaje de error y el còdigo HTTP del resultado
+*/
+func extenderConcesionMV(maquinaVirtual Maquina_virtual, administrador bool) (Concesion, string, int) {
+
+	concesion, err := getConcesionMV(maquinaVirtual)
+	if err != nil {
+		return concesion, "La máquina virtual no tiene concesión", http.StatusNotFound
+	}
+	if concesion.Fecha_expiracion.IsZero() {
+		return concesion, "La máquina virtual no vence", http.StatusConflict
+	}
+	if concesion.Estado == concesionEliminando {
+		return concesion, "La máquina virtual vencida ya se está eliminando", http.StatusConflict
+	}
+	var politica politicaConcesion
+	if propietario, err := getUser(maquinaVirtual.Persona_email); err == nil {
+		politica = politicaConcesionRol(propietario.Rol)
+	}
+	extension := politica.Extension
+	if administrador && extension == 0 {
+		extension = politica.Duracion
+	}
+	if extension == 0 || (!administrador && concesion.Extensiones_restantes == 0) {
+		return concesion, "La concesión de la máquina virtual no se puede extender más", http.StatusForbidden
+	}
+
+	desde := concesion.Fecha_expiracion
+	if ahora := time.Now().UTC(); desde.Before(ahora) {
+		desde = ahora
+	}
+	_, err = db.Exec("UPDATE concesion SET fecha_expiracion = ?, extensiones = extensiones + 1, estado = ?, fecha_detencion = NULL WHERE maquina_virtual_uuid = ? AND estado <> ?",
+		desde.Add(extension).Format("2006-01-02 15:04:05"), concesionVigente, maquinaVirtual.Uuid, concesionEliminando)
+	if err != nil {
+		log.Println("Error al extender la concesiòn de la MV:", err)
+		return concesion, "Error al extender la concesión", http.StatusInternalServerError
+	}
+	concesion, _ = getConcesionMV(maquinaVirtual)
+	return concesion, "", http.StatusOK
+}
+
+/*
+Funciòn que indica si la concesiòn de una MV ya venciò. Las MV vencidas no se pueden encender
+@uuidVM Paràmetro que contiene el uuid de la MV
+*/
+func concesionVencida(uuidVM string) bool {
+	var vencida bool
+	err := db.QueryRow("SELECT fecha_expiracion IS NOT NULL AND fecha_expiracion <= ? FROM concesion WHERE maquina_virtual_uuid = ?",
+		time.Now().UTC().Format("2006-01-02 15:04:05"), uuidVM).Scan(&vencida)
+	return err == nil && vencida
+}
+
+/*
+Funciòn que elimina la concesiòn de una MV eliminada
+*/
+func eliminarConcesionMV(uuidVM string) {
+	db.Exec("DELETE FROM concesion WHERE maquina_virtual_uuid = ?", uuidVM)
+}
+
+/*
+Funciòn que establece el disparador que revisa las concesiones de las MV
+*/
+func checkConcesiones() {
+
+	timeTicker := time.NewTicker(intervaloConcesiones)
+
+	for range timeTicker.C {
+		go revisarConcesiones()
+	}
+}
+
+/*
+Funciòn que revisa las concesiones: asigna concesiòn a las MV que aùn no tienen, avisa a los propietarios de las MV
+que estàn por vencer, apaga las MV vencidas y elimina las que superaron el periodo de gracia
+*/
+func revisarConcesiones() {
+
+	if !muConcesiones.TryLock() {
+		return
+	}
+	defer muConcesiones.Unlock()
+
+	//Las MV creadas antes de las concesiones reciben una concesiòn desde el momento actual
+	rows, err := db.Query("SELECT m.uuid, m.persona_email FROM maquina_virtual AS m LEFT JOIN concesion AS c ON c.maquina_virtual_uuid = m.uuid WHERE c.maquina_virtual_uuid IS NULL")
+	if err != nil {
+		log.Println("Error al consultar las MV sin concesiòn:", err)
+		return
+	}
+	var sinConcesion []Maquina_virtual
+	for rows.Next() {
+		var maquinaVirtual Maquina_virtual
+		if err := rows.Scan(&maquinaVirtual.Uuid, &maquinaVirtual.Persona_email); err == nil {
+			sinConcesion = append(sinConcesion, maquinaVirtual)
+		}
+	}
+	rows.Close()
+	for _, maquinaVirtual := range sinConcesion {
+		asignarConcesionMV(maquinaVirtual)
+	}
+
+	rows, err = db.Query("SELECT m.uuid, m.nombre, m.estado, m.persona_email FROM concesion AS c INNER JOIN maquina_virtual AS m ON m.uuid = c.maquina_virtual_uuid WHERE c.fecha_expiracion IS NOT NULL AND c.estado <> ?", concesionEliminando)
+	if err != nil {
+		log.Println("Error al consultar las concesiones:", err)
+		return
+	}
+	var maquinas []Maquina_virtual
+	for rows.Next() {
+		var maquinaVirtual Maquina_virtual
+		if err := rows.Scan(&maquinaVirtual.Uuid, &maquinaVirtual.Nombre, &maquinaVirtual.Estado, &maquinaVirtual.Persona_email); err == nil {
+			maquinas = append(maquinas, maquinaVirtual)
+		}
+	}
+	rows.Close()
+
+	ahora := time.Now().UTC()
+	for _, maquinaVirtual := range maquinas {
+		concesion, err := getConcesionMV(maquinaVirtual)
+		if err != nil {
+			continue
+		}
+		revisarConcesionMV(maquinaVirtual, concesion, ahora)
+	}
+}
+
+/*
+Funciòn que aplica a una MV la etapa de su concesiòn que corresponde al momento actual
+*/
+func revisarConcesionMV(maquinaVirtual Maquina_virtual, concesion Concesion, ahora time.Time) {
+
+	var politica politicaConcesion
+	if propietario, err := getUser(maquinaVirtual.Persona_email); err == nil {
+		politica = politicaConcesionRol(propietario.Rol)
+	}
+	encendida := maquinaVirtual.Estado == estadoEncendido || maquinaVirtual.Estado == estadoPausado || maquinaVirtual.Estado == estadoEncendiendo
+
+	switch concesion.Estado {
+	case concesionVigente, concesionAvisada:
+		if !ahora.Before(concesion.Fecha_expiracion) {
+			fechaDetencion := ahora.Format("2006-01-02 15:04:05")
+			if _, err := db.Exec("UPDATE concesion SET estado = ?, fecha_detencion = ? WHERE maquina_virtual_uuid = ?", concesionDetenida, fechaDetencion, maquinaVirtual.Uuid); err != nil {
+				log.Println("Error al actualizar la concesiòn de la MV:", err)
+				return
+			}
+			if encendida {
+				encolarSolicitudConcesion("shutdown", maquinaVirtual)
+			}
+			registrarAviso(maquinaVirtual.Persona_email, maquinaVirtual.Uuid, fmt.Sprintf("La máquina virtual %s venció y se apagó. Se eliminará el %s (UTC) si no se extiende su concesión",
+				maquinaVirtual.Nombre, ahora.Add(politica.Gracia).Format("2006-01-02 15:04")))
+			return
+		}
+		if concesion.Estado == concesionVigente && concesion.Fecha_expiracion.Sub(ahora) <= politica.Aviso {
+			db.Exec("UPDATE concesion SET estado = ? WHERE maquina_virtual_uuid = ? AND estado = ?", concesionAvisada, maquinaVirtual.Uuid, concesionVigente)
+			registrarAviso(maquinaVirtual.Persona_email, maquinaVirtual.Uuid, fmt.Sprintf("La máquina virtual %s vence el %s (UTC)",
+				maquinaVirtual.Nombre, concesion.Fecha_expiracion.Format("2006-01-02 15:04")))
+		}
+
+	case concesionDetenida:
+		if encendida {
+			//La MV vencida no atendiò el apagado ACPI; se fuerza el apagado antes de eliminarla
+			if maquinaVirtual.Estado != estadoEncendiendo {
+				encolarSolicitudConcesion("poweroff", maquinaVirtual)
+			}
+			return
+		}
+		if ahora.Before(concesion.Fecha_eliminacion) {
+			return
+		}
+		if _, err := db.Exec("UPDATE concesion SET estado = ? WHERE maquina_virtual_uuid = ?", concesionEliminando, maquinaVirtual.Uuid); err != nil {
+			log.Println("Error al actualizar la concesiòn de la MV:", err)
+			return
+		}
+		go eliminarMVVencida(maquinaVirtual)
+	}
+}
+
+/*
+Funciòn que elimina una MV vencida. Si la eliminaciòn falla (por ejemplo, porque la MV tiene clones enlazados ò el host
+no responde), la concesiòn vuelve a quedar detenida para que la siguiente revisiòn lo intente de nuevo
+*/
+func eliminarMVVencida(maquinaVirtual Maquina_virtual) {
+	fmt.Println("Concesiòn vencida: delete de la màquina " + maquinaVirtual.Nombre)
+	mensaje := deleteVM(maquinaVirtual.Uuid)
+	if _, err := getVM(maquinaVirtual.Uuid); err != sql.ErrNoRows {
+		log.Println("No se pudo eliminar la MV vencida " + maquinaVirtual.Nombre + ": " + mensaje)
+		if _, err := db.Exec("UPDATE concesion SET estado = ? WHERE maquina_virtual_uuid = ? AND estado = ?", concesionDetenida, maquinaVirtual.Uuid, concesionEliminando); err != nil {
+			log.Println("Error al actualizar la concesiòn de la MV:", err)
+		}
+		return
+	}
+	registrarAviso(maquinaVirtual.Persona_email, "", "La máquina virtual "+maquinaVirtual.Nombre+" se eliminó porque venció su concesión")
+}
+
+/*
+Funciòn que encola en la cola de gestiòn el apagado de una MV vencida
+@tipoSolicitud Paràmetro que contiene el tipo de solicitud: shutdown ò poweroff
+*/
+func encolarSolicitudConcesion(tipoSolicitud string, maquinaVirtual Maquina_virtual) {
+	fmt.Println("Concesiòn vencida: " + tipoSolicitud + " de la màquina " + maquinaVirtual.Nombre)
+	mu.Lock()
+	managementQueue.Queue.PushBack(map[string]interface{}{
+		"tipo_solicitud": tipoSolicitud,
+		"nombreVM":       maquinaVirtual.Uuid,
+	})
+	mu.Unlock()
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/ssh"
+)
+
+/*
+Estructura de datos tipo JSON con los datos de conexiòn a la consola remota (VRDE) de una MV
+@Direccion Representa la direcciòn a la que se conecta el cliente RDP: el host de la MV, o el servidor si se usa el proxy
+@Puerto Representa el puerto al que se conecta el cliente RDP
+@Usuario Representa el usuario de la sesiòn
+@Contrasenia Representa la contraseña de la sesiòn. Solo se entrega una vez y no se guarda en la base de datos
+@Expiracion Representa el momento a partir del cual las credenciales ya no permiten iniciar sesiòn
+@Proxy Representa si la conexiòn pasa por el proxy del servidor
+*/
+type SesionConsola struct {
+	Direccion   string
+	Puerto      int
+	Usuario     string
+	Contrasenia string
+	Expiracion  time.Time
+	Proxy       bool
+}
+
+// Rangos de puertos de las consolas en cada host y de los proxys del servidor y duraciòn de las credenciales de una sesiòn
+const (
+	puertoConsolaInicial      = 5000
+	puertoConsolaFinal        = 5999
+	puertoProxyConsolaInicial = 33890
+	puertoProxyConsolaFinal   = 33989
+	duracionSesionConsola     = 15 * time.Minute
+)
+
+// Variable que almacena la direcciòn pùblica del servidor para el proxy RDP. Si està vacìa los clientes se conectan directamente al host
+var proxyConsola = flag.String("proxyConsola", "", "Dirección pública del servidor para enviar las consolas RDP a través de un proxy")
+
+/*
+Funciòn que configura el endpoint para obtener los datos de conexiòn a la consola de una MV.
+La solicitud debe incluir la contraseña del usuario, ya que entrega credenciales para controlar la MV
+*/
+func manejarConsola() {
+
+	http.HandleFunc("/json/consoleVM", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Se requiere una solicitud POST", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var datos struct {
+			Email       string
+			Contrasenia string
+			NombreVM    string
+			ClientIP    string
+		}
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&datos); err != nil {
+			http.Error(w, "Error al decodificar JSON de la solicitud", http.StatusBadRequest)
+			return
+		}
+
+		if mensaje, estado := autenticarSolicitudConsola(datos.Email, datos.Contrasenia, datos.NombreVM); estado != http.StatusOK {
+			http.Error(w, mensaje, estado)
+			return
+		}
+
+		sesion, mensaje := abrirSesionConsola(datos.NombreVM, datos.ClientIP, *proxyConsola != "")
+		if mensaje != "" {
+			http.Error(w, mensaje, http.StatusConflict)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(sesion)
+	})
+}
+
+/*
+Funciòn que verifica la contraseña del solicitante y que sea el propietario de la MV o un administrador
+@return Retorna el mensaje de error y el còdigo HTTP correspondiente, o http.StatusOK si la solicitud està autorizada
+*/
+func autenticarSolicitudConsola(email string, contrasenia string, nombreVM string) (string, int) {
+	persona, err := getUser(email)
+	if err != nil || bcrypt.CompareHashAndPassword([]byte(persona.Contrasenia), []byte(contrasenia)) != nil {
+		return "Credenciales incorrectas", http.StatusUnauthorized
+	}
+	return validarPropietarioOAdministrador(nombreVM, email)
+}
+
+/*
+Funciòn que habilita la consola remota de una MV apagada en un puerto ùnico de su host.
+La autenticaciòn se delega en VBoxAuthSimple, que valida las credenciales de cada sesiòn guardadas en los datos extra de la MV.
+Tambièn habilita el primer puerto serie de la MV, que solo es accesible desde el host (ver configurarPuertoSerie)
+@maquinaVirtual Paràmetro que contiene la MV
+@host Paràmetro que contiene el host en el cual està la MV
+@config Paràmetro que contiene la configuraciòn SSH
+@return Retorna un mensaje de error, o una cadena vacìa si la consola quedò habilitada
+*/
+func configurarConsola(maquinaVirtual Maquina_virtual, host Host, config *ssh.ClientConfig) string {
+
+	puerto, err := asignarPuertoConsola(maquinaVirtual.Uuid, host.Id)
+	if err != nil {
+		log.Println("Error al asignar el puerto de la consola:", err)
+		return "Error al asignar el puerto de la consola"
+	}
+
+	if _, err := ejecutarVBoxManage(host, config, "setproperty", "vrdeauthlibrary", "VBoxAuthSimple"); err != nil {
+		log.Println("Error al configurar la autenticaciòn de las consolas del host:", err)
+		return "Error al configurar la autenticaciòn de las consolas del host"
+	}
+
+	if _, err := ejecutarVBoxManage(host, config, "modifyvm", maquinaVirtual.Nombre, "--vrde", "on", "--vrdeport", strconv.Itoa(puerto), "--vrdeauthtype", "external"); err != nil {
+		log.Println("Error al habilitar la consola de la MV:", err)
+		return "Error al habilitar la consola de la MV: " + describirErrorSSH(err)
+	}
+
+	return configurarPuertoSerie(maquinaVirtual, host, config)
+}
+
+/*
+Funciòn que obtiene la ruta del puerto serie de una MV en su host: un socket de dominio Unix en la carpeta personal del
+usuario SSH en Linux y Mac, ò una tuberìa con nombre local en Windows. Ninguno de los dos es accesible desde la red
+@maquinaVirtual Paràmetro que contiene la MV
+@host Paràmetro que contiene el host en el cual està la MV
+*/
+func rutaPuertoSerie(maquinaVirtual Maquina_virtual, host Host) string {
+	dialecto := dialectoDeHost(host)
+	if dialecto.Sistema == "Windows" {
+		return `\\.\pipe\uqcloud-serie-` + maquinaVirtual.Uuid
+	}
+	return dialecto.unirRuta(dialecto.directorioPersonal(host.Hostname), ".uqcloud-serie-"+maquinaVirtual.Uuid+".sock")
+}
+
+/*
+Funciòn que conecta el primer puerto serie de una MV apagada a un socket local del host. La consola web lo alcanza a travès
+de la conexiòn SSH con el host, por lo que solo se puede usar con un tiquete de consola
+@maquinaVirtual Paràmetro que contiene la MV
+@host Paràmetro que contiene el host en el cual està la MV
+@config Paràmetro que contiene la configuraciòn SSH
+@return Retorna un mensaje de error, o una cadena vacìa si el puerto serie quedò habilitado
+*/
+func configurarPuertoSerie(maquinaVirtual Maquina_virtual, host Host, config *ssh.ClientConfig) string {
+	if _, err := ejecutarVBoxManage(host, config, "modifyvm", maquinaVirtual.Nombre, "--uart1", "0x3F8", "4", "--uartmode1", "server", rutaPuertoSerie(maquinaVirtual, host)); err != nil {
+		log.Println("Error al habilitar el puerto serie de la MV:", err)
+		return "Error al habilitar el puerto serie de la MV"
+	}
+	return ""
+}
+
+/*
+Funciòn que reserva para la MV el primer puerto de consola libre de su host. Si la MV ya tiene un puerto lo conserva
+@uuidVM Paràmetro que contiene el uuid de la MV
+@hostId Paràmetro que contiene el host en el cual està la MV
+*/
+func asignarPuertoConsola(uuidVM string, hostId int) (int, error) {
+
+	var puerto int
+	if err := db.QueryRow("SELECT puerto FROM consola WHERE maquina_virtual_uuid = ?", uuidVM).Scan(&puerto); err == nil {
+		return puerto, nil
+	}
+
+	//La restricciòn UNIQUE (host_id, puerto) evita que dos MV reserven el mismo puerto al mismo tiempo; en ese caso se busca otro
+	for intento := 0; intento < 5; intento++ {
+		err := db.QueryRow(`SELECT MIN(p.puerto) FROM (SELECT ? AS puerto UNION SELECT puerto + 1 FROM consola WHERE host_id = ?) p
+			WHERE p.puerto <= ? AND p.puerto NOT IN (SELECT puerto FROM consola WHERE host_id = ?)`,
+			puertoConsolaInicial, hostId, puertoConsolaFinal, hostId).Scan(&puerto)
+		if err != nil || puerto == 0 {
+			return 0, errors.New("no hay puertos de consola libres en el host")
+		}
+		if _, err := db.Exec("INSERT INTO consola (maquina_virtual_uuid, host_id, puerto) VALUES (?, ?, ?)", uuidVM, hostId, puerto); err == nil {
+			return puerto, nil
+		}
+	}
+	return 0, errors.New("no se pudo reservar un puerto de consola en el host")
+}
+
+/*
+Funciòn que libera el puerto de consola de una MV eliminada
+@uuidVM Paràmetro que contiene el uuid de la MV
+*/
+func liberarConsola(uuidVM string) {
+	if _, err := db.Exec("DELETE FROM consola WHERE maquina_virtual_uuid = ?", uuidVM); err != nil {
+		log.Println("Error al liberar el puerto de la consola:", err)
+	}
+}
+
+/*
+Funciòn que genera las credenciales de una sesiòn de consola para una MV encendida. Las credenciales se eliminan
+de la MV cuando expiran; las sesiones RDP iniciadas antes de la expiraciòn continùan abiertas
+@nameVM Paràmetro que contiene el nombre de la MV
+@clientIP Paràmetro que contiene la direcciòn IP del usuario. Si se usa el proxy, solo se aceptan conexiones desde esa direcciòn
+@usarProxy Paràmetro que indica si se abre un puerto del proxy del servidor para la sesiòn
+@return Retorna los datos de conexiòn, o un mensaje de error
+*/
+func abrirSesionConsola(nameVM string, clientIP string, usarProxy bool) (SesionConsola, string) {
+
+	maquinaVirtual, err := getVM(nameVM)
+	if err != nil {
+		return SesionConsola{}, "Error al obtener la MV"
+	}
+
+	host, err := getHost(maquinaVirtual.Host_id)
+	if err != nil {
+		return SesionConsola{}, "Error al obtener el host"
+	}
+
+	config, err := configurarSSH(host.Hostname, *privateKeyPath)
+	if err != nil {
+		return SesionConsola{}, "Error al configurar SSH"
+	}
+
+	info, err := obtenerInfoMV(host, config, nameVM)
+	if err != nil {
+		log.Println("Error al obtener la informaciòn de la MV:", err)
+		return SesionConsola{}, "Error al obtener la informaciòn de la MV"
+	}
+	if !info.encendida() {
+		return SesionConsola{}, "La máquina virtual debe estar encendida para abrir la consola"
+	}
+
+	//Las MV creadas antes de habilitar las consolas deben apagarse una vez para configurarlas
+	var puerto int
+	if err := db.QueryRow("SELECT puerto FROM consola WHERE maquina_virtual_uuid = ?", maquinaVirtual.Uuid).Scan(&puerto); err != nil || info.Valores["vrde"] != "on" {
+		return SesionConsola{}, "La consola de la máquina virtual no está habilitada. Apáguela y vuelva a encenderla"
+	}
+
+	usuario := "s" + generarSecreto(4)
+	contrasenia := generarSecreto(12)
+	resumen := sha256.Sum256([]byte(contrasenia))
+	llave := "VBoxAuthSimple/users/" + usuario
+	if _, err := ejecutarVBoxManage(host, config, "setextradata", nameVM, llave, hex.EncodeToString(resumen[:])); err != nil {
+		log.Println("Error al registrar las credenciales de la consola:", err)
+		return SesionConsola{}, "Error al registrar las credenciales de la consola"
+	}
+
+	sesion := SesionConsola{
+		Direccion:   host.Ip,
+		Puerto:      puerto,
+		Usuario:     usuario,
+		Contrasenia: contrasenia,
+		Expiracion:  time.Now().Add(duracionSesionConsola),
+	}
+
+	//Sin valor, setextradata elimina la llave de la MV
+	time.AfterFunc(duracionSesionConsola, func() {
+		if _, err := ejecutarVBoxManage(host, config, "setextradata", nameVM, llave); err != nil {
+			log.Println("Error al eliminar las credenciales de la consola:", err)
+		}
+	})
+
+	if usarProxy {
+		puertoProxy, err := iniciarProxyConsola(net.JoinHostPort(host.Ip, strconv.Itoa(puerto)), clientIP, duracionSesionConsola)
+		if err != nil {
+			log.Println("Error al iniciar el proxy de la consola:", err)
+			return SesionConsola{}, "Error al iniciar el proxy de la consola"
+		}
+		sesion.Direccion = *proxyConsola
+		sesion.Puerto = puertoProxy
+		sesion.Proxy = true
+	}
+
+	return sesion, ""
+}
+
+/*
+Funciòn que abre en el servidor un puerto que reenvìa las conexiones RDP a la consola de la MV, para que los usuarios no se
+conecten directamente a los hosts. El puerto deja de aceptar conexiones nuevas cuando expira la sesiòn
+@destino Paràmetro que contiene la direcciòn y el puerto de la consola en el host
+@clientIP Paràmetro que contiene la ùnica direcciòn IP desde la que se aceptan conexiones. Si està vacìa se aceptan todas
+@duracion Paràmetro que contiene el tiempo durante el cual se aceptan conexiones nuevas
+@return Retorna el puerto del servidor asignado a la sesiòn
+*/
+func iniciarProxyConsola(destino string, clientIP string, duracion time.Duration) (int, error) {
+
+	var listener net.Listener
+	var err error
+	puerto := puertoProxyConsolaInicial
+	for ; puerto <= puertoProxyConsolaFinal; puerto++ {
+		if listener, err = net.Listen("tcp", ":"+strconv.Itoa(puerto)); err == nil {
+			break
+		}
+	}
+	if listener == nil {
+		return 0, fmt.Errorf("no hay puertos libres para el proxy de consolas: %v", err)
+	}
+	time.AfterFunc(duracion, func() { listener.Close() })
+
+	go func() {
+		for {
+			conexion, err := listener.Accept()
+			if err != nil {
+				return //El listener se cerrò al expirar la sesiòn
+			}
+			if ip, _, _ := net.SplitHostPort(conexion.RemoteAddr().String()); clientIP != "" && ip != clientIP {
+				log.Println("Conexiòn rechazada en el proxy de la consola desde", ip)
+				conexion.Close()
+				continue
+			}
+			go reenviarConexionConsola(conexion, destino)
+		}
+	}()
+
+	return puerto, nil
+}
+
+/*
+Funciòn que copia los datos en ambos sentidos entre el cliente RDP y la consola de la MV hasta que alguno cierra la conexiòn
+@cliente Paràmetro que contiene la conexiòn del cliente RDP
+@destino Paràmetro que contiene la direcciòn y el puerto de la consola en el host
+*/
+func reenviarConexionConsola(cliente net.Conn, destino string) {
+	defer cliente.Close()
+
+	consola, err := net.DialTimeout("tcp", destino, 10*time.Second)
+	if err != nil {
+		log.Println("Error al conectar el proxy con la consola de la MV:", err)
+		return
+	}
+	defer consola.Close()
+
+	terminado := make(chan struct{}, 2)
+	go func() {
+		io.Copy(consola, cliente)
+		terminado <- struct{}{}
+	}()
+	go func() {
+		io.Copy(cliente, consola)
+		terminado <- struct{}{}
+	}()
+	<-terminado
+}
+
+/*
+Funciòn que genera un texto aleatorio con un generador criptogràfico, para las credenciales de las sesiones
+@bytes Paràmetro que contiene la cantidad de bytes aleatorios. El texto tiene el doble de caracteres
+*/
+func generarSecreto(bytes int) string {
+	datos := make([]byte, bytes)
+	if _, err := rand.Read(datos); err != nil {
+		return generateRandomString(bytes * 2)
+	}
+	return hex.EncodeToString(datos)
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
+
+	"github.com/gorilla/websocket"
+	"golang.org/x/crypto/ssh"
+)
+
+/*
+Estructura que representa un tiquete de un solo uso para abrir la consola web de una MV.
+Los navegadores no pueden enviar credenciales al abrir un WebSocket, por lo que primero se solicita el tiquete con la contraseña
+@NombreVM Representa el nombre de la MV
+@Tipo Representa la consola a la que se conecta: serial, vrde ò ssh
+@Expiracion Representa el momento a partir del cual el tiquete ya no es vàlido
+*/
+type ticketConsola struct {
+	NombreVM   string
+	Tipo       string
+	Expiracion time.Time
+}
+
+// Tiempo durante el cual se puede usar un tiquete para abrir la consola web
+const duracionTicketConsola = time.Minute
+
+var (
+	ticketsConsola   = map[string]ticketConsola{}
+	muTicketsConsola sync.Mutex
+	tiposConsolaWeb  = map[string]bool{"serial": true, "vrde": true, "ssh": true}
+
+	//Cantidad de consolas web abiertas de cada MV, indexadas por uuid
+	consolasAbiertas = map[string]int{}
+
+	//El origen no se valida porque el tiquete ya autoriza la conexiòn y el front end se sirve desde otro puerto
+	actualizadorWebSocket = websocket.Upgrader{
+		ReadBufferSize:  32 * 1024,
+		WriteBufferSize: 32 * 1024,
+		CheckOrigin:     func(r *http.Request) bool { return true },
+	}
+)
+
+/*
+Funciòn que configura los endpoints de la consola web: uno para solicitar el tiquete y el WebSocket que conecta el navegador
+con el puerto serie, la consola VRDE o una sesiòn SSH de la MV
+*/
+func manejarConsolaWeb() {
+
+	//Endpoint para solicitar un tiquete de consola web. Para la consola VRDE tambièn entrega las credenciales de la sesiòn RDP
+	http.HandleFunc("/json/consoleTicket", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Se requiere una solicitud POST", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var datos struct {
+			Email       string
+			Contrasenia string
+			NombreVM    string
+			Tipo        string
+		}
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&datos); err != nil {
+			http.Error(w, "Error al decodificar JSON de la solicitud", http.StatusBadRequest)
+			return
+		}
+		if !tiposConsolaWeb[datos.Tipo] {
+			http.Error(w, "El campo 'tipo' debe ser 'serial', 'vrde' o 'ssh'", http.StatusBadRequest)
+			return
+		}
+
+		if mensaje, estado := autenticarSolicitudConsola(datos.Email, datos.Contrasenia, datos.NombreVM); estado != http.StatusOK {
+			http.Error(w, mensaje, estado)
+			return
+		}
+
+		response := map[string]interface{}{}
+		if datos.Tipo == "vrde" {
+			sesion, mensaje := abrirSesionConsola(datos.NombreVM, "", false)
+			if mensaje != "" {
+				http.Error(w, mensaje, http.StatusConflict)
+				return
+			}
+			response["sesion"] = sesion
+		}
+
+		ticket := ticketConsola{NombreVM: datos.NombreVM, Tipo: datos.Tipo, Expiracion: time.Now().Add(duracionTicketConsola)}
+		codigo := generarSecreto(24)
+		muTicketsConsola.Lock()
+		for clave, anterior := range ticketsConsola {
+			if time.Now().After(anterior.Expiracion) {
+				delete(ticketsConsola, clave)
+			}
+		}
+		ticketsConsola[codigo] = ticket
+		muTicketsConsola.Unlock()
+
+		response["ticket"] = codigo
+		response["expiracion"] = ticket.Expiracion
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(response)
+	})
+
+	//WebSocket de la consola: /ws/console?ticket=...
+	http.HandleFunc("/ws/console", func(w http.ResponseWriter, r *http.Request) {
+		codigo := r.URL.Query().Get("ticket")
+		muTicketsConsola.Lock()
+		ticket, existe := ticketsConsola[codigo]
+		delete(ticketsConsola, codigo)
+		muTicketsConsola.Unlock()
+		if !existe || time.Now().After(ticket.Expiracion) {
+			http.Error(w, "El tiquete de la consola no es válido", http.StatusUnauthorized)
+			return
+		}
+
+		maquinaVirtual, err := getVM(ticket.NombreVM)
+		if err != nil {
+			http.Error(w, "No se encontró la máquina virtual", http.StatusNotFound)
+			return
+		}
+
+		ws, err := actualizadorWebSocket.Upgrade(w, r, nil)
+		if err != nil {
+			log.Println("Error al abrir el WebSocket de la consola:", err)
+			return
+		}
+		defer ws.Close()
+
+		muTicketsConsola.Lock()
+		consolasAbiertas[maquinaVirtual.Uuid]++
+		muTicketsConsola.Unlock()
+		defer func() {
+			muTicketsConsola.Lock()
+			if consolasAbiertas[maquinaVirtual.Uuid]--; consolasAbiertas[maquinaVirtual.Uuid] <= 0 {
+				delete(consolasAbiertas, maquinaVirtual.Uuid)
+			}
+			muTicketsConsola.Unlock()
+		}()
+
+		var mensaje string
+		switch ticket.Tipo {
+		case "serial", "vrde":
+			mensaje = puenteConsolaHost(ws, maquinaVirtual, ticket.Tipo)
+		case "ssh":
+			mensaje = puenteConsolaSSH(ws, maquinaVirtual)
+		}
+		if mensaje != "" {
+			ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseInternalServerErr, mensaje))
+		}
+	})
+}
+
+/*
+Funciòn que obtiene la cantidad de consolas web abiertas de una MV
+@uuidVM Paràmetro que contiene el uuid de la MV
+*/
+func consolasWebAbiertas(uuidVM string) int {
+	muTicketsConsola.Lock()
+	defer muTicketsConsola.Unlock()
+	return consolasAbiertas[uuidVM]
+}
+
+/*
+Funciòn que conecta el WebSocket con el puerto serie o la consola VRDE de la MV en su host
+@ws Paràmetro que contiene el WebSocket del navegador
+@maquinaVirtual Paràmetro que contiene la MV
+@tipo Paràmetro que contiene la consola: serial ò vrde
+@return Retorna un mensaje de error si no se pudo conectar
+*/
+func puenteConsolaHost(ws *websocket.Conn, maquinaVirtual Maquina_virtual, tipo string) string {
+
+	var puerto int
+	if err := db.QueryRow("SELECT puerto FROM consola WHERE maquina_virtual_uuid = ?", maquinaVirtual.Uuid).Scan(&puerto); err != nil {
+		return "La consola de la máquina virtual no está habilitada"
+	}
+
+	host, err := getHost(maquinaVirtual.Host_id)
+	if err != nil {
+		return "Error al obtener el host"
+	}
+	if tipo == "serial" {
+		return puentePuertoSerie(ws, maquinaVirtual, host)
+	}
+
+	conexion, err := net.DialTimeout("tcp", net.JoinHostPort(host.Ip, strconv.Itoa(puerto)), 10*time.Second)
+	if err != nil {
+		log.Println("Error al conectar con la consola de la MV:", err)
+		return "No se pudo conectar con la consola de la máquina virtual"
+	}
+	defer conexion.Close()
+
+	puenteWebSocket(ws, conexion, conexion, nil)
+	return ""
+}
+
+/*
+Funciòn que conecta el WebSocket con el puerto serie de la MV a travès de la conexiòn SSH con su host, ya que el socket
+del puerto serie solo es accesible localmente. En Linux y Mac se reenvìa el socket de dominio Unix; en Windows, donde
+OpenSSH no reenvìa tuberìas con nombre, una sesiòn de PowerShell copia los datos entre la tuberìa y la sesiòn SSH
+@ws Paràmetro que contiene el WebSocket del navegador
+@maquinaVirtual Paràmetro que contiene la MV
+@host Paràmetro que contiene el host en el cual està la MV
+@return Retorna un mensaje de error si no se pudo conectar
+*/
+func puentePuertoSerie(ws *websocket.Conn, maquinaVirtual Maquina_virtual, host Host) string {
+
+	config, err := configurarSSH(host.Hostname, *privateKeyPath)
+	if err != nil {
+		log.Println("Error al configurar SSH:", err)
+		return "Error al configurar SSH"
+	}
+	cliente, err := ssh.Dial("tcp", net.JoinHostPort(host.Ip, "22"), config)
+	if err != nil {
+		log.Println("Error al establecer la conexiòn SSH con el host:", err)
+		return "No se pudo conectar con el host de la máquina virtual"
+	}
+	defer cliente.Close()
+
+	ruta := rutaPuertoSerie(maquinaVirtual, host)
+	if dialectoDeHost(host).Sistema != "Windows" {
+		conexion, err := cliente.Dial("unix", ruta)
+		if err != nil {
+			log.Println("Error al conectar con el puerto serie de la MV:", err)
+			return "No se pudo conectar con el puerto serie de la máquina virtual"
+		}
+		defer conexion.Close()
+		puenteWebSocket(ws, conexion, conexion, nil)
+		return ""
+	}
+
+	sesion, err := cliente.NewSession()
+	if err != nil {
+		log.Println("Error al crear la sesiòn SSH:", err)
+		return "Error al crear la sesión SSH"
+	}
+	defer sesion.Close()
+	entrada, err := sesion.StdinPipe()
+	if err != nil {
+		return "Error al abrir la entrada del puerto serie"
+	}
+	salida, err := sesion.StdoutPipe()
+	if err != nil {
+		return "Error al abrir la salida del puerto serie"
+	}
+	if err := sesion.Start(comandoPuenteTuberia(ruta)); err != nil {
+		log.Println("Error al conectar con el puerto serie de la MV:", err)
+		return "No se pudo conectar con el puerto serie de la máquina virtual"
+	}
+	puenteWebSocket(ws, salida, entrada, nil)
+	return ""
+}
+
+/*
+Funciòn que construye el comando de PowerShell que conecta su entrada y su salida estàndar con una tuberìa con nombre de Windows.
+El script se envìa codificado para que el intèrprete del host (cmd ò PowerShell) no tenga que citarlo
+@ruta Paràmetro que contiene la ruta de la tuberìa. Por ejemplo: \\.\pipe\nombre
+*/
+func comandoPuenteTuberia(ruta string) string {
+	nombre := ruta[strings.LastIndex(ruta, "\\")+1:]
+	script := "$p = New-Object System.IO.Pipes.NamedPipeClientStream('.', '" + strings.ReplaceAll(nombre, "'", "''") + "', [System.IO.Pipes.PipeDirection]::InOut); " +
+		"$p.Connect(10000); " +
+		"$s = $p.CopyToAsync([Console]::OpenStandardOutput()); " +
+		"$e = [Console]::OpenStandardInput().CopyToAsync($p); " +
+		"[void][System.Threading.Tasks.Task]::WaitAny(@($s, $e))"
+	codificado := make([]byte, 0, 2*len(script))
+	for _, unidad := range utf16.Encode([]rune(script)) {
+		codificado = append(codificado, byte(unidad), byte(unidad>>8))
+	}
+	return "powershell -NoProfile -NonInteractive -EncodedCommand " + base64.StdEncoding.EncodeToString(codificado)
+}
+
+/*
+Funciòn que abre una terminal SSH en la MV con la cuenta y la llave que usa la plataforma y la conecta con el WebSocket.
+Los mensajes de texto con el formato {"Filas": n, "Columnas": m} cambian el tamaño de la terminal
+@ws Paràmetro que contiene el WebSocket del navegador
+@maquinaVirtual Paràmetro que contiene la MV
+@return Retorna un mensaje de error si no se pudo conectar
+*/
+func puenteConsolaSSH(ws *websocket.Conn, maquinaVirtual Maquina_virtual) string {
+
+	if maquinaVirtual.Ip == "" {
+		return "La máquina virtual no tiene dirección IP"
+	}
+	direccion, puerto := direccionSSHMV(maquinaVirtual)
+
+	config, err := configurarSSH(maquinaVirtual.Hostname, *privateKeyPath)
+	if err != nil {
+		log.Println("Error al configurar SSH:", err)
+		return "Error al configurar SSH"
+	}
+
+	cliente, err := ssh.Dial("tcp", net.JoinHostPort(direccion, puerto), config)
+	if err != nil {
+		log.Println("Error al establecer la conexiòn SSH con la MV:", err)
+		return "No se pudo conectar por SSH con la máquina virtual"
+	}
+	defer cliente.Close()
+
+	sesion, err := cliente.NewSession()
+	if err != nil {
+		log.Println("Error al crear la sesiòn SSH:", err)
+		return "Error al crear la sesión SSH"
+	}
+	defer sesion.Close()
+
+	modos := ssh.TerminalModes{ssh.ECHO: 1, ssh.TTY_OP_ISPEED: 14400, ssh.TTY_OP_OSPEED: 14400}
+	if err := sesion.RequestPty("xterm", 24, 80, modos); err != nil {
+		log.Println("Error al solicitar la terminal SSH:", err)
+		return "Error al solicitar la terminal"
+	}
+	entrada, err := sesion.StdinPipe()
+	if err != nil {
+		return "Error al abrir la entrada de la terminal"
+	}
+	salida, err := sesion.StdoutPipe()
+	if err != nil {
+		return "Error al abrir la salida de la terminal"
+	}
+	if err := sesion.Shell(); err != nil {
+		log.Println("Error al iniciar la terminal SSH:", err)
+		return "Error al iniciar la terminal"
+	}
+
+	puenteWebSocket(ws, salida, entrada, func(filas int, columnas int) {
+		sesion.WindowChange(filas, columnas)
+	})
+	return ""
+}
+
+/*
+Funciòn que copia los datos entre el WebSocket y la consola hasta que alguno de los dos cierra la conexiòn
+@ws Paràmetro que contiene el WebSocket del navegador
+@lector Paràmetro que contiene la salida de la consola, que se envìa al navegador en mensajes binarios
+@escritor Paràmetro que contiene la entrada de la consola, que recibe los mensajes del navegador
+@redimensionar Paràmetro que contiene la funciòn que cambia el tamaño de la terminal. Si es nil todos los mensajes son datos
+*/
+func puenteWebSocket(ws *websocket.Conn, lector io.Reader, escritor io.Writer, redimensionar func(filas int, columnas int)) {
+
+	terminado := make(chan struct{}, 2)
+
+	go func() {
+		defer func() { terminado <- struct{}{} }()
+		for {
+			tipo, datos, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			if tipo == websocket.TextMessage && redimensionar != nil && strings.HasPrefix(string(datos), "{") {
+				var tamanio struct{ Filas, Columnas int }
+				if json.Unmarshal(datos, &tamanio) == nil && tamanio.Filas > 0 && tamanio.Columnas > 0 {
+					redimensionar(tamanio.Filas, tamanio.Columnas)
+					continue
+				}
+			}
+			if _, err := escritor.Write(datos); err != nil {
+				return
+			}
+		}
+	}()
+
+	go func() {
+		defer func() { terminado <- struct{}{} }()
+		buffer := make([]byte, 32*1024)
+		for {
+			n, err := lector.Read(buffer)
+			if n > 0 {
+				if ws.WriteMessage(websocket.BinaryMessage, buffer[:n]) != nil {
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	<-terminado
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+Estructura que representa una expresiòn cron de 5 campos: minuto, hora, dìa del mes, mes y dìa de la semana.
+Cada campo acepta *, valores, rangos (1-5), listas (1,3,5) y pasos (0-59/15, 8-18/2). El domingo es 0 ò 7 y los dìas
+de la semana tambièn se pueden escribir en inglès (mon, tue...). Como en cron, si el dìa del mes y el dìa de la semana
+estàn restringidos basta con que coincida uno de los dos
+*/
+type expresionCron struct {
+	minutos            []bool
+	horas              []bool
+	dias               []bool
+	meses              []bool
+	diasSemana         []bool
+	cualquierDia       bool
+	cualquierDiaSemana bool
+}
+
+var (
+	//Expresiones predefinidas equivalentes a una expresiòn de 5 campos
+	macrosCron = map[string]string{
+		"@hourly":  "0 * * * *",
+		"@daily":   "0 0 * * *",
+		"@weekly":  "0 0 * * 0",
+		"@monthly": "0 0 1 * *",
+	}
+
+	nombresDiasSemana = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+)
+
+/*
+Funciòn que interpreta una expresiòn cron. Por ejemplo: "0 8 * * mon" (lunes a las 8:00) ò "0 22 * * *" (todos los dìas a las 22:00)
+@expresion Paràmetro que contiene la expresiòn
+@return Retorna la expresiòn interpretada, ò un error si no es vàlida
+*/
+func parsearCron(expresion string) (expresionCron, error) {
+
+	var cron expresionCron
+	expresion = strings.ToLower(strings.TrimSpace(expresion))
+	if macro, ok := macrosCron[expresion]; ok {
+		expresion = macro
+	}
+	campos := strings.Fields(expresion)
+	if len(campos) != 5 {
+		return cron, errors.New("la expresión cron debe tener 5 campos: minuto hora día mes día_semana")
+	}
+
+	var err error
+	if cron.minutos, _, err = parsearCampoCron(campos[0], 0, 59, nil); err != nil {
+		return cron, errors.New("minuto inválido: " + err.Error())
+	}
+	if cron.horas, _, err = parsearCampoCron(campos[1], 0, 23, nil); err != nil {
+		return cron, errors.New("hora inválida: " + err.Error())
+	}
+	if cron.dias, cron.cualquierDia, err = parsearCampoCron(campos[2], 1, 31, nil); err != nil {
+		return cron, errors.New("día del mes inválido: " + err.Error())
+	}
+	if cron.meses, _, err = parsearCampoCron(campos[3], 1, 12, nil); err != nil {
+		return cron, errors.New("mes inválido: " + err.Error())
+	}
+	if cron.diasSemana, cron.cualquierDiaSemana, err = parsearCampoCron(campos[4], 0, 7, nombresDiasSemana); err != nil {
+		return cron, errors.New("día de la semana inválido: " + err.Error())
+	}
+	//El 7 tambièn representa el domingo
+	if cron.diasSemana[7] {
+		cron.diasSemana[0] = true
+	}
+	return cron, nil
+}
+
+/*
+Funciòn que interpreta un campo de una expresiòn cron
+@minimo Paràmetro que contiene el menor valor del campo
+@maximo Paràmetro que contiene el mayor valor del campo
+@nombres Paràmetro que contiene los nombres que se pueden usar en lugar de los nùmeros. Puede ser nil
+@return Retorna los valores permitidos indexados desde 0, si el campo es * y un error si no es vàlido
+*/
+func parsearCampoCron(campo string, minimo int, maximo int, nombres map[string]int) ([]bool, bool, error) {
+
+	valores := make([]bool, maximo+1)
+	valor := func(texto string) (int, error) {
+		if numero, ok := nombres[texto]; ok {
+			return numero, nil
+		}
+		numero, err := strconv.Atoi(texto)
+		if err != nil || numero < minimo || numero > maximo {
+			return 0, errors.New("'" + texto + "' está fuera del rango " + strconv.Itoa(minimo) + "-" + strconv.Itoa(maximo))
+		}
+		return numero, nil
+	}
+
+	for _, parte := range strings.Split(campo, ",") {
+		rango, paso := parte, 1
+		if i := strings.Index(parte, "/"); i >= 0 {
+			numero, err := strconv.Atoi(parte[i+1:])
+			if err != nil || numero <= 0 {
+				return nil, false, errors.New("paso inválido en '" + parte + "'")
+			}
+			rango, paso = parte[:i], numero
+		}
+
+		inicio, fin := minimo, maximo
+		switch {
+		case rango == "*":
+		case strings.Contains(rango, "-"):
+			extremos := strings.SplitN(rango, "-", 2)
+			var err error
+			if inicio, err = valor(extremos[0]); err != nil {
+				return nil, false, err
+			}
+			if fin, err = valor(extremos[1]); err != nil {
+				return nil, false, err
+			}
+			if inicio > fin {
+				return nil, false, errors.New("rango inválido '" + rango + "'")
+			}
+		default:
+			numero, err := valor(rango)
+			if err != nil {
+				return nil, false, err
+			}
+			inicio = numero
+			//Un valor con paso (5/15) se repite hasta el final del rango
+			fin = numero
+			if paso > 1 {
+				fin = maximo
+			}
+		}
+		for i := inicio; i <= fin; i += paso {
+			valores[i] = true
+		}
+	}
+	return valores, campo == "*", nil
+}
+
+/*
+Funciòn que indica si un momento coincide con la expresiòn cron. Solo se tienen en cuenta el minuto, la hora y la fecha
+@momento Paràmetro que contiene el momento en la zona horaria en la que se interpreta la expresiòn
+*/
+func (cron expresionCron) coincide(momento time.Time) bool {
+	return cron.minutos[momento.Minute()] && cron.horas[momento.Hour()] && cron.meses[int(momento.Month())] && cron.diaCoincide(momento)
+}
+
+/*
+Funciòn que indica si la fecha de un momento coincide con el dìa del mes y el dìa de la semana de la expresiòn cron
+*/
+func (cron expresionCron) diaCoincide(momento time.Time) bool {
+	dia := cron.dias[momento.Day()]
+	diaSemana := cron.diasSemana[int(momento.Weekday())]
+	switch {
+	case cron.cualquierDia && cron.cualquierDiaSemana:
+		return true
+	case cron.cualquierDia:
+		return diaSemana
+	case cron.cualquierDiaSemana:
+		return dia
+	}
+	return dia || diaSemana
+}
+
+/*
+Funciòn que indica si la expresiòn cron tiene alguna ejecuciòn despuès de un momento y hasta otro, inclusive
+@desde Paràmetro que contiene el momento de la ùltima revisiòn, que no se incluye
+@hasta Paràmetro que contiene el momento de la revisiòn actual
+*/
+func (cron expresionCron) pendiente(desde time.Time, hasta time.Time) bool {
+	siguiente := cron.siguiente(desde)
+	return !siguiente.IsZero() && !siguiente.After(hasta)
+}
+
+/*
+Funciòn que calcula la siguiente ejecuciòn de una expresiòn cron despuès de un momento, buscando hasta un año adelante
+@desde Paràmetro que contiene el momento desde el cual se busca
+@return Retorna el momento de la siguiente ejecuciòn, ò la fecha cero si no hay ninguna en el pròximo año
+*/
+func (cron expresionCron) siguiente(desde time.Time) time.Time {
+	momento := desde.Truncate(time.Minute).Add(time.Minute)
+	limite := momento.AddDate(1, 0, 0)
+	for momento.Before(limite) {
+		anio, mes, dia := momento.Date()
+		switch {
+		case !cron.meses[int(mes)]:
+			momento = time.Date(anio, mes+1, 1, 0, 0, 0, 0, momento.Location())
+		case !cron.diaCoincide(momento):
+			momento = time.Date(anio, mes, dia+1, 0, 0, 0, 0, momento.Location())
+		case !cron.horas[momento.Hour()]:
+			momento = time.Date(anio, mes, dia, momento.Hour()+1, 0, 0, 0, momento.Location())
+		case cron.minutos[momento.Minute()]:
+			return momento
+		default:
+			momento = momento.Add(time.Minute)
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// valoresCampo convierte los valores permitidos de un campo en la lista de nùmeros activos
+func valoresCampo(valores []bool) []int {
+	var activos []int
+	for i, activo := range valores {
+		if activo {
+			activos = append(activos, i)
+		}
+	}
+	return activos
+}
+
+func TestParsearCampoCron(t *testing.T) {
+	casos := []struct {
+		campo    string
+		minimo   int
+		maximo   int
+		nombres  map[string]int
+		esperado []int
+		todos    bool
+	}{
+		{"*", 0, 6, nil, []int{0, 1, 2, 3, 4, 5, 6}, true},
+		{"5", 0, 59, nil, []int{5}, false},
+		{"1,3,5", 0, 6, nil, []int{1, 3, 5}, false},
+		{"8-11", 0, 23, nil, []int{8, 9, 10, 11}, false},
+		{"*/15", 0, 59, nil, []int{0, 15, 30, 45}, false},
+		{"8-18/4", 0, 23, nil, []int{8, 12, 16}, false},
+		{"50/5", 0, 59, nil, []int{50, 55}, false},
+		{"1-2,10-11/1", 1, 12, nil, []int{1, 2, 10, 11}, false},
+		{"mon-fri", 0, 7, nombresDiasSemana, []int{1, 2, 3, 4, 5}, false},
+		{"sun,sat", 0, 7, nombresDiasSemana, []int{0, 6}, false},
+		{"5-7", 0, 7, nombresDiasSemana, []int{5, 6, 7}, false},
+	}
+	for _, caso := range casos {
+		t.Run(caso.campo, func(t *testing.T) {
+			valores, todos, err := parsearCampoCron(caso.campo, caso.minimo, caso.maximo, caso.nombres)
+			if err != nil {
+				t.Fatalf("parsearCampoCron(%q) retornò el error %v", caso.campo, err)
+			}
+			if activos := valoresCampo(valores); !igualesEnteros(activos, caso.esperado) {
+				t.Errorf("parsearCampoCron(%q) = %v, se esperaba %v", caso.campo, activos, caso.esperado)
+			}
+			if todos != caso.todos {
+				t.Errorf("parsearCampoCron(%q) indicò * = %v, se esperaba %v", caso.campo, todos, caso.todos)
+			}
+		})
+	}
+}
+
+func TestParsearCampoCronInvalido(t *testing.T) {
+	casos := []struct {
+		campo  string
+		minimo int
+		maximo int
+	}{
+		{"60", 0, 59},
+		{"0", 1, 31},
+		{"13", 1, 12},
+		{"10-5", 0, 23},
+		{"*/0", 0, 59},
+		{"*/-1", 0, 59},
+		{"1-", 0, 59},
+		{"lunes", 0, 7},
+		{"", 0, 59},
+		{"1,,2", 0, 59},
+	}
+	for _, caso := range casos {
+		if _, _, err := parsearCampoCron(caso.campo, caso.minimo, caso.maximo, nombresDiasSemana); err == nil {
+			t.Errorf("parsearCampoCron(%q) no retornò error", caso.campo)
+		}
+	}
+}
+
+func TestParsearCron(t *testing.T) {
+	validas := []string{"0 8 * * mon", "@daily", "@HOURLY", "  30 22 * * *  ", "0 0 1,15 * 7", "*/10 8-18 * 1-6 MON-FRI"}
+	for _, expresion := range validas {
+		if _, err := parsearCron(expresion); err != nil {
+			t.Errorf("parsearCron(%q) retornò el error %v", expresion, err)
+		}
+	}
+
+	invalidas := []string{"", "0 8 * *", "0 8 * * * *", "@yearly", "0 24 * * *", "0 8 32 * *", "0 8 * 0 *", "0 8 * * 8", "x 8 * * *"}
+	for _, expresion := range invalidas {
+		if _, err := parsearCron(expresion); err == nil {
+			t.Errorf("parsearCron(%q) no retornò error", expresion)
+		}
+	}
+
+	//El 7 y el 0 representan el domingo
+	for _, expresion := range []string{"0 0 * * 7", "0 0 * * 0", "0 0 * * sun"} {
+		cron, _ := parsearCron(expresion)
+		domingo := time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)
+		if !cron.coincide(domingo) {
+			t.Errorf("%q no coincide con el domingo %v", expresion, domingo)
+		}
+		if cron.coincide(domingo.AddDate(0, 0, 1)) {
+			t.Errorf("%q coincide con el lunes", expresion)
+		}
+	}
+}
+
+func TestCronDiaMesODiaSemana(t *testing.T) {
+	casos := []struct {
+		expresion string
+		fecha     time.Time
+		coincide  bool
+	}{
+		//Con los dos campos restringidos basta con que coincida uno
+		{"0 0 13 * fri", time.Date(2024, 9, 13, 0, 0, 0, 0, time.UTC), true}, //viernes 13
+		{"0 0 13 * fri", time.Date(2024, 8, 13, 0, 0, 0, 0, time.UTC), true}, //martes 13
+		{"0 0 13 * fri", time.Date(2024, 8, 16, 0, 0, 0, 0, time.UTC), true}, //viernes 16
+		{"0 0 13 * fri", time.Date(2024, 8, 14, 0, 0, 0, 0, time.UTC), false},
+		//Con uno de los dos en * solo cuenta el otro
+		{"0 0 13 * *", time.Date(2024, 8, 16, 0, 0, 0, 0, time.UTC), false},
+		{"0 0 * * fri", time.Date(2024, 8, 13, 0, 0, 0, 0, time.UTC), false},
+		{"0 0 * * fri", time.Date(2024, 8, 16, 0, 0, 0, 0, time.UTC), true},
+		{"0 0 * * *", time.Date(2024, 8, 14, 0, 0, 0, 0, time.UTC), true},
+		//El minuto, la hora y el mes tambièn deben coincidir
+		{"0 0 13 * fri", time.Date(2024, 9, 13, 0, 1, 0, 0, time.UTC), false},
+		{"0 0 * 2 *", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), false},
+	}
+	for _, caso := range casos {
+		cron, err := parsearCron(caso.expresion)
+		if err != nil {
+			t.Fatalf("parsearCron(%q) retornò el error %v", caso.expresion, err)
+		}
+		if coincide := cron.coincide(caso.fecha); coincide != caso.coincide {
+			t.Errorf("%q con %v = %v, se esperaba %v", caso.expresion, caso.fecha, coincide, caso.coincide)
+		}
+	}
+}
+
+func TestCronSiguiente(t *testing.T) {
+	casos := []struct {
+		nombre    string
+		expresion string
+		desde     time.Time
+		esperado  time.Time
+	}{
+		{"mismo dìa", "30 8 * * *", time.Date(2024, 3, 5, 7, 15, 42, 0, time.UTC), time.Date(2024, 3, 5, 8, 30, 0, 0, time.UTC)},
+		{"estrictamente despuès", "30 8 * * *", time.Date(2024, 3, 5, 8, 30, 0, 0, time.UTC), time.Date(2024, 3, 6, 8, 30, 0, 0, time.UTC)},
+		{"segundos truncados", "*/15 * * * *", time.Date(2024, 3, 5, 8, 14, 59, 999, time.UTC), time.Date(2024, 3, 5, 8, 15, 0, 0, time.UTC)},
+		{"fin de mes", "0 6 * * *", time.Date(2024, 1, 31, 22, 0, 0, 0, time.UTC), time.Date(2024, 2, 1, 6, 0, 0, 0, time.UTC)},
+		{"fin de año", "0 0 1 * *", time.Date(2024, 12, 15, 0, 0, 0, 0, time.UTC), time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"dìa 31 salta los meses cortos", "0 12 31 * *", time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 5, 31, 12, 0, 0, 0, time.UTC)},
+		{"29 de febrero", "0 0 29 2 *", time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"lunes siguiente", "0 8 * * mon", time.Date(2024, 3, 29, 9, 0, 0, 0, time.UTC), time.Date(2024, 4, 1, 8, 0, 0, 0, time.UTC)},
+		{"domingo como 7", "0 20 * * 7", time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 10, 20, 0, 0, 0, time.UTC)},
+		{"dìa de la semana antes que el del mes", "0 0 1 * fri", time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 8, 0, 0, 0, 0, time.UTC)},
+		{"dìa del mes antes que el de la semana", "0 0 1 * fri", time.Date(2024, 3, 30, 0, 0, 0, 0, time.UTC), time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{"sin ejecuciòn en un año", "0 0 30 2 *", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), time.Time{}},
+	}
+	for _, caso := range casos {
+		t.Run(caso.nombre, func(t *testing.T) {
+			cron, err := parsearCron(caso.expresion)
+			if err != nil {
+				t.Fatalf("parsearCron(%q) retornò el error %v", caso.expresion, err)
+			}
+			if siguiente := cron.siguiente(caso.desde); !siguiente.Equal(caso.esperado) {
+				t.Errorf("siguiente(%v) de %q = %v, se esperaba %v", caso.desde, caso.expresion, siguiente, caso.esperado)
+			}
+		})
+	}
+
+	//La siguiente ejecuciòn respeta la zona horaria del momento de partida
+	bogota := time.FixedZone("COT", -5*60*60)
+	cron, _ := parsearCron("0 22 * * *")
+	siguiente := cron.siguiente(time.Date(2024, 3, 5, 23, 0, 0, 0, bogota))
+	if esperado := time.Date(2024, 3, 6, 22, 0, 0, 0, bogota); !siguiente.Equal(esperado) {
+		t.Errorf("siguiente en COT = %v, se esperaba %v", siguiente, esperado)
+	}
+}
+
+func TestCronPendiente(t *testing.T) {
+	cron, _ := parsearCron("0 22 * * *")
+	casos := []struct {
+		nombre   string
+		desde    time.Time
+		hasta    time.Time
+		esperado bool
+	}{
+		{"minuto exacto", time.Date(2024, 3, 5, 21, 59, 0, 0, time.UTC), time.Date(2024, 3, 5, 22, 0, 0, 0, time.UTC), true},
+		{"revisiòn omitida", time.Date(2024, 3, 5, 21, 59, 0, 0, time.UTC), time.Date(2024, 3, 5, 22, 1, 0, 0, time.UTC), true},
+		{"ya ejecutada", time.Date(2024, 3, 5, 22, 0, 0, 0, time.UTC), time.Date(2024, 3, 5, 22, 5, 0, 0, time.UTC), false},
+		{"todavìa no", time.Date(2024, 3, 5, 20, 0, 0, 0, time.UTC), time.Date(2024, 3, 5, 21, 59, 0, 0, time.UTC), false},
+	}
+	for _, caso := range casos {
+		if pendiente := cron.pendiente(caso.desde, caso.hasta); pendiente != caso.esperado {
+			t.Errorf("pendiente en %q = %v, se esperaba %v", caso.nombre, pendiente, caso.esperado)
+		}
+	}
+}
+
+func igualesEnteros(a []int, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,500 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+/*
+Estructura de datos tipo JSON que representa la cuota de recursos de un usuario. Un valor de -1 indica que no hay lìmite
+@Maquinas Representa la cantidad màxima de MV
+@Ram Representa la memoria RAM total en mb que pueden sumar las MV
+@Cpu Representa la cantidad total de CPU que pueden sumar las MV
+@Disco Representa la capacidad total en mb que pueden sumar los discos de datos
+@Snapshots Representa la cantidad màxima de instantàneas de cada MV
+@Encendidas Representa la cantidad màxima de MV encendidas al mismo tiempo
+*/
+type Cuota struct {
+	Maquinas   int
+	Ram        int
+	Cpu        int
+	Disco      int
+	Snapshots  int
+	Encendidas int
+}
+
+/*
+Estructura de datos tipo JSON que representa la cuota personalizada de un usuario. Los campos nulos usan la cuota del rol
+*/
+type CuotaPersonalizada struct {
+	Maquinas   *int
+	Ram        *int
+	Cpu        *int
+	Disco      *int
+	Snapshots  *int
+	Encendidas *int
+}
+
+/*
+Estructura de datos tipo JSON que representa el uso de los recursos de un usuario frente a su cuota.
+En Uso, Snapshots contiene la mayor cantidad de instantàneas de una de sus MV
+*/
+type UsoCuota struct {
+	Email         string
+	Rol           string
+	Cuota         Cuota
+	Uso           Cuota
+	Personalizada bool
+}
+
+// Valor de los campos de una cuota que indica que no hay lìmite
+const sinLimite = -1
+
+// Cuota inicial de cada rol. Se registra en la tabla cuota_rol para los roles que aùn no tienen cuota; desde ahì la
+// configuran los administradores y se puede reemplazar para un usuario con una cuota personalizada
+var cuotaInicialPorRol = map[string]Cuota{
+	"Administrador": {Maquinas: sinLimite, Ram: sinLimite, Cpu: sinLimite, Disco: 204800, Snapshots: 10, Encendidas: sinLimite},
+	"Estudiante":    {Maquinas: 5, Ram: 8192, Cpu: 8, Disco: 20480, Snapshots: 3, Encendidas: 2},
+	"Invitado":      {Maquinas: 1, Ram: 1024, Cpu: 2, Disco: 0, Snapshots: 0, Encendidas: 1},
+}
+
+// Recursos de las MV que se estàn creando, indexados por el nombre de la MV. Se suman al uso de la cuota del propietario
+// desde que se verifica la cuota hasta que la MV se registra en la base de datos.
+// muCuotaMV serializa la verificaciòn y reserva de la cuota con el registro de las MV
+var (
+	muCuotaMV      sync.Mutex
+	muCreacionesMV sync.Mutex
+	creacionesMV   = map[string]Maquina_virtual{}
+)
+
+/*
+Funciòn que configura los endpoints para consultar el uso de las cuotas, configurar la cuota de los roles y personalizar la cuota de un usuario
+*/
+func manejarCuotas() {
+
+	//Endpoint para que un administrador consulte la cuota configurada de cada rol
+	http.HandleFunc("/json/consultRoleQuotas", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Se requiere una solicitud Get", http.StatusMethodNotAllowed)
+			return
+		}
+		if !esAdministrador(r.URL.Query().Get("email")) {
+			http.Error(w, "Solo los administradores pueden consultar las cuotas de los roles", http.StatusForbidden)
+			return
+		}
+
+		cuotas, err := consultCuotasRol()
+		if err != nil {
+			log.Println("Error al consultar las cuotas de los roles:", err)
+			http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(cuotas)
+	})
+
+	//Endpoint para que un administrador configure la cuota de un rol. Las cuotas personalizadas de los usuarios se mantienen
+	http.HandleFunc("/json/setRoleQuota", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Se requiere una solicitud POST", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var datos struct {
+			Email string
+			Rol   string
+			Cuota Cuota
+		}
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&datos); err != nil {
+			http.Error(w, "Error al decodificar JSON de la solicitud", http.StatusBadRequest)
+			return
+		}
+		if !esAdministrador(datos.Email) {
+			http.Error(w, "Solo los administradores pueden configurar las cuotas de los roles", http.StatusForbidden)
+			return
+		}
+		datos.Rol = strings.TrimSpace(datos.Rol)
+		if datos.Rol == "" || len(datos.Rol) > 50 {
+			http.Error(w, "El rol debe tener entre 1 y 50 caracteres", http.StatusBadRequest)
+			return
+		}
+		cuota := datos.Cuota
+		if err := validarCuotaPersonalizada(CuotaPersonalizada{&cuota.Maquinas, &cuota.Ram, &cuota.Cpu, &cuota.Disco, &cuota.Snapshots, &cuota.Encendidas}); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := guardarCuotaRol(datos.Rol, cuota); err != nil {
+			log.Println("Error al guardar la cuota del rol:", err)
+			http.Error(w, "Error al guardar la cuota", http.StatusInternalServerError)
+			return
+		}
+
+		response := map[string]string{"mensaje": "Cuota del rol guardada correctamente"}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(response)
+	})
+
+	//Endpoint para consultar el uso de los recursos frente a la cuota. Un administrador puede consultar otro usuario
+	//con el paràmetro usuario, ò todos los usuarios si no lo indica
+	http.HandleFunc("/json/consultQuotaUsage", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Se requiere una solicitud Get", http.StatusMethodNotAllowed)
+			return
+		}
+
+		email := r.URL.Query().Get("email")
+		usuario := r.URL.Query().Get("usuario")
+		solicitante, err := getUser(email)
+		if err != nil {
+			http.Error(w, "No se encontró el usuario solicitante", http.StatusNotFound)
+			return
+		}
+
+		var emails []string
+		switch {
+		case solicitante.Rol != "Administrador":
+			if usuario != "" && usuario != email {
+				http.Error(w, "Solo los administradores pueden consultar la cuota de otros usuarios", http.StatusForbidden)
+				return
+			}
+			emails = []string{email}
+		case usuario != "":
+			emails = []string{usuario}
+		default:
+			rows, err := db.Query("SELECT email FROM persona ORDER BY email")
+			if err != nil {
+				log.Println("Error al consultar los usuarios:", err)
+				http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+				return
+			}
+			for rows.Next() {
+				var emailUsuario string
+				if err := rows.Scan(&emailUsuario); err == nil {
+					emails = append(emails, emailUsuario)
+				}
+			}
+			rows.Close()
+		}
+
+		usos := []UsoCuota{}
+		for _, emailUsuario := range emails {
+			uso, err := getUsoCuota(emailUsuario)
+			if err == sql.ErrNoRows {
+				http.Error(w, "No se encontró el usuario", http.StatusNotFound)
+				return
+			} else if err != nil {
+				log.Println("Error al consultar el uso de la cuota:", err)
+				http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+				return
+			}
+			usos = append(usos, uso)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if usuario != "" || solicitante.Rol != "Administrador" {
+			json.NewEncoder(w).Encode(usos[0])
+			return
+		}
+		json.NewEncoder(w).Encode(usos)
+	})
+
+	//Endpoint para que un administrador personalice la cuota de un usuario. Si todos los campos son nulos se vuelve a la cuota del rol
+	http.HandleFunc("/json/setUserQuota", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Se requiere una solicitud POST", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var datos struct {
+			Email   string
+			Usuario string
+			Cuota   CuotaPersonalizada
+		}
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&datos); err != nil {
+			http.Error(w, "Error al decodificar JSON de la solicitud", http.StatusBadRequest)
+			return
+		}
+		if !esAdministrador(datos.Email) {
+			http.Error(w, "Solo los administradores pueden personalizar las cuotas", http.StatusForbidden)
+			return
+		}
+		if _, err := getUser(datos.Usuario); err != nil {
+			http.Error(w, "No se encontró el usuario", http.StatusNotFound)
+			return
+		}
+		if err := validarCuotaPersonalizada(datos.Cuota); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := guardarCuotaPersonalizada(datos.Usuario, datos.Cuota); err != nil {
+			log.Println("Error al guardar la cuota personalizada:", err)
+			http.Error(w, "Error al guardar la cuota", http.StatusInternalServerError)
+			return
+		}
+
+		uso, _ := getUsoCuota(datos.Usuario)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(uso)
+	})
+}
+
+/*
+Funciòn que verifica que los campos de una cuota personalizada sean -1 (sin lìmite) ò no negativos
+*/
+func validarCuotaPersonalizada(cuota CuotaPersonalizada) error {
+	campos := map[string]*int{
+		"Maquinas": cuota.Maquinas, "Ram": cuota.Ram, "Cpu": cuota.Cpu,
+		"Disco": cuota.Disco, "Snapshots": cuota.Snapshots, "Encendidas": cuota.Encendidas,
+	}
+	for nombre, valor := range campos {
+		if valor != nil && *valor < sinLimite {
+			return errors.New("el campo " + nombre + " debe ser -1 (sin límite) o mayor o igual a 0")
+		}
+	}
+	return nil
+}
+
+/*
+Funciòn que registra la cuota inicial de los roles que aùn no tienen cuota en la tabla cuota_rol
+*/
+func inicializarCuotasRol() {
+	for rol, cuota := range cuotaInicialPorRol {
+		_, err := db.Exec("INSERT IGNORE INTO cuota_rol (rol, maquinas, ram, cpu, disco, snapshots, encendidas) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			rol, cuota.Maquinas, cuota.Ram, cuota.Cpu, cuota.Disco, cuota.Snapshots, cuota.Encendidas)
+		if err != nil {
+			log.Println("Error al registrar la cuota inicial del rol "+rol+":", err)
+		}
+	}
+}
+
+/*
+Funciòn que guarda la cuota de un rol
+*/
+func guardarCuotaRol(rol string, cuota Cuota) error {
+	_, err := db.Exec(`INSERT INTO cuota_rol (rol, maquinas, ram, cpu, disco, snapshots, encendidas) VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE maquinas = VALUES(maquinas), ram = VALUES(ram), cpu = VALUES(cpu), disco = VALUES(disco),
+		snapshots = VALUES(snapshots), encendidas = VALUES(encendidas)`,
+		rol, cuota.Maquinas, cuota.Ram, cuota.Cpu, cuota.Disco, cuota.Snapshots, cuota.Encendidas)
+	return err
+}
+
+/*
+Funciòn que consulta la cuota configurada de cada rol
+@return Retorna un mapa con la cuota de cada rol
+*/
+func consultCuotasRol() (map[string]Cuota, error) {
+	rows, err := db.Query("SELECT rol, maquinas, ram, cpu, disco, snapshots, encendidas FROM cuota_rol")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	cuotas := map[string]Cuota{}
+	for rows.Next() {
+		var rol string
+		var cuota Cuota
+		if err := rows.Scan(&rol, &cuota.Maquinas, &cuota.Ram, &cuota.Cpu, &cuota.Disco, &cuota.Snapshots, &cuota.Encendidas); err != nil {
+			return nil, err
+		}
+		cuotas[rol] = cuota
+	}
+	return cuotas, rows.Err()
+}
+
+/*
+Funciòn que obtiene la cuota configurada de un rol. Los roles sin cuota usan la de los estudiantes y, si la base de datos
+no responde, se usa la cuota inicial
+*/
+func getCuotaRol(rol string) Cuota {
+	var cuota Cuota
+	err := db.QueryRow("SELECT maquinas, ram, cpu, disco, snapshots, encendidas FROM cuota_rol WHERE rol IN (?, 'Estudiante') ORDER BY rol = ? DESC LIMIT 1",
+		rol, rol).Scan(&cuota.Maquinas, &cuota.Ram, &cuota.Cpu, &cuota.Disco, &cuota.Snapshots, &cuota.Encendidas)
+	if err == nil {
+		return cuota
+	}
+	if err != sql.ErrNoRows {
+		log.Println("Error al consultar la cuota del rol:", err)
+	}
+	if cuota, existe := cuotaInicialPorRol[rol]; existe {
+		return cuota
+	}
+	return cuotaInicialPorRol["Estudiante"]
+}
+
+/*
+Funciòn que guarda la cuota personalizada de un usuario, ò la elimina si todos sus campos son nulos
+@email Paràmetro que contiene el email del usuario
+*/
+func guardarCuotaPersonalizada(email string, cuota CuotaPersonalizada) error {
+	if cuota == (CuotaPersonalizada{}) {
+		_, err := db.Exec("DELETE FROM cuota_persona WHERE persona_email = ?", email)
+		return err
+	}
+	_, err := db.Exec(`INSERT INTO cuota_persona (persona_email, maquinas, ram, cpu, disco, snapshots, encendidas) VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE maquinas = VALUES(maquinas), ram = VALUES(ram), cpu = VALUES(cpu), disco = VALUES(disco),
+		snapshots = VALUES(snapshots), encendidas = VALUES(encendidas)`,
+		email, cuota.Maquinas, cuota.Ram, cuota.Cpu, cuota.Disco, cuota.Snapshots, cuota.Encendidas)
+	return err
+}
+
+/*
+Funciòn que obtiene la cuota de un usuario: la configurada para su rol, con los campos de su cuota personalizada si la tiene
+@persona Paràmetro que contiene el usuario
+@return Retorna la cuota y si el usuario tiene una cuota personalizada
+*/
+func getCuota(persona Persona) (Cuota, bool) {
+
+	cuota := getCuotaRol(persona.Rol)
+
+	var maquinas, ram, cpu, disco, snapshots, encendidas sql.NullInt64
+	err := db.QueryRow("SELECT maquinas, ram, cpu, disco, snapshots, encendidas FROM cuota_persona WHERE persona_email = ?", persona.Email).Scan(
+		&maquinas, &ram, &cpu, &disco, &snapshots, &encendidas)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Println("Error al consultar la cuota personalizada:", err)
+		}
+		return cuota, false
+	}
+	for _, campo := range []struct {
+		valor   sql.NullInt64
+		destino *int
+	}{{maquinas, &cuota.Maquinas}, {ram, &cuota.Ram}, {cpu, &cuota.Cpu}, {disco, &cuota.Disco}, {snapshots, &cuota.Snapshots}, {encendidas, &cuota.Encendidas}} {
+		if campo.valor.Valid {
+			*campo.destino = int(campo.valor.Int64)
+		}
+	}
+	return cuota, true
+}
+
+/*
+Funciòn que consulta el uso de los recursos de un usuario frente a su cuota
+@email Paràmetro que contiene el email del usuario
+*/
+func getUsoCuota(email string) (UsoCuota, error) {
+
+	persona, err := getUser(email)
+	if err != nil {
+		return UsoCuota{}, err
+	}
+	uso := UsoCuota{Email: persona.Email, Rol: persona.Rol}
+	uso.Cuota, uso.Personalizada = getCuota(persona)
+
+	err = db.QueryRow(`SELECT COUNT(*), COALESCE(SUM(ram), 0), COALESCE(SUM(cpu), 0), COALESCE(SUM(estado IN (?, ?, ?)), 0)
+		FROM maquina_virtual WHERE persona_email = ?`, estadoEncendido, estadoEncendiendo, estadoPausado, email).Scan(
+		&uso.Uso.Maquinas, &uso.Uso.Ram, &uso.Uso.Cpu, &uso.Uso.Encendidas)
+	if err != nil {
+		return uso, err
+	}
+	muCreacionesMV.Lock()
+	for _, creacion := range creacionesMV {
+		if creacion.Persona_email == email {
+			uso.Uso.Maquinas++
+			uso.Uso.Ram += creacion.Ram
+			uso.Uso.Cpu += creacion.Cpu
+		}
+	}
+	muCreacionesMV.Unlock()
+	if err := db.QueryRow("SELECT COALESCE(SUM(tamanio), 0) FROM disco_datos WHERE persona_email = ?", email).Scan(&uso.Uso.Disco); err != nil {
+		return uso, err
+	}
+	err = db.QueryRow(`SELECT COALESCE(MAX(cantidad), 0) FROM (SELECT COUNT(*) AS cantidad FROM snapshot AS s
+		INNER JOIN maquina_virtual AS m ON m.uuid = s.maquina_virtual_uuid WHERE m.persona_email = ? AND s.base = FALSE GROUP BY s.maquina_virtual_uuid) AS conteo`, email).Scan(&uso.Uso.Snapshots)
+	return uso, err
+}
+
+/*
+Funciòn que indica si un valor supera el lìmite de un campo de la cuota
+*/
+func superaCuota(limite int, valor int) bool {
+	return limite != sinLimite && valor > limite
+}
+
+/*
+Funciòn que verifica que un usuario pueda sumar MV, memoria RAM y CPU sin superar su cuota. Se usa al crear, clonar,
+importar y modificar MV, tanto al encolar la solicitud como al ejecutarla
+@email Paràmetro que contiene el email del propietario
+@maquinas Paràmetro que contiene la cantidad de MV que se agregan
+@ram Paràmetro que contiene la memoria RAM en mb que se agrega. Puede ser negativa
+@cpu Paràmetro que contiene la cantidad de CPU que se agrega. Puede ser negativa
+*/
+func validarCuotaMV(email string, maquinas int, ram int, cpu int) error {
+
+	uso, err := getUsoCuota(email)
+	if err != nil {
+		return errors.New("no se pudo consultar la cuota del usuario")
+	}
+	var excedidos []string
+	if maquinas > 0 && superaCuota(uso.Cuota.Maquinas, uso.Uso.Maquinas+maquinas) {
+		excedidos = append(excedidos, fmt.Sprintf("%d màquinas virtuales (en uso: %d)", uso.Cuota.Maquinas, uso.Uso.Maquinas))
+	}
+	if ram > 0 && superaCuota(uso.Cuota.Ram, uso.Uso.Ram+ram) {
+		excedidos = append(excedidos, fmt.Sprintf("%d mb de RAM (en uso: %d mb)", uso.Cuota.Ram, uso.Uso.Ram))
+	}
+	if cpu > 0 && superaCuota(uso.Cuota.Cpu, uso.Uso.Cpu+cpu) {
+		excedidos = append(excedidos, fmt.Sprintf("%d CPU (en uso: %d)", uso.Cuota.Cpu, uso.Uso.Cpu))
+	}
+	if len(excedidos) > 0 {
+		return errors.New("el usuario superarìa su cuota de " + strings.Join(excedidos, ", "))
+	}
+	return nil
+}
+
+/*
+Funciòn que verifica la cuota del propietario de una MV que se va a crear y reserva sus recursos hasta que la MV se
+registra en la base de datos ò se libera la reserva. Asì, las creaciones simultàneas de un mismo usuario no superan su cuota
+@nombre Paràmetro que contiene el nombre ùnico de la MV que se va a crear
+@email Paràmetro que contiene el email del propietario
+@ram Paràmetro que contiene la memoria RAM en mb de la MV
+@cpu Paràmetro que contiene la cantidad de CPU de la MV
+*/
+func reservarCuotaMV(nombre string, email string, ram int, cpu int) error {
+
+	muCuotaMV.Lock()
+	defer muCuotaMV.Unlock()
+
+	if err := validarCuotaMV(email, 1, ram, cpu); err != nil {
+		return err
+	}
+	muCreacionesMV.Lock()
+	creacionesMV[nombre] = Maquina_virtual{Nombre: nombre, Persona_email: email, Ram: ram, Cpu: cpu}
+	muCreacionesMV.Unlock()
+	return nil
+}
+
+/*
+Funciòn que libera la cuota reservada para la creaciòn de una MV. No hace nada si la MV no tiene cuota reservada
+@nombre Paràmetro que contiene el nombre ùnico de la MV
+*/
+func liberarCuotaMV(nombre string) {
+	muCreacionesMV.Lock()
+	delete(creacionesMV, nombre)
+	muCreacionesMV.Unlock()
+}
+
+/*
+Funciòn que verifica que un usuario pueda encender una MV màs sin superar su cuota de MV encendidas
+@email Paràmetro que contiene el email del propietario
+*/
+func validarCuotaEncendido(email string) error {
+
+	uso, err := getUsoCuota(email)
+	if err != nil {
+		return errors.New("no se pudo consultar la cuota del usuario")
+	}
+	if superaCuota(uso.Cuota.Encendidas, uso.Uso.Encendidas+1) {
+		return fmt.Errorf("el usuario alcanzò su cuota de %d màquinas virtuales encendidas", uso.Cuota.Encendidas)
+	}
+	return nil
+}
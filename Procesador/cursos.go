@@ -0,0 +1,947 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+Estructura de datos tipo JSON que representa un curso (grupo) con sus instructores y estudiantes inscritos
+@Id Representa el identificador ùnico del curso
+@Nombre Representa el nombre del curso
+@Descripcion Representa una descripciòn libre del curso
+@Cuota Representa los recursos que pueden sumar las MV de los laboratorios del curso
+@Instructores Representa los emails de los instructores, que inscriben estudiantes y aprovisionan laboratorios
+@Estudiantes Representa los emails de los estudiantes inscritos
+@Plantillas Representa las plantillas con las que se pueden aprovisionar los laboratorios del curso
+@Fecha_creacion Representa la fecha de creaciòn del curso
+*/
+type Curso struct {
+	Id             int
+	Nombre         string
+	Descripcion    string
+	Cuota          CuotaCurso
+	Instructores   []string
+	Estudiantes    []string
+	Plantillas     []int
+	Fecha_creacion time.Time
+}
+
+/*
+Estructura de datos tipo JSON que representa la cuota de un curso. Un valor de -1 indica que no hay lìmite
+@Maquinas Representa la cantidad màxima de MV de los laboratorios del curso
+@Ram Representa la memoria RAM total en mb que pueden sumar las MV de los laboratorios
+@Cpu Representa la cantidad total de CPU que pueden sumar las MV de los laboratorios
+*/
+type CuotaCurso struct {
+	Maquinas int
+	Ram      int
+	Cpu      int
+}
+
+/*
+Estructura de datos tipo JSON que representa un laboratorio: el lote de MV, una por estudiante, que un instructor
+aprovisiona para un curso desde una plantilla. Cada MV se crea en un trabajo
+@Id Representa el identificador ùnico del laboratorio
+@Curso_id Representa el curso del laboratorio
+@Plantilla_id Representa la plantilla de las MV
+@Nombre Representa el nombre de las MV del laboratorio
+@Persona_email Representa el email del instructor que aprovisionò el laboratorio
+@Ram Representa la memoria RAM de cada MV en mb
+@Cpu Representa las unidades de procesamiento de cada MV
+@Fecha_creacion Representa la fecha de creaciòn del laboratorio
+@Trabajos Representa el trabajo de creaciòn de la MV de cada estudiante
+@Progreso Representa la cantidad de trabajos en cada estado
+@Maquinas Representa las MV del laboratorio que existen
+@Reserva_id Representa la reserva de capacidad del curso con la que se crean las MV. Si es 0 las MV se crean sin reserva
+*/
+type Laboratorio struct {
+	Id             int
+	Curso_id       int
+	Plantilla_id   int
+	Nombre         string
+	Persona_email  string
+	Ram            int
+	Cpu            int
+	Fecha_creacion time.Time
+	Trabajos       []Trabajo
+	Progreso       map[string]int
+	Maquinas       []Maquina_virtual
+	Reserva_id     int
+}
+
+// Roles de los miembros de un curso
+const (
+	rolInstructor = "instructor"
+	rolEstudiante = "estudiante"
+)
+
+// Tipo de los trabajos que crean las MV de un laboratorio
+const trabajoLaboratorio = "lab_provision"
+
+var accionesLaboratorio = map[string]bool{"start": true, "stop": true, "delete": true}
+
+/*
+Funciòn que configura los endpoints para administrar los cursos, sus miembros y plantillas, y los laboratorios.
+Los administradores crean los cursos y asignan instructores, cuotas y plantillas; los instructores inscriben
+estudiantes y aprovisionan y controlan los laboratorios
+*/
+func manejarCursos() {
+
+	//Endpoint para crear un curso
+	http.HandleFunc("/json/createCourse", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Se requiere una solicitud POST", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var datos struct {
+			Email string
+			Curso Curso
+		}
+		datos.Curso.Cuota = CuotaCurso{Maquinas: sinLimite, Ram: sinLimite, Cpu: sinLimite}
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&datos); err != nil {
+			http.Error(w, "Error al decodificar JSON de la solicitud", http.StatusBadRequest)
+			return
+		}
+		if !esAdministrador(datos.Email) {
+			http.Error(w, "Solo los administradores pueden crear cursos", http.StatusForbidden)
+			return
+		}
+		if err := validarCurso(datos.Curso); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		resultado, err := db.Exec("INSERT INTO curso (nombre, descripcion, maquinas, ram, cpu, fecha_creacion) VALUES (?, ?, ?, ?, ?, ?)",
+			strings.TrimSpace(datos.Curso.Nombre), datos.Curso.Descripcion, datos.Curso.Cuota.Maquinas, datos.Curso.Cuota.Ram, datos.Curso.Cuota.Cpu,
+			time.Now().UTC().Format("2006-01-02 15:04:05"))
+		if err != nil {
+			log.Println("Error al registrar el curso:", err)
+			http.Error(w, "Error al registrar el curso", http.StatusInternalServerError)
+			return
+		}
+		id, _ := resultado.LastInsertId()
+
+		response := map[string]interface{}{"mensaje": "Curso creado correctamente", "id": id}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(response)
+	})
+
+	//Endpoint para modificar el nombre, la descripciòn y la cuota de un curso
+	http.HandleFunc("/json/updateCourse", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Se requiere una solicitud POST", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var datos struct {
+			Email string
+			Curso Curso
+		}
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&datos); err != nil {
+			http.Error(w, "Error al decodificar JSON de la solicitud", http.StatusBadRequest)
+			return
+		}
+		if !esAdministrador(datos.Email) {
+			http.Error(w, "Solo los administradores pueden modificar cursos", http.StatusForbidden)
+			return
+		}
+		if _, err := getCurso(datos.Curso.Id); err != nil {
+			http.Error(w, "No se encontró el curso", http.StatusNotFound)
+			return
+		}
+		if err := validarCurso(datos.Curso); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		_, err := db.Exec("UPDATE curso SET nombre = ?, descripcion = ?, maquinas = ?, ram = ?, cpu = ? WHERE id = ?",
+			strings.TrimSpace(datos.Curso.Nombre), datos.Curso.Descripcion, datos.Curso.Cuota.Maquinas, datos.Curso.Cuota.Ram, datos.Curso.Cuota.Cpu, datos.Curso.Id)
+		if err != nil {
+			log.Println("Error al modificar el curso:", err)
+			http.Error(w, "Error al modificar el curso", http.StatusInternalServerError)
+			return
+		}
+
+		response := map[string]string{"mensaje": "Curso modificado correctamente"}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(response)
+	})
+
+	//Endpoint para eliminar un curso. Las MV de sus laboratorios se deben eliminar antes
+	http.HandleFunc("/json/deleteCourse", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Se requiere una solicitud POST", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var datos struct {
+			Email string
+			Id    int
+		}
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&datos); err != nil {
+			http.Error(w, "Error al decodificar JSON de la solicitud", http.StatusBadRequest)
+			return
+		}
+		if !esAdministrador(datos.Email) {
+			http.Error(w, "Solo los administradores pueden eliminar cursos", http.StatusForbidden)
+			return
+		}
+		if _, err := getCurso(datos.Id); err != nil {
+			http.Error(w, "No se encontró el curso", http.StatusNotFound)
+			return
+		}
+		if uso, err := getUsoCuotaCurso(datos.Id); err != nil || uso.Maquinas > 0 {
+			http.Error(w, "Debe eliminar primero las máquinas virtuales de los laboratorios del curso", http.StatusConflict)
+			return
+		}
+
+		eliminarCurso(datos.Id)
+
+		response := map[string]string{"mensaje": "Curso eliminado correctamente"}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(response)
+	})
+
+	//Endpoint para consultar los cursos. Los administradores ven todos y los demàs usuarios los cursos de los que son miembros
+	http.HandleFunc("/json/consultCourses", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Se requiere una solicitud POST", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var datos struct {
+			Email string
+		}
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&datos); err != nil {
+			http.Error(w, "Error al decodificar JSON de la solicitud", http.StatusBadRequest)
+			return
+		}
+		if _, err := getUser(datos.Email); err != nil {
+			http.Error(w, "No se encontró el usuario", http.StatusNotFound)
+			return
+		}
+
+		cursos, err := consultCursos(datos.Email, esAdministrador(datos.Email))
+		if err != nil {
+			log.Println("Error al consultar los cursos:", err)
+			http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(cursos)
+	})
+
+	//Endpoint para inscribir miembros en un curso. Solo los administradores asignan instructores
+	http.HandleFunc("/json/addCourseMembers", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Se requiere una solicitud POST", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var datos struct {
+			Email    string
+			Id       int
+			Rol      string
+			Miembros []string
+		}
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&datos); err != nil {
+			http.Error(w, "Error al decodificar JSON de la solicitud", http.StatusBadRequest)
+			return
+		}
+		if datos.Rol == "" {
+			datos.Rol = rolEstudiante
+		}
+		if datos.Rol != rolEstudiante && datos.Rol != rolInstructor {
+			http.Error(w, "El rol debe ser 'estudiante' o 'instructor'", http.StatusBadRequest)
+			return
+		}
+		if len(datos.Miembros) == 0 {
+			http.Error(w, "Debe indicar los miembros", http.StatusBadRequest)
+			return
+		}
+		if _, mensaje, estado := validarInstructorCurso(datos.Id, datos.Email); estado != http.StatusOK {
+			http.Error(w, mensaje, estado)
+			return
+		}
+		if datos.Rol == rolInstructor && !esAdministrador(datos.Email) {
+			http.Error(w, "Solo los administradores pueden asignar instructores", http.StatusForbidden)
+			return
+		}
+		for _, miembro := range datos.Miembros {
+			persona, err := getUser(miembro)
+			if err != nil {
+				http.Error(w, "No se encontró el usuario "+miembro, http.StatusNotFound)
+				return
+			}
+			if persona.Rol == "Invitado" {
+				http.Error(w, "Los usuarios invitados no se pueden inscribir en cursos", http.StatusBadRequest)
+				return
+			}
+		}
+
+		for _, miembro := range datos.Miembros {
+			_, err := db.Exec("INSERT INTO curso_miembro (curso_id, persona_email, rol) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE rol = VALUES(rol)",
+				datos.Id, miembro, datos.Rol)
+			if err != nil {
+				log.Println("Error al inscribir el miembro del curso:", err)
+				http.Error(w, "Error al inscribir a "+miembro, http.StatusInternalServerError)
+				return
+			}
+		}
+
+		response := map[string]string{"mensaje": "Miembros inscritos correctamente"}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(response)
+	})
+
+	//Endpoint para retirar miembros de un curso. Sus MV de laboratorio no se eliminan
+	http.HandleFunc("/json/removeCourseMembers", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Se requiere una solicitud POST", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var datos struct {
+			Email    string
+			Id       int
+			Miembros []string
+		}
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&datos); err != nil {
+			http.Error(w, "Error al decodificar JSON de la solicitud", http.StatusBadRequest)
+			return
+		}
+		if _, mensaje, estado := validarInstructorCurso(datos.Id, datos.Email); estado != http.StatusOK {
+			http.Error(w, mensaje, estado)
+			return
+		}
+		administrador := esAdministrador(datos.Email)
+		for _, miembro := range datos.Miembros {
+			if !administrador && rolEnCurso(datos.Id, miembro) == rolInstructor {
+				http.Error(w, "Solo los administradores pueden retirar instructores", http.StatusForbidden)
+				return
+			}
+		}
+
+		for _, miembro := range datos.Miembros {
+			db.Exec("DELETE FROM curso_miembro WHERE curso_id = ? AND persona_email = ?", datos.Id, miembro)
+		}
+
+		response := map[string]string{"mensaje": "Miembros retirados correctamente"}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(response)
+	})
+
+	//Endpoint para definir las plantillas permitidas en los laboratorios de un curso
+	http.HandleFunc("/json/setCourseTemplates", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Se requiere una solicitud POST", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var datos struct {
+			Email      string
+			Id         int
+			Plantillas []int
+		}
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&datos); err != nil {
+			http.Error(w, "Error al decodificar JSON de la solicitud", http.StatusBadRequest)
+			return
+		}
+		if !esAdministrador(datos.Email) {
+			http.Error(w, "Solo los administradores pueden definir las plantillas de un curso", http.StatusForbidden)
+			return
+		}
+		if _, err := getCurso(datos.Id); err != nil {
+			http.Error(w, "No se encontró el curso", http.StatusNotFound)
+			return
+		}
+		for _, idPlantilla := range datos.Plantillas {
+			if _, err := getPlantilla(idPlantilla); err != nil {
+				http.Error(w, "No se encontró la plantilla "+strconv.Itoa(idPlantilla), http.StatusNotFound)
+				return
+			}
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, "Error al guardar las plantillas", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+		if _, err := tx.Exec("DELETE FROM curso_plantilla WHERE curso_id = ?", datos.Id); err != nil {
+			http.Error(w, "Error al guardar las plantillas", http.StatusInternalServerError)
+			return
+		}
+		for _, idPlantilla := range datos.Plantillas {
+			if _, err := tx.Exec("INSERT IGNORE INTO curso_plantilla (curso_id, plantilla_id) VALUES (?, ?)", datos.Id, idPlantilla); err != nil {
+				http.Error(w, "Error al guardar las plantillas", http.StatusInternalServerError)
+				return
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			log.Println("Error al guardar las plantillas del curso:", err)
+			http.Error(w, "Error al guardar las plantillas", http.StatusInternalServerError)
+			return
+		}
+
+		response := map[string]string{"mensaje": "Plantillas del curso guardadas correctamente"}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(response)
+	})
+
+	//Endpoint para aprovisionar un laboratorio: una MV por estudiante inscrito, cada una creada en un trabajo
+	http.HandleFunc("/json/provisionLab", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Se requiere una solicitud POST", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var datos struct {
+			Email        string
+			Id           int
+			Plantilla_id int
+			Nombre       string
+			Ram          int
+			Cpu          int
+			Reserva_id   int
+		}
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&datos); err != nil {
+			http.Error(w, "Error al decodificar JSON de la solicitud", http.StatusBadRequest)
+			return
+		}
+		if err := validarNombre(datos.Nombre); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		curso, mensaje, estado := validarInstructorCurso(datos.Id, datos.Email)
+		if estado != http.StatusOK {
+			http.Error(w, mensaje, estado)
+			return
+		}
+
+		laboratorio := Laboratorio{Curso_id: curso.Id, Plantilla_id: datos.Plantilla_id, Nombre: datos.Nombre, Persona_email: datos.Email, Ram: datos.Ram, Cpu: datos.Cpu, Reserva_id: datos.Reserva_id}
+		trabajos, mensaje, estado := registrarLaboratorio(curso, &laboratorio)
+		if estado != http.StatusOK {
+			http.Error(w, mensaje, estado)
+			return
+		}
+		go aprovisionarLaboratorio(laboratorio)
+
+		response := map[string]interface{}{
+			"mensaje":  "Laboratorio registrado. Las máquinas virtuales se crean en los trabajos indicados",
+			"id":       laboratorio.Id,
+			"trabajos": trabajos,
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(response)
+	})
+
+	//Endpoint para consultar un laboratorio con el progreso de sus trabajos y sus MV
+	http.HandleFunc("/json/consultLab", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Se requiere una solicitud POST", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var datos struct {
+			Email string
+			Id    int
+		}
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&datos); err != nil {
+			http.Error(w, "Error al decodificar JSON de la solicitud", http.StatusBadRequest)
+			return
+		}
+		laboratorio, mensaje, estado := validarInstructorLaboratorio(datos.Id, datos.Email)
+		if estado != http.StatusOK {
+			http.Error(w, mensaje, estado)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(laboratorio)
+	})
+
+	//Endpoint para encender, apagar ò eliminar todas las MV de un laboratorio
+	http.HandleFunc("/json/labAction", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Se requiere una solicitud POST", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var datos struct {
+			Email  string
+			Id     int
+			Accion string
+		}
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&datos); err != nil {
+			http.Error(w, "Error al decodificar JSON de la solicitud", http.StatusBadRequest)
+			return
+		}
+		if !accionesLaboratorio[datos.Accion] {
+			http.Error(w, "La acción debe ser start, stop o delete", http.StatusBadRequest)
+			return
+		}
+		laboratorio, mensaje, estado := validarInstructorLaboratorio(datos.Id, datos.Email)
+		if estado != http.StatusOK {
+			http.Error(w, mensaje, estado)
+			return
+		}
+
+		solicitadas := accionLaboratorio(laboratorio, datos.Accion)
+
+		response := map[string]interface{}{
+			"mensaje":  fmt.Sprintf("Acción %s solicitada para %d de %d máquinas virtuales del laboratorio", datos.Accion, solicitadas, len(laboratorio.Maquinas)),
+			"cantidad": solicitadas,
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(response)
+	})
+}
+
+/*
+Funciòn que verifica el nombre y la cuota de un curso
+*/
+func validarCurso(curso Curso) error {
+	nombre := strings.TrimSpace(curso.Nombre)
+	if nombre == "" || len(nombre) > 100 {
+		return errors.New("el nombre del curso es obligatorio y debe tener máximo 100 caracteres")
+	}
+	if len(curso.Descripcion) > 500 {
+		return errors.New("la descripción del curso debe tener máximo 500 caracteres")
+	}
+	if curso.Cuota.Maquinas < sinLimite || curso.Cuota.Ram < sinLimite || curso.Cuota.Cpu < sinLimite {
+		return errors.New("los campos de la cuota deben ser -1 (sin límite) o mayores o iguales a 0")
+	}
+	return nil
+}
+
+/*
+Funciòn que obtiene un curso con sus miembros y plantillas dado su identificador ùnico
+*/
+func getCurso(id int) (Curso, error) {
+
+	var curso Curso
+	var fecha string
+	err := db.QueryRow("SELECT id, nombre, descripcion, maquinas, ram, cpu, fecha_creacion FROM curso WHERE id = ?", id).Scan(
+		&curso.Id, &curso.Nombre, &curso.Descripcion, &curso.Cuota.Maquinas, &curso.Cuota.Ram, &curso.Cuota.Cpu, &fecha)
+	if err != nil {
+		return curso, err
+	}
+	curso.Fecha_creacion, _ = time.Parse("2006-01-02 15:04:05", fecha)
+
+	curso.Instructores, curso.Estudiantes = []string{}, []string{}
+	rows, err := db.Query("SELECT persona_email, rol FROM curso_miembro WHERE curso_id = ? ORDER BY persona_email", id)
+	if err != nil {
+		return curso, err
+	}
+	for rows.Next() {
+		var email, rol string
+		if err := rows.Scan(&email, &rol); err != nil {
+			continue
+		}
+		if rol == rolInstructor {
+			curso.Instructores = append(curso.Instructores, email)
+		} else {
+			curso.Estudiantes = append(curso.Estudiantes, email)
+		}
+	}
+	rows.Close()
+
+	curso.Plantillas = []int{}
+	rows, err = db.Query("SELECT plantilla_id FROM curso_plantilla WHERE curso_id = ? ORDER BY plantilla_id", id)
+	if err != nil {
+		return curso, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var idPlantilla int
+		if err := rows.Scan(&idPlantilla); err == nil {
+			curso.Plantillas = append(curso.Plantillas, idPlantilla)
+		}
+	}
+	return curso, rows.Err()
+}
+
+/*
+Funciòn que consulta los cursos de un usuario
+@email Paràmetro que contiene el email del usuario
+@todos Paràmetro que indica si se consultan todos los cursos, para los administradores
+*/
+func consultCursos(email string, todos bool) ([]Curso, error) {
+
+	query := "SELECT id FROM curso ORDER BY nombre"
+	var argumentos []interface{}
+	if !todos {
+		query = "SELECT c.id FROM curso AS c INNER JOIN curso_miembro AS cm ON cm.curso_id = c.id WHERE cm.persona_email = ? ORDER BY c.nombre"
+		argumentos = append(argumentos, email)
+	}
+	rows, err := db.Query(query, argumentos...)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+
+	cursos := []Curso{}
+	for _, id := range ids {
+		curso, err := getCurso(id)
+		if err != nil {
+			log.Println("Error al obtener el curso:", err)
+			continue
+		}
+		cursos = append(cursos, curso)
+	}
+	return cursos, nil
+}
+
+/*
+Funciòn que obtiene el rol de un usuario en un curso: instructor, estudiante ò vacìo si no es miembro
+*/
+func rolEnCurso(idCurso int, email string) string {
+	var rol string
+	db.QueryRow("SELECT rol FROM curso_miembro WHERE curso_id = ? AND persona_email = ?", idCurso, email).Scan(&rol)
+	return rol
+}
+
+/*
+Funciòn que verifica que el usuario sea instructor del curso ò administrador
+@return Retorna el curso, un mensaje de error y el còdigo HTTP del resultado
+*/
+func validarInstructorCurso(idCurso int, email string) (Curso, string, int) {
+	curso, err := getCurso(idCurso)
+	if err != nil {
+		return curso, "No se encontró el curso", http.StatusNotFound
+	}
+	if rolEnCurso(idCurso, email) != rolInstructor && !esAdministrador(email) {
+		return curso, "Solo los instructores del curso y los administradores pueden realizar esta operación", http.StatusForbidden
+	}
+	return curso, "", http.StatusOK
+}
+
+/*
+Funciòn que elimina un curso con sus miembros, plantillas y laboratorios
+*/
+func eliminarCurso(idCurso int) {
+	db.Exec("DELETE lm FROM laboratorio_mv AS lm INNER JOIN laboratorio AS l ON l.id = lm.laboratorio_id WHERE l.curso_id = ?", idCurso)
+	db.Exec("DELETE FROM laboratorio WHERE curso_id = ?", idCurso)
+	db.Exec("DELETE FROM curso_plantilla WHERE curso_id = ?", idCurso)
+	db.Exec("DELETE FROM curso_miembro WHERE curso_id = ?", idCurso)
+	db.Exec("DELETE FROM curso WHERE id = ?", idCurso)
+}
+
+/*
+Funciòn que consulta los recursos que suman las MV existentes de los laboratorios de un curso
+*/
+func getUsoCuotaCurso(idCurso int) (CuotaCurso, error) {
+	var uso CuotaCurso
+	err := db.QueryRow(`SELECT COUNT(*), COALESCE(SUM(m.ram), 0), COALESCE(SUM(m.cpu), 0) FROM laboratorio_mv AS lm
+		INNER JOIN laboratorio AS l ON l.id = lm.laboratorio_id
+		INNER JOIN maquina_virtual AS m ON m.uuid = lm.maquina_virtual_uuid WHERE l.curso_id = ?`, idCurso).Scan(&uso.Maquinas, &uso.Ram, &uso.Cpu)
+	return uso, err
+}
+
+/*
+Funciòn que verifica que un curso pueda sumar MV a sus laboratorios sin superar su cuota
+@maquinas Paràmetro que contiene la cantidad de MV que se agregan
+@ram Paràmetro que contiene la memoria RAM en mb de cada MV
+@cpu Paràmetro que contiene las unidades de procesamiento de cada MV
+*/
+func validarCuotaCurso(curso Curso, maquinas int, ram int, cpu int) error {
+	uso, err := getUsoCuotaCurso(curso.Id)
+	if err != nil {
+		return errors.New("no se pudo consultar la cuota del curso")
+	}
+	if superaCuota(curso.Cuota.Maquinas, uso.Maquinas+maquinas) {
+		return fmt.Errorf("el curso superarìa su cuota de %d màquinas virtuales (en uso: %d)", curso.Cuota.Maquinas, uso.Maquinas)
+	}
+	if superaCuota(curso.Cuota.Ram, uso.Ram+maquinas*ram) {
+		return fmt.Errorf("el curso superarìa su cuota de %d mb de RAM (en uso: %d mb)", curso.Cuota.Ram, uso.Ram)
+	}
+	if superaCuota(curso.Cuota.Cpu, uso.Cpu+maquinas*cpu) {
+		return fmt.Errorf("el curso superarìa su cuota de %d CPU (en uso: %d)", curso.Cuota.Cpu, uso.Cpu)
+	}
+	return nil
+}
+
+/*
+Funciòn que valida y registra un laboratorio con un trabajo pendiente por cada estudiante inscrito. Los estudiantes
+cuya cuota no permite la MV reciben un trabajo con error
+@laboratorio Paràmetro que contiene el laboratorio. Se completan su identificador, RAM y CPU
+@return Retorna los identificadores de los trabajos, un mensaje de error y el còdigo HTTP del resultado
+*/
+func registrarLaboratorio(curso Curso, laboratorio *Laboratorio) ([]int, string, int) {
+
+	permitida := false
+	for _, idPlantilla := range curso.Plantillas {
+		permitida = permitida || idPlantilla == laboratorio.Plantilla_id
+	}
+	if !permitida {
+		return nil, "La plantilla no está permitida en el curso", http.StatusForbidden
+	}
+	specs := Maquina_virtual{Plantilla_id: laboratorio.Plantilla_id, Ram: laboratorio.Ram, Cpu: laboratorio.Cpu}
+	if _, err := aplicarPlantilla(&specs); err != nil {
+		return nil, err.Error(), http.StatusBadRequest
+	}
+	laboratorio.Ram, laboratorio.Cpu = specs.Ram, specs.Cpu
+	if len(curso.Estudiantes) == 0 {
+		return nil, "El curso no tiene estudiantes inscritos", http.StatusConflict
+	}
+
+	//Con una reserva, las MV usan su RAM y CPU y la reserva debe tener un lugar libre por estudiante
+	if laboratorio.Reserva_id > 0 {
+		reserva, err := validarUsoReserva(laboratorio.Reserva_id, laboratorio.Persona_email, len(curso.Estudiantes))
+		if err != nil {
+			return nil, err.Error(), http.StatusConflict
+		}
+		if reserva.Curso_id != curso.Id || reserva.Plantilla_id != laboratorio.Plantilla_id {
+			return nil, "La reserva no es del curso ni de la plantilla del laboratorio", http.StatusConflict
+		}
+		laboratorio.Ram, laboratorio.Cpu = reserva.Ram, reserva.Cpu
+	}
+	if err := validarCuotaCurso(curso, len(curso.Estudiantes), laboratorio.Ram, laboratorio.Cpu); err != nil {
+		return nil, err.Error(), http.StatusForbidden
+	}
+
+	resultado, err := db.Exec("INSERT INTO laboratorio (curso_id, plantilla_id, nombre, persona_email, ram, cpu, fecha_creacion) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		curso.Id, laboratorio.Plantilla_id, laboratorio.Nombre, laboratorio.Persona_email, laboratorio.Ram, laboratorio.Cpu,
+		time.Now().UTC().Format("2006-01-02 15:04:05"))
+	if err != nil {
+		log.Println("Error al registrar el laboratorio:", err)
+		return nil, "Error al registrar el laboratorio", http.StatusInternalServerError
+	}
+	id, _ := resultado.LastInsertId()
+	laboratorio.Id = int(id)
+
+	var trabajos []int
+	for _, estudiante := range curso.Estudiantes {
+		idTrabajo, err := crearTrabajo(trabajoLaboratorio, laboratorio.Nombre, laboratorio.Persona_email, 0)
+		if err != nil {
+			log.Println("Error al registrar el trabajo del laboratorio:", err)
+			continue
+		}
+		if _, err := db.Exec("INSERT INTO laboratorio_mv (laboratorio_id, persona_email, trabajo_id) VALUES (?, ?, ?)", laboratorio.Id, estudiante, idTrabajo); err != nil {
+			log.Println("Error al registrar la MV del laboratorio:", err)
+			actualizarTrabajo(idTrabajo, trabajoError, "Error al registrar la MV del laboratorio")
+			continue
+		}
+		if err := validarCuotaMV(estudiante, 1, laboratorio.Ram, laboratorio.Cpu); err != nil {
+			actualizarTrabajo(idTrabajo, trabajoError, recortarTexto(estudiante+": "+err.Error(), 255))
+		}
+		trabajos = append(trabajos, idTrabajo)
+	}
+	return trabajos, "", http.StatusOK
+}
+
+/*
+Funciòn que crea las MV de un laboratorio, una tras otra, en los trabajos pendientes. Cada MV lleva la etiqueta del
+laboratorio, con la que tambièn se puede programar su encendido y apagado
+*/
+func aprovisionarLaboratorio(laboratorio Laboratorio) {
+
+	rows, err := db.Query(`SELECT lm.persona_email, lm.trabajo_id FROM laboratorio_mv AS lm INNER JOIN trabajo AS t ON t.id = lm.trabajo_id
+		WHERE lm.laboratorio_id = ? AND t.estado = ? ORDER BY lm.trabajo_id`, laboratorio.Id, trabajoPendiente)
+	if err != nil {
+		log.Println("Error al consultar los trabajos del laboratorio:", err)
+		return
+	}
+	pendientes := map[int]string{}
+	var orden []int
+	for rows.Next() {
+		var email string
+		var idTrabajo int
+		if err := rows.Scan(&email, &idTrabajo); err == nil {
+			pendientes[idTrabajo] = email
+			orden = append(orden, idTrabajo)
+		}
+	}
+	rows.Close()
+
+	etiqueta := etiquetaLaboratorio(laboratorio.Id)
+	for _, idTrabajo := range orden {
+		estudiante := pendientes[idTrabajo]
+		actualizarTrabajo(idTrabajo, trabajoEnCurso, "Creando la MV de "+estudiante)
+
+		//La cuota del curso se vuelve a verificar porque pudo cambiar desde que se registrò el laboratorio
+		if curso, err := getCurso(laboratorio.Curso_id); err != nil {
+			actualizarTrabajo(idTrabajo, trabajoError, "No se encontrò el curso")
+			continue
+		} else if err := validarCuotaCurso(curso, 1, laboratorio.Ram, laboratorio.Cpu); err != nil {
+			actualizarTrabajo(idTrabajo, trabajoError, recortarTexto(err.Error(), 255))
+			continue
+		}
+
+		specs := Maquina_virtual{
+			Nombre:        laboratorio.Nombre,
+			Plantilla_id:  laboratorio.Plantilla_id,
+			Ram:           laboratorio.Ram,
+			Cpu:           laboratorio.Cpu,
+			Persona_email: estudiante,
+			Etiquetas:     []string{etiqueta},
+			Reserva_id:    laboratorio.Reserva_id,
+		}
+		mensaje := crateVM(specs, "")
+
+		var uuidVM string
+		err := db.QueryRow(`SELECT m.uuid FROM maquina_virtual AS m INNER JOIN etiqueta_mv AS e ON e.maquina_virtual_uuid = m.uuid
+			WHERE e.etiqueta = ? AND m.persona_email = ? LIMIT 1`, etiqueta, estudiante).Scan(&uuidVM)
+		if err != nil {
+			actualizarTrabajo(idTrabajo, trabajoError, recortarTexto(mensaje, 255))
+			continue
+		}
+		db.Exec("UPDATE laboratorio_mv SET maquina_virtual_uuid = ? WHERE laboratorio_id = ? AND persona_email = ?", uuidVM, laboratorio.Id, estudiante)
+		actualizarTrabajo(idTrabajo, trabajoTerminado, recortarTexto(mensaje, 255))
+	}
+}
+
+/*
+Funciòn que obtiene la etiqueta de las MV de un laboratorio
+*/
+func etiquetaLaboratorio(idLaboratorio int) string {
+	return "laboratorio-" + strconv.Itoa(idLaboratorio)
+}
+
+/*
+Funciòn que obtiene un laboratorio con sus trabajos, el progreso y las MV que existen
+*/
+func getLaboratorio(id int) (Laboratorio, error) {
+
+	var laboratorio Laboratorio
+	var fecha string
+	err := db.QueryRow("SELECT id, curso_id, plantilla_id, nombre, persona_email, ram, cpu, fecha_creacion FROM laboratorio WHERE id = ?", id).Scan(
+		&laboratorio.Id, &laboratorio.Curso_id, &laboratorio.Plantilla_id, &laboratorio.Nombre, &laboratorio.Persona_email,
+		&laboratorio.Ram, &laboratorio.Cpu, &fecha)
+	if err != nil {
+		return laboratorio, err
+	}
+	laboratorio.Fecha_creacion, _ = time.Parse("2006-01-02 15:04:05", fecha)
+
+	rows, err := db.Query("SELECT trabajo_id, maquina_virtual_uuid FROM laboratorio_mv WHERE laboratorio_id = ? ORDER BY trabajo_id", id)
+	if err != nil {
+		return laboratorio, err
+	}
+	var trabajos []int
+	var uuids []string
+	for rows.Next() {
+		var idTrabajo int
+		var uuidVM string
+		if err := rows.Scan(&idTrabajo, &uuidVM); err == nil {
+			trabajos = append(trabajos, idTrabajo)
+			if uuidVM != "" {
+				uuids = append(uuids, uuidVM)
+			}
+		}
+	}
+	rows.Close()
+
+	laboratorio.Trabajos, laboratorio.Maquinas = []Trabajo{}, []Maquina_virtual{}
+	laboratorio.Progreso = map[string]int{trabajoPendiente: 0, trabajoEnCurso: 0, trabajoTerminado: 0, trabajoError: 0}
+	for _, idTrabajo := range trabajos {
+		if trabajo, err := getTrabajo(idTrabajo); err == nil {
+			laboratorio.Trabajos = append(laboratorio.Trabajos, trabajo)
+			laboratorio.Progreso[trabajo.Estado]++
+		}
+	}
+	for _, uuidVM := range uuids {
+		//Las MV que los estudiantes ya eliminaron no se incluyen
+		if maquinaVirtual, err := getVM(uuidVM); err == nil {
+			laboratorio.Maquinas = append(laboratorio.Maquinas, maquinaVirtual)
+		}
+	}
+	return laboratorio, nil
+}
+
+/*
+Funciòn que verifica que el usuario sea instructor del curso del laboratorio ò administrador
+@return Retorna el laboratorio, un mensaje de error y el còdigo HTTP del resultado
+*/
+func validarInstructorLaboratorio(idLaboratorio int, email string) (Laboratorio, string, int) {
+	laboratorio, err := getLaboratorio(idLaboratorio)
+	if err != nil {
+		return laboratorio, "No se encontró el laboratorio", http.StatusNotFound
+	}
+	if rolEnCurso(laboratorio.Curso_id, email) != rolInstructor && !esAdministrador(email) {
+		return laboratorio, "Solo los instructores del curso y los administradores pueden realizar esta operación", http.StatusForbidden
+	}
+	return laboratorio, "", http.StatusOK
+}
+
+/*
+Funciòn que aplica una acciòn a todas las MV de un laboratorio. start enciende las MV apagadas ò guardadas y stop apaga
+con ACPI las encendidas, ambas por la cola de gestiòn; delete elimina cada MV, forzando antes el apagado si està encendida
+@accion Paràmetro que contiene la acciòn: start, stop ò delete
+@return Retorna la cantidad de MV a las que se aplicò la acciòn
+*/
+func accionLaboratorio(laboratorio Laboratorio, accion string) int {
+
+	solicitadas := 0
+	for _, maquinaVirtual := range laboratorio.Maquinas {
+		encendida := maquinaVirtual.Estado == estadoEncendido || maquinaVirtual.Estado == estadoPausado
+		switch {
+		case accion == "start" && (maquinaVirtual.Estado == estadoApagado || maquinaVirtual.Estado == estadoGuardado):
+			encolarAccionLaboratorio("start", maquinaVirtual, laboratorio)
+		case accion == "stop" && encendida:
+			encolarAccionLaboratorio("shutdown", maquinaVirtual, laboratorio)
+		case accion == "delete" && (encendida || maquinaVirtual.Estado == estadoApagado || maquinaVirtual.Estado == estadoGuardado || maquinaVirtual.Estado == estadoError):
+			go func(maquinaVirtual Maquina_virtual) {
+				if maquinaVirtual.Estado == estadoEncendido || maquinaVirtual.Estado == estadoPausado {
+					fmt.Println(forzarApagadoMV(maquinaVirtual.Uuid))
+				}
+				fmt.Println(deleteVM(maquinaVirtual.Uuid))
+			}(maquinaVirtual)
+		default:
+			continue
+		}
+		solicitadas++
+	}
+	return solicitadas
+}
+
+/*
+Funciòn que encola en la cola de gestiòn una acciòn sobre una MV de un laboratorio
+@tipoSolicitud Paràmetro que contiene el tipo de solicitud: start ò shutdown
+*/
+func encolarAccionLaboratorio(tipoSolicitud string, maquinaVirtual Maquina_virtual, laboratorio Laboratorio) {
+	fmt.Println("Laboratorio " + strconv.Itoa(laboratorio.Id) + ": " + tipoSolicitud + " de la màquina " + maquinaVirtual.Nombre)
+	mu.Lock()
+	managementQueue.Queue.PushBack(map[string]interface{}{
+		"tipo_solicitud": tipoSolicitud,
+		"nombreVM":       maquinaVirtual.Uuid,
+		"clientIP":       "",
+	})
+	mu.Unlock()
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"io"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+/*
+Estructura que representa las particularidades de los comandos segùn el sistema operativo de la màquina a la que se envìan
+@Sistema Representa el nombre del sistema operativo: Windows, Linux o Mac
+@Shell Representa el intèrprete que ejecuta los comandos recibidos por SSH
+@SeparadorRuta Representa el separador de directorios del sistema de archivos
+@RaizPersonal Representa el directorio que contiene las carpetas personales de los usuarios
+*/
+type dialectoHost struct {
+	Sistema       string
+	Shell         tipoShell
+	SeparadorRuta string
+	RaizPersonal  string
+}
+
+var (
+	dialectoWindows           = dialectoHost{Sistema: "Windows", Shell: shellCmd, SeparadorRuta: "\\", RaizPersonal: "C:\\Users"}
+	dialectoWindowsPowerShell = dialectoHost{Sistema: "Windows", Shell: shellPowerShell, SeparadorRuta: "\\", RaizPersonal: "C:\\Users"}
+	dialectoLinux             = dialectoHost{Sistema: "Linux", Shell: shellPOSIX, SeparadorRuta: "/", RaizPersonal: "/home"}
+	dialectoMac               = dialectoHost{Sistema: "Mac", Shell: shellPOSIX, SeparadorRuta: "/", RaizPersonal: "/Users"}
+)
+
+/*
+Funciòn que obtiene el dialecto que corresponde al sistema operativo registrado en la base de datos
+@sistemaOperativo Paràmetro que contiene el sistema operativo. Por ejemplo: Windows, Linux, Mac o Windows PowerShell
+@porDefecto Paràmetro que contiene el dialecto a usar cuando el sistema operativo no se reconoce
+*/
+func dialectoPorSistema(sistemaOperativo string, porDefecto dialectoHost) dialectoHost {
+	so := strings.ToLower(sistemaOperativo)
+	switch {
+	case strings.Contains(so, "powershell"):
+		return dialectoWindowsPowerShell
+	case strings.Contains(so, "windows"):
+		return dialectoWindows
+	case strings.Contains(so, "mac"), strings.Contains(so, "darwin"), strings.Contains(so, "os x"):
+		return dialectoMac
+	case strings.Contains(so, "linux"), strings.Contains(so, "ubuntu"), strings.Contains(so, "debian"):
+		return dialectoLinux
+	}
+	return porDefecto
+}
+
+/*
+Funciòn que obtiene el dialecto de un host de VirtualBox a partir de su campo Sistema_operativo.
+Los hosts sin sistema operativo registrado se consideran Windows, como en las primeras versiones de la plataforma
+@host Paràmetro que contiene el host
+*/
+func dialectoDeHost(host Host) dialectoHost {
+	return dialectoPorSistema(host.Sistema_operativo, dialectoWindows)
+}
+
+/*
+Funciòn que obtiene el dialecto de una màquina que ejecuta Docker dada su direcciòn IP.
+La màquina puede ser un host registrado o una màquina virtual de la plataforma; en otro caso se considera Linux
+@ip Paràmetro que contiene la direcciòn IP de la màquina
+*/
+func dialectoDeMaquina(ip string) dialectoHost {
+	if host, err := isAHostIp(ip); err == nil {
+		return dialectoDeHost(host)
+	}
+
+	var sistemaOperativo string
+	err := db.QueryRow("SELECT d.sistema_operativo FROM maquina_virtual m JOIN disco d ON m.disco_id = d.id WHERE m.ip = ? LIMIT 1", ip).Scan(&sistemaOperativo)
+	if err != nil && err != sql.ErrNoRows {
+		logger.Println("Error al consultar el sistema operativo de la màquina:", err)
+	}
+	return dialectoPorSistema(sistemaOperativo, dialectoLinux)
+}
+
+/*
+Funciòn que une los elementos de una ruta con el separador del sistema operativo
+@partes Paràmetro que contiene los elementos de la ruta
+*/
+func (d dialectoHost) unirRuta(partes ...string) string {
+	limpias := make([]string, 0, len(partes))
+	for i, parte := range partes {
+		if i > 0 {
+			parte = strings.TrimLeft(parte, "/\\")
+		}
+		if i < len(partes)-1 {
+			parte = strings.TrimRight(parte, "/\\")
+		}
+		//Una raìz como primer elemento se conserva como elemento vacìo para que la ruta empiece con el separador
+		if parte != "" || (i == 0 && partes[0] != "") {
+			limpias = append(limpias, parte)
+		}
+	}
+	if len(limpias) == 1 && limpias[0] == "" {
+		return d.SeparadorRuta
+	}
+	return strings.Join(limpias, d.SeparadorRuta)
+}
+
+/*
+Funciòn que obtiene el directorio que contiene un archivo. Acepta rutas con cualquiera de los dos separadores
+@ruta Paràmetro que contiene la ruta del archivo
+*/
+func (d dialectoHost) directorioDe(ruta string) string {
+	i := strings.LastIndexAny(ruta, "/\\")
+	if i < 0 {
+		return ""
+	}
+	if i == 0 {
+		return ruta[:1]
+	}
+	return ruta[:i]
+}
+
+/*
+Funciòn que obtiene la carpeta personal de un usuario del sistema operativo
+@usuario Paràmetro que contiene el nombre del usuario
+*/
+func (d dialectoHost) directorioPersonal(usuario string) string {
+	return d.unirRuta(d.RaizPersonal, usuario)
+}
+
+/*
+Funciòn que retorna el comando para crear un directorio junto con los directorios intermedios que no existan
+@ruta Paràmetro que contiene el directorio a crear
+*/
+func (d dialectoHost) crearDirectorio(ruta string) comandoRemoto {
+	if d.Sistema == "Windows" {
+		//mkdir de cmd.exe crea los directorios intermedios cuando las extensiones de comandos estàn activas
+		return nuevoComando("cmd", "/c", "if", "not", "exist", ruta, "mkdir", ruta)
+	}
+	return nuevoComando("mkdir", "-p", ruta)
+}
+
+/*
+Funciòn que retorna el comando para descomprimir un archivo zip en un directorio
+@archivo Paràmetro que contiene la ruta del archivo comprimido
+@destino Paràmetro que contiene el directorio en el que se extraen los archivos
+*/
+func (d dialectoHost) descomprimir(archivo string, destino string) comandoRemoto {
+	if d.Sistema == "Windows" {
+		//tar.exe (bsdtar) viene incluido desde Windows 10 y soporta archivos zip
+		return nuevoComando("tar", "-xf", archivo, "-C", destino)
+	}
+	return nuevoComando("unzip", "-o", archivo, "-d", destino)
+}
+
+/*
+Funciòn que retorna el comando para guardar en un archivo los datos recibidos por la entrada estàndar
+@ruta Paràmetro que contiene la ruta del archivo a crear. No puede contener comillas simples
+*/
+func (d dialectoHost) escribirArchivo(ruta string) comandoRemoto {
+	if d.Sistema == "Windows" {
+		//cmd.exe no tiene un equivalente a cat que conserve los datos binarios, por lo que se copia la entrada con .NET
+		return nuevoComando("powershell", "-NoProfile", "-NonInteractive", "-Command",
+			"$entrada=[Console]::OpenStandardInput(); $archivo=[IO.File]::Create('"+ruta+"'); $entrada.CopyTo($archivo); $archivo.Close()")
+	}
+	return nuevoComando("sh", "-c", `cat > "$1"`, "sh", ruta)
+}
+
+/*
+Funciòn que retorna el comando para enviar el contenido de un archivo por la salida estàndar
+@ruta Paràmetro que contiene la ruta del archivo a leer. No puede contener comillas simples
+*/
+func (d dialectoHost) leerArchivo(ruta string) comandoRemoto {
+	if d.Sistema == "Windows" {
+		return nuevoComando("powershell", "-NoProfile", "-NonInteractive", "-Command",
+			"$archivo=[IO.File]::OpenRead('"+ruta+"'); $salida=[Console]::OpenStandardOutput(); $archivo.CopyTo($salida); $salida.Flush(); $archivo.Close()")
+	}
+	return nuevoComando("cat", ruta)
+}
+
+/*
+Funciòn que retorna el comando para eliminar un archivo. No falla si el archivo no existe
+@ruta Paràmetro que contiene la ruta del archivo a eliminar
+*/
+func (d dialectoHost) eliminarArchivo(ruta string) comandoRemoto {
+	if d.Sistema == "Windows" {
+		return nuevoComando("cmd", "/c", "if", "exist", ruta, "del", "/f", "/q", ruta)
+	}
+	return nuevoComando("rm", "-f", ruta)
+}
+
+/*
+Funciòn que retorna el comando para consultar la tabla de vecinos (ARP y NDP) del host
+*/
+func (d dialectoHost) tablaVecinos() comandoRemoto {
+	switch d.Sistema {
+	case "Windows":
+		return nuevoComando("arp", "-a")
+	case "Mac":
+		return nuevoComando("arp", "-an")
+	}
+	return nuevoComando("ip", "neigh", "show")
+}
+
+/*
+Funciòn que construye el comando con las reglas de citado del dialecto y lo envìa por SSH
+@ip Paràmetro que contiene la direcciòn IP de la màquina
+@comando Paràmetro que contiene el comando a ejecutar
+@config Paràmetro que contiene la configuraciòn SSH
+@tiempo Paràmetro que contiene el tiempo màximo que puede tardar el comando
+*/
+func (d dialectoHost) ejecutar(ip string, comando comandoRemoto, config *ssh.ClientConfig, tiempo time.Duration) (string, error) {
+	return ejecutarComandoConTiempo(ip, d.Shell, comando, config, tiempo)
+}
+
+/*
+Funciòn que ejecuta un comando en un host de VirtualBox usando el dialecto de su sistema operativo
+@host Paràmetro que contiene el host en el cual se ejecuta el comando
+@config Paràmetro que contiene la configuraciòn SSH
+@comando Paràmetro que contiene el comando a ejecutar
+*/
+func ejecutarEnHost(host Host, config *ssh.ClientConfig, comando comandoRemoto) (string, error) {
+	return dialectoDeHost(host).ejecutar(host.Ip, comando, config, tiempoComandoSSH)
+}
+
+/*
+Funciòn que copia un archivo generado por el servidor a una ruta del host
+@host Paràmetro que contiene el host de destino
+@config Paràmetro que contiene la configuraciòn SSH
+@ruta Paràmetro que contiene la ruta del archivo en el host
+@datos Paràmetro que contiene el contenido del archivo
+*/
+func copiarArchivoAHost(host Host, config *ssh.ClientConfig, ruta string, datos []byte) error {
+	return copiarFlujoAHost(host, config, ruta, bytes.NewReader(datos), tiempoComandoSSH)
+}
+
+/*
+Funciòn que copia a una ruta del host los datos leìdos de un flujo, sin cargarlos completos en memoria
+@entrada Paràmetro que contiene el flujo con el contenido del archivo
+@tiempo Paràmetro que contiene el tiempo màximo que puede tardar la copia
+*/
+func copiarFlujoAHost(host Host, config *ssh.ClientConfig, ruta string, entrada io.Reader, tiempo time.Duration) error {
+	if strings.Contains(ruta, "'") {
+		return errArgumentoNoSeguro
+	}
+	dialecto := dialectoDeHost(host)
+	texto, err := dialecto.escribirArchivo(ruta).construir(dialecto.Shell)
+	if err != nil {
+		return err
+	}
+	_, err = enviarComandoSSHConEntrada(host.Ip, texto, config, tiempo, entrada)
+	return err
+}
+
+/*
+Funciòn que escribe en el destino indicado el contenido de un archivo del host
+@ruta Paràmetro que contiene la ruta del archivo en el host
+@salida Paràmetro que recibe el contenido del archivo
+@tiempo Paràmetro que contiene el tiempo màximo que puede tardar la copia
+*/
+func copiarArchivoDeHost(host Host, config *ssh.ClientConfig, ruta string, salida io.Writer, tiempo time.Duration) error {
+	if strings.Contains(ruta, "'") {
+		return errArgumentoNoSeguro
+	}
+	dialecto := dialectoDeHost(host)
+	texto, err := dialecto.leerArchivo(ruta).construir(dialecto.Shell)
+	if err != nil {
+		return err
+	}
+	return enviarComandoSSHConSalida(host.Ip, texto, config, tiempo, salida)
+}
+
+/*
+Funciòn que obtiene la carpeta en la que estàn los discos de un host, a partir de los discos registrados en la base de datos.
+Los archivos que la plataforma genera en el host (imàgenes de cloud-init, exportaciones OVA) se guardan en esa carpeta
+@host Paràmetro que contiene el host
+*/
+func directorioDiscosHost(host Host) (string, error) {
+	var ruta string
+	if err := db.QueryRow("SELECT ruta_ubicacion FROM disco WHERE host_id = ? ORDER BY id LIMIT 1", host.Id).Scan(&ruta); err != nil {
+		return "", err
+	}
+	return dialectoDeHost(host).directorioDe(ruta), nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import "testing"
+
+func TestDialectoPorSistema(t *testing.T) {
+	casos := []struct {
+		sistema  string
+		esperado dialectoHost
+	}{
+		{"Windows", dialectoWindows},
+		{"windows 11 pro", dialectoWindows},
+		{"Windows PowerShell", dialectoWindowsPowerShell},
+		{"POWERSHELL", dialectoWindowsPowerShell},
+		{"Linux", dialectoLinux},
+		{"Ubuntu 22.04", dialectoLinux},
+		{"debian", dialectoLinux},
+		{"Mac", dialectoMac},
+		{"macOS Sonoma", dialectoMac},
+		{"Darwin", dialectoMac},
+		{"Mac OS X", dialectoMac},
+		//Los sistemas no reconocidos usan el dialecto por defecto
+		{"", dialectoLinux},
+		{"FreeBSD", dialectoLinux},
+	}
+	for _, caso := range casos {
+		if dialecto := dialectoPorSistema(caso.sistema, dialectoLinux); dialecto != caso.esperado {
+			t.Errorf("dialectoPorSistema(%q) = %+v, se esperaba %+v", caso.sistema, dialecto, caso.esperado)
+		}
+	}
+
+	if dialecto := dialectoPorSistema("", dialectoWindows); dialecto != dialectoWindows {
+		t.Errorf("dialectoPorSistema sin sistema = %+v, se esperaba el dialecto por defecto", dialecto)
+	}
+	if dialecto := dialectoDeHost(Host{}); dialecto != dialectoWindows {
+		t.Errorf("dialectoDeHost sin sistema = %+v, se esperaba Windows", dialecto)
+	}
+}
+
+func TestUnirRuta(t *testing.T) {
+	casos := []struct {
+		nombre   string
+		dialecto dialectoHost
+		partes   []string
+		esperado string
+	}{
+		{"Linux", dialectoLinux, []string{"/home/user", "VMs", "disco.vdi"}, "/home/user/VMs/disco.vdi"},
+		{"Linux separadores repetidos", dialectoLinux, []string{"/home/user/", "/VMs/", "/disco.vdi"}, "/home/user/VMs/disco.vdi"},
+		{"Linux partes vacìas", dialectoLinux, []string{"/home/user", "", "disco.vdi"}, "/home/user/disco.vdi"},
+		{"Linux raìz", dialectoLinux, []string{"/", "disco.vdi"}, "/disco.vdi"},
+		{"Linux solo raìz", dialectoLinux, []string{"/", ""}, "/"},
+		{"Linux relativa", dialectoLinux, []string{"VMs", "disco.vdi"}, "VMs/disco.vdi"},
+		{"Linux sin partes", dialectoLinux, nil, ""},
+		{"Windows", dialectoWindows, []string{`C:\Users\user`, "VMs", "disco.vdi"}, `C:\Users\user\VMs\disco.vdi`},
+		{"Windows separadores mezclados", dialectoWindows, []string{`C:\Users\user\`, "/VMs/", `\disco.vdi`}, `C:\Users\user\VMs\disco.vdi`},
+		{"Windows con espacios", dialectoWindowsPowerShell, []string{`C:\Users\user`, "VirtualBox VMs"}, `C:\Users\user\VirtualBox VMs`},
+		{"Mac", dialectoMac, []string{"/Users/user", "VMs"}, "/Users/user/VMs"},
+		//El ùltimo elemento conserva su separador final
+		{"separador final", dialectoLinux, []string{"/home/user", "VMs/"}, "/home/user/VMs/"},
+	}
+	for _, caso := range casos {
+		t.Run(caso.nombre, func(t *testing.T) {
+			if ruta := caso.dialecto.unirRuta(caso.partes...); ruta != caso.esperado {
+				t.Errorf("unirRuta(%q) = %q, se esperaba %q", caso.partes, ruta, caso.esperado)
+			}
+		})
+	}
+}
+
+func TestDirectorioDe(t *testing.T) {
+	casos := []struct {
+		ruta     string
+		esperado string
+	}{
+		{"/home/user/VMs/disco.vdi", "/home/user/VMs"},
+		{`C:\Users\user\VMs\disco.vdi`, `C:\Users\user\VMs`},
+		{`C:\Users\user/VMs\disco.vdi`, `C:\Users\user/VMs`},
+		{"/disco.vdi", "/"},
+		{"disco.vdi", ""},
+	}
+	for _, caso := range casos {
+		if directorio := dialectoLinux.directorioDe(caso.ruta); directorio != caso.esperado {
+			t.Errorf("directorioDe(%q) = %q, se esperaba %q", caso.ruta, directorio, caso.esperado)
+		}
+	}
+
+	//La ruta del directorio vuelve a unirse con el nombre del archivo
+	if ruta := dialectoLinux.unirRuta(dialectoLinux.directorioDe("/disco.vdi"), "clon.vdi"); ruta != "/clon.vdi" {
+		t.Errorf("unirRuta(directorioDe(/disco.vdi)) = %q, se esperaba /clon.vdi", ruta)
+	}
+}
+
+func TestDirectorioPersonal(t *testing.T) {
+	casos := []struct {
+		dialecto dialectoHost
+		esperado string
+	}{
+		{dialectoWindows, `C:\Users\user`},
+		{dialectoWindowsPowerShell, `C:\Users\user`},
+		{dialectoLinux, "/home/user"},
+		{dialectoMac, "/Users/user"},
+	}
+	for _, caso := range casos {
+		if directorio := caso.dialecto.directorioPersonal("user"); directorio != caso.esperado {
+			t.Errorf("directorioPersonal en %s = %q, se esperaba %q", caso.dialecto.Sistema, directorio, caso.esperado)
+		}
+	}
+}
@@ -0,0 +1,457 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+/*
+Estructura de datos tipo JSON que representa una direcciòn IP de una MV
+@Tarjeta Representa el nùmero del adaptador de red de la MV (1 a 8). Es 0 si no se pudo asociar a un adaptador
+@Mac Representa la direcciòn MAC del adaptador, con el formato 08:00:27:ab:cd:ef
+@Ip Representa la direcciòn IP
+@Version Representa la versiòn del protocolo: 4 ò 6
+@Origen Representa de dònde se obtuvo la direcciòn: invitado (Guest Additions), dhcp (servidor DHCP de VirtualBox) ò arp (tabla de vecinos del host)
+*/
+type DireccionMV struct {
+	Tarjeta int
+	Mac     string
+	Ip      string
+	Version int
+	Origen  string
+}
+
+// Tiempo màximo de espera de la direcciòn IP al encender una MV, tiempo de cada espera de guestproperty wait
+// e intervalo con el que se actualizan las direcciones de las MV encendidas
+const (
+	tiempoEsperaIP            = 3 * time.Minute
+	tiempoEsperaPropiedad     = 15 * time.Second
+	intervaloActualizacionIPs = time.Minute
+)
+
+var (
+	patronPropiedadRed = regexp.MustCompile(`^/VirtualBox/GuestInfo/Net/(\d+)/(V4/IP|V6/IP|MAC|Status)$`)
+	patronMac          = regexp.MustCompile(`(?i)\b([0-9a-f]{1,2}[:-]){5}[0-9a-f]{1,2}\b`)
+
+	//Evita que una actualizaciòn de direcciones empiece antes de que termine la anterior
+	muActualizacionIPs sync.Mutex
+)
+
+/*
+Funciòn que normaliza una direcciòn MAC al formato 08:00:27:ab:cd:ef. Acepta el formato de VirtualBox (080027ABCDEF),
+el de Windows (08-00-27-ab-cd-ef) y el de Mac, que omite los ceros a la izquierda (8:0:27:ab:cd:ef)
+@mac Paràmetro que contiene la direcciòn MAC
+@return Retorna la direcciòn normalizada, o una cadena vacìa si no es vàlida
+*/
+func normalizarMac(mac string) string {
+	mac = strings.ToLower(strings.TrimSpace(mac))
+	var octetos []string
+	if len(mac) == 12 && !strings.ContainsAny(mac, ":-") {
+		for i := 0; i < 12; i += 2 {
+			octetos = append(octetos, mac[i:i+2])
+		}
+	} else {
+		octetos = strings.FieldsFunc(mac, func(r rune) bool { return r == ':' || r == '-' })
+	}
+	if len(octetos) != 6 {
+		return ""
+	}
+	for i, octeto := range octetos {
+		if len(octeto) == 1 {
+			octeto = "0" + octeto
+		}
+		if _, err := strconv.ParseUint(octeto, 16, 8); err != nil {
+			return ""
+		}
+		octetos[i] = octeto
+	}
+	return strings.Join(octetos, ":")
+}
+
+/*
+Funciòn que verifica si una direcciòn IP sirve para conectarse a la MV. Se descartan las direcciones de enlace local
+(169.254.x.x y fe80::), que la MV se asigna a sì misma cuando no obtiene respuesta del servidor DHCP
+@ip Paràmetro que contiene la direcciòn
+@return Retorna la versiòn de la direcciòn (4 ò 6), ò 0 si no es ùtil
+*/
+func versionDireccionUtil(ip string) int {
+	direccion := net.ParseIP(strings.TrimSpace(ip))
+	if direccion == nil || direccion.IsUnspecified() || direccion.IsLoopback() || direccion.IsLinkLocalUnicast() || direccion.IsMulticast() {
+		return 0
+	}
+	if direccion.To4() != nil {
+		return 4
+	}
+	return 6
+}
+
+/*
+Funciòn que obtiene las direcciones IP que reportan las Guest Additions en las propiedades /VirtualBox/GuestInfo/Net/.
+El ìndice de las propiedades es el de las interfaces del sistema operativo invitado, por lo que se asocian a los adaptadores por su MAC
+@propiedades Paràmetro que contiene las propiedades de red de la MV
+@info Paràmetro que contiene la informaciòn de la MV en VirtualBox
+*/
+func direccionesInvitado(propiedades []propiedadInvitado, info infoMV) []DireccionMV {
+
+	type interfaz struct {
+		mac, estado string
+		ips         []string
+	}
+	interfaces := make(map[string]*interfaz)
+	for _, propiedad := range propiedades {
+		coincidencia := patronPropiedadRed.FindStringSubmatch(propiedad.Nombre)
+		if coincidencia == nil {
+			continue
+		}
+		actual, ok := interfaces[coincidencia[1]]
+		if !ok {
+			actual = &interfaz{}
+			interfaces[coincidencia[1]] = actual
+		}
+		switch coincidencia[2] {
+		case "MAC":
+			actual.mac = normalizarMac(propiedad.Valor)
+		case "Status":
+			actual.estado = propiedad.Valor
+		default:
+			actual.ips = append(actual.ips, propiedad.Valor)
+		}
+	}
+
+	tarjetas := make(map[string]int)
+	for _, tarjeta := range info.Tarjetas {
+		tarjetas[normalizarMac(tarjeta.Mac)] = tarjeta.Numero
+	}
+
+	var direcciones []DireccionMV
+	for _, actual := range interfaces {
+		if strings.EqualFold(actual.estado, "Down") {
+			continue
+		}
+		for _, ip := range actual.ips {
+			if version := versionDireccionUtil(ip); version != 0 {
+				direcciones = append(direcciones, DireccionMV{Tarjeta: tarjetas[actual.mac], Mac: actual.mac, Ip: strings.TrimSpace(ip), Version: version, Origen: "invitado"})
+			}
+		}
+	}
+	return direcciones
+}
+
+/*
+Funciòn que interpreta la tabla de vecinos del host: ip neigh en Linux y arp -a en Windows y Mac
+@salida Paràmetro que contiene la salida del comando
+@return Retorna las direcciones IP de cada direcciòn MAC normalizada
+*/
+func parsearTablaVecinos(salida string) map[string][]string {
+	vecinos := make(map[string][]string)
+	for _, linea := range strings.Split(salida, "\n") {
+		mac := normalizarMac(patronMac.FindString(linea))
+		if mac == "" {
+			continue
+		}
+		for _, campo := range strings.Fields(linea) {
+			campo = strings.Trim(campo, "()")
+			if net.ParseIP(campo) != nil {
+				vecinos[mac] = append(vecinos[mac], campo)
+				break
+			}
+		}
+	}
+	return vecinos
+}
+
+/*
+Funciòn que busca en el host las direcciones de los adaptadores de una MV cuando las Guest Additions no las reportan.
+Las redes host-only y NAT se consultan en el servidor DHCP de VirtualBox y las MV en modo puente en la tabla de vecinos del host.
+Las MV en modo NAT y en redes internas no son visibles desde el host
+@host Paràmetro que contiene el host en el cual està la MV
+@config Paràmetro que contiene la configuraciòn SSH
+@info Paràmetro que contiene la informaciòn de la MV en VirtualBox
+*/
+func direccionesDesdeHost(host Host, config *ssh.ClientConfig, info infoMV) []DireccionMV {
+
+	var direcciones []DireccionMV
+	var vecinos map[string][]string
+	for _, tarjeta := range info.Tarjetas {
+		mac := normalizarMac(tarjeta.Mac)
+		if mac == "" {
+			continue
+		}
+		switch tarjeta.Tipo {
+		case "hostonly", "natnetwork":
+			opcion := "--interface=" + tarjeta.Red
+			if tarjeta.Tipo == "natnetwork" {
+				opcion = "--network=" + tarjeta.Red
+			}
+			salida, err := ejecutarVBoxManage(host, config, "dhcpserver", "findlease", opcion, "--mac-address="+mac)
+			if err != nil {
+				continue
+			}
+			for _, linea := range strings.Split(salida, "\n") {
+				linea = strings.TrimSpace(linea)
+				if !strings.HasPrefix(linea, "IP Address:") {
+					continue
+				}
+				valor := strings.TrimSpace(strings.TrimPrefix(linea, "IP Address:"))
+				if version := versionDireccionUtil(valor); version != 0 {
+					direcciones = append(direcciones, DireccionMV{Tarjeta: tarjeta.Numero, Mac: mac, Ip: valor, Version: version, Origen: "dhcp"})
+				}
+			}
+
+		case "bridged":
+			if vecinos == nil {
+				salida, err := ejecutarEnHost(host, config, dialectoDeHost(host).tablaVecinos())
+				if err != nil {
+					log.Println("Error al consultar la tabla de vecinos del host:", err)
+					vecinos = map[string][]string{}
+					continue
+				}
+				vecinos = parsearTablaVecinos(salida)
+			}
+			for _, ip := range vecinos[mac] {
+				if version := versionDireccionUtil(ip); version != 0 {
+					direcciones = append(direcciones, DireccionMV{Tarjeta: tarjeta.Numero, Mac: mac, Ip: ip, Version: version, Origen: "arp"})
+				}
+			}
+		}
+	}
+	return direcciones
+}
+
+/*
+Funciòn que consulta las direcciones actuales de una MV encendida: primero las reportadas por las Guest Additions y,
+si no hay ninguna, las que conoce el host
+@host Paràmetro que contiene el host en el cual està la MV
+@config Paràmetro que contiene la configuraciòn SSH
+@nameVM Paràmetro que contiene el nombre de la MV
+*/
+func descubrirDireccionesMV(host Host, config *ssh.ClientConfig, nameVM string) ([]DireccionMV, error) {
+
+	info, err := obtenerInfoMV(host, config, nameVM)
+	if err != nil {
+		return nil, err
+	}
+	propiedades, err := enumerarPropiedadesInvitado(host, config, nameVM, "/VirtualBox/GuestInfo/Net/")
+	if err != nil {
+		return nil, err
+	}
+
+	direcciones := direccionesInvitado(propiedades, info)
+	if len(direcciones) == 0 {
+		direcciones = direccionesDesdeHost(host, config, info)
+	}
+	sort.SliceStable(direcciones, func(i, j int) bool {
+		if direcciones[i].Tarjeta != direcciones[j].Tarjeta {
+			return direcciones[i].Tarjeta < direcciones[j].Tarjeta
+		}
+		return direcciones[i].Version < direcciones[j].Version
+	})
+	return direcciones, nil
+}
+
+/*
+Funciòn que espera a que una MV reciè encendida tenga una direcciòn IP. Entre consultas usa guestproperty wait,
+que termina en cuanto las Guest Additions publican un cambio en la red, en lugar de esperar un tiempo fijo
+@host Paràmetro que contiene el host en el cual està la MV
+@config Paràmetro que contiene la configuraciòn SSH
+@nameVM Paràmetro que contiene el nombre de la MV
+@limite Paràmetro que contiene el tiempo màximo de espera
+@return Retorna las direcciones de la MV, o ninguna si no se obtuvo una direcciòn en el tiempo lìmite
+*/
+func esperarDireccionesMV(host Host, config *ssh.ClientConfig, nameVM string, limite time.Duration) []DireccionMV {
+
+	maxEspera := time.Now().Add(limite)
+	for {
+		direcciones, err := descubrirDireccionesMV(host, config, nameVM)
+		if err != nil {
+			log.Println("Error al consultar las direcciones de la MV:", err)
+		}
+		if direccionPrincipal(direcciones) != "" || time.Now().After(maxEspera) {
+			return direcciones
+		}
+
+		fmt.Println("Obteniendo direcciòn IP de la màquina " + nameVM + "...")
+		//Sin --fail-on-timeout el comando termina sin error al cumplirse el tiempo de espera
+		inicio := time.Now()
+		ejecutarVBoxManage(host, config, "guestproperty", "wait", nameVM, "/VirtualBox/GuestInfo/Net/*", "--timeout", strconv.Itoa(int(tiempoEsperaPropiedad/time.Millisecond)))
+		if transcurrido := time.Since(inicio); transcurrido < time.Second {
+			time.Sleep(time.Second - transcurrido)
+		}
+	}
+}
+
+/*
+Funciòn que elige la direcciòn que se muestra como la IP de la MV: la primera IPv4 del adaptador 1,
+luego cualquier IPv4 y por ùltimo cualquier IPv6
+@direcciones Paràmetro que contiene las direcciones de la MV ordenadas por adaptador
+*/
+func direccionPrincipal(direcciones []DireccionMV) string {
+	for _, direccion := range direcciones {
+		if direccion.Tarjeta <= 1 && direccion.Version == 4 {
+			return direccion.Ip
+		}
+	}
+	for _, direccion := range direcciones {
+		if direccion.Version == 4 {
+			return direccion.Ip
+		}
+	}
+	if len(direcciones) > 0 {
+		return direcciones[0].Ip
+	}
+	return ""
+}
+
+/*
+Funciòn que guarda las direcciones de una MV en la base de datos y actualiza su direcciòn IP principal si cambiò
+@maquinaVirtual Paràmetro que contiene la MV
+@direcciones Paràmetro que contiene las direcciones actuales de la MV
+*/
+func registrarDireccionesMV(maquinaVirtual Maquina_virtual, direcciones []DireccionMV) {
+
+	principal := direccionPrincipal(direcciones)
+	if principal == "" {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Println("Error al registrar las direcciones de la MV:", err)
+		return
+	}
+	tx.Exec("DELETE FROM direccion_mv WHERE maquina_virtual_uuid = ?", maquinaVirtual.Uuid)
+	ahora := time.Now().UTC().Format("2006-01-02 15:04:05")
+	for _, direccion := range direcciones {
+		if _, err := tx.Exec("INSERT IGNORE INTO direccion_mv (maquina_virtual_uuid, tarjeta, mac, ip, version, origen, fecha_actualizacion) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			maquinaVirtual.Uuid, direccion.Tarjeta, direccion.Mac, direccion.Ip, direccion.Version, direccion.Origen, ahora); err != nil {
+			log.Println("Error al registrar la direcciòn de la MV:", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Println("Error al registrar las direcciones de la MV:", err)
+		return
+	}
+
+	if principal != maquinaVirtual.Ip {
+		if _, err := db.Exec("UPDATE maquina_virtual set ip = ? WHERE uuid = ?", principal, maquinaVirtual.Uuid); err != nil {
+			log.Println("Error al realizar la actualizaciòn de la IP", err)
+			return
+		}
+		if maquinaVirtual.Ip != "" {
+			log.Println("La direcciòn IP de la màquina " + maquinaVirtual.Nombre + " cambiò de " + maquinaVirtual.Ip + " a " + principal)
+		}
+	}
+}
+
+/*
+Funciòn que elimina las direcciones guardadas de una MV apagada o eliminada
+@uuidVM Paràmetro que contiene el uuid de la MV
+*/
+func eliminarDireccionesMV(uuidVM string) {
+	if _, err := db.Exec("DELETE FROM direccion_mv WHERE maquina_virtual_uuid = ?", uuidVM); err != nil {
+		log.Println("Error al eliminar las direcciones de la MV:", err)
+	}
+}
+
+/*
+Funciòn que consulta las direcciones guardadas de una MV
+@uuidVM Paràmetro que contiene el uuid de la MV
+*/
+func consultDireccionesMV(uuidVM string) ([]DireccionMV, error) {
+
+	rows, err := db.Query("SELECT tarjeta, mac, ip, version, origen FROM direccion_mv WHERE maquina_virtual_uuid = ? ORDER BY tarjeta, version", uuidVM)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var direcciones []DireccionMV
+	for rows.Next() {
+		var direccion DireccionMV
+		if err := rows.Scan(&direccion.Tarjeta, &direccion.Mac, &direccion.Ip, &direccion.Version, &direccion.Origen); err != nil {
+			log.Println("Error al obtener la fila")
+			continue
+		}
+		direcciones = append(direcciones, direccion)
+	}
+	return direcciones, rows.Err()
+}
+
+/*
+Funciòn que establece un disparador que actualiza periòdicamente las direcciones de las MV encendidas
+*/
+func checkDireccionesIP() {
+
+	timeTicker := time.NewTicker(intervaloActualizacionIPs)
+
+	for range timeTicker.C {
+		go actualizarDireccionesIP()
+	}
+}
+
+/*
+Funciòn que consulta las direcciones de todas las MV encendidas y guarda las que cambiaron. Las MV se agrupan por host
+para consultar una sola vez la lista de MV en ejecuciòn de cada uno
+*/
+func actualizarDireccionesIP() {
+
+	if !muActualizacionIPs.TryLock() {
+		return
+	}
+	defer muActualizacionIPs.Unlock()
+
+	rows, err := db.Query("SELECT uuid, nombre, ip, host_id FROM maquina_virtual WHERE estado = ?", estadoEncendido)
+	if err != nil {
+		log.Println("Error al consultar las MV encendidas:", err)
+		return
+	}
+	porHost := make(map[int][]Maquina_virtual)
+	for rows.Next() {
+		var maquinaVirtual Maquina_virtual
+		if err := rows.Scan(&maquinaVirtual.Uuid, &maquinaVirtual.Nombre, &maquinaVirtual.Ip, &maquinaVirtual.Host_id); err == nil {
+			porHost[maquinaVirtual.Host_id] = append(porHost[maquinaVirtual.Host_id], maquinaVirtual)
+		}
+	}
+	rows.Close()
+
+	for idHost, maquinas := range porHost {
+		host, err := getHost(idHost)
+		if err != nil {
+			continue
+		}
+		config, err := configurarSSH(host.Hostname, *privateKeyPath)
+		if err != nil {
+			continue
+		}
+		encendidas, err := listarMVsHost(host, config, true)
+		if err != nil {
+			log.Println("Error al consultar las MV encendidas del host "+host.Nombre+":", err)
+			continue
+		}
+		enEjecucion := make(map[string]bool)
+		for _, mv := range encendidas {
+			enEjecucion[mv.Nombre] = true
+		}
+
+		for _, maquinaVirtual := range maquinas {
+			if !enEjecucion[maquinaVirtual.Nombre] {
+				continue
+			}
+			direcciones, err := descubrirDireccionesMV(host, config, maquinaVirtual.Nombre)
+			if err != nil {
+				log.Println("Error al consultar las direcciones de la MV "+maquinaVirtual.Nombre+":", err)
+				continue
+			}
+			registrarDireccionesMV(maquinaVirtual, direcciones)
+		}
+	}
+}
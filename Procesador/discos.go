@@ -0,0 +1,667 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+/*
+Estructura de datos tipo JSON que representa un disco de datos adicional de una màquina virtual
+@Id Representa el identificador ùnico del disco en la base de datos
+@Nombre Representa el nombre del disco
+@Ruta_ubicacion Representa la ubicaciòn del archivo del disco en el host
+@Tamanio Representa la capacidad del disco en mb
+@Maquina_virtual_uuid Representa el uuid de la MV a la que està conectado el disco. Està vacìo si el disco està desconectado
+@Persona_email Representa el email del propietario del disco
+@Host_id Representa el identificador ùnico del host en el cual està el disco
+@Puerto Representa el puerto del controlador de almacenamiento al que està conectado el disco
+@Fecha_creacion Representa el momento en el que se creò el disco
+*/
+type DiscoDatos struct {
+	Id                   int
+	Nombre               string
+	Ruta_ubicacion       string
+	Tamanio              int
+	Maquina_virtual_uuid string
+	Persona_email        string
+	Host_id              int
+	Puerto               int
+	Fecha_creacion       time.Time
+}
+
+// Cantidad de puertos del controlador SATA "hardisk". VirtualBox crea los controladores SATA con 30 puertos
+const puertosControladorDiscos = 30
+
+/*
+Funciòn que configura los endpoints para la gestiòn de discos de datos.
+Las solicitudes para crear, redimensionar, conectar, desconectar y eliminar discos se encolan en la cola de gestiòn
+*/
+func manejarDiscos() {
+
+	//Endpoints para crear, redimensionar, conectar, desconectar y eliminar discos de datos
+	encolarSolicitudDisco := func(tipoEsperado string, mensaje string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				http.Error(w, "Se requiere una solicitud POST", http.StatusMethodNotAllowed)
+				return
+			}
+
+			var datos map[string]interface{}
+			decoder := json.NewDecoder(r.Body)
+			if err := decoder.Decode(&datos); err != nil {
+				http.Error(w, "Error al decodificar JSON de la solicitud", http.StatusBadRequest)
+				return
+			}
+
+			tipoSolicitud, _ := datos["tipo_solicitud"].(string)
+			if tipoSolicitud != tipoEsperado {
+				http.Error(w, "El campo 'tipo_solicitud' debe ser '"+tipoEsperado+"'", http.StatusBadRequest)
+				return
+			}
+
+			email, _ := datos["email"].(string)
+			nombreVM, _ := datos["nombreVM"].(string)
+			idDisco, _ := datos["idDisco"].(float64)
+			tamanio, _ := datos["tamanio"].(float64)
+
+			//Las solicitudes sobre un disco existente solo las puede hacer su propietario o un administrador
+			var disco DiscoDatos
+			if tipoSolicitud != "create_disk" {
+				var estado int
+				var mensajeError string
+				disco, mensajeError, estado = validarPropietarioDisco(int(idDisco), email)
+				if estado != http.StatusOK {
+					http.Error(w, mensajeError, estado)
+					return
+				}
+			}
+
+			//Las solicitudes que reciben una MV solo las puede hacer su propietario o un administrador
+			if tipoSolicitud == "create_disk" || tipoSolicitud == "attach_disk" {
+				if err := validarNombre(nombreVM); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				if mensajeError, estado := validarPropietarioOAdministrador(nombreVM, email); estado != http.StatusOK {
+					http.Error(w, mensajeError, estado)
+					return
+				}
+			}
+
+			switch tipoSolicitud {
+			case "create_disk":
+				if nombreDisco, _ := datos["nombreDisco"].(string); nombreDisco != "" {
+					if err := validarNombre(nombreDisco); err != nil {
+						http.Error(w, err.Error(), http.StatusBadRequest)
+						return
+					}
+				}
+				if tamanio <= 0 {
+					http.Error(w, "El tamaño del disco debe ser mayor que 0", http.StatusBadRequest)
+					return
+				}
+				maquinaVirtual, _ := getVM(nombreVM)
+				if err := validarLimiteDiscosDatos(maquinaVirtual.Persona_email, int(tamanio)); err != nil {
+					http.Error(w, err.Error(), http.StatusForbidden)
+					return
+				}
+
+			case "resize_disk":
+				//VirtualBox solo permite aumentar la capacidad de los discos
+				if int(tamanio) <= disco.Tamanio {
+					http.Error(w, "El nuevo tamaño debe ser mayor que el tamaño actual del disco", http.StatusBadRequest)
+					return
+				}
+				if err := validarLimiteDiscosDatos(disco.Persona_email, int(tamanio)-disco.Tamanio); err != nil {
+					http.Error(w, err.Error(), http.StatusForbidden)
+					return
+				}
+
+			case "attach_disk":
+				if disco.Maquina_virtual_uuid != "" {
+					http.Error(w, "El disco ya está conectado a una máquina virtual", http.StatusConflict)
+					return
+				}
+
+			case "detach_disk":
+				if disco.Maquina_virtual_uuid == "" {
+					http.Error(w, "El disco no está conectado a una máquina virtual", http.StatusConflict)
+					return
+				}
+			}
+
+			// Encola las peticiones.
+			identificarMV(datos)
+			mu.Lock()
+			managementQueue.Queue.PushBack(datos)
+			mu.Unlock()
+
+			// Envía una respuesta al cliente.
+			response := map[string]string{"mensaje": mensaje}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(response)
+		}
+	}
+
+	http.HandleFunc("/json/createDisk", encolarSolicitudDisco("create_disk", "Mensaje JSON para crear el disco recibido correctamente"))
+	http.HandleFunc("/json/resizeDisk", encolarSolicitudDisco("resize_disk", "Mensaje JSON para redimensionar el disco recibido correctamente"))
+	http.HandleFunc("/json/attachDisk", encolarSolicitudDisco("attach_disk", "Mensaje JSON para conectar el disco recibido correctamente"))
+	http.HandleFunc("/json/detachDisk", encolarSolicitudDisco("detach_disk", "Mensaje JSON para desconectar el disco recibido correctamente"))
+	http.HandleFunc("/json/deleteDisk", encolarSolicitudDisco("delete_disk", "Mensaje JSON para eliminar el disco recibido correctamente"))
+
+	//Endpoint para consultar los discos de datos de un usuario. Los administradores ven todos los discos
+	http.HandleFunc("/json/consultDisks", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Se requiere una solicitud POST", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var persona Persona
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&persona); err != nil { //Solo llega el email
+			http.Error(w, "Error al decodificar JSON de la solicitud", http.StatusBadRequest)
+			return
+		}
+
+		persona, err := getUser(persona.Email)
+		if err != nil {
+			http.Error(w, "No se encontró el usuario", http.StatusNotFound)
+			return
+		}
+
+		var discos []DiscoDatos
+		if persona.Rol == "Administrador" {
+			discos, err = consultDiscosDatos("", nil)
+		} else {
+			discos, err = consultDiscosDatos("WHERE persona_email = ?", persona.Email)
+		}
+		if err != nil {
+			log.Println("Error al consultar los discos de datos:", err)
+			http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(discos)
+	})
+}
+
+/*
+Funciòn que verifica que el solicitante sea el propietario del disco de datos o un administrador
+@idDisco Paràmetro que contiene el identificador del disco
+@email Paràmetro que contiene el email del solicitante
+@return Retorna el disco, el mensaje de error y el còdigo HTTP correspondiente, o http.StatusOK si la solicitud està autorizada
+*/
+func validarPropietarioDisco(idDisco int, email string) (DiscoDatos, string, int) {
+	disco, err := getDiscoDatos(idDisco)
+	if err != nil {
+		return disco, "No se encontró el disco", http.StatusNotFound
+	}
+	if disco.Persona_email != email && !esAdministrador(email) {
+		return disco, "Solo el propietario del disco o un administrador pueden realizar esta operación", http.StatusForbidden
+	}
+	return disco, "", http.StatusOK
+}
+
+/*
+Funciòn que verifica que la capacidad adicional no supere la cuota de discos de datos del usuario
+@email Paràmetro que contiene el email del propietario de los discos
+@adicional Paràmetro que contiene la capacidad en mb que se quiere agregar
+*/
+func validarLimiteDiscosDatos(email string, adicional int) error {
+	propietario, err := getUser(email)
+	if err != nil {
+		return errors.New("no se pudo obtener el propietario del disco")
+	}
+
+	var usado int
+	if err := db.QueryRow("SELECT COALESCE(SUM(tamanio), 0) FROM disco_datos WHERE persona_email = ?", email).Scan(&usado); err != nil {
+		return errors.New("no se pudo consultar la capacidad de los discos del usuario")
+	}
+
+	cuota, _ := getCuota(propietario)
+	if adicional > 0 && superaCuota(cuota.Disco, usado+adicional) {
+		return fmt.Errorf("el usuario superarìa su cuota de %d mb en discos de datos (en uso: %d mb)", cuota.Disco, usado)
+	}
+	return nil
+}
+
+/*
+Funciòn que crea un disco de datos en la carpeta de discos del host, lo conecta a la MV y lo registra en la base de datos.
+La capacidad del disco se suma al almacenamiento usado del host, ya que el archivo puede crecer hasta ese tamaño
+@maquinaVirtual Paràmetro que contiene la MV a la que se conecta el disco
+@host Paràmetro que contiene el host en el cual està la MV
+@config Paràmetro que contiene la configuraciòn SSH
+@directorio Paràmetro que contiene la carpeta del host en la que se crea el archivo del disco
+@nombre Paràmetro que contiene el nombre del disco
+@tamanio Paràmetro que contiene la capacidad del disco en mb
+@puerto Paràmetro que contiene el puerto del controlador "hardisk" al que se conecta el disco
+*/
+func crearDiscoDatos(maquinaVirtual Maquina_virtual, host Host, config *ssh.ClientConfig, directorio string, nombre string, tamanio int, puerto int) (DiscoDatos, string) {
+
+	if host.Almacenamiento_usado+tamanio > host.Almacenamiento_total {
+		return DiscoDatos{}, "El host no tiene almacenamiento disponible para el disco"
+	}
+
+	//Los 4 caracteres aleatorios evitan que el archivo coincida con el de un disco desconectado de la misma MV
+	ruta := dialectoDeHost(host).unirRuta(directorio, maquinaVirtual.Nombre+"_"+nombre+"_"+generateRandomString(4)+".vdi")
+
+	if _, err := ejecutarVBoxManage(host, config, "createmedium", "disk", "--filename", ruta, "--size", strconv.Itoa(tamanio), "--format", "VDI"); err != nil {
+		log.Println("Error al crear el disco de datos:", err)
+		return DiscoDatos{}, "Error al crear el disco de datos: " + describirErrorSSH(err)
+	}
+
+	if _, err := ejecutarVBoxManage(host, config, "storageattach", maquinaVirtual.Nombre, "--storagectl", "hardisk", "--port", strconv.Itoa(puerto), "--device", "0", "--type", "hdd", "--medium", ruta); err != nil {
+		log.Println("Error al conectar el disco de datos:", err)
+		ejecutarVBoxManage(host, config, "closemedium", "disk", ruta, "--delete")
+		return DiscoDatos{}, "Error al conectar el disco de datos a la MV"
+	}
+
+	disco := DiscoDatos{
+		Nombre:               nombre,
+		Ruta_ubicacion:       ruta,
+		Tamanio:              tamanio,
+		Maquina_virtual_uuid: maquinaVirtual.Uuid,
+		Persona_email:        maquinaVirtual.Persona_email,
+		Host_id:              host.Id,
+		Puerto:               puerto,
+		Fecha_creacion:       time.Now().UTC(),
+	}
+	resultado, err := db.Exec("INSERT INTO disco_datos (nombre, ruta_ubicacion, tamanio, maquina_virtual_uuid, persona_email, host_id, puerto, fecha_creacion) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		disco.Nombre, disco.Ruta_ubicacion, disco.Tamanio, disco.Maquina_virtual_uuid, disco.Persona_email, disco.Host_id, disco.Puerto, disco.Fecha_creacion.Format("2006-01-02 15:04:05"))
+	if err != nil {
+		log.Println("Error al registrar el disco de datos en la base de datos:", err)
+		return DiscoDatos{}, "Error al registrar el disco de datos en la base de datos"
+	}
+	if id, err := resultado.LastInsertId(); err == nil {
+		disco.Id = int(id)
+	}
+
+	if _, err := db.Exec("UPDATE host SET almacenamiento_usado = almacenamiento_usado + ? WHERE id = ?", tamanio, host.Id); err != nil {
+		log.Println("Error al actualizar el almacenamiento usado del host:", err)
+	}
+
+	return disco, ""
+}
+
+/*
+Funciòn que crea un disco de datos solicitado por un usuario y lo conecta al primer puerto libre de la MV. La MV debe estar apagada
+@nameVM Paràmetro que contiene el nombre de la màquina virtual
+@nombreDisco Paràmetro que contiene el nombre del disco. Si està vacìo se usa "datos"
+@tamanio Paràmetro que contiene la capacidad del disco en mb
+*/
+func agregarDiscoDatos(nameVM string, nombreDisco string, tamanio int) string {
+
+	maquinaVirtual, err := getVM(nameVM)
+	if err != nil {
+		log.Println("Error al obtener la MV:", err)
+		return "Error al obtener la MV"
+	}
+
+	if err := validarLimiteDiscosDatos(maquinaVirtual.Persona_email, tamanio); err != nil {
+		log.Println(err)
+		return err.Error()
+	}
+
+	host, config, info, mensaje := prepararMVApagadaDiscos(maquinaVirtual)
+	if mensaje != "" {
+		return mensaje
+	}
+
+	puerto := puertoLibreDiscos(info)
+	if puerto == 0 {
+		return "La MV no tiene puertos libres para màs discos"
+	}
+
+	directorio, err := directorioDiscosHost(host)
+	if err != nil {
+		return "El host no tiene una carpeta de discos registrada"
+	}
+
+	if nombreDisco == "" {
+		nombreDisco = "datos"
+	}
+	if _, mensaje := crearDiscoDatos(maquinaVirtual, host, config, directorio, nombreDisco, tamanio, puerto); mensaje != "" {
+		return mensaje
+	}
+
+	fmt.Println("Disco de datos creado correctamente")
+	return "Disco de datos creado correctamente"
+}
+
+/*
+Funciòn que aumenta la capacidad de un disco de datos. Si el disco està conectado, la MV debe estar apagada.
+El sistema de archivos del disco se debe extender desde la MV
+@idDisco Paràmetro que contiene el identificador del disco
+@tamanio Paràmetro que contiene la nueva capacidad del disco en mb
+*/
+func redimensionarDiscoDatos(idDisco int, tamanio int) string {
+
+	disco, err := getDiscoDatos(idDisco)
+	if err != nil {
+		return "No se encontrò el disco"
+	}
+	if tamanio <= disco.Tamanio {
+		return "El nuevo tamaño debe ser mayor que el tamaño actual del disco"
+	}
+	if err := validarLimiteDiscosDatos(disco.Persona_email, tamanio-disco.Tamanio); err != nil {
+		log.Println(err)
+		return err.Error()
+	}
+
+	host, config, mensaje := prepararHostDisco(disco)
+	if mensaje != "" {
+		return mensaje
+	}
+	if host.Almacenamiento_usado+tamanio-disco.Tamanio > host.Almacenamiento_total {
+		return "El host no tiene almacenamiento disponible para el disco"
+	}
+
+	if _, err := ejecutarVBoxManage(host, config, "modifymedium", "disk", disco.Ruta_ubicacion, "--resize", strconv.Itoa(tamanio)); err != nil {
+		log.Println("Error al redimensionar el disco de datos:", err)
+		return "Error al redimensionar el disco de datos: " + describirErrorSSH(err)
+	}
+
+	if _, err := db.Exec("UPDATE disco_datos SET tamanio = ? WHERE id = ?", tamanio, disco.Id); err != nil {
+		log.Println("Error al actualizar el disco de datos en la base de datos:", err)
+		return "Error al actualizar el disco de datos en la base de datos"
+	}
+	if _, err := db.Exec("UPDATE host SET almacenamiento_usado = almacenamiento_usado + ? WHERE id = ?", tamanio-disco.Tamanio, host.Id); err != nil {
+		log.Println("Error al actualizar el almacenamiento usado del host:", err)
+	}
+
+	fmt.Println("Disco de datos redimensionado correctamente")
+	return "Disco de datos redimensionado correctamente"
+}
+
+/*
+Funciòn que conecta un disco de datos desconectado al primer puerto libre de una MV apagada del mismo host y del mismo propietario
+@idDisco Paràmetro que contiene el identificador del disco
+@nameVM Paràmetro que contiene el nombre de la màquina virtual
+*/
+func conectarDiscoDatos(idDisco int, nameVM string) string {
+
+	disco, err := getDiscoDatos(idDisco)
+	if err != nil {
+		return "No se encontrò el disco"
+	}
+	if disco.Maquina_virtual_uuid != "" {
+		return "El disco ya està conectado a una MV"
+	}
+
+	maquinaVirtual, err := getVM(nameVM)
+	if err != nil {
+		log.Println("Error al obtener la MV:", err)
+		return "Error al obtener la MV"
+	}
+	if maquinaVirtual.Host_id != disco.Host_id {
+		return "El disco y la MV deben estar en el mismo host"
+	}
+	if maquinaVirtual.Persona_email != disco.Persona_email {
+		return "El disco y la MV deben tener el mismo propietario"
+	}
+
+	host, config, info, mensaje := prepararMVApagadaDiscos(maquinaVirtual)
+	if mensaje != "" {
+		return mensaje
+	}
+
+	puerto := puertoLibreDiscos(info)
+	if puerto == 0 {
+		return "La MV no tiene puertos libres para màs discos"
+	}
+
+	if _, err := ejecutarVBoxManage(host, config, "storageattach", maquinaVirtual.Nombre, "--storagectl", "hardisk", "--port", strconv.Itoa(puerto), "--device", "0", "--type", "hdd", "--medium", disco.Ruta_ubicacion); err != nil {
+		log.Println("Error al conectar el disco de datos:", err)
+		return "Error al conectar el disco de datos a la MV"
+	}
+
+	if _, err := db.Exec("UPDATE disco_datos SET maquina_virtual_uuid = ?, puerto = ? WHERE id = ?", maquinaVirtual.Uuid, puerto, disco.Id); err != nil {
+		log.Println("Error al actualizar el disco de datos en la base de datos:", err)
+		return "Error al actualizar el disco de datos en la base de datos"
+	}
+
+	fmt.Println("Disco de datos conectado correctamente")
+	return "Disco de datos conectado correctamente"
+}
+
+/*
+Funciòn que desconecta un disco de datos de su MV, que debe estar apagada. El disco se conserva en el host para conectarlo a otra MV
+@idDisco Paràmetro que contiene el identificador del disco
+*/
+func desconectarDiscoDatos(idDisco int) string {
+
+	disco, err := getDiscoDatos(idDisco)
+	if err != nil {
+		return "No se encontrò el disco"
+	}
+	if disco.Maquina_virtual_uuid == "" {
+		return "El disco no està conectado a una MV"
+	}
+	if mensaje := retirarDiscoDatos(disco); mensaje != "" {
+		return mensaje
+	}
+
+	fmt.Println("Disco de datos desconectado correctamente")
+	return "Disco de datos desconectado correctamente"
+}
+
+/*
+Funciòn que elimina un disco de datos y libera su almacenamiento en el host. Si està conectado, primero lo desconecta de la MV
+@idDisco Paràmetro que contiene el identificador del disco
+*/
+func eliminarDiscoDatos(idDisco int) string {
+
+	disco, err := getDiscoDatos(idDisco)
+	if err != nil {
+		return "No se encontrò el disco"
+	}
+	if disco.Maquina_virtual_uuid != "" {
+		if mensaje := retirarDiscoDatos(disco); mensaje != "" {
+			return mensaje
+		}
+		disco.Maquina_virtual_uuid = ""
+	}
+
+	host, config, mensaje := prepararHostDisco(disco)
+	if mensaje != "" {
+		return mensaje
+	}
+
+	if _, err := ejecutarVBoxManage(host, config, "closemedium", "disk", disco.Ruta_ubicacion, "--delete"); err != nil {
+		log.Println("Error al eliminar el disco de datos:", err)
+		return "Error al eliminar el disco de datos: " + describirErrorSSH(err)
+	}
+
+	if _, err := db.Exec("DELETE FROM disco_datos WHERE id = ?", disco.Id); err != nil {
+		log.Println("Error al eliminar el disco de datos de la base de datos:", err)
+		return "Error al eliminar el disco de datos de la base de datos"
+	}
+	if _, err := db.Exec("UPDATE host SET almacenamiento_usado = GREATEST(almacenamiento_usado - ?, 0) WHERE id = ?", disco.Tamanio, host.Id); err != nil {
+		log.Println("Error al actualizar el almacenamiento usado del host:", err)
+	}
+
+	fmt.Println("Disco de datos eliminado correctamente")
+	return "Disco de datos eliminado correctamente"
+}
+
+/*
+Funciòn que desconecta un disco de datos de su MV, que debe estar apagada, y lo marca como desconectado en la base de datos
+@return Retorna un mensaje de error, o una cadena vacìa si el disco se desconectò
+*/
+func retirarDiscoDatos(disco DiscoDatos) string {
+
+	var maquinaVirtual Maquina_virtual
+	err := db.QueryRow("SELECT nombre, host_id FROM maquina_virtual WHERE uuid = ?", disco.Maquina_virtual_uuid).Scan(&maquinaVirtual.Nombre, &maquinaVirtual.Host_id)
+	if err != nil {
+		log.Println("Error al obtener la MV del disco:", err)
+		return "Error al obtener la MV del disco"
+	}
+
+	host, config, _, mensaje := prepararMVApagadaDiscos(maquinaVirtual)
+	if mensaje != "" {
+		return mensaje
+	}
+
+	if _, err := ejecutarVBoxManage(host, config, "storageattach", maquinaVirtual.Nombre, "--storagectl", "hardisk", "--port", strconv.Itoa(disco.Puerto), "--device", "0", "--medium", "none"); err != nil {
+		log.Println("Error al desconectar el disco de datos:", err)
+		return "Error al desconectar el disco de datos de la MV"
+	}
+
+	if _, err := db.Exec("UPDATE disco_datos SET maquina_virtual_uuid = '', puerto = 0 WHERE id = ?", disco.Id); err != nil {
+		log.Println("Error al actualizar el disco de datos en la base de datos:", err)
+		return "Error al actualizar el disco de datos en la base de datos"
+	}
+	return ""
+}
+
+/*
+Funciòn que obtiene el host y la configuraciòn SSH de una MV y verifica que estè apagada, para cambiar sus discos
+@return Retorna el host, la configuraciòn SSH, la informaciòn de la MV en VirtualBox y un mensaje de error si no se puede continuar
+*/
+func prepararMVApagadaDiscos(maquinaVirtual Maquina_virtual) (Host, *ssh.ClientConfig, infoMV, string) {
+
+	host, err := getHost(maquinaVirtual.Host_id)
+	if err != nil {
+		log.Println("Error al obtener el host:", err)
+		return host, nil, infoMV{}, "Error al obtener el host"
+	}
+
+	config, err := configurarSSH(host.Hostname, *privateKeyPath)
+	if err != nil {
+		log.Println("Error al configurar SSH:", err)
+		return host, nil, infoMV{}, "Error al configurar SSH"
+	}
+
+	info, err := obtenerInfoMV(host, config, maquinaVirtual.Nombre)
+	if err != nil {
+		log.Println("Error al obtener la informaciòn de la MV:", err)
+		return host, nil, info, "Error al obtener la informaciòn de la MV"
+	}
+	if info.encendida() {
+		return host, nil, info, "Debe apagar la màquina para cambiar sus discos"
+	}
+	return host, config, info, ""
+}
+
+/*
+Funciòn que obtiene el host y la configuraciòn SSH de un disco de datos. Si el disco està conectado, verifica que la MV estè apagada
+@return Retorna el host, la configuraciòn SSH y un mensaje de error si no se puede continuar
+*/
+func prepararHostDisco(disco DiscoDatos) (Host, *ssh.ClientConfig, string) {
+
+	if disco.Maquina_virtual_uuid != "" {
+		var maquinaVirtual Maquina_virtual
+		err := db.QueryRow("SELECT nombre, host_id FROM maquina_virtual WHERE uuid = ?", disco.Maquina_virtual_uuid).Scan(&maquinaVirtual.Nombre, &maquinaVirtual.Host_id)
+		if err != nil {
+			log.Println("Error al obtener la MV del disco:", err)
+			return Host{}, nil, "Error al obtener la MV del disco"
+		}
+		host, config, _, mensaje := prepararMVApagadaDiscos(maquinaVirtual)
+		return host, config, mensaje
+	}
+
+	host, err := getHost(disco.Host_id)
+	if err != nil {
+		log.Println("Error al obtener el host:", err)
+		return host, nil, "Error al obtener el host"
+	}
+
+	config, err := configurarSSH(host.Hostname, *privateKeyPath)
+	if err != nil {
+		log.Println("Error al configurar SSH:", err)
+		return host, nil, "Error al configurar SSH"
+	}
+	return host, config, ""
+}
+
+/*
+Funciòn que busca el primer puerto libre del controlador "hardisk" de una MV. El puerto 0 lo ocupa el disco del sistema operativo
+@info Paràmetro que contiene la informaciòn de la MV en VirtualBox
+@return Retorna el puerto, o 0 si no hay puertos libres
+*/
+func puertoLibreDiscos(info infoMV) int {
+	for puerto := 1; puerto < puertosControladorDiscos; puerto++ {
+		if _, ocupado := info.medioEn("hardisk", puerto, 0); !ocupado {
+			return puerto
+		}
+	}
+	return 0
+}
+
+/*
+Funciòn que obtiene un disco de datos dado su identificador ùnico
+*/
+func getDiscoDatos(idDisco int) (DiscoDatos, error) {
+	discos, err := consultDiscosDatos("WHERE id = ?", idDisco)
+	if err != nil {
+		return DiscoDatos{}, err
+	}
+	if len(discos) == 0 {
+		return DiscoDatos{}, sql.ErrNoRows
+	}
+	return discos[0], nil
+}
+
+/*
+Funciòn que consulta los discos de datos que cumplen la condiciòn indicada
+@condicion Paràmetro que contiene la clàusula WHERE de la consulta. Si està vacìa se consultan todos los discos
+@argumento Paràmetro que contiene el valor de la condiciòn
+*/
+func consultDiscosDatos(condicion string, argumento interface{}) ([]DiscoDatos, error) {
+	consulta := "SELECT id, nombre, ruta_ubicacion, tamanio, maquina_virtual_uuid, persona_email, host_id, puerto, fecha_creacion FROM disco_datos " + condicion + " ORDER BY id"
+	var rows *sql.Rows
+	var err error
+	if condicion == "" {
+		rows, err = db.Query(consulta)
+	} else {
+		rows, err = db.Query(consulta, argumento)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var discos []DiscoDatos
+	for rows.Next() {
+		var disco DiscoDatos
+		var fechaCreacionStr string
+		if err := rows.Scan(&disco.Id, &disco.Nombre, &disco.Ruta_ubicacion, &disco.Tamanio, &disco.Maquina_virtual_uuid, &disco.Persona_email, &disco.Host_id, &disco.Puerto, &fechaCreacionStr); err != nil {
+			return nil, err
+		}
+		disco.Fecha_creacion, _ = time.Parse("2006-01-02 15:04:05", fechaCreacionStr)
+		discos = append(discos, disco)
+	}
+	return discos, rows.Err()
+}
+
+/*
+Funciòn que elimina los registros de los discos de datos de una MV eliminada y libera su almacenamiento en el host.
+Los archivos los elimina VirtualBox junto con la MV (unregistervm --delete)
+@maquinaVirtual Paràmetro que contiene la màquina virtual eliminada
+*/
+func eliminarRegistrosDiscosDatos(maquinaVirtual Maquina_virtual) {
+	var tamanio int
+	db.QueryRow("SELECT COALESCE(SUM(tamanio), 0) FROM disco_datos WHERE maquina_virtual_uuid = ?", maquinaVirtual.Uuid).Scan(&tamanio)
+
+	if _, err := db.Exec("DELETE FROM disco_datos WHERE maquina_virtual_uuid = ?", maquinaVirtual.Uuid); err != nil {
+		log.Println("Error al eliminar los discos de datos de la base de datos:", err)
+		return
+	}
+
+	if tamanio > 0 {
+		if _, err := db.Exec("UPDATE host SET almacenamiento_usado = GREATEST(almacenamiento_usado - ?, 0) WHERE id = ?", tamanio, maquinaVirtual.Host_id); err != nil {
+			log.Println("Error al actualizar el almacenamiento usado del host:", err)
+		}
+	}
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Tiempo que se espera a que el sistema operativo de la MV se apague con el botòn de apagado ACPI antes de forzar el apagado
+const tiempoApagadoACPI = 2 * time.Minute
+
+// Tiempo màximo que se puede solicitar para esperar el apagado ACPI
+const tiempoApagadoACPIMaximo = 10 * time.Minute
+
+/*
+Funciòn que configura los endpoints de las operaciones de energìa de las MV: apagado ACPI, apagado forzado,
+guardado del estado, pausa, reanudaciòn y reinicio. Las solicitudes se encolan en la cola de gestiòn
+*/
+func manejarEnergia() {
+
+	encolarSolicitudEnergia := func(tipoEsperado string, mensaje string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				http.Error(w, "Se requiere una solicitud POST", http.StatusMethodNotAllowed)
+				return
+			}
+
+			var datos map[string]interface{}
+			decoder := json.NewDecoder(r.Body)
+			if err := decoder.Decode(&datos); err != nil {
+				http.Error(w, "Error al decodificar JSON de la solicitud", http.StatusBadRequest)
+				return
+			}
+
+			tipoSolicitud, _ := datos["tipo_solicitud"].(string)
+			if tipoSolicitud != tipoEsperado {
+				http.Error(w, "El campo 'tipo_solicitud' debe ser '"+tipoEsperado+"'", http.StatusBadRequest)
+				return
+			}
+
+			email, _ := datos["email"].(string)
+			nombreVM, _ := datos["nombreVM"].(string)
+			if err := validarNombre(nombreVM); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if mensajeError, estado := validarPropietarioOAdministrador(nombreVM, email); estado != http.StatusOK {
+				http.Error(w, mensajeError, estado)
+				return
+			}
+
+			if tiempoEspera, _ := datos["tiempoEspera"].(float64); tiempoEspera < 0 || time.Duration(tiempoEspera)*time.Second > tiempoApagadoACPIMaximo {
+				http.Error(w, fmt.Sprintf("El tiempo de espera debe estar entre 0 y %d segundos", int(tiempoApagadoACPIMaximo.Seconds())), http.StatusBadRequest)
+				return
+			}
+
+			// Encola las peticiones.
+			identificarMV(datos)
+			mu.Lock()
+			managementQueue.Queue.PushBack(datos)
+			mu.Unlock()
+
+			// Envía una respuesta al cliente.
+			response := map[string]string{"mensaje": mensaje}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(response)
+		}
+	}
+
+	http.HandleFunc("/json/shutdownVM", encolarSolicitudEnergia("shutdown", "Mensaje JSON para apagar la MV con ACPI recibido correctamente"))
+	http.HandleFunc("/json/powerOffVM", encolarSolicitudEnergia("poweroff", "Mensaje JSON para forzar el apagado de la MV recibido correctamente"))
+	http.HandleFunc("/json/saveStateVM", encolarSolicitudEnergia("save_state", "Mensaje JSON para guardar el estado de la MV recibido correctamente"))
+	http.HandleFunc("/json/pauseVM", encolarSolicitudEnergia("pause", "Mensaje JSON para pausar la MV recibido correctamente"))
+	http.HandleFunc("/json/resumeVM", encolarSolicitudEnergia("resume", "Mensaje JSON para reanudar la MV recibido correctamente"))
+	http.HandleFunc("/json/resetVM", encolarSolicitudEnergia("reset", "Mensaje JSON para reiniciar la MV recibido correctamente"))
+}
+
+/*
+Funciòn que obtiene la MV, su host, la configuraciòn SSH y el estado de la MV en VirtualBox para una operaciòn de energìa
+@nameVM Paràmetro que contiene el nombre de la MV
+@return Retorna la MV, el host, la configuraciòn SSH, la informaciòn de la MV y un mensaje de error si no se puede continuar
+*/
+func prepararOperacionEnergia(nameVM string) (Maquina_virtual, Host, *ssh.ClientConfig, infoMV, string) {
+
+	maquinaVirtual, err := getVM(nameVM)
+	if err != nil {
+		log.Println("Error al obtener la MV:", err)
+		return maquinaVirtual, Host{}, nil, infoMV{}, "Error al obtener la MV"
+	}
+	host, err := getHost(maquinaVirtual.Host_id)
+	if err != nil {
+		log.Println("Error al obtener el host:", err)
+		return maquinaVirtual, host, nil, infoMV{}, "Error al obtener el host"
+	}
+	config, err := configurarSSH(host.Hostname, *privateKeyPath)
+	if err != nil {
+		log.Println("Error al configurar SSH:", err)
+		return maquinaVirtual, host, nil, infoMV{}, "Error al configurar SSH"
+	}
+	info, err := obtenerInfoMV(host, config, nameVM)
+	if err != nil {
+		log.Println("Error al obtener el estado de la MV:", err)
+		return maquinaVirtual, host, nil, info, "Error al obtener el estado de la MV"
+	}
+	sincronizarEstadoMV(&maquinaVirtual, info)
+	return maquinaVirtual, host, config, info, ""
+}
+
+/*
+Funciòn que apaga una MV encendida o pausada. Primero presiona el botòn de apagado ACPI para que el sistema operativo
+se apague de forma ordenada y, si no se apaga en el tiempo de espera, fuerza el apagado. Las MV pausadas no atienden
+el botòn ACPI, por lo que se apagan de inmediato
+@maquinaVirtual Paràmetro que contiene la MV
+@host Paràmetro que contiene el host en el cual està la MV
+@config Paràmetro que contiene la configuraciòn SSH
+@pausada Paràmetro que indica si la MV està pausada
+@espera Paràmetro que contiene el tiempo de espera del apagado ACPI
+@return Retorna un mensaje de error, o una cadena vacìa si la MV quedò apagada
+*/
+func detenerMV(maquinaVirtual Maquina_virtual, host Host, config *ssh.ClientConfig, pausada bool, espera time.Duration) string {
+
+	nameVM := maquinaVirtual.Nombre
+	if err := cambiarEstadoMV(maquinaVirtual, estadoApagando); err != nil {
+		log.Println("Error al cambiar el estado de la MV:", err)
+		return "La màquina no se puede apagar en su estado actual"
+	}
+	fmt.Println("Apagando màquina " + nameVM + "...")
+
+	forzar := pausada
+	if !forzar {
+		if _, err := ejecutarVBoxManage(host, config, "controlvm", nameVM, "acpipowerbutton"); err != nil {
+			log.Println("Error al enviar el botòn de apagado ACPI a la MV:", err)
+			forzar = true
+		}
+	}
+
+	if !forzar {
+		//Espera hasta que la màquina estè apagada o haya pasado el tiempo de espera
+		maxEspera := time.Now().Add(espera)
+		for {
+			running, err := isRunning(nameVM, host, config)
+			if err == nil && !running {
+				break
+			}
+			if time.Now().After(maxEspera) {
+				log.Println("La màquina " + nameVM + " no se apagò con el botòn ACPI, se forzarà el apagado")
+				forzar = true
+				break
+			}
+			time.Sleep(2 * time.Second)
+		}
+	}
+
+	if forzar {
+		if _, err := ejecutarVBoxManage(host, config, "controlvm", nameVM, "poweroff"); err != nil {
+			log.Println("Error al enviar el comando para apagar la MV:", err)
+			registrarEstadoMV(maquinaVirtual, estadoEncendido)
+			return "Error al enviar el comando para apagar la MV"
+		}
+	}
+
+	registrarEstadoMV(maquinaVirtual, estadoApagado)
+	fmt.Println("Màquina apagada con èxito")
+	return ""
+}
+
+/*
+Funciòn que apaga una MV con el botòn de apagado ACPI y fuerza el apagado si no termina en el tiempo de espera
+@nameVM Paràmetro que contiene el nombre de la MV
+@espera Paràmetro que contiene el tiempo de espera del apagado ACPI. Si es 0 se usa el tiempo por defecto
+*/
+func apagarMVACPI(nameVM string, espera time.Duration) string {
+
+	maquinaVirtual, host, config, info, mensaje := prepararOperacionEnergia(nameVM)
+	if mensaje != "" {
+		return mensaje
+	}
+	if !info.encendida() {
+		return "La màquina no està encendida"
+	}
+	if espera <= 0 {
+		espera = tiempoApagadoACPI
+	}
+	if mensaje := detenerMV(maquinaVirtual, host, config, info.Estado == "paused", espera); mensaje != "" {
+		return mensaje
+	}
+	return "Màquina apagada con èxito"
+}
+
+/*
+Funciòn que apaga una MV de inmediato, como si se desconectara la energìa
+@nameVM Paràmetro que contiene el nombre de la MV
+*/
+func forzarApagadoMV(nameVM string) string {
+
+	maquinaVirtual, host, config, info, mensaje := prepararOperacionEnergia(nameVM)
+	if mensaje != "" {
+		return mensaje
+	}
+	if !info.encendida() {
+		return "La màquina no està encendida"
+	}
+	if mensaje := detenerMV(maquinaVirtual, host, config, true, 0); mensaje != "" {
+		return mensaje
+	}
+	return "Màquina apagada con èxito"
+}
+
+/*
+Funciòn que guarda el estado de una MV encendida en el disco del host y la detiene (hibernaciòn).
+Al encenderla de nuevo continùa desde el punto en el que se guardò
+@nameVM Paràmetro que contiene el nombre de la MV
+*/
+func guardarEstadoMV(nameVM string) string {
+
+	maquinaVirtual, host, config, info, mensaje := prepararOperacionEnergia(nameVM)
+	if mensaje != "" {
+		return mensaje
+	}
+	if !info.encendida() {
+		return "La màquina no està encendida"
+	}
+
+	if err := cambiarEstadoMV(maquinaVirtual, estadoApagando); err != nil {
+		log.Println("Error al cambiar el estado de la MV:", err)
+		return "No se puede guardar el estado de la màquina en su estado actual"
+	}
+	//Guardar la memoria de la MV puede tardar màs que los comandos normales
+	if _, err := dialectoDeHost(host).ejecutar(host.Ip, vboxManage("controlvm", nameVM, "savestate"), config, tiempoComandoLargoSSH); err != nil {
+		log.Println("Error al guardar el estado de la MV:", err)
+		registrarEstadoMV(maquinaVirtual, estadoEncendido)
+		return "Error al guardar el estado de la MV"
+	}
+
+	registrarEstadoMV(maquinaVirtual, estadoGuardado)
+	fmt.Println("Estado de la màquina " + nameVM + " guardado con èxito")
+	return "Estado de la màquina guardado con èxito"
+}
+
+/*
+Funciòn que pausa una MV encendida. La MV conserva su memoria y sus recursos en el host, pero deja de ejecutarse
+@nameVM Paràmetro que contiene el nombre de la MV
+*/
+func pausarMV(nameVM string) string {
+
+	maquinaVirtual, host, config, info, mensaje := prepararOperacionEnergia(nameVM)
+	if mensaje != "" {
+		return mensaje
+	}
+	if info.Estado != "running" {
+		return "La màquina no està en ejecuciòn"
+	}
+	if !transicionPermitida(maquinaVirtual.Estado, estadoPausado) {
+		return "La màquina no se puede pausar en su estado actual"
+	}
+
+	if _, err := ejecutarVBoxManage(host, config, "controlvm", nameVM, "pause"); err != nil {
+		log.Println("Error al pausar la MV:", err)
+		return "Error al pausar la MV"
+	}
+
+	registrarEstadoMV(maquinaVirtual, estadoPausado)
+	fmt.Println("Màquina " + nameVM + " pausada")
+	return "Màquina pausada con èxito"
+}
+
+/*
+Funciòn que reanuda una MV pausada, o enciende una MV con el estado guardado para que continùe desde donde se guardò
+@nameVM Paràmetro que contiene el nombre de la MV
+*/
+func reanudarMV(nameVM string) string {
+
+	maquinaVirtual, host, config, info, mensaje := prepararOperacionEnergia(nameVM)
+	if mensaje != "" {
+		return mensaje
+	}
+
+	switch info.Estado {
+	case "paused":
+		if _, err := ejecutarVBoxManage(host, config, "controlvm", nameVM, "resume"); err != nil {
+			log.Println("Error al reanudar la MV:", err)
+			return "Error al reanudar la MV"
+		}
+		registrarEstadoMV(maquinaVirtual, estadoEncendido)
+		fmt.Println("Màquina " + nameVM + " reanudada")
+		return "Màquina reanudada con èxito"
+
+	case "saved":
+		return startVM(nameVM, "")
+	}
+	return "La màquina no està pausada ni tiene un estado guardado"
+}
+
+/*
+Funciòn que reinicia una MV encendida de inmediato, como el botòn de reinicio de un computador, y espera su nueva direcciòn IP
+@nameVM Paràmetro que contiene el nombre de la MV
+*/
+func reiniciarMV(nameVM string) string {
+
+	maquinaVirtual, host, config, info, mensaje := prepararOperacionEnergia(nameVM)
+	if mensaje != "" {
+		return mensaje
+	}
+	if info.Estado != "running" {
+		return "La màquina no està en ejecuciòn"
+	}
+
+	if err := cambiarEstadoMV(maquinaVirtual, estadoEncendiendo); err != nil {
+		log.Println("Error al cambiar el estado de la MV:", err)
+		return "La màquina no se puede reiniciar en su estado actual"
+	}
+	if _, err := ejecutarVBoxManage(host, config, "controlvm", nameVM, "reset"); err != nil {
+		log.Println("Error al reiniciar la MV:", err)
+		registrarEstadoMV(maquinaVirtual, estadoEncendido)
+		return "Error al reiniciar la MV"
+	}
+	fmt.Println("Reiniciando la màquina: " + nameVM)
+
+	//Las propiedades de red del arranque anterior siguen publicadas hasta que las Guest Additions las actualizan
+	time.Sleep(5 * time.Second)
+	direcciones := esperarDireccionesMV(host, config, nameVM, tiempoEsperaIP)
+	registrarEstadoMV(maquinaVirtual, estadoEncendido)
+	registrarDireccionesMV(maquinaVirtual, direcciones)
+	return "Màquina reiniciada con èxito"
+}
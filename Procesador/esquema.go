@@ -0,0 +1,283 @@
+package main
+
+import "log"
+
+/*
+Sentencias para crear las tablas que usan las funcionalidades agregadas despuès del esquema original de la base de datos.
+Las tablas originales (persona, host, disco, catalogo, catalogo_disco, maquina_virtual) no se modifican porque varias
+consultas las leen con SELECT *; la informaciòn adicional de una MV se guarda en tablas relacionadas por su uuid
+*/
+var tablasAdicionales = []string{
+	`CREATE TABLE IF NOT EXISTS snapshot (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		uuid VARCHAR(64) NOT NULL,
+		nombre VARCHAR(100) NOT NULL,
+		descripcion VARCHAR(255) NOT NULL DEFAULT '',
+		maquina_virtual_uuid VARCHAR(64) NOT NULL,
+		tamanio INT NOT NULL DEFAULT 0,
+		base BOOLEAN NOT NULL DEFAULT FALSE,
+		fecha_creacion DATETIME NOT NULL,
+		UNIQUE KEY snapshot_mv_nombre (maquina_virtual_uuid, nombre)
+	)`,
+	`CREATE TABLE IF NOT EXISTS clon (
+		maquina_virtual_uuid VARCHAR(64) PRIMARY KEY,
+		origen_uuid VARCHAR(64) NOT NULL,
+		modo VARCHAR(10) NOT NULL,
+		snapshot_id INT NOT NULL DEFAULT 0,
+		tamanio INT NOT NULL DEFAULT 0
+	)`,
+	`CREATE TABLE IF NOT EXISTS plantilla (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		nombre VARCHAR(100) NOT NULL,
+		descripcion VARCHAR(255) NOT NULL DEFAULT '',
+		disco_id INT NOT NULL,
+		ram_defecto INT NOT NULL,
+		ram_maxima INT NOT NULL,
+		cpu_defecto INT NOT NULL,
+		cpu_maxima INT NOT NULL,
+		modo_red VARCHAR(20) NOT NULL DEFAULT 'bridged',
+		discos_extra TEXT NOT NULL,
+		aprovisionamiento TEXT NOT NULL,
+		configuracion_inicial TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS disco_datos (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		nombre VARCHAR(150) NOT NULL,
+		ruta_ubicacion VARCHAR(255) NOT NULL,
+		tamanio INT NOT NULL,
+		maquina_virtual_uuid VARCHAR(64) NOT NULL DEFAULT '',
+		persona_email VARCHAR(100) NOT NULL DEFAULT '',
+		host_id INT NOT NULL,
+		puerto INT NOT NULL DEFAULT 0,
+		fecha_creacion DATETIME NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS trabajo (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		tipo VARCHAR(20) NOT NULL,
+		estado VARCHAR(20) NOT NULL,
+		maquina_virtual VARCHAR(100) NOT NULL DEFAULT '',
+		persona_email VARCHAR(100) NOT NULL,
+		host_id INT NOT NULL DEFAULT 0,
+		ruta VARCHAR(255) NOT NULL DEFAULT '',
+		mensaje VARCHAR(255) NOT NULL DEFAULT '',
+		fecha_creacion DATETIME NOT NULL,
+		fecha_actualizacion DATETIME NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS imagen_iso (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		nombre VARCHAR(100) NOT NULL,
+		ruta_ubicacion VARCHAR(255) NOT NULL,
+		sistema_operativo VARCHAR(50) NOT NULL DEFAULT '',
+		distribucion_sistema_operativo VARCHAR(50) NOT NULL DEFAULT '',
+		arquitectura INT NOT NULL DEFAULT 64,
+		host_id INT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS consola (
+		maquina_virtual_uuid VARCHAR(64) PRIMARY KEY,
+		host_id INT NOT NULL,
+		puerto INT NOT NULL,
+		UNIQUE KEY consola_host_puerto (host_id, puerto)
+	)`,
+	`CREATE TABLE IF NOT EXISTS red_mv (
+		maquina_virtual_uuid VARCHAR(64) PRIMARY KEY,
+		modo VARCHAR(20) NOT NULL,
+		red VARCHAR(100) NOT NULL DEFAULT ''
+	)`,
+	`CREATE TABLE IF NOT EXISTS reenvio_puerto (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		maquina_virtual_uuid VARCHAR(64) NOT NULL,
+		host_id INT NOT NULL,
+		nombre VARCHAR(100) NOT NULL,
+		protocolo VARCHAR(3) NOT NULL,
+		puerto_host INT NOT NULL,
+		puerto_invitado INT NOT NULL,
+		UNIQUE KEY reenvio_host_puerto (host_id, protocolo, puerto_host),
+		UNIQUE KEY reenvio_mv_nombre (maquina_virtual_uuid, nombre)
+	)`,
+	`CREATE TABLE IF NOT EXISTS red_privada (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		nombre VARCHAR(100) NOT NULL,
+		tipo VARCHAR(20) NOT NULL,
+		segmento VARCHAR(50) NOT NULL DEFAULT '',
+		persona_email VARCHAR(100) NOT NULL,
+		host_id INT NOT NULL DEFAULT 0,
+		fecha_creacion DATETIME NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS red_privada_mv (
+		red_id INT NOT NULL,
+		maquina_virtual_uuid VARCHAR(64) NOT NULL,
+		tarjeta INT NOT NULL,
+		PRIMARY KEY (red_id, maquina_virtual_uuid),
+		UNIQUE KEY red_privada_mv_tarjeta (maquina_virtual_uuid, tarjeta)
+	)`,
+	`CREATE TABLE IF NOT EXISTS direccion_mv (
+		maquina_virtual_uuid VARCHAR(64) NOT NULL,
+		tarjeta INT NOT NULL,
+		mac VARCHAR(17) NOT NULL DEFAULT '',
+		ip VARCHAR(45) NOT NULL,
+		version INT NOT NULL,
+		origen VARCHAR(10) NOT NULL,
+		fecha_actualizacion DATETIME NOT NULL,
+		PRIMARY KEY (maquina_virtual_uuid, ip)
+	)`,
+	`CREATE TABLE IF NOT EXISTS estado_mv (
+		maquina_virtual_uuid VARCHAR(64) PRIMARY KEY,
+		estado_anterior VARCHAR(20) NOT NULL,
+		fecha_transicion DATETIME NOT NULL,
+		detalle VARCHAR(255) NOT NULL DEFAULT ''
+	)`,
+	`CREATE TABLE IF NOT EXISTS metadatos_mv (
+		maquina_virtual_uuid VARCHAR(64) PRIMARY KEY,
+		descripcion VARCHAR(500) NOT NULL DEFAULT ''
+	)`,
+	`CREATE TABLE IF NOT EXISTS etiqueta_mv (
+		maquina_virtual_uuid VARCHAR(64) NOT NULL,
+		etiqueta VARCHAR(50) NOT NULL,
+		PRIMARY KEY (maquina_virtual_uuid, etiqueta),
+		KEY etiqueta_mv_etiqueta (etiqueta)
+	)`,
+	`CREATE TABLE IF NOT EXISTS programacion (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		nombre VARCHAR(100) NOT NULL,
+		persona_email VARCHAR(100) NOT NULL,
+		tipo_objetivo VARCHAR(10) NOT NULL,
+		objetivo VARCHAR(64) NOT NULL,
+		accion VARCHAR(10) NOT NULL,
+		expresion VARCHAR(100) NOT NULL DEFAULT '',
+		horas_inactividad INT NOT NULL DEFAULT 0,
+		activa BOOLEAN NOT NULL DEFAULT TRUE,
+		ultima_ejecucion DATETIME NULL,
+		fecha_creacion DATETIME NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS concesion (
+		maquina_virtual_uuid VARCHAR(64) PRIMARY KEY,
+		fecha_expiracion DATETIME NULL,
+		extensiones INT NOT NULL DEFAULT 0,
+		estado VARCHAR(10) NOT NULL DEFAULT 'vigente',
+		fecha_detencion DATETIME NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS concesion_rol (
+		rol VARCHAR(50) PRIMARY KEY,
+		duracion INT NOT NULL,
+		extension INT NOT NULL,
+		max_extensiones INT NOT NULL,
+		aviso INT NOT NULL,
+		gracia INT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS aviso (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		persona_email VARCHAR(100) NOT NULL,
+		maquina_virtual_uuid VARCHAR(64) NOT NULL DEFAULT '',
+		mensaje VARCHAR(255) NOT NULL,
+		leido BOOLEAN NOT NULL DEFAULT FALSE,
+		fecha_creacion DATETIME NOT NULL,
+		KEY aviso_persona (persona_email, leido)
+	)`,
+	`CREATE TABLE IF NOT EXISTS sesion_invitado (
+		token VARCHAR(64) PRIMARY KEY,
+		persona_email VARCHAR(100) NOT NULL,
+		ip_cliente VARCHAR(45) NOT NULL,
+		estado VARCHAR(10) NOT NULL DEFAULT 'activa',
+		fecha_creacion DATETIME NOT NULL,
+		fecha_expiracion DATETIME NOT NULL,
+		KEY sesion_invitado_ip (ip_cliente, estado)
+	)`,
+	`CREATE TABLE IF NOT EXISTS cuota_persona (
+		persona_email VARCHAR(100) PRIMARY KEY,
+		maquinas INT NULL,
+		ram INT NULL,
+		cpu INT NULL,
+		disco INT NULL,
+		snapshots INT NULL,
+		encendidas INT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS cuota_rol (
+		rol VARCHAR(50) PRIMARY KEY,
+		maquinas INT NOT NULL,
+		ram INT NOT NULL,
+		cpu INT NOT NULL,
+		disco INT NOT NULL,
+		snapshots INT NOT NULL,
+		encendidas INT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS curso (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		nombre VARCHAR(100) NOT NULL,
+		descripcion VARCHAR(500) NOT NULL DEFAULT '',
+		maquinas INT NOT NULL DEFAULT -1,
+		ram INT NOT NULL DEFAULT -1,
+		cpu INT NOT NULL DEFAULT -1,
+		fecha_creacion DATETIME NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS curso_miembro (
+		curso_id INT NOT NULL,
+		persona_email VARCHAR(100) NOT NULL,
+		rol VARCHAR(20) NOT NULL,
+		PRIMARY KEY (curso_id, persona_email),
+		KEY curso_miembro_persona (persona_email)
+	)`,
+	`CREATE TABLE IF NOT EXISTS curso_plantilla (
+		curso_id INT NOT NULL,
+		plantilla_id INT NOT NULL,
+		PRIMARY KEY (curso_id, plantilla_id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS laboratorio (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		curso_id INT NOT NULL,
+		plantilla_id INT NOT NULL,
+		nombre VARCHAR(100) NOT NULL,
+		persona_email VARCHAR(100) NOT NULL,
+		ram INT NOT NULL,
+		cpu INT NOT NULL,
+		fecha_creacion DATETIME NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS laboratorio_mv (
+		laboratorio_id INT NOT NULL,
+		persona_email VARCHAR(100) NOT NULL,
+		trabajo_id INT NOT NULL,
+		maquina_virtual_uuid VARCHAR(64) NOT NULL DEFAULT '',
+		PRIMARY KEY (laboratorio_id, persona_email)
+	)`,
+	`CREATE TABLE IF NOT EXISTS reserva (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		persona_email VARCHAR(100) NOT NULL,
+		curso_id INT NOT NULL DEFAULT 0,
+		plantilla_id INT NOT NULL,
+		cantidad INT NOT NULL,
+		ram INT NOT NULL,
+		cpu INT NOT NULL,
+		fecha_inicio DATETIME NOT NULL,
+		fecha_fin DATETIME NOT NULL,
+		estado VARCHAR(20) NOT NULL,
+		fecha_creacion DATETIME NOT NULL,
+		KEY reserva_periodo (fecha_inicio, fecha_fin)
+	)`,
+	`CREATE TABLE IF NOT EXISTS reserva_host (
+		reserva_id INT NOT NULL,
+		host_id INT NOT NULL,
+		cantidad INT NOT NULL,
+		PRIMARY KEY (reserva_id, host_id),
+		KEY reserva_host_host (host_id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS reserva_mv (
+		maquina_virtual_uuid VARCHAR(64) PRIMARY KEY,
+		reserva_id INT NOT NULL,
+		host_id INT NOT NULL,
+		KEY reserva_mv_reserva (reserva_id)
+	)`,
+}
+
+/*
+Funciòn que crea en la base de datos las tablas adicionales que aùn no existen
+*/
+func crearTablasAdicionales() {
+	for _, sentencia := range tablasAdicionales {
+		if _, err := db.Exec(sentencia); err != nil {
+			log.Fatal("Error al crear las tablas adicionales: ", err)
+		}
+	}
+
+	//Registra los valores configurables por defecto de los roles que aùn no los tienen
+	inicializarCuotasRol()
+	inicializarPoliticasConcesion()
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Estados de una MV guardados en maquina_virtual.estado. Creando, Encendiendo, Apagando y Eliminando son estados transitorios
+const (
+	estadoCreando     = "Creando"
+	estadoApagado     = "Apagado"
+	estadoEncendiendo = "Encendiendo"
+	estadoEncendido   = "Encendido"
+	estadoPausado     = "Pausado"
+	estadoApagando    = "Apagando"
+	estadoGuardado    = "Guardado"
+	estadoEliminando  = "Eliminando"
+	estadoError       = "Error"
+
+	//Estado transitorio que usaban las versiones anteriores para el encendido y el apagado
+	estadoProcesandoAnterior = "Procesando"
+)
+
+var (
+	//Estados a los que puede pasar una MV desde cada estado
+	transicionesEstado = map[string][]string{
+		estadoCreando:     {estadoApagado, estadoEncendiendo, estadoError},
+		estadoApagado:     {estadoEncendiendo, estadoEliminando, estadoError},
+		estadoEncendiendo: {estadoEncendido, estadoApagado, estadoGuardado, estadoApagando, estadoError},
+		estadoEncendido:   {estadoApagando, estadoEncendiendo, estadoPausado, estadoApagado, estadoError},
+		estadoPausado:     {estadoEncendido, estadoApagando, estadoApagado, estadoError},
+		estadoApagando:    {estadoApagado, estadoGuardado, estadoEncendido, estadoError},
+		estadoGuardado:    {estadoEncendiendo, estadoEliminando, estadoApagado, estadoError},
+		estadoEliminando:  {estadoApagado, estadoGuardado, estadoError},
+		estadoError:       {estadoApagado, estadoEncendiendo, estadoEncendido, estadoPausado, estadoGuardado, estadoEliminando},
+	}
+
+	estadosTransitorios = []string{estadoCreando, estadoEncendiendo, estadoApagando, estadoEliminando, estadoProcesandoAnterior}
+
+	//Estado de la MV que corresponde a cada estado de VirtualBox
+	estadosVBox = map[string]string{
+		"running":        estadoEncendido,
+		"paused":         estadoPausado,
+		"saved":          estadoGuardado,
+		"poweroff":       estadoApagado,
+		"aborted":        estadoApagado,
+		"gurumeditation": estadoError,
+	}
+
+	errTransicionNoPermitida = errors.New("transiciòn de estado no permitida")
+)
+
+/*
+Funciòn que indica si una MV puede pasar de un estado a otro
+@origen Paràmetro que contiene el estado actual
+@destino Paràmetro que contiene el nuevo estado
+*/
+func transicionPermitida(origen string, destino string) bool {
+	if origen == destino {
+		return true
+	}
+	for _, permitido := range transicionesEstado[origen] {
+		if permitido == destino {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Funciòn que cambia el estado de una MV si la transiciòn està permitida y guarda el momento del cambio.
+El cambio se hace con la condiciòn de que el estado no haya cambiado desde que se consultò, por lo que dos operaciones
+simultàneas sobre la misma MV no pueden hacer la misma transiciòn
+@maquinaVirtual Paràmetro que contiene la MV. Solo se usa su uuid
+@destino Paràmetro que contiene el nuevo estado
+@return Retorna un error si la transiciòn no està permitida o no se pudo guardar
+*/
+func cambiarEstadoMV(maquinaVirtual Maquina_virtual, destino string) error {
+
+	var actual string
+	if err := db.QueryRow("SELECT estado FROM maquina_virtual WHERE uuid = ?", maquinaVirtual.Uuid).Scan(&actual); err != nil {
+		return err
+	}
+	if actual == destino {
+		return nil
+	}
+	if !transicionPermitida(actual, destino) {
+		return fmt.Errorf("%w: de %s a %s", errTransicionNoPermitida, actual, destino)
+	}
+	return escribirEstadoMV(maquinaVirtual.Uuid, actual, destino, "")
+}
+
+/*
+Funciòn que asigna un estado a una MV sin validar la transiciòn. Se usa para corregir estados que no coinciden con VirtualBox
+@uuidVM Paràmetro que contiene el uuid de la MV
+@destino Paràmetro que contiene el nuevo estado
+@detalle Paràmetro que contiene el motivo del cambio
+*/
+func forzarEstadoMV(uuidVM string, destino string, detalle string) error {
+	var actual string
+	if err := db.QueryRow("SELECT estado FROM maquina_virtual WHERE uuid = ?", uuidVM).Scan(&actual); err != nil {
+		return err
+	}
+	return escribirEstadoMV(uuidVM, actual, destino, detalle)
+}
+
+/*
+Funciòn que guarda el nuevo estado de una MV y el momento de la transiciòn. Los estados sin direcciòn IP
+(Apagado y Guardado) tambièn eliminan las direcciones de la MV
+*/
+func escribirEstadoMV(uuidVM string, actual string, destino string, detalle string) error {
+
+	query := "UPDATE maquina_virtual SET estado = ? WHERE uuid = ? AND estado = ?"
+	if destino == estadoApagado || destino == estadoGuardado {
+		query = "UPDATE maquina_virtual SET estado = ?, ip = '' WHERE uuid = ? AND estado = ?"
+	}
+	resultado, err := db.Exec(query, destino, uuidVM, actual)
+	if err != nil {
+		return err
+	}
+	if filas, _ := resultado.RowsAffected(); filas == 0 {
+		return fmt.Errorf("%w: el estado de la MV cambiò a la vez desde %s", errTransicionNoPermitida, actual)
+	}
+	if destino == estadoApagado || destino == estadoGuardado {
+		eliminarDireccionesMV(uuidVM)
+	}
+
+	_, err = db.Exec(`INSERT INTO estado_mv (maquina_virtual_uuid, estado_anterior, fecha_transicion, detalle) VALUES (?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE estado_anterior = VALUES(estado_anterior), fecha_transicion = VALUES(fecha_transicion), detalle = VALUES(detalle)`,
+		uuidVM, actual, time.Now().UTC().Format("2006-01-02 15:04:05"), recortarTexto(detalle, 255))
+	if err != nil {
+		log.Println("Error al registrar la transiciòn de estado de la MV:", err)
+	}
+	return nil
+}
+
+/*
+Funciòn que cambia el estado de una MV y registra en el log las transiciones que no se pudieron hacer.
+Se usa en los pasos de una operaciòn que ya validò su transiciòn inicial
+*/
+func registrarEstadoMV(maquinaVirtual Maquina_virtual, destino string) {
+	if err := cambiarEstadoMV(maquinaVirtual, destino); err != nil {
+		log.Println("Error al cambiar el estado de la màquina "+maquinaVirtual.Nombre+" a "+destino+":", err)
+	}
+}
+
+/*
+Funciòn que corrige el estado de una MV que no coincide con su estado en VirtualBox, por ejemplo porque se apagò desde
+el sistema operativo invitado. Las MV en un estado transitorio no se corrigen porque tienen una operaciòn en curso
+@maquinaVirtual Paràmetro que contiene la MV. Su estado se actualiza si se corrige
+@info Paràmetro que contiene la informaciòn de la MV en VirtualBox
+*/
+func sincronizarEstadoMV(maquinaVirtual *Maquina_virtual, info infoMV) {
+	estado, ok := estadosVBox[info.Estado]
+	if !ok || estado == maquinaVirtual.Estado {
+		return
+	}
+	for _, transitorio := range estadosTransitorios {
+		if maquinaVirtual.Estado == transitorio {
+			return
+		}
+	}
+	if err := forzarEstadoMV(maquinaVirtual.Uuid, estado, "Sincronizado con VirtualBox"); err != nil {
+		log.Println("Error al sincronizar el estado de la màquina "+maquinaVirtual.Nombre+":", err)
+		return
+	}
+	maquinaVirtual.Estado = estado
+}
+
+/*
+Funciòn que recorta un texto a una longitud màxima de caracteres
+*/
+func recortarTexto(texto string, longitud int) string {
+	if runas := []rune(texto); len(runas) > longitud {
+		return string(runas[:longitud])
+	}
+	return texto
+}
+
+/*
+Funciòn que consulta el momento de la ùltima transiciòn de estado de una MV
+@uuidVM Paràmetro que contiene el uuid de la MV
+@return Retorna el momento del cambio, o la fecha cero si la MV no ha cambiado de estado desde que se creò
+*/
+func getFechaEstadoMV(uuidVM string) time.Time {
+	var fecha string
+	if err := db.QueryRow("SELECT fecha_transicion FROM estado_mv WHERE maquina_virtual_uuid = ?", uuidVM).Scan(&fecha); err != nil {
+		return time.Time{}
+	}
+	fechaTransicion, _ := time.Parse("2006-01-02 15:04:05", fecha)
+	return fechaTransicion
+}
+
+/*
+Funciòn que corrige al iniciar el servidor el estado de las MV que quedaron en un estado transitorio porque el servidor
+se detuvo durante una operaciòn. El nuevo estado se toma de VirtualBox; si el host no responde o la MV ya no existe
+en el host, la MV queda en estado Error para que un administrador la revise
+*/
+func recuperarEstadosMV() {
+
+	marcadores := strings.TrimSuffix(strings.Repeat("?, ", len(estadosTransitorios)), ", ")
+	argumentos := make([]interface{}, len(estadosTransitorios))
+	for i, estado := range estadosTransitorios {
+		argumentos[i] = estado
+	}
+	rows, err := db.Query("SELECT uuid, nombre, estado, host_id FROM maquina_virtual WHERE estado IN ("+marcadores+")", argumentos...)
+	if err != nil {
+		log.Println("Error al consultar las MV en estados transitorios:", err)
+		return
+	}
+	var maquinas []Maquina_virtual
+	for rows.Next() {
+		var maquinaVirtual Maquina_virtual
+		if err := rows.Scan(&maquinaVirtual.Uuid, &maquinaVirtual.Nombre, &maquinaVirtual.Estado, &maquinaVirtual.Host_id); err == nil {
+			maquinas = append(maquinas, maquinaVirtual)
+		}
+	}
+	rows.Close()
+
+	for _, maquinaVirtual := range maquinas {
+		destino, detalle := estadoRecuperado(maquinaVirtual)
+		if err := forzarEstadoMV(maquinaVirtual.Uuid, destino, detalle); err != nil {
+			log.Println("Error al recuperar el estado de la màquina "+maquinaVirtual.Nombre+":", err)
+			continue
+		}
+		log.Println("Estado de la màquina " + maquinaVirtual.Nombre + " recuperado: de " + maquinaVirtual.Estado + " a " + destino)
+	}
+}
+
+/*
+Funciòn que obtiene de VirtualBox el estado que debe tener una MV que quedò en un estado transitorio
+@return Retorna el nuevo estado y el motivo del cambio
+*/
+func estadoRecuperado(maquinaVirtual Maquina_virtual) (string, string) {
+
+	detalle := "Recuperado al iniciar el servidor desde " + maquinaVirtual.Estado
+	host, err := getHost(maquinaVirtual.Host_id)
+	if err != nil {
+		return estadoError, detalle + ": no se encontrò el host"
+	}
+	config, err := configurarSSH(host.Hostname, *privateKeyPath)
+	if err != nil {
+		return estadoError, detalle + ": error al configurar SSH"
+	}
+	info, err := obtenerInfoMV(host, config, maquinaVirtual.Nombre)
+	if err != nil {
+		return estadoError, detalle + ": " + describirErrorSSH(err)
+	}
+	if estado, ok := estadosVBox[info.Estado]; ok {
+		return estado, detalle
+	}
+	return estadoError, detalle + ": estado de VirtualBox desconocido " + info.Estado
+}
@@ -0,0 +1,408 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+/*
+Estructura de datos tipo JSON que representa la sesiòn de un usuario invitado. Cada sesiòn tiene una cuenta temporal
+y una sola MV, que se eliminan juntas cuando la sesiòn vence
+@Token Representa el identificador secreto de la sesiòn, que se entrega al crearla
+@Persona_email Representa el email de la cuenta temporal del invitado
+@Ip_cliente Representa la direcciòn IP desde la cual se creò la sesiòn
+@Estado Representa el estado de la sesiòn: activa ò cerrando (se estàn eliminando la MV y la cuenta)
+@Fecha_creacion Representa el momento en el que se creò la sesiòn
+@Fecha_expiracion Representa el momento en el que vence la sesiòn
+@Maquina_virtual Representa la MV del invitado. Es nil mientras la MV se crea
+*/
+type SesionInvitado struct {
+	Token            string
+	Persona_email    string
+	Ip_cliente       string
+	Estado           string
+	Fecha_creacion   time.Time
+	Fecha_expiracion time.Time
+	Maquina_virtual  *Maquina_virtual
+}
+
+// Estados de una sesiòn de invitado
+const (
+	sesionActiva   = "activa"
+	sesionCerrando = "cerrando"
+)
+
+// Cantidad màxima de sesiones de invitado activas al mismo tiempo desde una misma direcciòn IP
+const limiteInvitadosPorIP = 2
+
+var muSesionesInvitado sync.Mutex
+
+// Cuentas de invitado cuya MV està en la cola de creaciòn ò se està creando. Como la cola, se guardan en memoria.
+// Sus cuentas no se eliminan hasta que termina la creaciòn, para que la MV no quede sin propietario
+var (
+	muCreacionesInvitado sync.Mutex
+	creacionesInvitado   = map[string]bool{}
+)
+
+/*
+Funciòn que obtiene la duraciòn de las sesiones de invitado, que es la misma de la concesiòn de sus MV
+*/
+func duracionSesionInvitado() time.Duration {
+	return politicaConcesionRol("Invitado").Duracion
+}
+
+/*
+Funciòn que configura los endpoints para crear, consultar y cerrar las sesiones de los usuarios invitados
+*/
+func manejarInvitados() {
+
+	//Endpoint para crear una sesiòn de invitado con su cuenta temporal y su MV
+	http.HandleFunc("/json/createGuestMachine", func(w http.ResponseWriter, r *http.Request) {
+		// Verifica que la solicitud sea del método POST.
+		if r.Method != http.MethodPost {
+			http.Error(w, "Se requiere una solicitud POST", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var datos struct {
+			Ip           string
+			Distribucion string
+		}
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&datos); err != nil {
+			http.Error(w, "Error al decodificar el JSON ", http.StatusBadRequest)
+			return
+		}
+		if strings.TrimSpace(datos.Ip) == "" || strings.TrimSpace(datos.Distribucion) == "" {
+			http.Error(w, "La dirección IP del cliente y la distribución son obligatorias", http.StatusBadRequest)
+			return
+		}
+
+		sesion, mensaje, estado := createTempAccount(datos.Ip, datos.Distribucion)
+		if estado != http.StatusOK {
+			http.Error(w, mensaje, estado)
+			return
+		}
+
+		// Envía una respuesta al cliente. El campo mensaje conserva el email de la cuenta temporal
+		response := map[string]interface{}{
+			"mensaje":          sesion.Persona_email,
+			"token":            sesion.Token,
+			"fecha_expiracion": sesion.Fecha_expiracion,
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(response)
+	})
+
+	//Endpoint para consultar una sesiòn de invitado y su MV
+	http.HandleFunc("/json/consultGuestSession", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Se requiere una solicitud POST", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var datos struct {
+			Token string
+		}
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&datos); err != nil {
+			http.Error(w, "Error al decodificar JSON de la solicitud", http.StatusBadRequest)
+			return
+		}
+		sesion, err := getSesionInvitado(datos.Token)
+		if err != nil {
+			http.Error(w, "No se encontró la sesión", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(sesion)
+	})
+
+	//Endpoint para cerrar una sesiòn de invitado antes de su vencimiento. La MV y la cuenta se eliminan en segundo plano
+	http.HandleFunc("/json/closeGuestSession", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Se requiere una solicitud POST", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var datos struct {
+			Token string
+		}
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&datos); err != nil {
+			http.Error(w, "Error al decodificar JSON de la solicitud", http.StatusBadRequest)
+			return
+		}
+		if _, err := getSesionInvitado(datos.Token); err != nil {
+			http.Error(w, "No se encontró la sesión", http.StatusNotFound)
+			return
+		}
+		_, err := db.Exec("UPDATE sesion_invitado SET estado = ?, fecha_expiracion = LEAST(fecha_expiracion, ?) WHERE token = ?",
+			sesionCerrando, time.Now().UTC().Format("2006-01-02 15:04:05"), datos.Token)
+		if err != nil {
+			log.Println("Error al cerrar la sesiòn de invitado:", err)
+			http.Error(w, "Error al cerrar la sesión", http.StatusInternalServerError)
+			return
+		}
+		go revisarSesionesInvitado()
+
+		response := map[string]string{"mensaje": "Sesión cerrada. La máquina virtual y la cuenta temporal se eliminarán en breve"}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(response)
+	})
+}
+
+/*
+Funciòn que se encarga de crear cuentas temporales para usuarios invitados
+Registra la sesiòn del invitado, crea la cuenta en la base de datos y encola la creaciòn de su màquina virtual temporal.
+
+@clientIP Paràmetro que contiene la direcciòn IP desde la cual se està realizando la solicitud de crear la cuenta temporal
+@return Retorna la sesiòn creada, un mensaje de error y el còdigo HTTP del resultado
+*/
+func createTempAccount(clientIP string, distribucion_SO string) (SesionInvitado, string, int) {
+
+	var sesion SesionInvitado
+
+	//Se serializa la creaciòn de sesiones para que el lìmite por IP no se supere con solicitudes simultàneas
+	muSesionesInvitado.Lock()
+	defer muSesionesInvitado.Unlock()
+
+	var activas int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sesion_invitado WHERE ip_cliente = ? AND estado = ?", clientIP, sesionActiva).Scan(&activas); err != nil {
+		log.Println("Error al contar las sesiones de invitado:", err)
+		return sesion, "Error interno del servidor", http.StatusInternalServerError
+	}
+	if activas >= limiteInvitadosPorIP {
+		return sesion, fmt.Sprintf("Ya hay %d sesiones de invitado activas desde esta dirección IP", activas), http.StatusTooManyRequests
+	}
+
+	var persona Persona
+
+	persona.Nombre = "Usuario"
+	persona.Apellido = "Invitado"
+	persona.Email = generateRandomEmail()
+	persona.Rol = "Invitado"
+
+	//La contraseña de la cuenta temporal es aleatoria; el invitado se identifica con el token de la sesiòn
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(generarSecreto(16)), bcrypt.DefaultCost)
+	if err != nil {
+		log.Println("Error al encriptar la contraseña:", err)
+		return sesion, "Error al crear la cuenta temporal", http.StatusInternalServerError
+	}
+
+	ahora := time.Now().UTC().Truncate(time.Second)
+	sesion = SesionInvitado{
+		Token:            generarSecreto(32),
+		Persona_email:    persona.Email,
+		Ip_cliente:       clientIP,
+		Estado:           sesionActiva,
+		Fecha_creacion:   ahora,
+		Fecha_expiracion: ahora.Add(duracionSesionInvitado()),
+	}
+
+	//La sesiòn se registra antes que la cuenta para que la limpieza de cuentas huèrfanas no la elimine
+	_, err = db.Exec("INSERT INTO sesion_invitado (token, persona_email, ip_cliente, estado, fecha_creacion, fecha_expiracion) VALUES (?, ?, ?, ?, ?, ?)",
+		sesion.Token, sesion.Persona_email, sesion.Ip_cliente, sesion.Estado,
+		sesion.Fecha_creacion.Format("2006-01-02 15:04:05"), sesion.Fecha_expiracion.Format("2006-01-02 15:04:05"))
+	if err != nil {
+		log.Println("Error al registrar la sesiòn de invitado:", err)
+		return sesion, "Error al crear la sesión de invitado", http.StatusInternalServerError
+	}
+
+	query := "INSERT INTO persona (nombre, apellido, email, contrasenia, rol) VALUES ( ?, ?, ?, ?, ?);"
+
+	_, err1 := db.Exec(query, persona.Nombre, persona.Apellido, persona.Email, hashedPassword, persona.Rol)
+	if err1 != nil {
+		log.Println("Hubo un error al registrar el usuario en la base de datos", err1)
+		db.Exec("DELETE FROM sesion_invitado WHERE token = ?", sesion.Token)
+		return sesion, "Error al crear la cuenta temporal", http.StatusInternalServerError
+	}
+
+	muCreacionesInvitado.Lock()
+	creacionesInvitado[persona.Email] = true
+	muCreacionesInvitado.Unlock()
+	createTempVM(persona.Email, clientIP, distribucion_SO)
+
+	return sesion, "", http.StatusOK
+}
+
+/*
+Funciòn que consulta una sesiòn de invitado y su MV
+@token Paràmetro que contiene el token de la sesiòn
+*/
+func getSesionInvitado(token string) (SesionInvitado, error) {
+
+	var sesion SesionInvitado
+	if strings.TrimSpace(token) == "" {
+		return sesion, sql.ErrNoRows
+	}
+	var creacion, expiracion string
+	err := db.QueryRow("SELECT token, persona_email, ip_cliente, estado, fecha_creacion, fecha_expiracion FROM sesion_invitado WHERE token = ?", token).Scan(
+		&sesion.Token, &sesion.Persona_email, &sesion.Ip_cliente, &sesion.Estado, &creacion, &expiracion)
+	if err != nil {
+		return sesion, err
+	}
+	sesion.Fecha_creacion, _ = time.Parse("2006-01-02 15:04:05", creacion)
+	sesion.Fecha_expiracion, _ = time.Parse("2006-01-02 15:04:05", expiracion)
+
+	if persona, err := getUser(sesion.Persona_email); err == nil {
+		if maquinas, err := consultMachines(persona, FiltroMaquinas{}); err == nil && len(maquinas) > 0 {
+			sesion.Maquina_virtual = &maquinas[0]
+		}
+	}
+	return sesion, nil
+}
+
+/*
+Funciòn que establece el disparador que revisa las sesiones de invitado
+*/
+func checkSesionesInvitado() {
+
+	timeTicker := time.NewTicker(intervaloConcesiones)
+
+	for range timeTicker.C {
+		go revisarSesionesInvitado()
+	}
+}
+
+/*
+Funciòn que cierra las sesiones de invitado vencidas: apaga y elimina la MV del invitado y, cuando ya no tiene MV,
+elimina la cuenta temporal y la sesiòn. Tambièn elimina las cuentas de invitado que quedaron sin sesiòn ni MV
+*/
+func revisarSesionesInvitado() {
+
+	if !muSesionesInvitado.TryLock() {
+		return
+	}
+	defer muSesionesInvitado.Unlock()
+
+	_, err := db.Exec("UPDATE sesion_invitado SET estado = ? WHERE estado = ? AND fecha_expiracion <= ?",
+		sesionCerrando, sesionActiva, time.Now().UTC().Format("2006-01-02 15:04:05"))
+	if err != nil {
+		log.Println("Error al cerrar las sesiones de invitado vencidas:", err)
+		return
+	}
+
+	rows, err := db.Query("SELECT persona_email FROM sesion_invitado WHERE estado = ?", sesionCerrando)
+	if err != nil {
+		log.Println("Error al consultar las sesiones de invitado:", err)
+		return
+	}
+	var emails []string
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err == nil {
+			emails = append(emails, email)
+		}
+	}
+	rows.Close()
+
+	//Las cuentas de invitado creadas antes de las sesiones no tienen sesiòn; se eliminan cuando ya no tienen MV
+	rows, err = db.Query(`SELECT p.email FROM persona AS p WHERE p.rol = 'Invitado'
+		AND NOT EXISTS (SELECT 1 FROM sesion_invitado AS s WHERE s.persona_email = p.email)
+		AND NOT EXISTS (SELECT 1 FROM maquina_virtual AS m WHERE m.persona_email = p.email)`)
+	if err != nil {
+		log.Println("Error al consultar las cuentas de invitado huèrfanas:", err)
+		return
+	}
+	var huerfanas []string
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err == nil {
+			huerfanas = append(huerfanas, email)
+		}
+	}
+	rows.Close()
+
+	for _, email := range emails {
+		cerrarSesionInvitado(email)
+	}
+	for _, email := range huerfanas {
+		if !creacionInvitadoEnCurso(email) {
+			deleteAccount(email)
+		}
+	}
+}
+
+/*
+Funciòn que indica si la MV de un invitado està en la cola de creaciòn ò se està creando
+@email Paràmetro que contiene el email de la cuenta temporal del invitado
+*/
+func creacionInvitadoEnCurso(email string) bool {
+	muCreacionesInvitado.Lock()
+	defer muCreacionesInvitado.Unlock()
+	return creacionesInvitado[email]
+}
+
+/*
+Funciòn que registra que terminò la creaciòn de la MV de un invitado, con ò sin èxito. No hace nada para los demàs usuarios
+@email Paràmetro que contiene el email del propietario de la MV
+*/
+func finalizarCreacionInvitado(email string) {
+	muCreacionesInvitado.Lock()
+	delete(creacionesInvitado, email)
+	muCreacionesInvitado.Unlock()
+}
+
+/*
+Funciòn que avanza el cierre de la sesiòn de un invitado: encola el apagado de su MV encendida ò la eliminaciòn de
+su MV apagada, y elimina la cuenta y la sesiòn cuando ya no tiene MV
+@email Paràmetro que contiene el email de la cuenta temporal del invitado
+*/
+func cerrarSesionInvitado(email string) {
+
+	rows, err := db.Query("SELECT uuid, nombre, estado FROM maquina_virtual WHERE persona_email = ?", email)
+	if err != nil {
+		log.Println("Error al consultar las MV del invitado:", err)
+		return
+	}
+	var maquinas []Maquina_virtual
+	for rows.Next() {
+		var maquinaVirtual Maquina_virtual
+		if err := rows.Scan(&maquinaVirtual.Uuid, &maquinaVirtual.Nombre, &maquinaVirtual.Estado); err == nil {
+			maquinas = append(maquinas, maquinaVirtual)
+		}
+	}
+	rows.Close()
+
+	if len(maquinas) == 0 {
+		//Si la MV aùn se està creando, la cuenta se elimina en una pròxima ejecuciòn, cuando la MV ya està registrada
+		if creacionInvitadoEnCurso(email) {
+			return
+		}
+		deleteAccount(email)
+		return
+	}
+
+	for _, maquinaVirtual := range maquinas {
+		var tipoSolicitud string
+		switch maquinaVirtual.Estado {
+		case estadoEncendido, estadoPausado:
+			tipoSolicitud = "poweroff"
+		case estadoApagado, estadoGuardado, estadoError:
+			tipoSolicitud = "delete"
+		default:
+			//La MV està en una transiciòn; se revisa de nuevo en la siguiente ejecuciòn
+			continue
+		}
+		fmt.Println("Sesiòn de invitado vencida: " + tipoSolicitud + " de la màquina " + maquinaVirtual.Nombre)
+		mu.Lock()
+		managementQueue.Queue.PushBack(map[string]interface{}{
+			"tipo_solicitud": tipoSolicitud,
+			"nombreVM":       maquinaVirtual.Uuid,
+		})
+		mu.Unlock()
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/binary"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Tamaño de los sectores de una imagen ISO 9660
+const tamanioSectorISO = 2048
+
+/*
+Funciòn que genera en memoria una imagen ISO 9660 con los archivos indicados en su directorio raìz.
+Solo soporta lo necesario para las imàgenes de configuraciòn de las MV (por ejemplo, la semilla NoCloud de cloud-init):
+un ùnico directorio y nombres sin extensiones Joliet ni Rock Ridge. Linux muestra los nombres en minùsculas y sin el sufijo ";1"
+@etiqueta Paràmetro que contiene la etiqueta del volumen. Por ejemplo: CIDATA
+@archivos Paràmetro que contiene el contenido de cada archivo indexado por su nombre
+*/
+func crearISO(etiqueta string, archivos map[string][]byte) []byte {
+
+	nombres := make([]string, 0, len(archivos))
+	for nombre := range archivos {
+		nombres = append(nombres, nombre)
+	}
+	sort.Strings(nombres) //ISO 9660 exige que las entradas del directorio estèn ordenadas
+
+	//Distribuciòn de los sectores: 16 reservados, descriptor primario, terminador, tablas de rutas L y M, directorio raìz y archivos
+	const (
+		sectorDescriptor = 16
+		sectorTerminador = 17
+		sectorTablaL     = 18
+		sectorTablaM     = 19
+		sectorRaiz       = 20
+	)
+	sectorArchivo := make(map[string]int, len(nombres))
+	siguiente := sectorRaiz + 1
+	for _, nombre := range nombres {
+		sectorArchivo[nombre] = siguiente
+		siguiente += sectoresISO(len(archivos[nombre]))
+	}
+	totalSectores := siguiente
+
+	imagen := make([]byte, totalSectores*tamanioSectorISO)
+	fecha := time.Now().UTC()
+
+	//Directorio raìz: entradas "." y "..", seguidas de los archivos
+	raiz := registroDirectorioISO([]byte{0}, sectorRaiz, tamanioSectorISO, true, fecha)
+	directorio := append([]byte{}, raiz...)
+	directorio = append(directorio, registroDirectorioISO([]byte{1}, sectorRaiz, tamanioSectorISO, true, fecha)...)
+	for _, nombre := range nombres {
+		identificador := []byte(strings.ToUpper(nombre) + ";1")
+		directorio = append(directorio, registroDirectorioISO(identificador, sectorArchivo[nombre], len(archivos[nombre]), false, fecha)...)
+	}
+	copy(imagen[sectorRaiz*tamanioSectorISO:], directorio)
+
+	for _, nombre := range nombres {
+		copy(imagen[sectorArchivo[nombre]*tamanioSectorISO:], archivos[nombre])
+	}
+
+	//Tablas de rutas con una sola entrada para el directorio raìz
+	tablaL := []byte{1, 0, 0, 0, 0, 0, 1, 0, 0, 0}
+	binary.LittleEndian.PutUint32(tablaL[2:], sectorRaiz)
+	binary.LittleEndian.PutUint16(tablaL[6:], 1)
+	copy(imagen[sectorTablaL*tamanioSectorISO:], tablaL)
+	tablaM := []byte{1, 0, 0, 0, 0, 0, 0, 1, 0, 0}
+	binary.BigEndian.PutUint32(tablaM[2:], sectorRaiz)
+	binary.BigEndian.PutUint16(tablaM[6:], 1)
+	copy(imagen[sectorTablaM*tamanioSectorISO:], tablaM)
+
+	//Descriptor primario del volumen
+	pvd := imagen[sectorDescriptor*tamanioSectorISO : (sectorDescriptor+1)*tamanioSectorISO]
+	pvd[0] = 1
+	copy(pvd[1:6], "CD001")
+	pvd[6] = 1
+	copy(pvd[8:40], rellenarISO("", 32))
+	copy(pvd[40:72], rellenarISO(strings.ToUpper(etiqueta), 32))
+	ambosOrdenes32(pvd[80:88], uint32(totalSectores))
+	ambosOrdenes16(pvd[120:124], 1)
+	ambosOrdenes16(pvd[124:128], 1)
+	ambosOrdenes16(pvd[128:132], tamanioSectorISO)
+	ambosOrdenes32(pvd[132:140], uint32(len(tablaL)))
+	binary.LittleEndian.PutUint32(pvd[140:144], sectorTablaL)
+	binary.BigEndian.PutUint32(pvd[148:152], sectorTablaM)
+	copy(pvd[156:190], raiz)
+	copy(pvd[190:813], rellenarISO("", 813-190))
+	fechaTexto := []byte(fecha.Format("20060102150405") + "00")
+	copy(pvd[813:829], fechaTexto)
+	copy(pvd[830:846], fechaTexto)
+	copy(pvd[847:863], "0000000000000000")
+	copy(pvd[864:880], "0000000000000000")
+	pvd[881] = 1
+
+	//Terminador del conjunto de descriptores
+	terminador := imagen[sectorTerminador*tamanioSectorISO:]
+	terminador[0] = 255
+	copy(terminador[1:6], "CD001")
+	terminador[6] = 1
+
+	return imagen
+}
+
+// Retorna la cantidad de sectores que ocupa un archivo. Los archivos vacìos ocupan un sector
+func sectoresISO(tamanio int) int {
+	if tamanio == 0 {
+		return 1
+	}
+	return (tamanio + tamanioSectorISO - 1) / tamanioSectorISO
+}
+
+// Construye un registro de directorio ISO 9660 para un archivo o directorio
+func registroDirectorioISO(identificador []byte, sector int, tamanio int, esDirectorio bool, fecha time.Time) []byte {
+	longitud := 33 + len(identificador)
+	if longitud%2 != 0 {
+		longitud++
+	}
+	registro := make([]byte, longitud)
+	registro[0] = byte(longitud)
+	ambosOrdenes32(registro[2:10], uint32(sector))
+	ambosOrdenes32(registro[10:18], uint32(tamanio))
+	registro[18] = byte(fecha.Year() - 1900)
+	registro[19] = byte(fecha.Month())
+	registro[20] = byte(fecha.Day())
+	registro[21] = byte(fecha.Hour())
+	registro[22] = byte(fecha.Minute())
+	registro[23] = byte(fecha.Second())
+	if esDirectorio {
+		registro[25] = 2
+	}
+	ambosOrdenes16(registro[28:32], 1)
+	registro[32] = byte(len(identificador))
+	copy(registro[33:], identificador)
+	return registro
+}
+
+// Escribe un entero de 32 bits en formato little endian seguido del mismo valor en big endian
+func ambosOrdenes32(destino []byte, valor uint32) {
+	binary.LittleEndian.PutUint32(destino[0:4], valor)
+	binary.BigEndian.PutUint32(destino[4:8], valor)
+}
+
+// Escribe un entero de 16 bits en formato little endian seguido del mismo valor en big endian
+func ambosOrdenes16(destino []byte, valor uint16) {
+	binary.LittleEndian.PutUint16(destino[0:2], valor)
+	binary.BigEndian.PutUint16(destino[2:4], valor)
+}
+
+// Completa un texto con espacios hasta la longitud indicada, como exigen los campos de texto de ISO 9660
+func rellenarISO(texto string, longitud int) string {
+	if len(texto) >= longitud {
+		return texto[:longitud]
+	}
+	return texto + strings.Repeat(" ", longitud-len(texto))
+}
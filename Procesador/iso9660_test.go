@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// registroISO contiene los campos de un registro de directorio que verifican las pruebas
+type registroISO struct {
+	identificador string
+	sector        uint32
+	tamanio       uint32
+	esDirectorio  bool
+}
+
+// leerRegistrosISO recorre los registros de directorio de un sector hasta encontrar uno de longitud 0
+func leerRegistrosISO(t *testing.T, datos []byte) []registroISO {
+	t.Helper()
+	var registros []registroISO
+	for posicion := 0; posicion < len(datos) && datos[posicion] != 0; {
+		longitud := int(datos[posicion])
+		registro := datos[posicion : posicion+longitud]
+		registros = append(registros, registroISO{
+			identificador: string(registro[33 : 33+int(registro[32])]),
+			sector:        leerAmbosOrdenes32(t, registro[2:10]),
+			tamanio:       leerAmbosOrdenes32(t, registro[10:18]),
+			esDirectorio:  registro[25]&2 != 0,
+		})
+		posicion += longitud
+	}
+	return registros
+}
+
+// leerAmbosOrdenes32 lee un entero escrito en ambos òrdenes y verifica que las dos mitades coincidan
+func leerAmbosOrdenes32(t *testing.T, datos []byte) uint32 {
+	t.Helper()
+	little := binary.LittleEndian.Uint32(datos[0:4])
+	if big := binary.BigEndian.Uint32(datos[4:8]); little != big {
+		t.Errorf("valor en ambos òrdenes inconsistente: %d y %d", little, big)
+	}
+	return little
+}
+
+// leerAmbosOrdenes16 lee un entero de 16 bits escrito en ambos òrdenes y verifica que las dos mitades coincidan
+func leerAmbosOrdenes16(t *testing.T, datos []byte) uint16 {
+	t.Helper()
+	little := binary.LittleEndian.Uint16(datos[0:2])
+	if big := binary.BigEndian.Uint16(datos[2:4]); little != big {
+		t.Errorf("valor en ambos òrdenes inconsistente: %d y %d", little, big)
+	}
+	return little
+}
+
+func TestCrearISODescriptor(t *testing.T) {
+	archivos := map[string][]byte{
+		"user-data": []byte("#cloud-config\n"),
+		"meta-data": bytes.Repeat([]byte("x"), tamanioSectorISO+1),
+	}
+	imagen := crearISO("cidata", archivos)
+
+	//Raìz en el sector 20, meta-data ocupa dos sectores y user-data uno
+	totalSectores := 20 + 1 + 2 + 1
+	if len(imagen) != totalSectores*tamanioSectorISO {
+		t.Fatalf("tamaño de la imagen = %d, se esperaba %d", len(imagen), totalSectores*tamanioSectorISO)
+	}
+
+	pvd := imagen[16*tamanioSectorISO : 17*tamanioSectorISO]
+	if pvd[0] != 1 || string(pvd[1:6]) != "CD001" || pvd[6] != 1 {
+		t.Errorf("cabecera del descriptor primario = %v %q %v", pvd[0], pvd[1:6], pvd[6])
+	}
+	if etiqueta := string(pvd[40:72]); etiqueta != rellenarISO("CIDATA", 32) {
+		t.Errorf("etiqueta del volumen = %q, se esperaba CIDATA rellenada con espacios", etiqueta)
+	}
+	if sectores := leerAmbosOrdenes32(t, pvd[80:88]); sectores != uint32(totalSectores) {
+		t.Errorf("tamaño del volumen = %d sectores, se esperaba %d", sectores, totalSectores)
+	}
+	campos16 := []struct {
+		nombre   string
+		inicio   int
+		esperado uint16
+	}{
+		{"tamaño del conjunto", 120, 1},
+		{"nùmero de secuencia", 124, 1},
+		{"tamaño del bloque", 128, tamanioSectorISO},
+	}
+	for _, campo := range campos16 {
+		if valor := leerAmbosOrdenes16(t, pvd[campo.inicio:campo.inicio+4]); valor != campo.esperado {
+			t.Errorf("%s = %d, se esperaba %d", campo.nombre, valor, campo.esperado)
+		}
+	}
+	if tamanio := leerAmbosOrdenes32(t, pvd[132:140]); tamanio != 10 {
+		t.Errorf("tamaño de la tabla de rutas = %d, se esperaba 10", tamanio)
+	}
+	if sector := binary.LittleEndian.Uint32(pvd[140:144]); sector != 18 {
+		t.Errorf("sector de la tabla de rutas L = %d, se esperaba 18", sector)
+	}
+	if sector := binary.BigEndian.Uint32(pvd[148:152]); sector != 19 {
+		t.Errorf("sector de la tabla de rutas M = %d, se esperaba 19", sector)
+	}
+	if pvd[881] != 1 {
+		t.Errorf("versiòn de la estructura de archivos = %d, se esperaba 1", pvd[881])
+	}
+
+	//El registro del directorio raìz del descriptor apunta al sector 20
+	raiz := leerRegistrosISO(t, pvd[156:190])
+	if len(raiz) != 1 || raiz[0] != (registroISO{"\x00", 20, tamanioSectorISO, true}) {
+		t.Errorf("registro raìz del descriptor = %+v", raiz)
+	}
+
+	//Tablas de rutas con la ùnica entrada del directorio raìz
+	tablaL := imagen[18*tamanioSectorISO : 18*tamanioSectorISO+10]
+	if binary.LittleEndian.Uint32(tablaL[2:6]) != 20 || binary.LittleEndian.Uint16(tablaL[6:8]) != 1 {
+		t.Errorf("tabla de rutas L = %v", tablaL)
+	}
+	tablaM := imagen[19*tamanioSectorISO : 19*tamanioSectorISO+10]
+	if binary.BigEndian.Uint32(tablaM[2:6]) != 20 || binary.BigEndian.Uint16(tablaM[6:8]) != 1 {
+		t.Errorf("tabla de rutas M = %v", tablaM)
+	}
+
+	terminador := imagen[17*tamanioSectorISO:]
+	if terminador[0] != 255 || string(terminador[1:6]) != "CD001" || terminador[6] != 1 {
+		t.Errorf("terminador = %v %q %v", terminador[0], terminador[1:6], terminador[6])
+	}
+}
+
+func TestCrearISODirectorioRaiz(t *testing.T) {
+	casos := []struct {
+		nombre   string
+		archivos map[string][]byte
+		esperado []registroISO
+	}{
+		{
+			"sin archivos",
+			map[string][]byte{},
+			[]registroISO{
+				{"\x00", 20, tamanioSectorISO, true},
+				{"\x01", 20, tamanioSectorISO, true},
+			},
+		},
+		{
+			"semilla NoCloud ordenada",
+			map[string][]byte{
+				"user-data":      []byte("#cloud-config\n"),
+				"meta-data":      bytes.Repeat([]byte("x"), tamanioSectorISO+1),
+				"network-config": {},
+			},
+			[]registroISO{
+				{"\x00", 20, tamanioSectorISO, true},
+				{"\x01", 20, tamanioSectorISO, true},
+				{"META-DATA;1", 21, tamanioSectorISO + 1, false},
+				{"NETWORK-CONFIG;1", 23, 0, false},
+				{"USER-DATA;1", 24, 14, false},
+			},
+		},
+	}
+	for _, caso := range casos {
+		t.Run(caso.nombre, func(t *testing.T) {
+			imagen := crearISO("cidata", caso.archivos)
+			registros := leerRegistrosISO(t, imagen[20*tamanioSectorISO:21*tamanioSectorISO])
+			if len(registros) != len(caso.esperado) {
+				t.Fatalf("registros del directorio raìz = %+v, se esperaba %+v", registros, caso.esperado)
+			}
+			for i := range registros {
+				if registros[i] != caso.esperado[i] {
+					t.Errorf("registro %d = %+v, se esperaba %+v", i, registros[i], caso.esperado[i])
+				}
+			}
+
+			//El contenido de cada archivo empieza en su sector y el resto queda en ceros
+			for _, registro := range registros {
+				if registro.esDirectorio {
+					continue
+				}
+				inicio := int(registro.sector) * tamanioSectorISO
+				fin := inicio + sectoresISO(int(registro.tamanio))*tamanioSectorISO
+				contenido := imagen[inicio : inicio+int(registro.tamanio)]
+				for nombre, datos := range caso.archivos {
+					if registro.identificador == strings.ToUpper(nombre)+";1" && !bytes.Equal(contenido, datos) {
+						t.Errorf("contenido de %s no coincide", nombre)
+					}
+				}
+				if relleno := imagen[inicio+int(registro.tamanio) : fin]; !bytes.Equal(relleno, make([]byte, len(relleno))) {
+					t.Errorf("el relleno de %s no està en ceros", registro.identificador)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,461 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+/*
+Estructura de datos tipo JSON que representa una imagen ISO registrada en un host. Por ejemplo: un instalador o un CD de herramientas
+@Id Representa el identificador ùnico de la imagen
+@Nombre Representa el nombre de la imagen
+@Ruta_ubicacion Representa la ubicaciòn del archivo de la imagen en el host
+@Sistema_operativo Representa el sistema operativo que instala la imagen. Por ejemplo: Linux. Està vacìo en los CD de herramientas
+@Distribucion_sistema_operativo Representa la distribuciòn del sistema operativo. Por ejemplo: Ubuntu
+@Arquitectura Representa la arquitectura del sistema operativo: 32 ò 64
+@Host_id Representa el identificador ùnico del host en el cual està la imagen
+*/
+type ImagenISO struct {
+	Id                             int
+	Nombre                         string
+	Ruta_ubicacion                 string
+	Sistema_operativo              string
+	Distribucion_sistema_operativo string
+	Arquitectura                   int
+	Host_id                        int
+}
+
+// Puerto del controlador "optico" en el que se conectan las imàgenes ISO. El puerto 1 lo usa la semilla de cloud-init
+const puertoUnidadISO = "0"
+
+// Capacidad en mb del disco de las MV creadas desde una imagen ISO cuando la solicitud no la indica
+const tamanioDiscoISODefecto = 20480
+
+// Dispositivos que se pueden indicar en el orden de arranque de una MV
+var dispositivosArranque = map[string]bool{"disk": true, "dvd": true, "net": true, "floppy": true, "none": true}
+
+/*
+Funciòn que configura los endpoints de la biblioteca de imàgenes ISO. El registro y la eliminaciòn de imàgenes solo los pueden
+realizar los administradores; las solicitudes para conectar, expulsar y cambiar el orden de arranque se encolan en la cola de gestiòn
+*/
+func manejarISOs() {
+
+	//Endpoint para consultar las imàgenes ISO. Si se indica host_id solo se consultan las de ese host
+	http.HandleFunc("/json/consultISOs", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Se requiere una solicitud Get", http.StatusMethodNotAllowed)
+			return
+		}
+
+		hostId, _ := strconv.Atoi(r.URL.Query().Get("host_id"))
+		imagenes, err := consultImagenesISO(hostId)
+		if err != nil {
+			log.Printf("Error al consultar las imágenes ISO: %v", err)
+			http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(imagenes)
+	})
+
+	//Endpoint para registrar una imagen ISO que ya està en la carpeta de un host
+	http.HandleFunc("/json/addISO", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Se requiere una solicitud POST", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var datos struct {
+			Email string
+			Iso   ImagenISO
+		}
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&datos); err != nil {
+			http.Error(w, "Error al decodificar JSON de la solicitud", http.StatusBadRequest)
+			return
+		}
+		if !esAdministrador(datos.Email) {
+			http.Error(w, "Solo los administradores pueden gestionar las imágenes ISO", http.StatusForbidden)
+			return
+		}
+		if err := validarImagenISO(datos.Iso); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		resultado, err := db.Exec("INSERT INTO imagen_iso (nombre, ruta_ubicacion, sistema_operativo, distribucion_sistema_operativo, arquitectura, host_id) VALUES (?, ?, ?, ?, ?, ?)",
+			datos.Iso.Nombre, datos.Iso.Ruta_ubicacion, datos.Iso.Sistema_operativo, datos.Iso.Distribucion_sistema_operativo, datos.Iso.Arquitectura, datos.Iso.Host_id)
+		if err != nil {
+			log.Println("Error al registrar la imagen ISO:", err)
+			http.Error(w, "Error al registrar la imagen ISO", http.StatusInternalServerError)
+			return
+		}
+		id, _ := resultado.LastInsertId()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]int64{"id": id})
+	})
+
+	//Endpoint para eliminar el registro de una imagen ISO. El archivo se conserva en el host
+	http.HandleFunc("/json/deleteISO", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Se requiere una solicitud POST", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var datos struct {
+			Email string
+			Id    int
+		}
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&datos); err != nil {
+			http.Error(w, "Error al decodificar JSON de la solicitud", http.StatusBadRequest)
+			return
+		}
+		if !esAdministrador(datos.Email) {
+			http.Error(w, "Solo los administradores pueden gestionar las imágenes ISO", http.StatusForbidden)
+			return
+		}
+
+		resultado, err := db.Exec("DELETE FROM imagen_iso WHERE id = ?", datos.Id)
+		if err != nil {
+			log.Println("Error al eliminar la imagen ISO:", err)
+			http.Error(w, "Error al eliminar la imagen ISO", http.StatusInternalServerError)
+			return
+		}
+		if filas, _ := resultado.RowsAffected(); filas == 0 {
+			http.Error(w, "No se encontró la imagen ISO", http.StatusNotFound)
+			return
+		}
+
+		response := map[string]string{"mensaje": "Imagen ISO eliminada correctamente"}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(response)
+	})
+
+	//Endpoints para conectar y expulsar imàgenes ISO y para cambiar el orden de arranque de una MV
+	encolarSolicitudUnidad := func(tipoEsperado string, mensaje string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				http.Error(w, "Se requiere una solicitud POST", http.StatusMethodNotAllowed)
+				return
+			}
+
+			var datos map[string]interface{}
+			decoder := json.NewDecoder(r.Body)
+			if err := decoder.Decode(&datos); err != nil {
+				http.Error(w, "Error al decodificar JSON de la solicitud", http.StatusBadRequest)
+				return
+			}
+
+			tipoSolicitud, _ := datos["tipo_solicitud"].(string)
+			if tipoSolicitud != tipoEsperado {
+				http.Error(w, "El campo 'tipo_solicitud' debe ser '"+tipoEsperado+"'", http.StatusBadRequest)
+				return
+			}
+
+			nombreVM, _ := datos["nombreVM"].(string)
+			email, _ := datos["email"].(string)
+			if err := validarNombre(nombreVM); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if mensajeError, estado := validarPropietarioOAdministrador(nombreVM, email); estado != http.StatusOK {
+				http.Error(w, mensajeError, estado)
+				return
+			}
+
+			switch tipoSolicitud {
+			case "attach_iso":
+				idISO, _ := datos["idISO"].(float64)
+				imagen, err := getImagenISO(int(idISO))
+				if err != nil {
+					http.Error(w, "No se encontró la imagen ISO", http.StatusNotFound)
+					return
+				}
+				if maquinaVirtual, _ := getVM(nombreVM); maquinaVirtual.Host_id != imagen.Host_id {
+					http.Error(w, "La imagen ISO debe estar en el mismo host que la máquina virtual", http.StatusBadRequest)
+					return
+				}
+
+			case "boot_order":
+				if _, err := ordenArranqueSolicitud(datos["orden"]); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+			}
+
+			// Encola las peticiones.
+			identificarMV(datos)
+			mu.Lock()
+			managementQueue.Queue.PushBack(datos)
+			mu.Unlock()
+
+			// Envía una respuesta al cliente.
+			response := map[string]string{"mensaje": mensaje}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(response)
+		}
+	}
+
+	http.HandleFunc("/json/attachISO", encolarSolicitudUnidad("attach_iso", "Mensaje JSON para conectar la imagen ISO recibido correctamente"))
+	http.HandleFunc("/json/ejectISO", encolarSolicitudUnidad("eject_iso", "Mensaje JSON para expulsar la imagen ISO recibido correctamente"))
+	http.HandleFunc("/json/bootOrder", encolarSolicitudUnidad("boot_order", "Mensaje JSON para cambiar el orden de arranque recibido correctamente"))
+}
+
+/*
+Funciòn que valida los campos de una imagen ISO antes de registrarla
+@imagen Paràmetro que contiene la imagen a validar
+*/
+func validarImagenISO(imagen ImagenISO) error {
+	if err := validarNombre(imagen.Nombre); err != nil {
+		return err
+	}
+	if !strings.HasSuffix(strings.ToLower(imagen.Ruta_ubicacion), ".iso") {
+		return errors.New("la ruta de la imagen debe terminar en .iso")
+	}
+	if imagen.Arquitectura != 0 && imagen.Arquitectura != 32 && imagen.Arquitectura != 64 {
+		return errors.New("la arquitectura debe ser 32 ò 64")
+	}
+	if _, err := getHost(imagen.Host_id); err != nil {
+		return errors.New("el host de la imagen no existe")
+	}
+	return nil
+}
+
+/*
+Funciòn que convierte el orden de arranque recibido en una solicitud en una lista de dispositivos
+@valor Paràmetro que contiene la lista recibida en el JSON. Por ejemplo: ["dvd", "disk"]
+*/
+func ordenArranqueSolicitud(valor interface{}) ([]string, error) {
+	lista, _ := valor.([]interface{})
+	if len(lista) == 0 || len(lista) > 4 {
+		return nil, errors.New("el orden de arranque debe tener entre 1 y 4 dispositivos")
+	}
+	orden := make([]string, 0, len(lista))
+	for _, elemento := range lista {
+		dispositivo, _ := elemento.(string)
+		if !dispositivosArranque[dispositivo] {
+			return nil, errors.New("el dispositivo de arranque '" + dispositivo + "' no es vàlido")
+		}
+		orden = append(orden, dispositivo)
+	}
+	return orden, nil
+}
+
+/*
+Funciòn que conecta una imagen ISO de la biblioteca a la unidad de DVD de una MV. Si la MV aùn no tiene unidad de DVD debe estar apagada
+@nameVM Paràmetro que contiene el nombre de la màquina virtual
+@idISO Paràmetro que contiene el identificador de la imagen ISO
+*/
+func conectarISO(nameVM string, idISO int) string {
+
+	imagen, err := getImagenISO(idISO)
+	if err != nil {
+		return "No se encontrò la imagen ISO"
+	}
+
+	maquinaVirtual, host, config, mensaje := prepararUnidadOptica(nameVM)
+	if mensaje != "" {
+		return mensaje
+	}
+	if maquinaVirtual.Host_id != imagen.Host_id {
+		return "La imagen ISO debe estar en el mismo host que la MV"
+	}
+
+	if err := asegurarControladorOptico(host, config, nameVM); err != nil {
+		log.Println("Error al agregar el controlador de la unidad òptica:", err)
+		return "Error al agregar la unidad de DVD. Apague la MV e intente de nuevo"
+	}
+
+	if _, err := ejecutarVBoxManage(host, config, "storageattach", nameVM, "--storagectl", "optico", "--port", puertoUnidadISO, "--device", "0", "--type", "dvddrive", "--medium", imagen.Ruta_ubicacion, "--forceunmount"); err != nil {
+		log.Println("Error al conectar la imagen ISO:", err)
+		return "Error al conectar la imagen ISO: " + describirErrorSSH(err)
+	}
+
+	fmt.Println("Imagen ISO conectada correctamente")
+	return "Imagen ISO conectada correctamente"
+}
+
+/*
+Funciòn que expulsa la imagen ISO de la unidad de DVD de una MV. La unidad queda vacìa
+@nameVM Paràmetro que contiene el nombre de la màquina virtual
+*/
+func expulsarISO(nameVM string) string {
+
+	_, host, config, mensaje := prepararUnidadOptica(nameVM)
+	if mensaje != "" {
+		return mensaje
+	}
+
+	if _, err := ejecutarVBoxManage(host, config, "storageattach", nameVM, "--storagectl", "optico", "--port", puertoUnidadISO, "--device", "0", "--type", "dvddrive", "--medium", "emptydrive", "--forceunmount"); err != nil {
+		log.Println("Error al expulsar la imagen ISO:", err)
+		return "Error al expulsar la imagen ISO: " + describirErrorSSH(err)
+	}
+
+	fmt.Println("Imagen ISO expulsada correctamente")
+	return "Imagen ISO expulsada correctamente"
+}
+
+/*
+Funciòn que cambia el orden de arranque de una MV, que debe estar apagada. Las posiciones no indicadas quedan en "none"
+@nameVM Paràmetro que contiene el nombre de la màquina virtual
+@orden Paràmetro que contiene los dispositivos de arranque en orden. Por ejemplo: dvd, disk
+*/
+func cambiarOrdenArranque(nameVM string, orden []string) string {
+
+	_, host, config, mensaje := prepararUnidadOptica(nameVM)
+	if mensaje != "" {
+		return mensaje
+	}
+
+	if running, err := isRunning(nameVM, host, config); err != nil || running {
+		return "Debe apagar la màquina para cambiar el orden de arranque"
+	}
+
+	if _, mensaje := configurarOrdenArranque(host, config, nameVM, orden); mensaje != "" {
+		return mensaje
+	}
+
+	fmt.Println("Orden de arranque modificado correctamente")
+	return "Orden de arranque modificado correctamente"
+}
+
+/*
+Funciòn que envìa al host el comando para asignar el orden de arranque de una MV
+@return Retorna la salida del comando y un mensaje de error si el comando fallò
+*/
+func configurarOrdenArranque(host Host, config *ssh.ClientConfig, nameVM string, orden []string) (string, string) {
+	argumentos := []string{"modifyvm", nameVM}
+	for i := 0; i < 4; i++ {
+		dispositivo := "none"
+		if i < len(orden) {
+			dispositivo = orden[i]
+		}
+		argumentos = append(argumentos, "--boot"+strconv.Itoa(i+1), dispositivo)
+	}
+	salida, err := ejecutarVBoxManage(host, config, argumentos...)
+	if err != nil {
+		log.Println("Error al cambiar el orden de arranque:", err)
+		return salida, "Error al cambiar el orden de arranque: " + describirErrorSSH(err)
+	}
+	return salida, ""
+}
+
+/*
+Funciòn que obtiene la MV, su host y la configuraciòn SSH para las operaciones sobre la unidad de DVD
+@return Retorna la MV, el host, la configuraciòn SSH y un mensaje de error si no se puede continuar
+*/
+func prepararUnidadOptica(nameVM string) (Maquina_virtual, Host, *ssh.ClientConfig, string) {
+
+	maquinaVirtual, err := getVM(nameVM)
+	if err != nil {
+		log.Println("Error al obtener la MV:", err)
+		return maquinaVirtual, Host{}, nil, "Error al obtener la MV"
+	}
+
+	host, err := getHost(maquinaVirtual.Host_id)
+	if err != nil {
+		log.Println("Error al obtener el host:", err)
+		return maquinaVirtual, host, nil, "Error al obtener el host"
+	}
+
+	config, err := configurarSSH(host.Hostname, *privateKeyPath)
+	if err != nil {
+		log.Println("Error al configurar SSH:", err)
+		return maquinaVirtual, host, nil, "Error al configurar SSH"
+	}
+	return maquinaVirtual, host, config, ""
+}
+
+/*
+Funciòn que prepara una MV reciè creada para instalar el sistema operativo desde una imagen ISO: crea un disco vacìo propio
+en el puerto 0 del controlador "hardisk", conecta la imagen a la unidad de DVD y arranca primero desde el DVD
+@nameVM Paràmetro que contiene el nombre de la MV reciè creada
+@imagen Paràmetro que contiene la imagen ISO de instalaciòn
+@directorio Paràmetro que contiene la carpeta del host en la que se crea el disco
+@tamanio Paràmetro que contiene la capacidad del disco en mb
+*/
+func prepararMVDesdeISO(host Host, config *ssh.ClientConfig, nameVM string, imagen ImagenISO, directorio string, tamanio int) string {
+
+	if host.Almacenamiento_usado+tamanio > host.Almacenamiento_total {
+		return "El host no tiene almacenamiento disponible para el disco de la MV"
+	}
+
+	ruta := dialectoDeHost(host).unirRuta(directorio, nameVM+".vdi")
+	if _, err := ejecutarVBoxManage(host, config, "createmedium", "disk", "--filename", ruta, "--size", strconv.Itoa(tamanio), "--format", "VDI"); err != nil {
+		log.Println("Error al crear el disco de la MV:", err)
+		return "Error al crear el disco de la MV: " + describirErrorSSH(err)
+	}
+
+	if _, err := ejecutarVBoxManage(host, config, "storageattach", nameVM, "--storagectl", "hardisk", "--port", "0", "--device", "0", "--type", "hdd", "--medium", ruta); err != nil {
+		log.Println("Error al conectar el disco a la MV:", err)
+		ejecutarVBoxManage(host, config, "closemedium", "disk", ruta, "--delete")
+		return "Error al conectar el disco a la MV"
+	}
+
+	if err := asegurarControladorOptico(host, config, nameVM); err != nil {
+		log.Println("Error al agregar el controlador de la unidad òptica:", err)
+		return "Error al agregar el controlador de la unidad òptica"
+	}
+	if _, err := ejecutarVBoxManage(host, config, "storageattach", nameVM, "--storagectl", "optico", "--port", puertoUnidadISO, "--device", "0", "--type", "dvddrive", "--medium", imagen.Ruta_ubicacion); err != nil {
+		log.Println("Error al conectar la imagen ISO:", err)
+		return "Error al conectar la imagen ISO"
+	}
+
+	if _, mensaje := configurarOrdenArranque(host, config, nameVM, []string{"dvd", "disk"}); mensaje != "" {
+		return mensaje
+	}
+	return ""
+}
+
+/*
+Funciòn que obtiene una imagen ISO dado su identificador ùnico
+*/
+func getImagenISO(idISO int) (ImagenISO, error) {
+	var imagen ImagenISO
+	err := db.QueryRow("SELECT id, nombre, ruta_ubicacion, sistema_operativo, distribucion_sistema_operativo, arquitectura, host_id FROM imagen_iso WHERE id = ?", idISO).Scan(
+		&imagen.Id, &imagen.Nombre, &imagen.Ruta_ubicacion, &imagen.Sistema_operativo, &imagen.Distribucion_sistema_operativo, &imagen.Arquitectura, &imagen.Host_id)
+	return imagen, err
+}
+
+/*
+Funciòn que consulta las imàgenes ISO registradas
+@hostId Paràmetro que contiene el host del cual se consultan las imàgenes. Si es 0 se consultan las de todos los hosts
+*/
+func consultImagenesISO(hostId int) ([]ImagenISO, error) {
+	var rows *sql.Rows
+	var err error
+	if hostId > 0 {
+		rows, err = db.Query("SELECT id, nombre, ruta_ubicacion, sistema_operativo, distribucion_sistema_operativo, arquitectura, host_id FROM imagen_iso WHERE host_id = ? ORDER BY nombre", hostId)
+	} else {
+		rows, err = db.Query("SELECT id, nombre, ruta_ubicacion, sistema_operativo, distribucion_sistema_operativo, arquitectura, host_id FROM imagen_iso ORDER BY nombre")
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var imagenes []ImagenISO
+	for rows.Next() {
+		var imagen ImagenISO
+		if err := rows.Scan(&imagen.Id, &imagen.Nombre, &imagen.Ruta_ubicacion, &imagen.Sistema_operativo, &imagen.Distribucion_sistema_operativo, &imagen.Arquitectura, &imagen.Host_id); err != nil {
+			return nil, err
+		}
+		imagenes = append(imagenes, imagen)
+	}
+	return imagenes, rows.Err()
+}
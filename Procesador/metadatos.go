@@ -0,0 +1,368 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Cantidad màxima de etiquetas de una MV
+const maxEtiquetasMV = 20
+
+// Longitud màxima de la descripciòn de una MV
+const longitudDescripcionMV = 500
+
+var patronEtiqueta = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.:-]{0,49}$`)
+
+var errFiltroInvalido = errors.New("filtro de consulta inválido")
+
+/*
+Estructura de datos tipo JSON con los filtros de la consulta de màquinas virtuales. Los filtros vacìos no se aplican
+@Etiquetas Representa las etiquetas que deben tener todas las MV consultadas
+@Texto Representa un texto que debe aparecer en el nombre ò en la descripciòn de la MV
+@Estado Representa el estado de las MV consultadas
+*/
+type FiltroMaquinas struct {
+	Etiquetas []string
+	Texto     string
+	Estado    string
+}
+
+/*
+Funciòn que configura los endpoints para renombrar una MV y editar su descripciòn y sus etiquetas
+*/
+func manejarMetadatos() {
+
+	//Endpoint para renombrar una MV. El cambio se hace en VirtualBox y en la base de datos, por lo que se encola
+	http.HandleFunc("/json/renameVM", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Se requiere una solicitud POST", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var datos map[string]interface{}
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&datos); err != nil {
+			http.Error(w, "Error al decodificar JSON de la solicitud", http.StatusBadRequest)
+			return
+		}
+
+		tipoSolicitud, _ := datos["tipo_solicitud"].(string)
+		if tipoSolicitud != "rename" {
+			http.Error(w, "El campo 'tipo_solicitud' debe ser 'rename'", http.StatusBadRequest)
+			return
+		}
+
+		email, _ := datos["email"].(string)
+		nombreVM, _ := datos["nombreVM"].(string)
+		nuevoNombre, _ := datos["nuevoNombre"].(string)
+		if err := validarNombre(nombreVM); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		//El nombre final lleva 4 caracteres aleatorios, igual que al crear la MV
+		if err := validarNombre(nuevoNombre); err != nil || len(nuevoNombre) > 95 {
+			http.Error(w, "El nuevo nombre solo puede contener letras, números, '.', '_' y '-', con máximo 95 caracteres", http.StatusBadRequest)
+			return
+		}
+		if mensaje, estado := validarPropietarioOAdministrador(nombreVM, email); estado != http.StatusOK {
+			http.Error(w, mensaje, estado)
+			return
+		}
+		identificarMV(datos)
+
+		// Encola las peticiones.
+		mu.Lock()
+		managementQueue.Queue.PushBack(datos)
+		mu.Unlock()
+
+		// Envía una respuesta al cliente.
+		response := map[string]string{"mensaje": "Mensaje JSON para renombrar la MV recibido correctamente"}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(response)
+	})
+
+	//Endpoint para cambiar la descripciòn y las etiquetas de una MV. Solo se modifican los campos enviados
+	http.HandleFunc("/json/updateVMMetadata", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Se requiere una solicitud POST", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var datos map[string]interface{}
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&datos); err != nil {
+			http.Error(w, "Error al decodificar JSON de la solicitud", http.StatusBadRequest)
+			return
+		}
+
+		email, _ := datos["email"].(string)
+		nombreVM, _ := datos["nombreVM"].(string)
+		if err := validarNombre(nombreVM); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if mensaje, estado := validarPropietarioOAdministrador(nombreVM, email); estado != http.StatusOK {
+			http.Error(w, mensaje, estado)
+			return
+		}
+		maquinaVirtual, _ := getVM(nombreVM)
+
+		if valor, presente := datos["descripcion"]; presente {
+			descripcion, _ := valor.(string)
+			if err := guardarDescripcionMV(maquinaVirtual.Uuid, descripcion); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if valor, presente := datos["etiquetas"]; presente {
+			lista, _ := valor.([]interface{})
+			etiquetas := make([]string, 0, len(lista))
+			for _, elemento := range lista {
+				etiqueta, _ := elemento.(string)
+				etiquetas = append(etiquetas, etiqueta)
+			}
+			if err := guardarEtiquetasMV(maquinaVirtual.Uuid, etiquetas); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		maquinaVirtual.Descripcion, maquinaVirtual.Etiquetas = getMetadatosMV(maquinaVirtual.Uuid)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(maquinaVirtual)
+	})
+}
+
+/*
+Funciòn que reemplaza en una solicitud encolada el nombre de la MV por su uuid, para que la operaciòn se aplique
+a la misma MV aunque se renombre antes de que se procese. Si la MV no existe la solicitud no se modifica
+@datos Paràmetro que contiene la solicitud. El nombre està en "nombreVM" ò en el campo Nombre de "specifications"
+*/
+func identificarMV(datos map[string]interface{}) {
+	if nombreVM, ok := datos["nombreVM"].(string); ok && nombreVM != "" {
+		if maquinaVirtual, err := getVM(nombreVM); err == nil {
+			datos["nombreVM"] = maquinaVirtual.Uuid
+		}
+	}
+	if specs, ok := datos["specifications"].(map[string]interface{}); ok {
+		if nombreVM, ok := specs["Nombre"].(string); ok && nombreVM != "" {
+			if maquinaVirtual, err := getVM(nombreVM); err == nil {
+				specs["Nombre"] = maquinaVirtual.Uuid
+			}
+		}
+	}
+}
+
+/*
+Funciòn que cambia el nombre de una MV apagada en VirtualBox y en la base de datos. Al nombre nuevo se le agregan
+4 caracteres aleatorios, igual que al crear la MV, para que sea ùnico
+@nameVM Paràmetro que contiene el uuid ò el nombre de la MV
+@nuevoNombre Paràmetro que contiene el nombre base nuevo
+*/
+func renombrarMV(nameVM string, nuevoNombre string) string {
+
+	maquinaVirtual, err := getVM(nameVM)
+	if err != nil {
+		log.Println("Error al obtener la MV:", err)
+		return "Error al obtener la MV"
+	}
+	if maquinaVirtual.Estado != estadoApagado {
+		return "Debe apagar la màquina para renombrarla"
+	}
+	host, err := getHost(maquinaVirtual.Host_id)
+	if err != nil {
+		log.Println("Error al obtener el host:", err)
+		return "Error al obtener el host"
+	}
+	config, err := configurarSSH(host.Hostname, *privateKeyPath)
+	if err != nil {
+		log.Println("Error al configurar SSH:", err)
+		return "Error al configurar SSH"
+	}
+	if running, err := isRunning(maquinaVirtual.Uuid, host, config); err != nil || running {
+		return "Debe apagar la màquina para renombrarla"
+	}
+
+	nombreFinal, mensaje := generarNombreMV(nuevoNombre)
+	if mensaje != "" {
+		return mensaje
+	}
+
+	if _, err := ejecutarVBoxManage(host, config, "modifyvm", maquinaVirtual.Uuid, "--name", nombreFinal); err != nil {
+		log.Println("Error al renombrar la MV:", err)
+		return "Error al renombrar la MV: " + describirErrorSSH(err)
+	}
+	if _, err := db.Exec("UPDATE maquina_virtual SET nombre = ? WHERE uuid = ?", nombreFinal, maquinaVirtual.Uuid); err != nil {
+		log.Println("Error al guardar el nuevo nombre de la MV:", err)
+		//Devuelve el nombre anterior en VirtualBox para que coincida con la base de datos
+		if _, err := ejecutarVBoxManage(host, config, "modifyvm", maquinaVirtual.Uuid, "--name", maquinaVirtual.Nombre); err != nil {
+			log.Println("Error al restaurar el nombre de la MV en VirtualBox:", err)
+		}
+		return "Error al guardar el nuevo nombre de la MV"
+	}
+
+	fmt.Println("Màquina " + maquinaVirtual.Nombre + " renombrada a " + nombreFinal)
+	return "Màquina renombrada a " + nombreFinal
+}
+
+/*
+Funciòn que guarda la descripciòn de una MV
+@uuidVM Paràmetro que contiene el uuid de la MV
+@descripcion Paràmetro que contiene la descripciòn. Si està vacìa se elimina
+*/
+func guardarDescripcionMV(uuidVM string, descripcion string) error {
+	descripcion = strings.TrimSpace(descripcion)
+	if len([]rune(descripcion)) > longitudDescripcionMV {
+		return fmt.Errorf("la descripción no puede tener más de %d caracteres", longitudDescripcionMV)
+	}
+	_, err := db.Exec(`INSERT INTO metadatos_mv (maquina_virtual_uuid, descripcion) VALUES (?, ?)
+		ON DUPLICATE KEY UPDATE descripcion = VALUES(descripcion)`, uuidVM, descripcion)
+	if err != nil {
+		log.Println("Error al guardar la descripciòn de la MV:", err)
+		return errors.New("error al guardar la descripción de la máquina virtual")
+	}
+	return nil
+}
+
+/*
+Funciòn que reemplaza las etiquetas de una MV. Las etiquetas se guardan en minùsculas y sin repetir
+@uuidVM Paràmetro que contiene el uuid de la MV
+@etiquetas Paràmetro que contiene las nuevas etiquetas. Si està vacìo se eliminan todas
+*/
+func guardarEtiquetasMV(uuidVM string, etiquetas []string) error {
+
+	etiquetas, err := normalizarEtiquetas(etiquetas)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Println("Error al iniciar la transacciòn:", err)
+		return errors.New("error al guardar las etiquetas de la máquina virtual")
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM etiqueta_mv WHERE maquina_virtual_uuid = ?", uuidVM); err != nil {
+		log.Println("Error al eliminar las etiquetas de la MV:", err)
+		return errors.New("error al guardar las etiquetas de la máquina virtual")
+	}
+	for _, etiqueta := range etiquetas {
+		if _, err := tx.Exec("INSERT INTO etiqueta_mv (maquina_virtual_uuid, etiqueta) VALUES (?, ?)", uuidVM, etiqueta); err != nil {
+			log.Println("Error al guardar la etiqueta de la MV:", err)
+			return errors.New("error al guardar las etiquetas de la máquina virtual")
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Println("Error al confirmar la transacciòn:", err)
+		return errors.New("error al guardar las etiquetas de la máquina virtual")
+	}
+	return nil
+}
+
+/*
+Funciòn que valida las etiquetas de una MV y las convierte a minùsculas, eliminando las repetidas
+@return Retorna las etiquetas normalizadas, ò un error si alguna no es vàlida
+*/
+func normalizarEtiquetas(etiquetas []string) ([]string, error) {
+	var resultado []string
+	vistas := make(map[string]bool)
+	for _, etiqueta := range etiquetas {
+		etiqueta = strings.ToLower(strings.TrimSpace(etiqueta))
+		if !patronEtiqueta.MatchString(etiqueta) {
+			return nil, errors.New("la etiqueta '" + etiqueta + "' solo puede contener letras, números, '.', '_', ':' y '-', con máximo 50 caracteres")
+		}
+		if !vistas[etiqueta] {
+			vistas[etiqueta] = true
+			resultado = append(resultado, etiqueta)
+		}
+	}
+	if len(resultado) > maxEtiquetasMV {
+		return nil, fmt.Errorf("una máquina virtual no puede tener más de %d etiquetas", maxEtiquetasMV)
+	}
+	return resultado, nil
+}
+
+/*
+Funciòn que consulta la descripciòn y las etiquetas de una MV
+@uuidVM Paràmetro que contiene el uuid de la MV
+*/
+func getMetadatosMV(uuidVM string) (string, []string) {
+	var descripcion string
+	db.QueryRow("SELECT descripcion FROM metadatos_mv WHERE maquina_virtual_uuid = ?", uuidVM).Scan(&descripcion)
+
+	etiquetas := []string{}
+	rows, err := db.Query("SELECT etiqueta FROM etiqueta_mv WHERE maquina_virtual_uuid = ? ORDER BY etiqueta", uuidVM)
+	if err != nil {
+		log.Println("Error al consultar las etiquetas de la MV:", err)
+		return descripcion, etiquetas
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var etiqueta string
+		if err := rows.Scan(&etiqueta); err == nil {
+			etiquetas = append(etiquetas, etiqueta)
+		}
+	}
+	return descripcion, etiquetas
+}
+
+/*
+Funciòn que copia la descripciòn y las etiquetas de una MV en otra, por ejemplo al clonarla
+*/
+func copiarMetadatosMV(uuidOrigen string, uuidDestino string) {
+	descripcion, etiquetas := getMetadatosMV(uuidOrigen)
+	if descripcion != "" {
+		guardarDescripcionMV(uuidDestino, descripcion)
+	}
+	if len(etiquetas) > 0 {
+		guardarEtiquetasMV(uuidDestino, etiquetas)
+	}
+}
+
+/*
+Funciòn que elimina la descripciòn y las etiquetas de una MV eliminada
+*/
+func eliminarMetadatosMV(uuidVM string) {
+	db.Exec("DELETE FROM metadatos_mv WHERE maquina_virtual_uuid = ?", uuidVM)
+	db.Exec("DELETE FROM etiqueta_mv WHERE maquina_virtual_uuid = ?", uuidVM)
+}
+
+/*
+Funciòn que construye las condiciones SQL de un filtro de màquinas virtuales sobre la tabla maquina_virtual con alias m
+@return Retorna las condiciones, unidas con AND, y sus argumentos
+*/
+func condicionesFiltroMaquinas(filtro FiltroMaquinas) ([]string, []interface{}, error) {
+	var condiciones []string
+	var argumentos []interface{}
+
+	if filtro.Estado != "" {
+		condiciones = append(condiciones, "m.estado = ?")
+		argumentos = append(argumentos, filtro.Estado)
+	}
+	if texto := strings.TrimSpace(filtro.Texto); texto != "" {
+		patron := "%" + strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_").Replace(texto) + "%"
+		condiciones = append(condiciones, "(m.nombre LIKE ? OR m.uuid IN (SELECT maquina_virtual_uuid FROM metadatos_mv WHERE descripcion LIKE ?))")
+		argumentos = append(argumentos, patron, patron)
+	}
+	if len(filtro.Etiquetas) > 0 {
+		etiquetas, err := normalizarEtiquetas(filtro.Etiquetas)
+		if err != nil {
+			return nil, nil, err
+		}
+		marcadores := strings.TrimSuffix(strings.Repeat("?, ", len(etiquetas)), ", ")
+		condiciones = append(condiciones, "m.uuid IN (SELECT maquina_virtual_uuid FROM etiqueta_mv WHERE etiqueta IN ("+marcadores+") GROUP BY maquina_virtual_uuid HAVING COUNT(*) = ?)")
+		for _, etiqueta := range etiquetas {
+			argumentos = append(argumentos, etiqueta)
+		}
+		argumentos = append(argumentos, len(etiquetas))
+	}
+	return condiciones, argumentos, nil
+}
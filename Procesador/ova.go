@@ -0,0 +1,440 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+/*
+Funciòn que configura los endpoints para exportar màquinas virtuales como archivos OVA, descargarlos e importar archivos OVA.
+Las exportaciones e importaciones se registran como trabajos y se encolan en la cola de gestiòn
+*/
+func manejarOVA() {
+
+	//Endpoint para exportar una màquina virtual apagada como un archivo OVA
+	http.HandleFunc("/json/exportVM", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Se requiere una solicitud POST", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var datos map[string]interface{}
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&datos); err != nil {
+			http.Error(w, "Error al decodificar JSON de la solicitud", http.StatusBadRequest)
+			return
+		}
+
+		nombreVM, _ := datos["nombreVM"].(string)
+		email, _ := datos["email"].(string)
+		if err := validarNombre(nombreVM); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if mensaje, estado := validarPropietarioOAdministrador(nombreVM, email); estado != http.StatusOK {
+			http.Error(w, mensaje, estado)
+			return
+		}
+
+		maquinaVirtual, _ := getVM(nombreVM)
+		if maquinaVirtual.Estado != estadoApagado {
+			http.Error(w, "Debe apagar la máquina virtual para exportarla", http.StatusConflict)
+			return
+		}
+
+		trabajoId, err := crearTrabajo("export", nombreVM, email, maquinaVirtual.Host_id)
+		if err != nil {
+			log.Println("Error al registrar el trabajo:", err)
+			http.Error(w, "Error al registrar el trabajo", http.StatusInternalServerError)
+			return
+		}
+
+		// Encola las peticiones.
+		mu.Lock()
+		managementQueue.Queue.PushBack(map[string]interface{}{"tipo_solicitud": "export", "trabajo_id": trabajoId})
+		mu.Unlock()
+
+		// Envía una respuesta al cliente.
+		response := map[string]interface{}{"mensaje": "Exportación de la MV encolada correctamente", "trabajo_id": trabajoId}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(response)
+	})
+
+	//Endpoint para descargar el archivo OVA de una exportaciòn terminada. El archivo se elimina del host una vez descargado
+	http.HandleFunc("/json/downloadExport", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Se requiere una solicitud GET", http.StatusMethodNotAllowed)
+			return
+		}
+
+		id, err := strconv.Atoi(r.URL.Query().Get("id"))
+		if err != nil {
+			http.Error(w, "El identificador del trabajo no es válido", http.StatusBadRequest)
+			return
+		}
+		email := r.URL.Query().Get("email")
+
+		trabajo, err := getTrabajo(id)
+		if err != nil || trabajo.Tipo != "export" {
+			http.Error(w, "No se encontró la exportación", http.StatusNotFound)
+			return
+		}
+		if trabajo.Persona_email != email && !esAdministrador(email) {
+			http.Error(w, "No tiene permiso para descargar la exportación", http.StatusForbidden)
+			return
+		}
+		if trabajo.Estado != trabajoTerminado || trabajo.Ruta == "" {
+			http.Error(w, "La exportación no está disponible para descargar", http.StatusConflict)
+			return
+		}
+
+		host, err := getHost(trabajo.Host_id)
+		if err != nil {
+			http.Error(w, "Error al obtener el host", http.StatusInternalServerError)
+			return
+		}
+		config, err := configurarSSH(host.Hostname, *privateKeyPath)
+		if err != nil {
+			http.Error(w, "Error al configurar SSH", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", "attachment; filename=\""+trabajo.Maquina_virtual+".ova\"")
+		if err := copiarArchivoDeHost(host, config, trabajo.Ruta, w, tiempoComandoLargoSSH); err != nil {
+			//Los encabezados ya se enviaron, por lo que el error solo se registra y el archivo se conserva para otro intento
+			log.Println("Error al descargar el archivo OVA:", err)
+			return
+		}
+
+		if _, err := ejecutarEnHost(host, config, dialectoDeHost(host).eliminarArchivo(trabajo.Ruta)); err != nil {
+			log.Println("Error al eliminar el archivo OVA del host:", err)
+		}
+		asignarRutaTrabajo(trabajo.Id, "")
+	})
+
+	//Endpoint para importar un archivo OVA. El archivo se envìa en el cuerpo de la solicitud y los datos en la URL:
+	// /json/importVM?email=...&nombre=...&host_id=...&sistema_operativo=...&distribucion=...
+	http.HandleFunc("/json/importVM", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Se requiere una solicitud POST", http.StatusMethodNotAllowed)
+			return
+		}
+
+		parametros := r.URL.Query()
+		email := parametros.Get("email")
+		nombre := parametros.Get("nombre")
+		if err := validarNombre(nombre); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		persona, err := getUser(email)
+		if err != nil {
+			http.Error(w, "No se encontró el usuario solicitante", http.StatusNotFound)
+			return
+		}
+		if persona.Rol == "Invitado" {
+			http.Error(w, "Los usuarios invitados no pueden importar máquinas virtuales", http.StatusForbidden)
+			return
+		}
+		//La memoria y la CPU de la MV importada se verifican cuando se analiza el archivo
+		if err := validarCuotaMV(email, 1, 0, 0); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
+		//Si no se indica el host se elige uno de forma aleatoria, como en la creaciòn de MV
+		var host Host
+		if hostId, _ := strconv.Atoi(parametros.Get("host_id")); hostId > 0 {
+			host, err = getHost(hostId)
+		} else {
+			host, err = selectHost()
+		}
+		if err != nil {
+			http.Error(w, "No se encontró el host", http.StatusNotFound)
+			return
+		}
+
+		directorio, err := directorioDiscosHost(host)
+		if err != nil {
+			http.Error(w, "El host no tiene una carpeta de discos registrada", http.StatusConflict)
+			return
+		}
+		config, err := configurarSSH(host.Hostname, *privateKeyPath)
+		if err != nil {
+			http.Error(w, "Error al configurar SSH", http.StatusInternalServerError)
+			return
+		}
+
+		//El archivo no puede ser mayor que el almacenamiento libre del host
+		disponible := int64(host.Almacenamiento_total-host.Almacenamiento_usado) * 1024 * 1024
+		if disponible <= 0 {
+			http.Error(w, "El host no tiene almacenamiento disponible", http.StatusInsufficientStorage)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, disponible)
+
+		trabajoId, err := crearTrabajo("import", nombre, email, host.Id)
+		if err != nil {
+			log.Println("Error al registrar el trabajo:", err)
+			http.Error(w, "Error al registrar el trabajo", http.StatusInternalServerError)
+			return
+		}
+
+		ruta := dialectoDeHost(host).unirRuta(directorio, "importacion_"+strconv.Itoa(trabajoId)+".ova")
+		actualizarTrabajo(trabajoId, trabajoEnCurso, "Recibiendo el archivo OVA")
+		if err := copiarFlujoAHost(host, config, ruta, r.Body, tiempoComandoLargoSSH); err != nil {
+			log.Println("Error al copiar el archivo OVA al host:", err)
+			ejecutarEnHost(host, config, dialectoDeHost(host).eliminarArchivo(ruta))
+			actualizarTrabajo(trabajoId, trabajoError, "Error al recibir el archivo OVA")
+			http.Error(w, "Error al recibir el archivo OVA", http.StatusBadRequest)
+			return
+		}
+		asignarRutaTrabajo(trabajoId, ruta)
+		actualizarTrabajo(trabajoId, trabajoPendiente, "Archivo OVA recibido")
+
+		// Encola las peticiones.
+		mu.Lock()
+		managementQueue.Queue.PushBack(map[string]interface{}{
+			"tipo_solicitud":    "import",
+			"trabajo_id":        trabajoId,
+			"sistema_operativo": parametros.Get("sistema_operativo"),
+			"distribucion":      parametros.Get("distribucion"),
+		})
+		mu.Unlock()
+
+		// Envía una respuesta al cliente.
+		response := map[string]interface{}{"mensaje": "Importación de la MV encolada correctamente", "trabajo_id": trabajoId}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(response)
+	})
+}
+
+/*
+Funciòn que exporta una MV apagada como un archivo OVA en la carpeta de discos de su host.
+La ruta del archivo se guarda en el trabajo para que el usuario lo descargue
+@trabajoId Paràmetro que contiene el identificador del trabajo de exportaciòn
+*/
+func exportarMV(trabajoId int) string {
+
+	trabajo, err := getTrabajo(trabajoId)
+	if err != nil {
+		log.Println("Error al obtener el trabajo:", err)
+		return "Error al obtener el trabajo"
+	}
+	mensaje := ejecutarExportacion(trabajo)
+	if mensaje != "" {
+		actualizarTrabajo(trabajo.Id, trabajoError, mensaje)
+		return mensaje
+	}
+	actualizarTrabajo(trabajo.Id, trabajoTerminado, "MV exportada correctamente")
+	fmt.Println("MV exportada correctamente")
+	return "MV exportada correctamente"
+}
+
+/*
+Funciòn que realiza la exportaciòn de un trabajo
+@return Retorna un mensaje de error, o una cadena vacìa si la exportaciòn fue exitosa
+*/
+func ejecutarExportacion(trabajo Trabajo) string {
+
+	maquinaVirtual, err := getVM(trabajo.Maquina_virtual)
+	if err != nil {
+		log.Println("Error al obtener la MV:", err)
+		return "Error al obtener la MV"
+	}
+
+	host, err := getHost(maquinaVirtual.Host_id)
+	if err != nil {
+		log.Println("Error al obtener el host:", err)
+		return "Error al obtener el host"
+	}
+
+	config, err := configurarSSH(host.Hostname, *privateKeyPath)
+	if err != nil {
+		log.Println("Error al configurar SSH:", err)
+		return "Error al configurar SSH"
+	}
+
+	info, err := obtenerInfoMV(host, config, maquinaVirtual.Nombre)
+	if err != nil {
+		log.Println("Error al obtener la informaciòn de la MV:", err)
+		return "Error al obtener la informaciòn de la MV"
+	}
+	if info.encendida() {
+		return "Debe apagar la màquina para exportarla"
+	}
+
+	directorio, err := directorioDiscosHost(host)
+	if err != nil {
+		return "El host no tiene una carpeta de discos registrada"
+	}
+	dialecto := dialectoDeHost(host)
+	ruta := dialecto.unirRuta(directorio, "exportacion_"+strconv.Itoa(trabajo.Id)+"_"+maquinaVirtual.Nombre+".ova")
+
+	actualizarTrabajo(trabajo.Id, trabajoEnCurso, "Exportando la MV")
+	if _, err := dialecto.ejecutar(host.Ip, vboxManage("export", maquinaVirtual.Nombre, "--output", ruta, "--ovf20"), config, tiempoComandoLargoSSH); err != nil {
+		log.Println("Error al exportar la MV:", err)
+		dialecto.ejecutar(host.Ip, dialecto.eliminarArchivo(ruta), config, tiempoComandoSSH)
+		return "Error al exportar la MV: " + describirErrorSSH(err)
+	}
+
+	asignarRutaTrabajo(trabajo.Id, ruta)
+	return ""
+}
+
+/*
+Funciòn que importa un archivo OVA recibido en el host del trabajo y registra la MV a nombre del solicitante.
+Antes de importarlo consulta la RAM y CPU que pide el archivo para validarlas con los recursos del host, y al terminar
+reserva esos recursos igual que crateVM. El disco de la MV importada es propio, por lo que se registra como un clon sin origen
+@trabajoId Paràmetro que contiene el identificador del trabajo de importaciòn
+@sistemaOperativo Paràmetro que contiene el sistema operativo de la MV importada. Por ejemplo: Linux
+@distribucion Paràmetro que contiene la distribuciòn del sistema operativo. Por ejemplo: Ubuntu
+*/
+func importarMV(trabajoId int, sistemaOperativo string, distribucion string) string {
+
+	trabajo, err := getTrabajo(trabajoId)
+	if err != nil {
+		log.Println("Error al obtener el trabajo:", err)
+		return "Error al obtener el trabajo"
+	}
+
+	host, err := getHost(trabajo.Host_id)
+	if err != nil {
+		log.Println("Error al obtener el host:", err)
+		actualizarTrabajo(trabajo.Id, trabajoError, "Error al obtener el host")
+		return "Error al obtener el host"
+	}
+
+	config, err := configurarSSH(host.Hostname, *privateKeyPath)
+	if err != nil {
+		log.Println("Error al configurar SSH:", err)
+		actualizarTrabajo(trabajo.Id, trabajoError, "Error al configurar SSH")
+		return "Error al configurar SSH"
+	}
+
+	nameVM, mensaje := ejecutarImportacion(trabajo, host, config, sistemaOperativo, distribucion)
+
+	//El archivo OVA se elimina del host tanto si la importaciòn fue exitosa como si fallò
+	if _, err := ejecutarEnHost(host, config, dialectoDeHost(host).eliminarArchivo(trabajo.Ruta)); err != nil {
+		log.Println("Error al eliminar el archivo OVA del host:", err)
+	}
+	asignarRutaTrabajo(trabajo.Id, "")
+
+	if mensaje != "" {
+		actualizarTrabajo(trabajo.Id, trabajoError, mensaje)
+		return mensaje
+	}
+	actualizarTrabajo(trabajo.Id, trabajoTerminado, "MV importada correctamente con el nombre "+nameVM)
+	fmt.Println("MV importada correctamente")
+	return "MV importada correctamente"
+}
+
+/*
+Funciòn que realiza la importaciòn de un trabajo
+@return Retorna el nombre de la MV importada, o un mensaje de error
+*/
+func ejecutarImportacion(trabajo Trabajo, host Host, config *ssh.ClientConfig, sistemaOperativo string, distribucion string) (string, string) {
+
+	dialecto := dialectoDeHost(host)
+	actualizarTrabajo(trabajo.Id, trabajoEnCurso, "Analizando el archivo OVA")
+
+	//Analiza el archivo sin importarlo para conocer los recursos de la MV
+	analisis, err := ejecutarVBoxManage(host, config, "import", trabajo.Ruta, "--dry-run")
+	if err != nil {
+		log.Println("Error al analizar el archivo OVA:", err)
+		return "", "El archivo no es un OVA vàlido: " + describirErrorSSH(err)
+	}
+	ram, cpu := parsearAnalisisImportacion(analisis)
+	if ram <= 0 || cpu <= 0 {
+		return "", "El archivo OVA no describe la memoria y la CPU de la MV"
+	}
+	nameVM, mensaje := generarNombreMV(trabajo.Maquina_virtual)
+	if nameVM == "" {
+		return "", mensaje
+	}
+	if err := reservarCuotaMV(nameVM, trabajo.Persona_email, ram, cpu); err != nil {
+		return "", err.Error()
+	}
+	defer liberarCuotaMV(nameVM)
+
+	//Vuelve a consultar el host para validar los recursos con las reservas actuales
+	host, err = getHost(host.Id)
+	if err != nil {
+		return "", "Error al obtener el host"
+	}
+	if !validarDisponibilidadRecursosHost(cpu, ram, host) {
+		return "", "No hay recursos disponibles en el host para importar la MV"
+	}
+
+	actualizarTrabajo(trabajo.Id, trabajoEnCurso, "Importando la MV")
+	if _, err := dialecto.ejecutar(host.Ip, vboxManage("import", trabajo.Ruta, "--vsys", "0", "--vmname", nameVM), config, tiempoComandoLargoSSH); err != nil {
+		log.Println("Error al importar la MV:", err)
+		return "", "Error al importar la MV: " + describirErrorSSH(err)
+	}
+
+	//Desde aquì la MV importada està registrada en VirtualBox; si algùn paso falla se elimina junto con sus discos
+	info, err := obtenerInfoMV(host, config, nameVM)
+	if err != nil {
+		log.Println("Error al obtener la informaciòn de la MV:", err)
+		descartarMVCreada(host, config, Maquina_virtual{Nombre: nameVM}, false)
+		return "", "Error al obtener la informaciòn de la MV importada"
+	}
+
+	//Conecta la MV a la red del host en modo puente, como las MV creadas en la plataforma
+	if mensaje := configurarRedMV(host, config, info.Uuid, nameVM, "", ""); mensaje != "" {
+		descartarMVCreada(host, config, Maquina_virtual{Uuid: info.Uuid, Nombre: nameVM}, false)
+		return "", mensaje
+	}
+
+	//Los discos importados ocupan almacenamiento en el host hasta que se elimina la MV
+	tamanio := 0
+	for _, medio := range info.discosDuros() {
+		if disco, err := obtenerInfoMedio(host, config, medio.Uuid); err == nil {
+			tamanio += disco.Tamanio
+		}
+	}
+
+	//La MV se asocia al disco del catàlogo del mismo sistema operativo, o a cualquier disco del host si no hay uno
+	disco, err := getDisk(sistemaOperativo, distribucion, host.Id)
+	if err != nil {
+		disco, _ = getPrimerDiscoHost(host.Id)
+	}
+
+	maquinaVirtual := Maquina_virtual{
+		Uuid:           info.Uuid,
+		Nombre:         nameVM,
+		Ram:            info.Ram,
+		Cpu:            info.Cpu,
+		Estado:         estadoApagado,
+		Hostname:       "uqcloud",
+		Persona_email:  trabajo.Persona_email,
+		Fecha_creacion: time.Now().UTC(),
+	}
+	if mensaje := registrarMVCreada(maquinaVirtual, host, disco.Id); mensaje != "" {
+		descartarMVCreada(host, config, maquinaVirtual, false)
+		return "", mensaje
+	}
+
+	_, err = db.Exec("INSERT INTO clon (maquina_virtual_uuid, origen_uuid, modo, snapshot_id, tamanio) VALUES (?, '', 'import', 0, ?)", maquinaVirtual.Uuid, tamanio)
+	if err != nil {
+		log.Println("Error al registrar el disco de la MV importada:", err)
+	}
+	if tamanio > 0 {
+		if _, err := db.Exec("UPDATE host SET almacenamiento_usado = almacenamiento_usado + ? WHERE id = ?", tamanio, host.Id); err != nil {
+			log.Println("Error al actualizar el almacenamiento usado del host:", err)
+		}
+	}
+
+	return nameVM, ""
+}
@@ -0,0 +1,435 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"golang.org/x/crypto/ssh"
+)
+
+/*
+Estructura de datos tipo JSON que representa una plantilla para crear màquinas virtuales
+@Id Representa el identificador ùnico de la plantilla
+@Nombre Representa el nombre de la plantilla
+@Descripcion Representa la descripciòn de la plantilla
+@Disco_id Representa el disco base de las MV creadas con la plantilla. Las MV pueden crearse en cualquier host que tenga un disco con el mismo sistema operativo y distribuciòn
+@Ram_defecto Representa la memoria RAM asignada cuando la solicitud no indica una. Se representa en mb
+@Ram_maxima Representa la memoria RAM màxima que se puede solicitar. Se representa en mb
+@Cpu_defecto Representa las unidades de procesamiento asignadas cuando la solicitud no indica una cantidad
+@Cpu_maxima Representa las unidades de procesamiento màximas que se pueden solicitar
+@Modo_red Representa el modo del adaptador de red de las MV creadas con la plantilla: bridged, nat, natnetwork ò hostonly
+@Discos_extra Representa la capacidad en mb de cada disco de datos que se crea con la MV
+@Aprovisionamiento Representa los comandos que se ejecutan en la MV por SSH despuès del primer encendido
+@Configuracion_inicial Representa la configuraciòn de cloud-init de las MV creadas con la plantilla. Es opcional
+*/
+type Plantilla struct {
+	Id                    int
+	Nombre                string
+	Descripcion           string
+	Disco_id              int
+	Ram_defecto           int
+	Ram_maxima            int
+	Cpu_defecto           int
+	Cpu_maxima            int
+	Modo_red              string
+	Discos_extra          []int
+	Aprovisionamiento     []string
+	Configuracion_inicial *ConfiguracionInicial
+}
+
+/*
+Funciòn que configura los endpoints para consultar y administrar las plantillas de màquinas virtuales.
+La creaciòn, modificaciòn y eliminaciòn solo las pueden realizar los administradores
+*/
+func manejarPlantillas() {
+
+	//Endpoint para consultar las plantillas
+	http.HandleFunc("/json/consultTemplates", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Se requiere una solicitud Get", http.StatusMethodNotAllowed)
+			return
+		}
+
+		plantillas, err := consultPlantillas()
+		if err != nil {
+			log.Printf("Error al consultar las plantillas: %v", err)
+			http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(plantillas)
+	})
+
+	//Endpoint para crear una plantilla
+	http.HandleFunc("/json/createTemplate", func(w http.ResponseWriter, r *http.Request) {
+		plantilla, ok := decodificarSolicitudPlantilla(w, r)
+		if !ok {
+			return
+		}
+
+		id, err := guardarPlantilla(plantilla)
+		if err != nil {
+			log.Println("Error al crear la plantilla:", err)
+			http.Error(w, "Error al crear la plantilla", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]int{"id": id})
+	})
+
+	//Endpoint para modificar una plantilla
+	http.HandleFunc("/json/updateTemplate", func(w http.ResponseWriter, r *http.Request) {
+		plantilla, ok := decodificarSolicitudPlantilla(w, r)
+		if !ok {
+			return
+		}
+		if _, err := getPlantilla(plantilla.Id); err != nil {
+			http.Error(w, "No se encontró la plantilla", http.StatusNotFound)
+			return
+		}
+
+		if _, err := guardarPlantilla(plantilla); err != nil {
+			log.Println("Error al modificar la plantilla:", err)
+			http.Error(w, "Error al modificar la plantilla", http.StatusInternalServerError)
+			return
+		}
+
+		response := map[string]string{"mensaje": "Plantilla modificada correctamente"}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(response)
+	})
+
+	//Endpoint para eliminar una plantilla
+	http.HandleFunc("/json/deleteTemplate", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Se requiere una solicitud POST", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var datos struct {
+			Email string
+			Id    int
+		}
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&datos); err != nil {
+			http.Error(w, "Error al decodificar JSON de la solicitud", http.StatusBadRequest)
+			return
+		}
+		if !esAdministrador(datos.Email) {
+			http.Error(w, "Solo los administradores pueden gestionar plantillas", http.StatusForbidden)
+			return
+		}
+
+		//Los cursos, sus laboratorios y las reservas vigentes fallarìan al usar una plantilla eliminada
+		if mensaje, err := referenciasPlantilla(datos.Id); err != nil {
+			log.Println("Error al consultar las referencias de la plantilla:", err)
+			http.Error(w, "Error al eliminar la plantilla", http.StatusInternalServerError)
+			return
+		} else if mensaje != "" {
+			http.Error(w, mensaje, http.StatusConflict)
+			return
+		}
+
+		resultado, err := db.Exec("DELETE FROM plantilla WHERE id = ?", datos.Id)
+		if err != nil {
+			log.Println("Error al eliminar la plantilla:", err)
+			http.Error(w, "Error al eliminar la plantilla", http.StatusInternalServerError)
+			return
+		}
+		if filas, _ := resultado.RowsAffected(); filas == 0 {
+			http.Error(w, "No se encontró la plantilla", http.StatusNotFound)
+			return
+		}
+
+		response := map[string]string{"mensaje": "Plantilla eliminada correctamente"}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(response)
+	})
+}
+
+/*
+Funciòn que verifica si una plantilla està en uso por un curso, un laboratorio ò una reserva que aùn no termina
+@return Retorna un mensaje que indica el uso de la plantilla, ò una cadena vacìa si no està en uso
+*/
+func referenciasPlantilla(id int) (string, error) {
+	referencias := []struct {
+		consulta string
+		mensaje  string
+	}{
+		{"SELECT COUNT(*) FROM curso_plantilla WHERE plantilla_id = ?", "La plantilla está permitida en uno o más cursos"},
+		{"SELECT COUNT(*) FROM laboratorio WHERE plantilla_id = ?", "La plantilla se usa en uno o más laboratorios"},
+		{"SELECT COUNT(*) FROM reserva WHERE plantilla_id = ? AND estado = '" + reservaActiva + "' AND fecha_fin > UTC_TIMESTAMP()", "La plantilla se usa en una o más reservas vigentes"},
+	}
+	for _, referencia := range referencias {
+		var cantidad int
+		if err := db.QueryRow(referencia.consulta, id).Scan(&cantidad); err != nil {
+			return "", err
+		}
+		if cantidad > 0 {
+			return referencia.mensaje, nil
+		}
+	}
+	return "", nil
+}
+
+/*
+Funciòn que decodifica y valida las solicitudes de creaciòn y modificaciòn de plantillas: {"email": ..., "plantilla": {...}}
+@return Retorna la plantilla y true si la solicitud es vàlida. En otro caso responde el error al cliente y retorna false
+*/
+func decodificarSolicitudPlantilla(w http.ResponseWriter, r *http.Request) (Plantilla, bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Se requiere una solicitud POST", http.StatusMethodNotAllowed)
+		return Plantilla{}, false
+	}
+
+	var datos struct {
+		Email     string
+		Plantilla Plantilla
+	}
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&datos); err != nil {
+		http.Error(w, "Error al decodificar JSON de la solicitud", http.StatusBadRequest)
+		return Plantilla{}, false
+	}
+	if !esAdministrador(datos.Email) {
+		http.Error(w, "Solo los administradores pueden gestionar plantillas", http.StatusForbidden)
+		return Plantilla{}, false
+	}
+	if err := validarPlantilla(&datos.Plantilla); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return Plantilla{}, false
+	}
+	return datos.Plantilla, true
+}
+
+/*
+Funciòn que valida los campos de una plantilla y completa los valores por defecto
+@plantilla Paràmetro que contiene la plantilla a validar
+*/
+func validarPlantilla(plantilla *Plantilla) error {
+	if err := validarNombre(plantilla.Nombre); err != nil {
+		return err
+	}
+	if _, err := getDiskById(plantilla.Disco_id); err != nil {
+		return errors.New("el disco base de la plantilla no existe")
+	}
+	if plantilla.Ram_maxima <= 0 || plantilla.Cpu_maxima <= 0 {
+		return errors.New("la RAM y la CPU màximas deben ser mayores que cero")
+	}
+	if plantilla.Ram_defecto <= 0 || plantilla.Ram_defecto > plantilla.Ram_maxima {
+		return errors.New("la RAM por defecto debe estar entre 1 y la RAM màxima")
+	}
+	if plantilla.Cpu_defecto <= 0 || plantilla.Cpu_defecto > plantilla.Cpu_maxima {
+		return errors.New("la CPU por defecto debe estar entre 1 y la CPU màxima")
+	}
+	if plantilla.Modo_red == "" {
+		plantilla.Modo_red = "bridged"
+	}
+	if err := validarModoRed(plantilla.Modo_red, ""); err != nil {
+		return err
+	}
+	for _, tamanio := range plantilla.Discos_extra {
+		if tamanio <= 0 {
+			return errors.New("la capacidad de los discos extra debe ser mayor que cero")
+		}
+	}
+	if plantilla.Configuracion_inicial != nil {
+		return validarConfiguracionInicial(plantilla.Configuracion_inicial)
+	}
+	return nil
+}
+
+/*
+Funciòn que crea una plantilla, o la modifica si tiene un identificador asignado
+@return Retorna el identificador de la plantilla
+*/
+func guardarPlantilla(plantilla Plantilla) (int, error) {
+	discosExtra, err := json.Marshal(plantilla.Discos_extra)
+	if err != nil {
+		return 0, err
+	}
+	aprovisionamiento, err := json.Marshal(plantilla.Aprovisionamiento)
+	if err != nil {
+		return 0, err
+	}
+	configuracionInicial, err := json.Marshal(plantilla.Configuracion_inicial)
+	if err != nil {
+		return 0, err
+	}
+
+	if plantilla.Id > 0 {
+		_, err := db.Exec("UPDATE plantilla SET nombre = ?, descripcion = ?, disco_id = ?, ram_defecto = ?, ram_maxima = ?, cpu_defecto = ?, cpu_maxima = ?, modo_red = ?, discos_extra = ?, aprovisionamiento = ?, configuracion_inicial = ? WHERE id = ?",
+			plantilla.Nombre, plantilla.Descripcion, plantilla.Disco_id, plantilla.Ram_defecto, plantilla.Ram_maxima, plantilla.Cpu_defecto, plantilla.Cpu_maxima,
+			plantilla.Modo_red, string(discosExtra), string(aprovisionamiento), string(configuracionInicial), plantilla.Id)
+		return plantilla.Id, err
+	}
+
+	resultado, err := db.Exec("INSERT INTO plantilla (nombre, descripcion, disco_id, ram_defecto, ram_maxima, cpu_defecto, cpu_maxima, modo_red, discos_extra, aprovisionamiento, configuracion_inicial) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		plantilla.Nombre, plantilla.Descripcion, plantilla.Disco_id, plantilla.Ram_defecto, plantilla.Ram_maxima, plantilla.Cpu_defecto, plantilla.Cpu_maxima,
+		plantilla.Modo_red, string(discosExtra), string(aprovisionamiento), string(configuracionInicial))
+	if err != nil {
+		return 0, err
+	}
+	id, err := resultado.LastInsertId()
+	return int(id), err
+}
+
+const columnasPlantilla = "id, nombre, descripcion, disco_id, ram_defecto, ram_maxima, cpu_defecto, cpu_maxima, modo_red, discos_extra, aprovisionamiento, configuracion_inicial"
+
+/*
+Funciòn que lee una fila de la tabla plantilla. Los discos extra, el aprovisionamiento y la configuraciòn inicial se guardan como JSON
+*/
+func escanearPlantilla(fila interface{ Scan(...interface{}) error }) (Plantilla, error) {
+	var plantilla Plantilla
+	var discosExtra, aprovisionamiento, configuracionInicial string
+	err := fila.Scan(&plantilla.Id, &plantilla.Nombre, &plantilla.Descripcion, &plantilla.Disco_id, &plantilla.Ram_defecto, &plantilla.Ram_maxima,
+		&plantilla.Cpu_defecto, &plantilla.Cpu_maxima, &plantilla.Modo_red, &discosExtra, &aprovisionamiento, &configuracionInicial)
+	if err != nil {
+		return plantilla, err
+	}
+	json.Unmarshal([]byte(discosExtra), &plantilla.Discos_extra)
+	json.Unmarshal([]byte(aprovisionamiento), &plantilla.Aprovisionamiento)
+	json.Unmarshal([]byte(configuracionInicial), &plantilla.Configuracion_inicial)
+	return plantilla, nil
+}
+
+/*
+Funciòn que obtiene una plantilla dado su identificador ùnico
+@id Paràmetro que contiene el identificador de la plantilla
+*/
+func getPlantilla(id int) (Plantilla, error) {
+	plantilla, err := escanearPlantilla(db.QueryRow("SELECT "+columnasPlantilla+" FROM plantilla WHERE id = ?", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			log.Println("No se encontrò la plantilla " + strconv.Itoa(id))
+		} else {
+			log.Println("Hubo un error al realizar la consulta:", err)
+		}
+	}
+	return plantilla, err
+}
+
+/*
+Funciòn que consulta todas las plantillas
+*/
+func consultPlantillas() ([]Plantilla, error) {
+	rows, err := db.Query("SELECT " + columnasPlantilla + " FROM plantilla ORDER BY nombre")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var plantillas []Plantilla
+	for rows.Next() {
+		plantilla, err := escanearPlantilla(rows)
+		if err != nil {
+			log.Println("Error al obtener la fila")
+			continue
+		}
+		plantillas = append(plantillas, plantilla)
+	}
+	return plantillas, rows.Err()
+}
+
+/*
+Funciòn que aplica una plantilla a las especificaciones de una nueva MV: asigna la RAM y la CPU por defecto si no se indicaron,
+verifica que no superen los màximos de la plantilla y toma el sistema operativo y la distribuciòn de su disco base
+@specs Paràmetro que contiene las especificaciones enviadas por el usuario
+@return Retorna la plantilla aplicada, o un error si la plantilla no existe o las especificaciones superan sus lìmites
+*/
+func aplicarPlantilla(specs *Maquina_virtual) (Plantilla, error) {
+	plantilla, err := getPlantilla(specs.Plantilla_id)
+	if err != nil {
+		return plantilla, errors.New("la plantilla no existe")
+	}
+
+	if specs.Ram == 0 {
+		specs.Ram = plantilla.Ram_defecto
+	}
+	if specs.Cpu == 0 {
+		specs.Cpu = plantilla.Cpu_defecto
+	}
+	if specs.Modo_red == "" {
+		specs.Modo_red = plantilla.Modo_red
+	}
+	if specs.Ram < 0 || specs.Ram > plantilla.Ram_maxima {
+		return plantilla, fmt.Errorf("la plantilla %s permite màximo %d mb de RAM", plantilla.Nombre, plantilla.Ram_maxima)
+	}
+	if specs.Cpu < 0 || specs.Cpu > plantilla.Cpu_maxima {
+		return plantilla, fmt.Errorf("la plantilla %s permite màximo %d CPU", plantilla.Nombre, plantilla.Cpu_maxima)
+	}
+
+	disco, err := getDiskById(plantilla.Disco_id)
+	if err != nil {
+		return plantilla, errors.New("el disco base de la plantilla no existe")
+	}
+	specs.Sistema_operativo = disco.Sistema_operativo
+	specs.Distribucion_sistema_operativo = disco.Distribucion_sistema_operativo
+
+	return plantilla, nil
+}
+
+/*
+Funciòn que configura una MV reciè creada con los discos extra de la plantilla. El modo de red de la plantilla se aplica en aplicarPlantilla
+@maquinaVirtual Paràmetro que contiene la MV creada
+@host Paràmetro que contiene el host en el cual està la MV
+@config Paràmetro que contiene la configuraciòn SSH
+@disco Paràmetro que contiene el disco base de la MV. Los discos extra se crean en la misma carpeta
+@plantilla Paràmetro que contiene la plantilla
+*/
+func configurarMVPlantilla(maquinaVirtual Maquina_virtual, host Host, config *ssh.ClientConfig, disco Disco, plantilla Plantilla) string {
+
+	directorio := dialectoDeHost(host).directorioDe(disco.Ruta_ubicacion)
+	for i, tamanio := range plantilla.Discos_extra {
+		//El puerto 0 del controlador lo ocupa el disco del sistema operativo
+		if _, mensaje := crearDiscoDatos(maquinaVirtual, host, config, directorio, "datos"+strconv.Itoa(i+1), tamanio, i+1); mensaje != "" {
+			return mensaje
+		}
+		host.Almacenamiento_usado += tamanio
+	}
+	return ""
+}
+
+/*
+Funciòn que ejecuta por SSH los comandos de aprovisionamiento de una plantilla en una MV encendida.
+Los comandos los escribe un administrador, por lo que se envìan tal cual al intèrprete de la MV
+@nameVM Paràmetro que contiene el nombre de la màquina virtual
+@comandos Paràmetro que contiene los comandos a ejecutar, en orden
+*/
+func aprovisionarMV(nameVM string, comandos []string) {
+	maquinaVirtual, err := getVM(nameVM)
+	if err != nil || maquinaVirtual.Ip == "" {
+		log.Println("No se puede aprovisionar la MV " + nameVM + ": no tiene direcciòn IP")
+		return
+	}
+
+	if !marcapasos(*privateKeyPath, maquinaVirtual.Hostname, maquinaVirtual.Ip) {
+		log.Println("No se puede aprovisionar la MV " + nameVM + ": no responde por SSH")
+		return
+	}
+
+	config, err := configurarSSH(maquinaVirtual.Hostname, *privateKeyPath)
+	if err != nil {
+		log.Println("Error al configurar SSH:", err)
+		return
+	}
+
+	for _, comando := range comandos {
+		if _, err := enviarComandoSSHConTiempo(maquinaVirtual.Ip, comando, config, tiempoComandoLargoSSH); err != nil {
+			log.Println("Error al ejecutar el comando de aprovisionamiento '"+comando+"' en la MV "+nameVM+":", err)
+			return
+		}
+	}
+	fmt.Println("Màquina " + nameVM + " aprovisionada correctamente")
+}
@@ -0,0 +1,557 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+/*
+Estructura de datos tipo JSON que representa una programaciòn de encendido ò apagado de MV
+@Id Representa el identificador ùnico de la programaciòn
+@Nombre Representa el nombre de la programaciòn
+@Persona_email Representa el email del usuario que creò la programaciòn
+@Tipo_objetivo Representa a quièn se aplica: mv (una MV) ò etiqueta (el grupo de MV con una etiqueta)
+@Objetivo Representa el uuid de la MV ò la etiqueta del grupo
+@Accion Representa la acciòn: start (encender), stop (apagar con ACPI) ò idle_stop (apagar las MV inactivas)
+@Expresion Representa la expresiòn cron de las acciones start y stop, en la hora local del servidor. Por ejemplo: 0 8 * * mon
+@Horas_inactividad Representa las horas sin actividad despuès de las cuales la acciòn idle_stop apaga la MV
+@Activa Representa si la programaciòn se ejecuta
+@Ultima_ejecucion Representa el ùltimo momento en el que se ejecutò la programaciòn
+@Proxima_ejecucion Representa el siguiente momento en el que se ejecutarà una programaciòn start ò stop
+@Fecha_creacion Representa la fecha de creaciòn de la programaciòn
+*/
+type Programacion struct {
+	Id                int
+	Nombre            string
+	Persona_email     string
+	Tipo_objetivo     string
+	Objetivo          string
+	Accion            string
+	Expresion         string
+	Horas_inactividad int
+	Activa            bool
+	Ultima_ejecucion  time.Time
+	Proxima_ejecucion time.Time
+	Fecha_creacion    time.Time
+}
+
+// Intervalo con el que el programador revisa las programaciones
+const intervaloProgramador = time.Minute
+
+// Tiempo hacia atràs en el que el programador recupera las ejecuciones que no alcanzò a revisar, por ejemplo porque una
+// revisiòn anterior se demorò. Las ejecuciones màs antiguas, como las perdidas mientras el servidor estuvo apagado, se omiten
+const recuperacionProgramador = time.Hour
+
+// Cantidad màxima de horas de inactividad de una programaciòn idle_stop
+const maxHorasInactividad = 720
+
+var (
+	accionesProgramacion = map[string]bool{"start": true, "stop": true, "idle_stop": true}
+	tiposObjetivo        = map[string]bool{"mv": true, "etiqueta": true}
+
+	//Momento desde el cual cada MV encendida està inactiva. Se reinicia cuando se reinicia el servidor
+	inactividadMV   = map[string]time.Time{}
+	muInactividadMV sync.Mutex
+
+	muProgramador      sync.Mutex
+	muApagadoInactivas sync.Mutex
+)
+
+/*
+Funciòn que configura los endpoints para crear, consultar, activar y eliminar las programaciones de encendido y apagado
+*/
+func manejarProgramaciones() {
+
+	//Endpoint para crear una programaciòn
+	http.HandleFunc("/json/createSchedule", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Se requiere una solicitud POST", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var datos struct {
+			Email            string
+			Nombre           string
+			TipoObjetivo     string
+			Objetivo         string
+			Accion           string
+			Expresion        string
+			HorasInactividad int
+		}
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&datos); err != nil {
+			http.Error(w, "Error al decodificar JSON de la solicitud", http.StatusBadRequest)
+			return
+		}
+		if _, err := getUser(datos.Email); err != nil {
+			http.Error(w, "No se encontró el usuario", http.StatusNotFound)
+			return
+		}
+		if err := validarNombre(datos.Nombre); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !accionesProgramacion[datos.Accion] {
+			http.Error(w, "La acción debe ser 'start', 'stop' o 'idle_stop'", http.StatusBadRequest)
+			return
+		}
+		if datos.Accion == "idle_stop" {
+			if datos.HorasInactividad < 1 || datos.HorasInactividad > maxHorasInactividad {
+				http.Error(w, fmt.Sprintf("Las horas de inactividad deben estar entre 1 y %d", maxHorasInactividad), http.StatusBadRequest)
+				return
+			}
+			datos.Expresion = ""
+		} else {
+			if _, err := parsearCron(datos.Expresion); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			datos.HorasInactividad = 0
+		}
+
+		if datos.TipoObjetivo == "" {
+			datos.TipoObjetivo = "mv"
+		}
+		switch datos.TipoObjetivo {
+		case "mv":
+			if err := validarNombre(datos.Objetivo); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if mensaje, estado := validarPropietarioOAdministrador(datos.Objetivo, datos.Email); estado != http.StatusOK {
+				http.Error(w, mensaje, estado)
+				return
+			}
+			maquinaVirtual, _ := getVM(datos.Objetivo)
+			datos.Objetivo = maquinaVirtual.Uuid
+		case "etiqueta":
+			etiquetas, err := normalizarEtiquetas([]string{datos.Objetivo})
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			datos.Objetivo = etiquetas[0]
+		default:
+			http.Error(w, "El tipo de objetivo debe ser 'mv' o 'etiqueta'", http.StatusBadRequest)
+			return
+		}
+
+		resultado, err := db.Exec("INSERT INTO programacion (nombre, persona_email, tipo_objetivo, objetivo, accion, expresion, horas_inactividad, activa, fecha_creacion) VALUES (?, ?, ?, ?, ?, ?, ?, TRUE, ?)",
+			datos.Nombre, datos.Email, datos.TipoObjetivo, datos.Objetivo, datos.Accion, datos.Expresion, datos.HorasInactividad, time.Now().UTC().Format("2006-01-02 15:04:05"))
+		if err != nil {
+			log.Println("Error al registrar la programaciòn:", err)
+			http.Error(w, "Error al registrar la programación", http.StatusInternalServerError)
+			return
+		}
+		id, _ := resultado.LastInsertId()
+
+		response := map[string]interface{}{"mensaje": "Programación creada con éxito", "id": id}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(response)
+	})
+
+	//Endpoint para consultar las programaciones del usuario, ò todas si es administrador
+	http.HandleFunc("/json/consultSchedules", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Se requiere una solicitud POST", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var persona Persona
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&persona); err != nil { //Solo llega el email
+			http.Error(w, "Error al decodificar JSON de la solicitud", http.StatusBadRequest)
+			return
+		}
+
+		persona, err := getUser(persona.Email)
+		if err != nil {
+			http.Error(w, "No se encontró el usuario", http.StatusNotFound)
+			return
+		}
+
+		var programaciones []Programacion
+		if persona.Rol == "Administrador" {
+			programaciones, err = consultProgramaciones("", nil)
+		} else {
+			programaciones, err = consultProgramaciones("WHERE persona_email = ?", persona.Email)
+		}
+		if err != nil {
+			log.Println("Error al consultar las programaciones:", err)
+			http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(programaciones)
+	})
+
+	//Endpoint para activar ò desactivar una programaciòn
+	http.HandleFunc("/json/toggleSchedule", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Se requiere una solicitud POST", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var datos struct {
+			Email  string
+			Id     int
+			Activa bool
+		}
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&datos); err != nil {
+			http.Error(w, "Error al decodificar JSON de la solicitud", http.StatusBadRequest)
+			return
+		}
+		programacion, mensaje, estado := validarPropietarioProgramacion(datos.Id, datos.Email)
+		if estado != http.StatusOK {
+			http.Error(w, mensaje, estado)
+			return
+		}
+
+		if _, err := db.Exec("UPDATE programacion SET activa = ? WHERE id = ?", datos.Activa, programacion.Id); err != nil {
+			log.Println("Error al actualizar la programaciòn:", err)
+			http.Error(w, "Error al actualizar la programación", http.StatusInternalServerError)
+			return
+		}
+
+		response := map[string]string{"mensaje": "Programación actualizada con éxito"}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(response)
+	})
+
+	//Endpoint para eliminar una programaciòn
+	http.HandleFunc("/json/deleteSchedule", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Se requiere una solicitud POST", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var datos struct {
+			Email string
+			Id    int
+		}
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&datos); err != nil {
+			http.Error(w, "Error al decodificar JSON de la solicitud", http.StatusBadRequest)
+			return
+		}
+		programacion, mensaje, estado := validarPropietarioProgramacion(datos.Id, datos.Email)
+		if estado != http.StatusOK {
+			http.Error(w, mensaje, estado)
+			return
+		}
+
+		if _, err := db.Exec("DELETE FROM programacion WHERE id = ?", programacion.Id); err != nil {
+			log.Println("Error al eliminar la programaciòn:", err)
+			http.Error(w, "Error al eliminar la programación", http.StatusInternalServerError)
+			return
+		}
+
+		response := map[string]string{"mensaje": "Programación eliminada con éxito"}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(response)
+	})
+}
+
+/*
+Funciòn que valida que el solicitante sea el creador de la programaciòn ò un administrador
+@return Retorna la programaciòn, un mensaje de error y el còdigo HTTP de la validaciòn
+*/
+func validarPropietarioProgramacion(id int, email string) (Programacion, string, int) {
+	programaciones, err := consultProgramaciones("WHERE id = ?", id)
+	if err != nil || len(programaciones) == 0 {
+		return Programacion{}, "No se encontró la programación", http.StatusNotFound
+	}
+	solicitante, err := getUser(email)
+	if err != nil {
+		return programaciones[0], "No se encontró el usuario solicitante", http.StatusNotFound
+	}
+	if programaciones[0].Persona_email != solicitante.Email && solicitante.Rol != "Administrador" {
+		return programaciones[0], "Solo el creador de la programación o un administrador pueden realizar esta operación", http.StatusForbidden
+	}
+	return programaciones[0], "", http.StatusOK
+}
+
+/*
+Funciòn que consulta las programaciones que cumplen una condiciòn
+@condicion Paràmetro que contiene la condiciòn SQL. Si està vacìa se consultan todas
+@argumento Paràmetro que contiene el valor de la condiciòn
+*/
+func consultProgramaciones(condicion string, argumento interface{}) ([]Programacion, error) {
+
+	query := "SELECT id, nombre, persona_email, tipo_objetivo, objetivo, accion, expresion, horas_inactividad, activa, COALESCE(ultima_ejecucion, ''), fecha_creacion FROM programacion " + condicion
+	var rows *sql.Rows
+	var err error
+	if condicion == "" {
+		rows, err = db.Query(query)
+	} else {
+		rows, err = db.Query(query, argumento)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var programaciones []Programacion
+	ahora := time.Now()
+	for rows.Next() {
+		var programacion Programacion
+		var ultima, fecha string
+		if err := rows.Scan(&programacion.Id, &programacion.Nombre, &programacion.Persona_email, &programacion.Tipo_objetivo, &programacion.Objetivo,
+			&programacion.Accion, &programacion.Expresion, &programacion.Horas_inactividad, &programacion.Activa, &ultima, &fecha); err != nil {
+			log.Println("Error al obtener la fila")
+			continue
+		}
+		programacion.Ultima_ejecucion, _ = time.Parse("2006-01-02 15:04:05", ultima)
+		programacion.Fecha_creacion, _ = time.Parse("2006-01-02 15:04:05", fecha)
+		if cron, err := parsearCron(programacion.Expresion); err == nil && programacion.Activa {
+			programacion.Proxima_ejecucion = cron.siguiente(ahora)
+		}
+		programaciones = append(programaciones, programacion)
+	}
+	return programaciones, rows.Err()
+}
+
+/*
+Funciòn que elimina las programaciones de una MV eliminada. Las programaciones de etiquetas se conservan
+*/
+func eliminarProgramacionesMV(uuidVM string) {
+	db.Exec("DELETE FROM programacion WHERE tipo_objetivo = 'mv' AND objetivo = ?", uuidVM)
+	muInactividadMV.Lock()
+	delete(inactividadMV, uuidVM)
+	muInactividadMV.Unlock()
+}
+
+/*
+Funciòn que establece el disparador del programador, que revisa las programaciones cada minuto
+*/
+func checkProgramaciones() {
+
+	timeTicker := time.NewTicker(intervaloProgramador)
+
+	for ahora := range timeTicker.C {
+		go ejecutarProgramaciones(ahora)
+	}
+}
+
+/*
+Funciòn que ejecuta las programaciones activas: encola el encendido ò el apagado de las MV de las programaciones cuya
+expresiòn cron tuvo alguna ejecuciòn desde su ùltima ejecuciòn, de modo que una revisiòn omitida se recupera en la siguiente.
+El apagado de las MV que superaron sus horas de inactividad se revisa aparte, para que su demora no retrase las programaciones
+@ahora Paràmetro que contiene el momento de la revisiòn
+*/
+func ejecutarProgramaciones(ahora time.Time) {
+
+	if !muProgramador.TryLock() {
+		return
+	}
+	defer muProgramador.Unlock()
+
+	programaciones, err := consultProgramaciones("WHERE activa = ?", true)
+	if err != nil {
+		log.Println("Error al consultar las programaciones:", err)
+		return
+	}
+
+	minuto := ahora.Truncate(time.Minute)
+	horasInactividad := make(map[string]int)
+	for _, programacion := range programaciones {
+		if programacion.Accion == "idle_stop" {
+			for _, maquinaVirtual := range objetivosProgramacion(programacion) {
+				if horas, existe := horasInactividad[maquinaVirtual.Uuid]; !existe || programacion.Horas_inactividad < horas {
+					horasInactividad[maquinaVirtual.Uuid] = programacion.Horas_inactividad
+				}
+			}
+			continue
+		}
+
+		cron, err := parsearCron(programacion.Expresion)
+		if err != nil || !cron.pendiente(desdeProgramacion(programacion, minuto), minuto) {
+			continue
+		}
+		//Marca la ejecuciòn antes de encolar para que una revisiòn repetida en el mismo minuto no la ejecute dos veces
+		resultado, err := db.Exec("UPDATE programacion SET ultima_ejecucion = ? WHERE id = ? AND (ultima_ejecucion IS NULL OR ultima_ejecucion < ?)",
+			minuto.UTC().Format("2006-01-02 15:04:05"), programacion.Id, minuto.UTC().Format("2006-01-02 15:04:05"))
+		if err != nil {
+			log.Println("Error al registrar la ejecuciòn de la programaciòn:", err)
+			continue
+		}
+		if filas, _ := resultado.RowsAffected(); filas == 0 {
+			continue
+		}
+
+		for _, maquinaVirtual := range objetivosProgramacion(programacion) {
+			switch {
+			case programacion.Accion == "start" && (maquinaVirtual.Estado == estadoApagado || maquinaVirtual.Estado == estadoGuardado):
+				encolarAccionProgramada("start", maquinaVirtual, programacion)
+			case programacion.Accion == "stop" && (maquinaVirtual.Estado == estadoEncendido || maquinaVirtual.Estado == estadoPausado):
+				encolarAccionProgramada("shutdown", maquinaVirtual, programacion)
+			}
+		}
+	}
+
+	if muApagadoInactivas.TryLock() {
+		go func() {
+			defer muApagadoInactivas.Unlock()
+			apagarMVInactivas(horasInactividad, ahora)
+		}()
+	}
+}
+
+/*
+Funciòn que calcula el momento desde el cual se buscan ejecuciones pendientes de una programaciòn: su ùltima ejecuciòn, el
+minuto anterior a su creaciòn ò el lìmite de recuperaciòn del programador, el que sea màs reciente
+@minuto Paràmetro que contiene el minuto de la revisiòn actual, en la zona horaria del servidor
+*/
+func desdeProgramacion(programacion Programacion, minuto time.Time) time.Time {
+	desde := minuto.Add(-recuperacionProgramador)
+	if creacion := programacion.Fecha_creacion.Truncate(time.Minute).Add(-time.Minute); creacion.After(desde) {
+		desde = creacion
+	}
+	if programacion.Ultima_ejecucion.After(desde) {
+		desde = programacion.Ultima_ejecucion
+	}
+	return desde.In(minuto.Location())
+}
+
+/*
+Funciòn que obtiene las MV a las que se aplica una programaciòn. Las programaciones de etiquetas creadas por un usuario
+solo se aplican a sus MV; las de un administrador se aplican a todas las MV con la etiqueta
+*/
+func objetivosProgramacion(programacion Programacion) []Maquina_virtual {
+
+	var rows *sql.Rows
+	var err error
+	if programacion.Tipo_objetivo == "mv" {
+		rows, err = db.Query("SELECT uuid, nombre, estado, host_id FROM maquina_virtual WHERE uuid = ?", programacion.Objetivo)
+	} else {
+		query := "SELECT m.uuid, m.nombre, m.estado, m.host_id FROM maquina_virtual AS m INNER JOIN etiqueta_mv AS e ON e.maquina_virtual_uuid = m.uuid WHERE e.etiqueta = ?"
+		if creador, errUsuario := getUser(programacion.Persona_email); errUsuario == nil && creador.Rol == "Administrador" {
+			rows, err = db.Query(query, programacion.Objetivo)
+		} else {
+			rows, err = db.Query(query+" AND m.persona_email = ?", programacion.Objetivo, programacion.Persona_email)
+		}
+	}
+	if err != nil {
+		log.Println("Error al consultar las MV de la programaciòn:", err)
+		return nil
+	}
+	defer rows.Close()
+
+	var maquinas []Maquina_virtual
+	for rows.Next() {
+		var maquinaVirtual Maquina_virtual
+		if err := rows.Scan(&maquinaVirtual.Uuid, &maquinaVirtual.Nombre, &maquinaVirtual.Estado, &maquinaVirtual.Host_id); err == nil {
+			maquinas = append(maquinas, maquinaVirtual)
+		}
+	}
+	return maquinas
+}
+
+/*
+Funciòn que encola en la cola de gestiòn una operaciòn de una programaciòn, igual que si la hubiera solicitado el usuario
+@tipoSolicitud Paràmetro que contiene el tipo de solicitud: start ò shutdown
+*/
+func encolarAccionProgramada(tipoSolicitud string, maquinaVirtual Maquina_virtual, programacion Programacion) {
+	fmt.Println("Programaciòn " + programacion.Nombre + ": " + tipoSolicitud + " de la màquina " + maquinaVirtual.Nombre)
+	mu.Lock()
+	managementQueue.Queue.PushBack(map[string]interface{}{
+		"tipo_solicitud":  tipoSolicitud,
+		"nombreVM":        maquinaVirtual.Uuid,
+		"clientIP":        "",
+		"programacion_id": programacion.Id,
+	})
+	mu.Unlock()
+}
+
+/*
+Funciòn que apaga las MV encendidas que llevan màs horas inactivas que las de su programaciòn idle_stop. Una MV està activa
+si tiene una consola web abierta ò si las Guest Additions reportan usuarios con sesiòn iniciada. Las MV sin Guest Additions
+no reportan usuarios, por lo que se consideran inactivas desde que el servidor las ve encendidas
+@horasInactividad Paràmetro que contiene las horas de inactividad permitidas de cada MV, indexadas por uuid
+@ahora Paràmetro que contiene el momento de la revisiòn
+*/
+func apagarMVInactivas(horasInactividad map[string]int, ahora time.Time) {
+
+	muInactividadMV.Lock()
+	for uuidVM := range inactividadMV {
+		if _, existe := horasInactividad[uuidVM]; !existe {
+			delete(inactividadMV, uuidVM)
+		}
+	}
+	muInactividadMV.Unlock()
+
+	configuraciones := make(map[int]*ssh.ClientConfig)
+	for uuidVM, horas := range horasInactividad {
+		maquinaVirtual, err := getVM(uuidVM)
+		if err != nil {
+			continue
+		}
+		if maquinaVirtual.Estado != estadoEncendido {
+			muInactividadMV.Lock()
+			delete(inactividadMV, uuidVM)
+			muInactividadMV.Unlock()
+			continue
+		}
+
+		host, err := getHost(maquinaVirtual.Host_id)
+		if err != nil {
+			continue
+		}
+		config, existe := configuraciones[host.Id]
+		if !existe {
+			if config, err = configurarSSH(host.Hostname, *privateKeyPath); err != nil {
+				continue
+			}
+			configuraciones[host.Id] = config
+		}
+
+		activa := consolasWebAbiertas(uuidVM) > 0 || usuariosInvitado(host, config, uuidVM) > 0
+
+		muInactividadMV.Lock()
+		desde, existe := inactividadMV[uuidVM]
+		switch {
+		case activa:
+			delete(inactividadMV, uuidVM)
+		case !existe:
+			inactividadMV[uuidVM] = ahora
+		case ahora.Sub(desde) >= time.Duration(horas)*time.Hour:
+			delete(inactividadMV, uuidVM)
+			muInactividadMV.Unlock()
+			encolarAccionProgramada("shutdown", maquinaVirtual, Programacion{Nombre: "inactividad de " + strconv.Itoa(horas) + " horas"})
+			continue
+		}
+		muInactividadMV.Unlock()
+	}
+}
+
+/*
+Funciòn que obtiene la cantidad de usuarios con sesiòn iniciada en una MV segùn las Guest Additions
+@return Retorna la cantidad de usuarios, ò 0 si las Guest Additions no la reportan
+*/
+func usuariosInvitado(host Host, config *ssh.ClientConfig, uuidVM string) int {
+	propiedades, err := enumerarPropiedadesInvitado(host, config, uuidVM, "/VirtualBox/GuestInfo/OS/LoggedInUsers")
+	if err != nil {
+		return 0
+	}
+	for _, propiedad := range propiedades {
+		if propiedad.Nombre == "/VirtualBox/GuestInfo/OS/LoggedInUsers" {
+			usuarios, _ := strconv.Atoi(propiedad.Valor)
+			return usuarios
+		}
+	}
+	return 0
+}
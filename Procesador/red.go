@@ -0,0 +1,622 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+/*
+Estructura de datos tipo JSON que representa una regla de reenvìo de puertos de una MV en modo NAT
+@Id Representa el identificador ùnico de la regla en la base de datos
+@Maquina_virtual_uuid Representa el uuid de la MV
+@Host_id Representa el identificador ùnico del host en el cual se abre el puerto
+@Nombre Representa el nombre de la regla en VirtualBox
+@Protocolo Representa el protocolo de la regla: tcp ò udp
+@Puerto_host Representa el puerto del host que se reenvìa a la MV
+@Puerto_invitado Representa el puerto de la MV que recibe las conexiones
+*/
+type ReenvioPuerto struct {
+	Id                   int
+	Maquina_virtual_uuid string
+	Host_id              int
+	Nombre               string
+	Protocolo            string
+	Puerto_host          int
+	Puerto_invitado      int
+}
+
+// Rango de puertos de los hosts que se asignan a las reglas de reenvìo y red de las redes NAT que se crean en los hosts
+const (
+	puertoReenvioInicial = 20000
+	puertoReenvioFinal   = 29999
+	segmentoRedNAT       = "10.0.2.0/24"
+)
+
+var (
+	redNATDefecto     = flag.String("redNat", "NatNetwork", "Nombre de la red NAT de VirtualBox para las MV en modo natnetwork")
+	adaptadorHostOnly = flag.String("adaptadorHostOnly", "vboxnet0", "Adaptador de los hosts para las MV en modo hostonly")
+
+	//Redes que los usuarios pueden solicitar ademàs de las redes por defecto. Las configura el administrador del servidor
+	redesNATPermitidas            = flag.String("redesNatPermitidas", "", "Redes NAT adicionales, separadas por comas, que se pueden solicitar para las MV en modo natnetwork")
+	adaptadoresHostOnlyPermitidos = flag.String("adaptadoresHostOnlyPermitidos", "", "Adaptadores host-only adicionales, separados por comas, que se pueden solicitar para las MV en modo hostonly")
+
+	//Nombres que VirtualBox usa para las redes privadas de los usuarios (ver nombreVBoxRedPrivada). No se pueden solicitar
+	//como red de una MV porque la conectarìan a la red privada de otro usuario
+	patronRedPrivadaVBox = regexp.MustCompile(`^uq[0-9]+_`)
+
+	//Modos del adaptador de red que se pueden asignar a una MV. Si una MV no tiene registro en la tabla red_mv està en modo puente
+	modosRed          = map[string]bool{"bridged": true, "nat": true, "natnetwork": true, "hostonly": true}
+	protocolosReenvio = map[string]bool{"tcp": true, "udp": true}
+)
+
+/*
+Funciòn que configura los endpoints para cambiar el modo de red de las MV y administrar sus reglas de reenvìo de puertos.
+Los cambios se encolan en la cola de gestiòn
+*/
+func manejarRed() {
+
+	//Endpoints para cambiar el modo de red y agregar o eliminar reglas de reenvìo de puertos
+	encolarSolicitudRed := func(tipoEsperado string, mensaje string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				http.Error(w, "Se requiere una solicitud POST", http.StatusMethodNotAllowed)
+				return
+			}
+
+			var datos map[string]interface{}
+			decoder := json.NewDecoder(r.Body)
+			if err := decoder.Decode(&datos); err != nil {
+				http.Error(w, "Error al decodificar JSON de la solicitud", http.StatusBadRequest)
+				return
+			}
+
+			tipoSolicitud, _ := datos["tipo_solicitud"].(string)
+			if tipoSolicitud != tipoEsperado {
+				http.Error(w, "El campo 'tipo_solicitud' debe ser '"+tipoEsperado+"'", http.StatusBadRequest)
+				return
+			}
+
+			email, _ := datos["email"].(string)
+			nombreVM, _ := datos["nombreVM"].(string)
+			if err := validarNombre(nombreVM); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if mensajeError, estado := validarPropietarioOAdministrador(nombreVM, email); estado != http.StatusOK {
+				http.Error(w, mensajeError, estado)
+				return
+			}
+			maquinaVirtual, _ := getVM(nombreVM)
+
+			switch tipoSolicitud {
+			case "network_mode":
+				modo, _ := datos["modo"].(string)
+				red, _ := datos["red"].(string)
+				if err := validarModoRed(modo, red); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+
+			case "add_port_forward":
+				if modo, _ := getRedMV(maquinaVirtual.Uuid); modo != "nat" {
+					http.Error(w, "Solo se pueden reenviar puertos a las máquinas virtuales en modo NAT", http.StatusConflict)
+					return
+				}
+				nombreRegla, _ := datos["nombreRegla"].(string)
+				protocolo, _ := datos["protocolo"].(string)
+				puertoInvitado, _ := datos["puertoInvitado"].(float64)
+				puertoHost, _ := datos["puertoHost"].(float64)
+				if err := validarNombre(nombreRegla); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				if !protocolosReenvio[protocolo] {
+					http.Error(w, "El protocolo debe ser 'tcp' o 'udp'", http.StatusBadRequest)
+					return
+				}
+				if puertoInvitado < 1 || puertoInvitado > 65535 {
+					http.Error(w, "El puerto de la máquina virtual debe estar entre 1 y 65535", http.StatusBadRequest)
+					return
+				}
+				if puertoHost != 0 && (puertoHost < puertoReenvioInicial || puertoHost > puertoReenvioFinal) {
+					http.Error(w, fmt.Sprintf("El puerto del host debe estar entre %d y %d", puertoReenvioInicial, puertoReenvioFinal), http.StatusBadRequest)
+					return
+				}
+
+			case "delete_port_forward":
+				nombreRegla, _ := datos["nombreRegla"].(string)
+				if _, err := getReenvioPuerto(maquinaVirtual.Uuid, nombreRegla); err != nil {
+					http.Error(w, "No se encontró la regla de reenvío", http.StatusNotFound)
+					return
+				}
+			}
+
+			// Encola las peticiones.
+			identificarMV(datos)
+			mu.Lock()
+			managementQueue.Queue.PushBack(datos)
+			mu.Unlock()
+
+			// Envía una respuesta al cliente.
+			response := map[string]string{"mensaje": mensaje}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(response)
+		}
+	}
+
+	http.HandleFunc("/json/networkMode", encolarSolicitudRed("network_mode", "Mensaje JSON para cambiar el modo de red recibido correctamente"))
+	http.HandleFunc("/json/addPortForward", encolarSolicitudRed("add_port_forward", "Mensaje JSON para agregar la regla de reenvío recibido correctamente"))
+	http.HandleFunc("/json/deletePortForward", encolarSolicitudRed("delete_port_forward", "Mensaje JSON para eliminar la regla de reenvío recibido correctamente"))
+
+	//Endpoint para consultar el modo de red y las reglas de reenvìo de una MV
+	http.HandleFunc("/json/consultNetwork", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Se requiere una solicitud POST", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var datos struct {
+			Email    string
+			NombreVM string
+		}
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&datos); err != nil {
+			http.Error(w, "Error al decodificar JSON de la solicitud", http.StatusBadRequest)
+			return
+		}
+		if mensajeError, estado := validarPropietarioOAdministrador(datos.NombreVM, datos.Email); estado != http.StatusOK {
+			http.Error(w, mensajeError, estado)
+			return
+		}
+
+		maquinaVirtual, _ := getVM(datos.NombreVM)
+		host, err := getHost(maquinaVirtual.Host_id)
+		if err != nil {
+			http.Error(w, "Error al obtener el host", http.StatusInternalServerError)
+			return
+		}
+		reenvios, err := consultReenviosPuerto(maquinaVirtual.Uuid)
+		if err != nil {
+			log.Println("Error al consultar las reglas de reenvìo:", err)
+			http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+			return
+		}
+
+		//Las reglas de reenvìo se usan con la direcciòn del host
+		modo, red := getRedMV(maquinaVirtual.Uuid)
+		response := map[string]interface{}{"modo": modo, "red": red, "ipHost": host.Ip, "reenvios": reenvios}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(response)
+	})
+}
+
+/*
+Funciòn que valida el modo de red y el nombre de la red solicitados para una MV. Solo se aceptan la red por defecto y
+las redes permitidas en la configuraciòn del servidor, y nunca una red privada de VirtualBox
+@modo Paràmetro que contiene el modo: bridged, nat, natnetwork ò hostonly
+@red Paràmetro que contiene la red NAT ò el adaptador host-only. Si està vacìo se usa el de la configuraciòn del servidor
+*/
+func validarModoRed(modo string, red string) error {
+	if !modosRed[modo] {
+		return errors.New("el modo de red debe ser 'bridged', 'nat', 'natnetwork' o 'hostonly'")
+	}
+	if red == "" {
+		return nil
+	}
+	if err := validarNombre(red); err != nil {
+		return err
+	}
+	if patronRedPrivadaVBox.MatchString(red) {
+		return errors.New("la red '" + red + "' está reservada para las redes privadas")
+	}
+	switch modo {
+	case "natnetwork":
+		if !redPermitida(red, *redNATDefecto, *redesNATPermitidas) {
+			return errors.New("la red NAT '" + red + "' no está permitida")
+		}
+	case "hostonly":
+		if !redPermitida(red, *adaptadorHostOnly, *adaptadoresHostOnlyPermitidos) {
+			return errors.New("el adaptador host-only '" + red + "' no está permitido")
+		}
+	}
+	return nil
+}
+
+/*
+Funciòn que indica si una red es la red por defecto ò una de las redes permitidas
+@red Paràmetro que contiene el nombre de la red solicitada
+@porDefecto Paràmetro que contiene la red por defecto del modo
+@permitidas Paràmetro que contiene las redes permitidas, separadas por comas
+*/
+func redPermitida(red string, porDefecto string, permitidas string) bool {
+	if red == porDefecto {
+		return true
+	}
+	for _, permitida := range strings.Split(permitidas, ",") {
+		if strings.TrimSpace(permitida) == red {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Funciòn que obtiene el modo de red de una MV
+@uuidVM Paràmetro que contiene el uuid de la MV
+@return Retorna el modo y la red. Las MV sin registro estàn en modo puente
+*/
+func getRedMV(uuidVM string) (string, string) {
+	modo, red := "bridged", ""
+	db.QueryRow("SELECT modo, red FROM red_mv WHERE maquina_virtual_uuid = ?", uuidVM).Scan(&modo, &red)
+	return modo, red
+}
+
+/*
+Funciòn que configura el primer adaptador de red de una MV apagada y registra el modo en la base de datos
+@host Paràmetro que contiene el host en el cual està la MV
+@config Paràmetro que contiene la configuraciòn SSH
+@uuidVM Paràmetro que contiene el uuid de la MV
+@nameVM Paràmetro que contiene el nombre de la MV
+@modo Paràmetro que contiene el modo de red. Si està vacìo se usa el modo puente
+@red Paràmetro que contiene la red NAT ò el adaptador host-only. Si està vacìo se usa el de la configuraciòn del servidor
+@return Retorna un mensaje de error, o una cadena vacìa si la configuraciòn fue exitosa
+*/
+func configurarRedMV(host Host, config *ssh.ClientConfig, uuidVM string, nameVM string, modo string, red string) string {
+
+	argumentos := []string{"modifyvm", nameVM}
+	switch modo {
+	case "nat":
+		red = ""
+		argumentos = append(argumentos, "--nic1", "nat")
+	case "natnetwork":
+		if red == "" {
+			red = *redNATDefecto
+		}
+		if mensaje := asegurarRedNAT(host, config, red, segmentoRedNAT); mensaje != "" {
+			return mensaje
+		}
+		argumentos = append(argumentos, "--nic1", "natnetwork", "--nat-network1", red)
+	case "hostonly":
+		if red == "" {
+			red = *adaptadorHostOnly
+		}
+		argumentos = append(argumentos, "--nic1", "hostonly", "--hostonlyadapter1", red)
+	default:
+		modo, red = "bridged", host.Adaptador_red
+		argumentos = append(argumentos, "--nic1", "bridged", "--bridgeadapter1", red)
+	}
+
+	if _, err := ejecutarVBoxManage(host, config, argumentos...); err != nil {
+		log.Println("Error al ejecutar el comando para configurar el adaptador de red de la MV:", err)
+		return "Error al configurar el adaptador de red de la MV"
+	}
+
+	if _, err := db.Exec("INSERT INTO red_mv (maquina_virtual_uuid, modo, red) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE modo = VALUES(modo), red = VALUES(red)", uuidVM, modo, red); err != nil {
+		log.Println("Error al registrar el modo de red de la MV:", err)
+		return "Error al registrar el modo de red de la MV"
+	}
+	return ""
+}
+
+/*
+Funciòn que crea y enciende una red NAT en el host si aùn no existe
+@host Paràmetro que contiene el host
+@config Paràmetro que contiene la configuraciòn SSH
+@red Paràmetro que contiene el nombre de la red NAT
+@segmento Paràmetro que contiene la red IPv4 con la que se crea la red NAT
+*/
+func asegurarRedNAT(host Host, config *ssh.ClientConfig, red string, segmento string) string {
+
+	salida, err := ejecutarVBoxManage(host, config, "list", "natnets")
+	if err != nil {
+		log.Println("Error al consultar las redes NAT del host:", err)
+		return "Error al consultar las redes NAT del host"
+	}
+	//VirtualBox 6 y 7 muestran la red como "Name:" y VirtualBox 5 como "NetworkName:"
+	for _, linea := range strings.Split(salida, "\n") {
+		campos := strings.Fields(linea)
+		if len(campos) == 2 && (campos[0] == "Name:" || campos[0] == "NetworkName:") && campos[1] == red {
+			return ""
+		}
+	}
+
+	if _, err := ejecutarVBoxManage(host, config, "natnetwork", "add", "--netname", red, "--network", segmento, "--enable", "--dhcp", "on"); err != nil {
+		log.Println("Error al crear la red NAT:", err)
+		return "Error al crear la red NAT " + red
+	}
+	if _, err := ejecutarVBoxManage(host, config, "natnetwork", "start", "--netname", red); err != nil {
+		log.Println("Error al iniciar la red NAT:", err)
+	}
+	return ""
+}
+
+/*
+Funciòn que cambia el modo de red de una MV apagada. Al salir del modo NAT se eliminan sus reglas de reenvìo de puertos
+@nameVM Paràmetro que contiene el nombre de la MV
+@modo Paràmetro que contiene el nuevo modo de red
+@red Paràmetro que contiene la red NAT ò el adaptador host-only
+*/
+func cambiarModoRed(nameVM string, modo string, red string) string {
+
+	maquinaVirtual, err := getVM(nameVM)
+	if err != nil {
+		log.Println("Error al obtener la MV:", err)
+		return "Error al obtener la MV"
+	}
+
+	host, err := getHost(maquinaVirtual.Host_id)
+	if err != nil {
+		log.Println("Error al obtener el host:", err)
+		return "Error al obtener el host"
+	}
+	config, err := configurarSSH(host.Hostname, *privateKeyPath)
+	if err != nil {
+		log.Println("Error al configurar SSH:", err)
+		return "Error al configurar SSH"
+	}
+	if running, err := isRunning(nameVM, host, config); err != nil || running {
+		return "Debe apagar la màquina para cambiar su modo de red"
+	}
+
+	if modo != "nat" {
+		reenvios, _ := consultReenviosPuerto(maquinaVirtual.Uuid)
+		for _, reenvio := range reenvios {
+			if _, err := ejecutarVBoxManage(host, config, "modifyvm", nameVM, "--natpf1", "delete", reenvio.Nombre); err != nil {
+				log.Println("Error al eliminar la regla de reenvìo "+reenvio.Nombre+":", err)
+			}
+		}
+		db.Exec("DELETE FROM reenvio_puerto WHERE maquina_virtual_uuid = ?", maquinaVirtual.Uuid)
+	}
+
+	if mensaje := configurarRedMV(host, config, maquinaVirtual.Uuid, nameVM, modo, red); mensaje != "" {
+		return mensaje
+	}
+	fmt.Println("Modo de red de la màquina " + nameVM + " cambiado a " + modo)
+	return "Modo de red cambiado con èxito"
+}
+
+/*
+Funciòn que agrega una regla de reenvìo de puertos a una MV en modo NAT. Si la MV està encendida la regla se aplica de inmediato
+@nameVM Paràmetro que contiene el nombre de la MV
+@nombre Paràmetro que contiene el nombre de la regla
+@protocolo Paràmetro que contiene el protocolo: tcp ò udp
+@puertoInvitado Paràmetro que contiene el puerto de la MV
+@puertoHost Paràmetro que contiene el puerto solicitado en el host. Si es 0 se asigna el primer puerto libre
+*/
+func agregarReenvioPuerto(nameVM string, nombre string, protocolo string, puertoInvitado int, puertoHost int) string {
+
+	maquinaVirtual, err := getVM(nameVM)
+	if err != nil {
+		log.Println("Error al obtener la MV:", err)
+		return "Error al obtener la MV"
+	}
+	if modo, _ := getRedMV(maquinaVirtual.Uuid); modo != "nat" {
+		return "Solo se pueden reenviar puertos a las màquinas virtuales en modo NAT"
+	}
+
+	host, err := getHost(maquinaVirtual.Host_id)
+	if err != nil {
+		log.Println("Error al obtener el host:", err)
+		return "Error al obtener el host"
+	}
+	config, err := configurarSSH(host.Hostname, *privateKeyPath)
+	if err != nil {
+		log.Println("Error al configurar SSH:", err)
+		return "Error al configurar SSH"
+	}
+
+	puertoHost, err = asignarPuertoReenvio(maquinaVirtual.Uuid, host.Id, nombre, protocolo, puertoInvitado, puertoHost)
+	if err != nil {
+		log.Println("Error al asignar el puerto de reenvìo:", err)
+		return err.Error()
+	}
+
+	regla := fmt.Sprintf("%s,%s,,%d,,%d", nombre, protocolo, puertoHost, puertoInvitado)
+	running, _ := isRunning(nameVM, host, config)
+	if running {
+		_, err = ejecutarVBoxManage(host, config, "controlvm", nameVM, "natpf1", regla)
+	} else {
+		_, err = ejecutarVBoxManage(host, config, "modifyvm", nameVM, "--natpf1", regla)
+	}
+	if err != nil {
+		log.Println("Error al agregar la regla de reenvìo:", err)
+		db.Exec("DELETE FROM reenvio_puerto WHERE maquina_virtual_uuid = ? AND nombre = ?", maquinaVirtual.Uuid, nombre)
+		return "Error al agregar la regla de reenvìo"
+	}
+
+	mensaje := fmt.Sprintf("Puerto %d del host %s reenviado al puerto %d de la màquina %s", puertoHost, host.Ip, puertoInvitado, nameVM)
+	fmt.Println(mensaje)
+	return mensaje
+}
+
+/*
+Funciòn que reserva en la base de datos el puerto del host de una regla de reenvìo
+@return Retorna el puerto reservado, o un error si el puerto solicitado està ocupado o no hay puertos libres
+*/
+func asignarPuertoReenvio(uuidVM string, hostId int, nombre string, protocolo string, puertoInvitado int, solicitado int) (int, error) {
+
+	insertar := func(puerto int) error {
+		_, err := db.Exec("INSERT INTO reenvio_puerto (maquina_virtual_uuid, host_id, nombre, protocolo, puerto_host, puerto_invitado) VALUES (?, ?, ?, ?, ?, ?)",
+			uuidVM, hostId, nombre, protocolo, puerto, puertoInvitado)
+		return err
+	}
+
+	var existente int
+	if err := db.QueryRow("SELECT id FROM reenvio_puerto WHERE maquina_virtual_uuid = ? AND nombre = ?", uuidVM, nombre).Scan(&existente); err == nil {
+		return 0, errors.New("la màquina ya tiene una regla de reenvìo con el nombre " + nombre)
+	}
+
+	if solicitado > 0 {
+		if err := insertar(solicitado); err != nil {
+			return 0, fmt.Errorf("el puerto %d del host ya està en uso", solicitado)
+		}
+		return solicitado, nil
+	}
+
+	//La restricciòn UNIQUE (host_id, protocolo, puerto_host) evita que dos reglas reserven el mismo puerto al mismo tiempo; en ese caso se busca otro
+	var puerto int
+	for intento := 0; intento < 5; intento++ {
+		err := db.QueryRow(`SELECT MIN(p.puerto) FROM (SELECT ? AS puerto UNION SELECT puerto_host + 1 FROM reenvio_puerto WHERE host_id = ? AND protocolo = ?) p
+			WHERE p.puerto <= ? AND p.puerto NOT IN (SELECT puerto_host FROM reenvio_puerto WHERE host_id = ? AND protocolo = ?)`,
+			puertoReenvioInicial, hostId, protocolo, puertoReenvioFinal, hostId, protocolo).Scan(&puerto)
+		if err != nil || puerto == 0 {
+			return 0, errors.New("no hay puertos libres en el host para reenviar")
+		}
+		if err := insertar(puerto); err == nil {
+			return puerto, nil
+		}
+	}
+	return 0, errors.New("no se pudo reservar un puerto de reenvìo en el host")
+}
+
+/*
+Funciòn que elimina una regla de reenvìo de puertos de una MV y libera el puerto del host
+@nameVM Paràmetro que contiene el nombre de la MV
+@nombre Paràmetro que contiene el nombre de la regla
+*/
+func eliminarReenvioPuerto(nameVM string, nombre string) string {
+
+	maquinaVirtual, err := getVM(nameVM)
+	if err != nil {
+		log.Println("Error al obtener la MV:", err)
+		return "Error al obtener la MV"
+	}
+	if _, err := getReenvioPuerto(maquinaVirtual.Uuid, nombre); err != nil {
+		return "No se encontrò la regla de reenvìo"
+	}
+
+	host, err := getHost(maquinaVirtual.Host_id)
+	if err != nil {
+		log.Println("Error al obtener el host:", err)
+		return "Error al obtener el host"
+	}
+	config, err := configurarSSH(host.Hostname, *privateKeyPath)
+	if err != nil {
+		log.Println("Error al configurar SSH:", err)
+		return "Error al configurar SSH"
+	}
+
+	running, _ := isRunning(nameVM, host, config)
+	if running {
+		_, err = ejecutarVBoxManage(host, config, "controlvm", nameVM, "natpf1", "delete", nombre)
+	} else {
+		_, err = ejecutarVBoxManage(host, config, "modifyvm", nameVM, "--natpf1", "delete", nombre)
+	}
+	if err != nil {
+		log.Println("Error al eliminar la regla de reenvìo:", err)
+		return "Error al eliminar la regla de reenvìo"
+	}
+
+	if _, err := db.Exec("DELETE FROM reenvio_puerto WHERE maquina_virtual_uuid = ? AND nombre = ?", maquinaVirtual.Uuid, nombre); err != nil {
+		log.Println("Error al eliminar el registro de la regla de reenvìo:", err)
+	}
+	fmt.Println("Regla de reenvìo " + nombre + " eliminada de la màquina " + nameVM)
+	return "Regla de reenvìo eliminada con èxito"
+}
+
+/*
+Funciòn que copia el modo de red de una MV a su clon. VirtualBox copia las reglas de reenvìo junto con la MV,
+por lo que se eliminan del clon para que no use los mismos puertos del host que la MV de origen
+@host Paràmetro que contiene el host en el cual estàn las MV
+@config Paràmetro que contiene la configuraciòn SSH
+@origen Paràmetro que contiene la MV de origen
+@clon Paràmetro que contiene el clon apagado
+*/
+func copiarRedClon(host Host, config *ssh.ClientConfig, origen Maquina_virtual, clon Maquina_virtual) {
+
+	modo, red := getRedMV(origen.Uuid)
+	if _, err := db.Exec("INSERT INTO red_mv (maquina_virtual_uuid, modo, red) VALUES (?, ?, ?)", clon.Uuid, modo, red); err != nil {
+		log.Println("Error al registrar el modo de red del clon:", err)
+	}
+
+	reenvios, _ := consultReenviosPuerto(origen.Uuid)
+	for _, reenvio := range reenvios {
+		if _, err := ejecutarVBoxManage(host, config, "modifyvm", clon.Nombre, "--natpf1", "delete", reenvio.Nombre); err != nil {
+			log.Println("Error al eliminar la regla de reenvìo "+reenvio.Nombre+" del clon:", err)
+		}
+	}
+}
+
+/*
+Funciòn que elimina el modo de red y libera los puertos de reenvìo de una MV eliminada
+@uuidVM Paràmetro que contiene el uuid de la MV
+*/
+func liberarRedMV(uuidVM string) {
+	if _, err := db.Exec("DELETE FROM reenvio_puerto WHERE maquina_virtual_uuid = ?", uuidVM); err != nil {
+		log.Println("Error al liberar los puertos de reenvìo:", err)
+	}
+	if _, err := db.Exec("DELETE FROM red_mv WHERE maquina_virtual_uuid = ?", uuidVM); err != nil {
+		log.Println("Error al eliminar el modo de red de la MV:", err)
+	}
+}
+
+/*
+Funciòn que obtiene una regla de reenvìo de una MV por su nombre
+*/
+func getReenvioPuerto(uuidVM string, nombre string) (ReenvioPuerto, error) {
+	reenvios, err := consultReenviosPuerto(uuidVM)
+	if err != nil {
+		return ReenvioPuerto{}, err
+	}
+	for _, reenvio := range reenvios {
+		if reenvio.Nombre == nombre {
+			return reenvio, nil
+		}
+	}
+	return ReenvioPuerto{}, errors.New("no se encontrò la regla de reenvìo")
+}
+
+/*
+Funciòn que consulta las reglas de reenvìo de puertos de una MV
+@uuidVM Paràmetro que contiene el uuid de la MV
+*/
+func consultReenviosPuerto(uuidVM string) ([]ReenvioPuerto, error) {
+
+	rows, err := db.Query("SELECT id, maquina_virtual_uuid, host_id, nombre, protocolo, puerto_host, puerto_invitado FROM reenvio_puerto WHERE maquina_virtual_uuid = ? ORDER BY puerto_host", uuidVM)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reenvios []ReenvioPuerto
+	for rows.Next() {
+		var reenvio ReenvioPuerto
+		if err := rows.Scan(&reenvio.Id, &reenvio.Maquina_virtual_uuid, &reenvio.Host_id, &reenvio.Nombre, &reenvio.Protocolo, &reenvio.Puerto_host, &reenvio.Puerto_invitado); err != nil {
+			log.Println("Error al obtener la fila")
+			continue
+		}
+		reenvios = append(reenvios, reenvio)
+	}
+	return reenvios, rows.Err()
+}
+
+/*
+Funciòn que obtiene la direcciòn para conectarse por SSH a una MV. Las MV en modo NAT solo son accesibles
+a travès de una regla que reenvìe un puerto del host al puerto 22
+@maquinaVirtual Paràmetro que contiene la MV
+@return Retorna la direcciòn IP y el puerto
+*/
+func direccionSSHMV(maquinaVirtual Maquina_virtual) (string, string) {
+	if modo, _ := getRedMV(maquinaVirtual.Uuid); modo == "nat" {
+		reenvios, _ := consultReenviosPuerto(maquinaVirtual.Uuid)
+		for _, reenvio := range reenvios {
+			if reenvio.Protocolo == "tcp" && reenvio.Puerto_invitado == 22 {
+				if host, err := getHost(maquinaVirtual.Host_id); err == nil {
+					return host.Ip, strconv.Itoa(reenvio.Puerto_host)
+				}
+			}
+		}
+	}
+	return maquinaVirtual.Ip, "22"
+}
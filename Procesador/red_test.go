@@ -0,0 +1,40 @@
+package main
+
+import "testing"
+
+func TestValidarModoRed(t *testing.T) {
+	redesAnteriores, adaptadoresAnteriores := *redesNATPermitidas, *adaptadoresHostOnlyPermitidos
+	defer func() { *redesNATPermitidas, *adaptadoresHostOnlyPermitidos = redesAnteriores, adaptadoresAnteriores }()
+	*redesNATPermitidas = "LabRedes, uq7_lab"
+	*adaptadoresHostOnlyPermitidos = "vboxnet1"
+
+	casos := []struct {
+		modo   string
+		red    string
+		valido bool
+	}{
+		{"bridged", "", true},
+		{"nat", "", true},
+		{"natnetwork", "", true},
+		{"hostonly", "", true},
+		{"natnetwork", *redNATDefecto, true},
+		{"natnetwork", "LabRedes", true},
+		{"hostonly", *adaptadorHostOnly, true},
+		{"hostonly", "vboxnet1", true},
+		{"puente", "", false},
+		{"natnetwork", "OtraRed", false},
+		{"natnetwork", "vboxnet1", false},
+		{"hostonly", "LabRedes", false},
+		{"hostonly", "vboxnet9", false},
+		//Las redes privadas de VirtualBox nunca se aceptan, aunque estèn en la lista de redes permitidas
+		{"natnetwork", "uq3_equipo", false},
+		{"natnetwork", "uq7_lab", false},
+		{"natnetwork", "red con espacios", false},
+	}
+	for _, caso := range casos {
+		err := validarModoRed(caso.modo, caso.red)
+		if (err == nil) != caso.valido {
+			t.Errorf("validarModoRed(%q, %q) = %v, se esperaba vàlido = %v", caso.modo, caso.red, err, caso.valido)
+		}
+	}
+}
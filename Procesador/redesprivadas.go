@@ -0,0 +1,598 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+/*
+Estructura de datos tipo JSON que representa una red privada que comunica solo a las MV de un proyecto o grupo.
+Todas las MV de una red privada deben estar en el mismo host, que se fija al conectar la primera MV
+@Id Representa el identificador ùnico de la red
+@Nombre Representa el nombre de la red, normalmente el del proyecto o grupo
+@Tipo Representa el tipo de red en VirtualBox: intnet (red interna sin salida) ò natnetwork (red NAT con salida a internet)
+@Segmento Representa la red IPv4 de las redes NAT. Por ejemplo: 10.0.2.0/24
+@Persona_email Representa el email del propietario de la red
+@Host_id Representa el host en el que estàn las MV de la red. Es 0 mientras la red no tiene MV conectadas
+@Fecha_creacion Representa el momento en el que se creò la red
+@Miembros Representa los nombres de las MV conectadas a la red
+*/
+type RedPrivada struct {
+	Id             int
+	Nombre         string
+	Tipo           string
+	Segmento       string
+	Persona_email  string
+	Host_id        int
+	Fecha_creacion time.Time
+	Miembros       []string
+}
+
+// Cantidad de adaptadores de red de una MV en VirtualBox. El primero lo usa el modo de red de la MV
+const tarjetasRedMV = 8
+
+// Tipos de red que se pueden usar como red privada
+var tiposRedPrivada = map[string]bool{"intnet": true, "natnetwork": true}
+
+/*
+Funciòn que configura los endpoints para administrar las redes privadas y conectarlas a las MV como adaptadores adicionales.
+La conexiòn y desconexiòn de las MV se encolan en la cola de gestiòn
+*/
+func manejarRedesPrivadas() {
+
+	//Endpoint para crear una red privada
+	http.HandleFunc("/json/createPrivateNetwork", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Se requiere una solicitud POST", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var datos struct {
+			Email    string
+			Nombre   string
+			Tipo     string
+			Segmento string
+		}
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&datos); err != nil {
+			http.Error(w, "Error al decodificar JSON de la solicitud", http.StatusBadRequest)
+			return
+		}
+		if _, err := getUser(datos.Email); err != nil {
+			http.Error(w, "No se encontró el usuario", http.StatusNotFound)
+			return
+		}
+		if err := validarNombre(datos.Nombre); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if datos.Tipo == "" {
+			datos.Tipo = "intnet"
+		}
+		if !tiposRedPrivada[datos.Tipo] {
+			http.Error(w, "El tipo de red debe ser 'intnet' o 'natnetwork'", http.StatusBadRequest)
+			return
+		}
+		if datos.Tipo == "natnetwork" {
+			if datos.Segmento == "" {
+				datos.Segmento = segmentoRedNAT
+			}
+			if _, _, err := net.ParseCIDR(datos.Segmento); err != nil || strings.Contains(datos.Segmento, ":") {
+				http.Error(w, "El segmento debe ser una red IPv4. Por ejemplo: 10.0.2.0/24", http.StatusBadRequest)
+				return
+			}
+		} else {
+			datos.Segmento = ""
+		}
+
+		resultado, err := db.Exec("INSERT INTO red_privada (nombre, tipo, segmento, persona_email, host_id, fecha_creacion) VALUES (?, ?, ?, ?, 0, ?)",
+			datos.Nombre, datos.Tipo, datos.Segmento, datos.Email, time.Now().UTC().Format("2006-01-02 15:04:05"))
+		if err != nil {
+			log.Println("Error al registrar la red privada:", err)
+			http.Error(w, "Error al registrar la red privada", http.StatusInternalServerError)
+			return
+		}
+		id, _ := resultado.LastInsertId()
+
+		response := map[string]interface{}{"mensaje": "Red privada creada con éxito", "id": id}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(response)
+	})
+
+	//Endpoint para eliminar una red privada sin MV conectadas
+	http.HandleFunc("/json/deletePrivateNetwork", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Se requiere una solicitud POST", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var datos struct {
+			Email string
+			Id    int
+		}
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&datos); err != nil {
+			http.Error(w, "Error al decodificar JSON de la solicitud", http.StatusBadRequest)
+			return
+		}
+		red, mensaje, estado := validarPropietarioRedPrivada(datos.Id, datos.Email)
+		if estado != http.StatusOK {
+			http.Error(w, mensaje, estado)
+			return
+		}
+		if len(red.Miembros) > 0 {
+			http.Error(w, "Debe desconectar las máquinas virtuales de la red antes de eliminarla", http.StatusConflict)
+			return
+		}
+
+		if _, err := db.Exec("DELETE FROM red_privada WHERE id = ?", red.Id); err != nil {
+			log.Println("Error al eliminar la red privada:", err)
+			http.Error(w, "Error al eliminar la red privada", http.StatusInternalServerError)
+			return
+		}
+
+		response := map[string]string{"mensaje": "Red privada eliminada con éxito"}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(response)
+	})
+
+	//Endpoint para consultar las redes privadas de un usuario. Los administradores ven todas las redes
+	http.HandleFunc("/json/consultPrivateNetworks", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Se requiere una solicitud POST", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var persona Persona
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&persona); err != nil { //Solo llega el email
+			http.Error(w, "Error al decodificar JSON de la solicitud", http.StatusBadRequest)
+			return
+		}
+
+		persona, err := getUser(persona.Email)
+		if err != nil {
+			http.Error(w, "No se encontró el usuario", http.StatusNotFound)
+			return
+		}
+
+		var redes []RedPrivada
+		if persona.Rol == "Administrador" {
+			redes, err = consultRedesPrivadas("", nil)
+		} else {
+			redes, err = consultRedesPrivadas("WHERE persona_email = ?", persona.Email)
+		}
+		if err != nil {
+			log.Println("Error al consultar las redes privadas:", err)
+			http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(redes)
+	})
+
+	//Endpoints para conectar y desconectar MV de una red privada
+	encolarSolicitudRedPrivada := func(tipoEsperado string, mensaje string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				http.Error(w, "Se requiere una solicitud POST", http.StatusMethodNotAllowed)
+				return
+			}
+
+			var datos map[string]interface{}
+			decoder := json.NewDecoder(r.Body)
+			if err := decoder.Decode(&datos); err != nil {
+				http.Error(w, "Error al decodificar JSON de la solicitud", http.StatusBadRequest)
+				return
+			}
+
+			tipoSolicitud, _ := datos["tipo_solicitud"].(string)
+			if tipoSolicitud != tipoEsperado {
+				http.Error(w, "El campo 'tipo_solicitud' debe ser '"+tipoEsperado+"'", http.StatusBadRequest)
+				return
+			}
+
+			email, _ := datos["email"].(string)
+			nombreVM, _ := datos["nombreVM"].(string)
+			idRed, _ := datos["idRed"].(float64)
+			if err := validarNombre(nombreVM); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if mensajeError, estado := validarPropietarioOAdministrador(nombreVM, email); estado != http.StatusOK {
+				http.Error(w, mensajeError, estado)
+				return
+			}
+			red, mensajeError, estado := validarPropietarioRedPrivada(int(idRed), email)
+			if estado != http.StatusOK {
+				http.Error(w, mensajeError, estado)
+				return
+			}
+
+			maquinaVirtual, _ := getVM(nombreVM)
+			conectada := false
+			for _, miembro := range red.Miembros {
+				conectada = conectada || miembro == maquinaVirtual.Nombre
+			}
+			if tipoSolicitud == "attach_private_network" {
+				if conectada {
+					http.Error(w, "La máquina virtual ya está conectada a la red", http.StatusConflict)
+					return
+				}
+				if red.Host_id != 0 && red.Host_id != maquinaVirtual.Host_id {
+					http.Error(w, "Las máquinas virtuales de la red están en otro host", http.StatusConflict)
+					return
+				}
+			} else if !conectada {
+				http.Error(w, "La máquina virtual no está conectada a la red", http.StatusConflict)
+				return
+			}
+
+			// Encola las peticiones.
+			identificarMV(datos)
+			mu.Lock()
+			managementQueue.Queue.PushBack(datos)
+			mu.Unlock()
+
+			// Envía una respuesta al cliente.
+			response := map[string]string{"mensaje": mensaje}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(response)
+		}
+	}
+
+	http.HandleFunc("/json/attachPrivateNetwork", encolarSolicitudRedPrivada("attach_private_network", "Mensaje JSON para conectar la red privada recibido correctamente"))
+	http.HandleFunc("/json/detachPrivateNetwork", encolarSolicitudRedPrivada("detach_private_network", "Mensaje JSON para desconectar la red privada recibido correctamente"))
+}
+
+/*
+Funciòn que verifica que una red privada exista y que el solicitante sea su propietario o un administrador
+@return Retorna la red, y un mensaje y un còdigo HTTP de error si la validaciòn falla
+*/
+func validarPropietarioRedPrivada(idRed int, email string) (RedPrivada, string, int) {
+	red, err := getRedPrivada(idRed)
+	if err != nil {
+		return red, "No se encontró la red privada", http.StatusNotFound
+	}
+	solicitante, err := getUser(email)
+	if err != nil {
+		return red, "No se encontró el usuario solicitante", http.StatusNotFound
+	}
+	if red.Persona_email != solicitante.Email && solicitante.Rol != "Administrador" {
+		return red, "Solo el propietario de la red privada o un administrador pueden realizar esta operación", http.StatusForbidden
+	}
+	return red, "", http.StatusOK
+}
+
+/*
+Funciòn que obtiene el host en el que se debe crear una MV conectada a redes privadas
+@redes Paràmetro que contiene los identificadores de las redes privadas de la nueva MV
+@email Paràmetro que contiene el email del propietario de la nueva MV
+@return Retorna el host de las redes, 0 si ninguna tiene MV conectadas, o un error si las redes estàn en hosts distintos
+*/
+func hostRedesPrivadas(redes []int, email string) (int, error) {
+
+	if len(redes) > tarjetasRedMV-1 {
+		return 0, fmt.Errorf("una màquina virtual se puede conectar màximo a %d redes privadas", tarjetasRedMV-1)
+	}
+	idHost := 0
+	for _, idRed := range redes {
+		red, mensaje, estado := validarPropietarioRedPrivada(idRed, email)
+		if estado != http.StatusOK {
+			return 0, errors.New(mensaje)
+		}
+		if red.Host_id != 0 {
+			if idHost != 0 && idHost != red.Host_id {
+				return 0, errors.New("las redes privadas solicitadas estàn en hosts distintos")
+			}
+			idHost = red.Host_id
+		}
+	}
+	return idHost, nil
+}
+
+/*
+Funciòn que conecta una MV apagada a una red privada en uno de sus adaptadores. Si la red aùn no tiene MV conectadas
+queda asignada al host de la MV
+@host Paràmetro que contiene el host en el cual està la MV
+@config Paràmetro que contiene la configuraciòn SSH
+@maquinaVirtual Paràmetro que contiene la MV
+@red Paràmetro que contiene la red privada
+@tarjeta Paràmetro que contiene el nùmero del adaptador de red de la MV, entre 2 y 8
+@return Retorna un mensaje de error, o una cadena vacìa si la conexiòn fue exitosa
+*/
+func conectarTarjetaRedPrivada(host Host, config *ssh.ClientConfig, maquinaVirtual Maquina_virtual, red RedPrivada, tarjeta int) string {
+
+	//La red se asigna al host solo si sigue libre, por si otra MV se conectò al mismo tiempo desde otro host
+	if red.Host_id == 0 {
+		db.Exec("UPDATE red_privada SET host_id = ? WHERE id = ? AND host_id = 0", host.Id, red.Id)
+		db.QueryRow("SELECT host_id FROM red_privada WHERE id = ?", red.Id).Scan(&red.Host_id)
+	}
+	if red.Host_id != host.Id {
+		return "Las màquinas virtuales de la red " + red.Nombre + " estàn en otro host"
+	}
+
+	numero := strconv.Itoa(tarjeta)
+	nombreVBox := nombreVBoxRedPrivada(red)
+	argumentos := []string{"modifyvm", maquinaVirtual.Nombre, "--nic" + numero, red.Tipo}
+	if red.Tipo == "natnetwork" {
+		if mensaje := asegurarRedNAT(host, config, nombreVBox, red.Segmento); mensaje != "" {
+			return mensaje
+		}
+		argumentos = append(argumentos, "--nat-network"+numero, nombreVBox)
+	} else {
+		argumentos = append(argumentos, "--intnet"+numero, nombreVBox)
+	}
+
+	if _, err := ejecutarVBoxManage(host, config, argumentos...); err != nil {
+		log.Println("Error al conectar la MV a la red privada:", err)
+		liberarHostRedPrivada(host, config, red)
+		return "Error al conectar la MV a la red privada " + red.Nombre
+	}
+
+	if _, err := db.Exec("INSERT INTO red_privada_mv (red_id, maquina_virtual_uuid, tarjeta) VALUES (?, ?, ?)", red.Id, maquinaVirtual.Uuid, tarjeta); err != nil {
+		log.Println("Error al registrar la conexiòn a la red privada:", err)
+		return "Error al registrar la conexiòn a la red privada"
+	}
+	return ""
+}
+
+/*
+Funciòn que conecta una MV existente a una red privada en su primer adaptador libre. La MV debe estar apagada
+@nameVM Paràmetro que contiene el nombre de la MV
+@idRed Paràmetro que contiene el identificador de la red privada
+*/
+func conectarRedPrivada(nameVM string, idRed int) string {
+
+	maquinaVirtual, err := getVM(nameVM)
+	if err != nil {
+		log.Println("Error al obtener la MV:", err)
+		return "Error al obtener la MV"
+	}
+	red, err := getRedPrivada(idRed)
+	if err != nil {
+		return "No se encontrò la red privada"
+	}
+
+	host, config, info, mensaje := prepararMVApagadaRed(maquinaVirtual)
+	if mensaje != "" {
+		return mensaje
+	}
+
+	tarjeta := tarjetaLibreRed(info)
+	if tarjeta == 0 {
+		return "La màquina no tiene adaptadores de red libres"
+	}
+	if mensaje := conectarTarjetaRedPrivada(host, config, maquinaVirtual, red, tarjeta); mensaje != "" {
+		return mensaje
+	}
+
+	fmt.Println("Màquina " + nameVM + " conectada a la red privada " + red.Nombre)
+	return "Màquina conectada a la red privada con èxito"
+}
+
+/*
+Funciòn que desconecta una MV de una red privada y deshabilita el adaptador que usaba. La MV debe estar apagada
+@nameVM Paràmetro que contiene el nombre de la MV
+@idRed Paràmetro que contiene el identificador de la red privada
+*/
+func desconectarRedPrivada(nameVM string, idRed int) string {
+
+	maquinaVirtual, err := getVM(nameVM)
+	if err != nil {
+		log.Println("Error al obtener la MV:", err)
+		return "Error al obtener la MV"
+	}
+	red, err := getRedPrivada(idRed)
+	if err != nil {
+		return "No se encontrò la red privada"
+	}
+
+	var tarjeta int
+	if err := db.QueryRow("SELECT tarjeta FROM red_privada_mv WHERE red_id = ? AND maquina_virtual_uuid = ?", idRed, maquinaVirtual.Uuid).Scan(&tarjeta); err != nil {
+		return "La màquina no està conectada a la red privada"
+	}
+
+	host, config, _, mensaje := prepararMVApagadaRed(maquinaVirtual)
+	if mensaje != "" {
+		return mensaje
+	}
+
+	if _, err := ejecutarVBoxManage(host, config, "modifyvm", nameVM, "--nic"+strconv.Itoa(tarjeta), "none"); err != nil {
+		log.Println("Error al desconectar la MV de la red privada:", err)
+		return "Error al desconectar la MV de la red privada"
+	}
+	db.Exec("DELETE FROM red_privada_mv WHERE red_id = ? AND maquina_virtual_uuid = ?", idRed, maquinaVirtual.Uuid)
+	liberarHostRedPrivada(host, config, red)
+
+	fmt.Println("Màquina " + nameVM + " desconectada de la red privada " + red.Nombre)
+	return "Màquina desconectada de la red privada con èxito"
+}
+
+/*
+Funciòn que obtiene el host, la configuraciòn SSH y la informaciòn de una MV, y verifica que estè apagada,
+ya que VirtualBox solo permite habilitar adaptadores de red con la MV apagada
+@return Retorna el host, la configuraciòn SSH, la informaciòn de la MV y un mensaje de error si no se puede continuar
+*/
+func prepararMVApagadaRed(maquinaVirtual Maquina_virtual) (Host, *ssh.ClientConfig, infoMV, string) {
+
+	host, err := getHost(maquinaVirtual.Host_id)
+	if err != nil {
+		log.Println("Error al obtener el host:", err)
+		return host, nil, infoMV{}, "Error al obtener el host"
+	}
+
+	config, err := configurarSSH(host.Hostname, *privateKeyPath)
+	if err != nil {
+		log.Println("Error al configurar SSH:", err)
+		return host, nil, infoMV{}, "Error al configurar SSH"
+	}
+
+	info, err := obtenerInfoMV(host, config, maquinaVirtual.Nombre)
+	if err != nil {
+		log.Println("Error al obtener la informaciòn de la MV:", err)
+		return host, nil, info, "Error al obtener la informaciòn de la MV"
+	}
+	if info.encendida() {
+		return host, nil, info, "Debe apagar la màquina para cambiar sus redes privadas"
+	}
+	return host, config, info, ""
+}
+
+/*
+Funciòn que busca el primer adaptador de red deshabilitado de una MV. El adaptador 1 lo usa el modo de red de la MV
+@info Paràmetro que contiene la informaciòn de la MV en VirtualBox
+@return Retorna el nùmero del adaptador, o 0 si no hay adaptadores libres
+*/
+func tarjetaLibreRed(info infoMV) int {
+	ocupadas := make(map[int]bool)
+	for _, tarjeta := range info.Tarjetas {
+		ocupadas[tarjeta.Numero] = true
+	}
+	for numero := 2; numero <= tarjetasRedMV; numero++ {
+		if !ocupadas[numero] {
+			return numero
+		}
+	}
+	return 0
+}
+
+/*
+Funciòn que libera el host de una red privada cuando ya no tiene MV conectadas, para que la siguiente MV pueda estar en cualquier host.
+Las redes NAT se eliminan del host
+@host Paràmetro que contiene el host de la red
+@config Paràmetro que contiene la configuraciòn SSH
+@red Paràmetro que contiene la red privada
+*/
+func liberarHostRedPrivada(host Host, config *ssh.ClientConfig, red RedPrivada) {
+
+	resultado, err := db.Exec("UPDATE red_privada SET host_id = 0 WHERE id = ? AND NOT EXISTS (SELECT 1 FROM red_privada_mv WHERE red_id = ?)", red.Id, red.Id)
+	if err != nil {
+		log.Println("Error al liberar el host de la red privada:", err)
+		return
+	}
+	if filas, _ := resultado.RowsAffected(); filas > 0 && red.Tipo == "natnetwork" {
+		if _, err := ejecutarVBoxManage(host, config, "natnetwork", "remove", "--netname", nombreVBoxRedPrivada(red)); err != nil {
+			log.Println("Error al eliminar la red NAT del host:", err)
+		}
+	}
+}
+
+/*
+Funciòn que elimina las conexiones a redes privadas de una MV eliminada y libera el host de las redes que quedan vacìas
+@host Paràmetro que contiene el host de la MV
+@config Paràmetro que contiene la configuraciòn SSH
+@uuidVM Paràmetro que contiene el uuid de la MV
+*/
+func liberarRedesPrivadasMV(host Host, config *ssh.ClientConfig, uuidVM string) {
+
+	redes, err := consultRedesPrivadas("WHERE id IN (SELECT red_id FROM red_privada_mv WHERE maquina_virtual_uuid = ?)", uuidVM)
+	if err != nil {
+		log.Println("Error al consultar las redes privadas de la MV:", err)
+		return
+	}
+	db.Exec("DELETE FROM red_privada_mv WHERE maquina_virtual_uuid = ?", uuidVM)
+	for _, red := range redes {
+		liberarHostRedPrivada(host, config, red)
+	}
+}
+
+/*
+Funciòn que registra las conexiones a redes privadas de un clon. VirtualBox copia los adaptadores de red junto con la MV
+y el clon se crea en el mismo host, por lo que queda conectado a las mismas redes
+@origen Paràmetro que contiene la MV de origen
+@clon Paràmetro que contiene el clon
+*/
+func copiarRedesPrivadasClon(origen Maquina_virtual, clon Maquina_virtual) {
+	if _, err := db.Exec("INSERT INTO red_privada_mv (red_id, maquina_virtual_uuid, tarjeta) SELECT red_id, ?, tarjeta FROM red_privada_mv WHERE maquina_virtual_uuid = ?", clon.Uuid, origen.Uuid); err != nil {
+		log.Println("Error al registrar las redes privadas del clon:", err)
+	}
+}
+
+/*
+Funciòn que genera el nombre con el que se crea una red privada en VirtualBox. El identificador evita que
+dos redes con el mismo nombre queden conectadas entre sì
+*/
+func nombreVBoxRedPrivada(red RedPrivada) string {
+	return "uq" + strconv.Itoa(red.Id) + "_" + red.Nombre
+}
+
+/*
+Funciòn que obtiene una red privada dado su identificador ùnico
+*/
+func getRedPrivada(idRed int) (RedPrivada, error) {
+	redes, err := consultRedesPrivadas("WHERE id = ?", idRed)
+	if err != nil {
+		return RedPrivada{}, err
+	}
+	if len(redes) == 0 {
+		return RedPrivada{}, sql.ErrNoRows
+	}
+	return redes[0], nil
+}
+
+/*
+Funciòn que consulta las redes privadas que cumplen una condiciòn, junto con los nombres de sus MV
+@condicion Paràmetro que contiene la clàusula WHERE de la consulta. Si està vacìa se consultan todas las redes
+@argumento Paràmetro que contiene el valor de la condiciòn
+*/
+func consultRedesPrivadas(condicion string, argumento interface{}) ([]RedPrivada, error) {
+
+	query := "SELECT id, nombre, tipo, segmento, persona_email, host_id, fecha_creacion FROM red_privada " + condicion
+	var rows *sql.Rows
+	var err error
+	if condicion == "" {
+		rows, err = db.Query(query)
+	} else {
+		rows, err = db.Query(query, argumento)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var redes []RedPrivada
+	for rows.Next() {
+		var red RedPrivada
+		var fecha string
+		if err := rows.Scan(&red.Id, &red.Nombre, &red.Tipo, &red.Segmento, &red.Persona_email, &red.Host_id, &fecha); err != nil {
+			log.Println("Error al obtener la fila")
+			continue
+		}
+		red.Fecha_creacion, _ = time.Parse("2006-01-02 15:04:05", fecha)
+		redes = append(redes, red)
+	}
+	if err := rows.Err(); err != nil {
+		return redes, err
+	}
+
+	for i := range redes {
+		miembros, err := db.Query("SELECT m.nombre FROM red_privada_mv r JOIN maquina_virtual m ON r.maquina_virtual_uuid = m.uuid WHERE r.red_id = ? ORDER BY r.tarjeta, m.nombre", redes[i].Id)
+		if err != nil {
+			return redes, err
+		}
+		for miembros.Next() {
+			var nombre string
+			if miembros.Scan(&nombre) == nil {
+				redes[i].Miembros = append(redes[i].Miembros, nombre)
+			}
+		}
+		miembros.Close()
+	}
+	return redes, nil
+}
@@ -0,0 +1,613 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+/*
+Estructura de datos tipo JSON que representa una reserva de capacidad: N MV de una plantilla entre dos momentos.
+Durante la reserva la memoria RAM y la CPU de las MV que aùn no se han creado quedan retenidas en los hosts asignados
+@Id Representa el identificador ùnico de la reserva
+@Persona_email Representa el email del instructor ò administrador que hizo la reserva
+@Curso_id Representa el curso cuyos miembros pueden usar la reserva. Si es 0 solo la puede usar quien la hizo
+@Plantilla_id Representa la plantilla de las MV reservadas
+@Cantidad Representa la cantidad de MV reservadas
+@Ram Representa la memoria RAM de cada MV en mb. Si es 0 se usa la de la plantilla
+@Cpu Representa las unidades de procesamiento de cada MV. Si es 0 se usan las de la plantilla
+@Fecha_inicio Representa el inicio de la reserva
+@Fecha_fin Representa el fin de la reserva
+@Estado Representa el estado de la reserva: activa ò cancelada
+@Hosts Representa la cantidad de MV reservadas en cada host
+@Usadas Representa la cantidad de MV creadas con la reserva que aùn existen y de las que se estàn creando
+@Fecha_creacion Representa la fecha de creaciòn de la reserva
+@Advertencias Representa los hosts asignados cuyas MV actuales no dejarìan espacio para la reserva si siguen encendidas
+cuando empiece. Solo se entrega al crear la reserva
+*/
+type Reserva struct {
+	Id             int
+	Persona_email  string
+	Curso_id       int
+	Plantilla_id   int
+	Cantidad       int
+	Ram            int
+	Cpu            int
+	Fecha_inicio   time.Time
+	Fecha_fin      time.Time
+	Estado         string
+	Hosts          []ReservaHost
+	Usadas         int
+	Fecha_creacion time.Time
+	Advertencias   []string
+}
+
+/*
+Estructura de datos tipo JSON que representa la parte de una reserva asignada a un host
+@Host_id Representa el host
+@Cantidad Representa la cantidad de MV reservadas en el host
+@Usadas Representa la cantidad de MV creadas en el host con la reserva
+*/
+type ReservaHost struct {
+	Host_id  int
+	Cantidad int
+	Usadas   int
+}
+
+// Estados de una reserva
+const (
+	reservaActiva    = "activa"
+	reservaCancelada = "cancelada"
+)
+
+// Duraciòn màxima de una reserva
+const maxDuracionReserva = 7 * 24 * time.Hour
+
+// Fracciòn de la RAM y la CPU de los hosts que se puede usar, la misma que usa validarDisponibilidadRecursosHost
+const fraccionUsableHost = 0.75
+
+// Serializa la admisiòn de reservas para que dos reservas simultàneas no se asignen la misma capacidad, y la
+// asignaciòn de los lugares de una reserva para que las creaciones simultàneas no superen su cantidad
+var muReservas sync.Mutex
+
+// Prefijo del uuid de los registros de reserva_mv que reclaman un lugar de la reserva para una MV que se està creando
+const prefijoLugarPendiente = "pendiente:"
+
+/*
+Funciòn que configura los endpoints del calendario de reservas de capacidad
+*/
+func manejarReservas() {
+
+	//Endpoint para reservar capacidad. Se rechaza si los hosts no tienen capacidad libre de otras reservas en el periodo
+	http.HandleFunc("/json/createReservation", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Se requiere una solicitud POST", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var datos struct {
+			Email   string
+			Reserva Reserva
+		}
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&datos); err != nil {
+			http.Error(w, "Error al decodificar JSON de la solicitud", http.StatusBadRequest)
+			return
+		}
+		reserva := datos.Reserva
+		reserva.Persona_email = datos.Email
+
+		//Las reservas de un curso las hacen sus instructores con las plantillas del curso; las demàs, los administradores
+		if reserva.Curso_id > 0 {
+			curso, mensaje, estado := validarInstructorCurso(reserva.Curso_id, datos.Email)
+			if estado != http.StatusOK {
+				http.Error(w, mensaje, estado)
+				return
+			}
+			permitida := false
+			for _, idPlantilla := range curso.Plantillas {
+				permitida = permitida || idPlantilla == reserva.Plantilla_id
+			}
+			if !permitida {
+				http.Error(w, "La plantilla no está permitida en el curso", http.StatusForbidden)
+				return
+			}
+		} else if !esAdministrador(datos.Email) {
+			http.Error(w, "Solo los administradores pueden hacer reservas sin curso", http.StatusForbidden)
+			return
+		}
+
+		if err := validarReserva(&reserva); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := registrarReserva(&reserva); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(reserva)
+	})
+
+	//Endpoint para consultar el calendario de reservas activas entre dos momentos. Si no se indican se consulta desde ahora
+	http.HandleFunc("/json/consultReservations", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Se requiere una solicitud POST", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var datos struct {
+			Email string
+			Desde time.Time
+			Hasta time.Time
+		}
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&datos); err != nil {
+			http.Error(w, "Error al decodificar JSON de la solicitud", http.StatusBadRequest)
+			return
+		}
+		if _, err := getUser(datos.Email); err != nil {
+			http.Error(w, "No se encontró el usuario", http.StatusNotFound)
+			return
+		}
+		if datos.Desde.IsZero() {
+			datos.Desde = time.Now().UTC()
+		}
+		if datos.Hasta.IsZero() {
+			datos.Hasta = datos.Desde.Add(30 * 24 * time.Hour)
+		}
+
+		reservas, err := consultReservas("fecha_inicio < ? AND fecha_fin > ? AND estado = ?",
+			datos.Hasta.UTC().Format("2006-01-02 15:04:05"), datos.Desde.UTC().Format("2006-01-02 15:04:05"), reservaActiva)
+		if err != nil {
+			log.Println("Error al consultar las reservas:", err)
+			http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(reservas)
+	})
+
+	//Endpoint para cancelar una reserva y liberar la capacidad retenida. Las MV ya creadas no se eliminan
+	http.HandleFunc("/json/cancelReservation", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Se requiere una solicitud POST", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var datos struct {
+			Email string
+			Id    int
+		}
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&datos); err != nil {
+			http.Error(w, "Error al decodificar JSON de la solicitud", http.StatusBadRequest)
+			return
+		}
+		reserva, err := getReserva(datos.Id)
+		if err != nil {
+			http.Error(w, "No se encontró la reserva", http.StatusNotFound)
+			return
+		}
+		if reserva.Persona_email != datos.Email && !esAdministrador(datos.Email) {
+			http.Error(w, "Solo quien hizo la reserva y los administradores pueden cancelarla", http.StatusForbidden)
+			return
+		}
+
+		if _, err := db.Exec("UPDATE reserva SET estado = ? WHERE id = ?", reservaCancelada, reserva.Id); err != nil {
+			log.Println("Error al cancelar la reserva:", err)
+			http.Error(w, "Error al cancelar la reserva", http.StatusInternalServerError)
+			return
+		}
+
+		response := map[string]string{"mensaje": "Reserva cancelada correctamente"}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(response)
+	})
+}
+
+/*
+Funciòn que verifica el periodo y la cantidad de una reserva y completa su RAM y CPU con las de la plantilla
+*/
+func validarReserva(reserva *Reserva) error {
+	if reserva.Cantidad <= 0 {
+		return errors.New("la cantidad de máquinas virtuales debe ser mayor a 0")
+	}
+	reserva.Fecha_inicio = reserva.Fecha_inicio.UTC().Truncate(time.Second)
+	reserva.Fecha_fin = reserva.Fecha_fin.UTC().Truncate(time.Second)
+	if reserva.Fecha_inicio.IsZero() || !reserva.Fecha_fin.After(reserva.Fecha_inicio) {
+		return errors.New("la fecha de fin debe ser posterior a la fecha de inicio")
+	}
+	if !reserva.Fecha_fin.After(time.Now().UTC()) {
+		return errors.New("la reserva ya terminó")
+	}
+	if reserva.Fecha_fin.Sub(reserva.Fecha_inicio) > maxDuracionReserva {
+		return fmt.Errorf("la reserva puede durar máximo %d días", int(maxDuracionReserva.Hours()/24))
+	}
+	specs := Maquina_virtual{Plantilla_id: reserva.Plantilla_id, Ram: reserva.Ram, Cpu: reserva.Cpu}
+	if _, err := aplicarPlantilla(&specs); err != nil {
+		return err
+	}
+	reserva.Ram, reserva.Cpu = specs.Ram, specs.Cpu
+	if reserva.Ram <= 0 || reserva.Cpu <= 0 {
+		return errors.New("la plantilla no define la memoria y la CPU de las máquinas virtuales")
+	}
+	return nil
+}
+
+/*
+Funciòn que admite una reserva: reparte sus MV entre los hosts que tienen el disco de la plantilla, segùn la capacidad
+que no ocupan otras reservas del mismo periodo, y la registra. Si no cabe completa se rechaza.
+Si la reserva empieza de inmediato tambièn se descuentan los recursos que usan las MV actuales del host; si empieza despuès,
+se advierte de los hosts en los que las MV actuales no dejarìan espacio, ya que no se sabe si seguiràn existiendo
+@reserva Paràmetro que contiene la reserva validada. Se completan su identificador, estado y hosts
+*/
+func registrarReserva(reserva *Reserva) error {
+
+	plantilla, err := getPlantilla(reserva.Plantilla_id)
+	if err != nil {
+		return errors.New("la plantilla no existe")
+	}
+	discoBase, err := getDiskById(plantilla.Disco_id)
+	if err != nil {
+		return errors.New("el disco base de la plantilla no existe")
+	}
+
+	muReservas.Lock()
+	defer muReservas.Unlock()
+
+	rows, err := db.Query("SELECT id, nombre, ram_total, cpu_total, ram_usada, cpu_usada FROM host")
+	if err != nil {
+		log.Println("Error al consultar los hosts:", err)
+		return errors.New("no se pudieron consultar los hosts")
+	}
+	type capacidadHost struct {
+		host     Host
+		maquinas int
+		enUso    int
+	}
+	var capacidades []capacidadHost
+	var hosts []Host
+	for rows.Next() {
+		var host Host
+		if err := rows.Scan(&host.Id, &host.Nombre, &host.Ram_total, &host.Cpu_total, &host.Ram_usada, &host.Cpu_usada); err == nil {
+			hosts = append(hosts, host)
+		}
+	}
+	rows.Close()
+
+	inmediata := !reserva.Fecha_inicio.After(time.Now().UTC())
+	for _, host := range hosts {
+		if _, err := getDisk(discoBase.Sistema_operativo, discoBase.Distribucion_sistema_operativo, host.Id); err != nil {
+			continue
+		}
+		ram, cpu, err := recursosReservadosHost(host.Id, reserva.Fecha_inicio, reserva.Fecha_fin)
+		if err != nil {
+			return errors.New("no se pudieron consultar las reservas del host")
+		}
+		libreRam := int(float64(host.Ram_total)*fraccionUsableHost) - ram
+		libreCpu := int(float64(host.Cpu_total)*fraccionUsableHost) - cpu
+		maquinas := maquinasQueCaben(libreRam, libreCpu, reserva.Ram, reserva.Cpu)
+		//Las MV que ya existen en el host ocupan su capacidad; las de reservas en curso se cuentan dos veces, como cota superior
+		enUso := maquinasQueCaben(libreRam-host.Ram_usada, libreCpu-host.Cpu_usada, reserva.Ram, reserva.Cpu)
+		if inmediata {
+			maquinas = enUso
+		}
+		if maquinas > 0 {
+			capacidades = append(capacidades, capacidadHost{host, maquinas, enUso})
+		}
+	}
+
+	//Asigna primero los hosts con màs capacidad libre para usar la menor cantidad de hosts
+	sort.Slice(capacidades, func(i, j int) bool { return capacidades[i].maquinas > capacidades[j].maquinas })
+	pendientes, disponibles := reserva.Cantidad, 0
+	reserva.Hosts = []ReservaHost{}
+	for _, capacidad := range capacidades {
+		disponibles += capacidad.maquinas
+		if pendientes == 0 {
+			continue
+		}
+		cantidad := capacidad.maquinas
+		if cantidad > pendientes {
+			cantidad = pendientes
+		}
+		reserva.Hosts = append(reserva.Hosts, ReservaHost{Host_id: capacidad.host.Id, Cantidad: cantidad})
+		pendientes -= cantidad
+		if cantidad > capacidad.enUso {
+			reserva.Advertencias = append(reserva.Advertencias, fmt.Sprintf("Las máquinas virtuales actuales del host %s solo dejan espacio para %d de las %d máquinas virtuales reservadas en él",
+				capacidad.host.Nombre, capacidad.enUso, cantidad))
+		}
+	}
+	if pendientes > 0 {
+		return fmt.Errorf("no hay capacidad para la reserva en el periodo solicitado: solo se pueden reservar %d máquinas virtuales de la plantilla", disponibles)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return errors.New("no se pudo registrar la reserva")
+	}
+	defer tx.Rollback()
+	reserva.Estado = reservaActiva
+	reserva.Fecha_creacion = time.Now().UTC().Truncate(time.Second)
+	resultado, err := tx.Exec("INSERT INTO reserva (persona_email, curso_id, plantilla_id, cantidad, ram, cpu, fecha_inicio, fecha_fin, estado, fecha_creacion) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		reserva.Persona_email, reserva.Curso_id, reserva.Plantilla_id, reserva.Cantidad, reserva.Ram, reserva.Cpu,
+		reserva.Fecha_inicio.Format("2006-01-02 15:04:05"), reserva.Fecha_fin.Format("2006-01-02 15:04:05"), reserva.Estado,
+		reserva.Fecha_creacion.Format("2006-01-02 15:04:05"))
+	if err != nil {
+		log.Println("Error al registrar la reserva:", err)
+		return errors.New("no se pudo registrar la reserva")
+	}
+	id, _ := resultado.LastInsertId()
+	reserva.Id = int(id)
+	for _, reservaHost := range reserva.Hosts {
+		if _, err := tx.Exec("INSERT INTO reserva_host (reserva_id, host_id, cantidad) VALUES (?, ?, ?)", reserva.Id, reservaHost.Host_id, reservaHost.Cantidad); err != nil {
+			log.Println("Error al registrar la reserva:", err)
+			return errors.New("no se pudo registrar la reserva")
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Println("Error al registrar la reserva:", err)
+		return errors.New("no se pudo registrar la reserva")
+	}
+	return nil
+}
+
+/*
+Funciòn que calcula cuàntas MV con la RAM y la CPU indicadas caben en la capacidad libre de un host
+*/
+func maquinasQueCaben(libreRam int, libreCpu int, ram int, cpu int) int {
+	maquinas := libreRam / ram
+	if porCpu := libreCpu / cpu; porCpu < maquinas {
+		maquinas = porCpu
+	}
+	if maquinas < 0 {
+		return 0
+	}
+	return maquinas
+}
+
+/*
+Funciòn que suma la memoria RAM y la CPU que las reservas activas asignan a un host en un periodo. Se suman todas las
+reservas que se cruzan con el periodo, aunque no coincidan entre sì, por lo que el resultado es una cota superior
+*/
+func recursosReservadosHost(hostId int, inicio time.Time, fin time.Time) (int, int, error) {
+	var ram, cpu int
+	err := db.QueryRow(`SELECT COALESCE(SUM(rh.cantidad * r.ram), 0), COALESCE(SUM(rh.cantidad * r.cpu), 0) FROM reserva_host AS rh
+		INNER JOIN reserva AS r ON r.id = rh.reserva_id WHERE rh.host_id = ? AND r.estado = ? AND r.fecha_inicio < ? AND r.fecha_fin > ?`,
+		hostId, reservaActiva, fin.Format("2006-01-02 15:04:05"), inicio.Format("2006-01-02 15:04:05")).Scan(&ram, &cpu)
+	return ram, cpu, err
+}
+
+/*
+Funciòn que calcula la memoria RAM y la CPU que las reservas en curso retienen en un host: la de las MV reservadas
+que aùn no se han creado. El programador las suma a los recursos usados del host al validar su disponibilidad
+@reservaExcluida Paràmetro que contiene una reserva cuyos recursos no se cuentan. Si es 0 se cuentan todas
+*/
+func recursosRetenidosHost(hostId int, reservaExcluida int) (int, int) {
+	var ram, cpu int
+	ahora := time.Now().UTC().Format("2006-01-02 15:04:05")
+	err := db.QueryRow(`SELECT COALESCE(SUM(GREATEST(rh.cantidad - (SELECT COUNT(*) FROM reserva_mv AS rm
+			INNER JOIN maquina_virtual AS m ON m.uuid = rm.maquina_virtual_uuid WHERE rm.reserva_id = rh.reserva_id AND rm.host_id = rh.host_id), 0) * r.ram), 0),
+		COALESCE(SUM(GREATEST(rh.cantidad - (SELECT COUNT(*) FROM reserva_mv AS rm
+			INNER JOIN maquina_virtual AS m ON m.uuid = rm.maquina_virtual_uuid WHERE rm.reserva_id = rh.reserva_id AND rm.host_id = rh.host_id), 0) * r.cpu), 0)
+		FROM reserva_host AS rh INNER JOIN reserva AS r ON r.id = rh.reserva_id
+		WHERE rh.host_id = ? AND r.estado = ? AND r.fecha_inicio <= ? AND r.fecha_fin > ? AND r.id <> ?`, hostId, reservaActiva, ahora, ahora, reservaExcluida).Scan(&ram, &cpu)
+	if err != nil {
+		log.Println("Error al consultar los recursos retenidos por reservas:", err)
+	}
+	return ram, cpu
+}
+
+/*
+Funciòn que consulta reservas con sus hosts y las MV usadas
+@condicion Paràmetro que contiene la condiciòn WHERE sobre la tabla reserva
+@argumentos Paràmetro que contiene los argumentos de la condiciòn
+*/
+func consultReservas(condicion string, argumentos ...interface{}) ([]Reserva, error) {
+
+	rows, err := db.Query(`SELECT id, persona_email, curso_id, plantilla_id, cantidad, ram, cpu, fecha_inicio, fecha_fin, estado, fecha_creacion
+		FROM reserva WHERE `+condicion+" ORDER BY fecha_inicio, id", argumentos...)
+	if err != nil {
+		return nil, err
+	}
+	reservas := []Reserva{}
+	for rows.Next() {
+		var reserva Reserva
+		var inicio, fin, creacion string
+		if err := rows.Scan(&reserva.Id, &reserva.Persona_email, &reserva.Curso_id, &reserva.Plantilla_id, &reserva.Cantidad, &reserva.Ram, &reserva.Cpu,
+			&inicio, &fin, &reserva.Estado, &creacion); err != nil {
+			log.Println("Error al obtener la fila")
+			continue
+		}
+		reserva.Fecha_inicio, _ = time.Parse("2006-01-02 15:04:05", inicio)
+		reserva.Fecha_fin, _ = time.Parse("2006-01-02 15:04:05", fin)
+		reserva.Fecha_creacion, _ = time.Parse("2006-01-02 15:04:05", creacion)
+		reservas = append(reservas, reserva)
+	}
+	rows.Close()
+
+	for i := range reservas {
+		reservas[i].Hosts, reservas[i].Usadas = hostsReserva(reservas[i].Id)
+	}
+	return reservas, nil
+}
+
+/*
+Funciòn que obtiene la parte de una reserva asignada a cada host, con las MV creadas que aùn existen y las que se estàn creando
+@return Retorna los hosts de la reserva y el total de MV usadas
+*/
+func hostsReserva(idReserva int) ([]ReservaHost, int) {
+	hosts := []ReservaHost{}
+	rows, err := db.Query(`SELECT rh.host_id, rh.cantidad, (SELECT COUNT(*) FROM reserva_mv AS rm LEFT JOIN maquina_virtual AS m ON m.uuid = rm.maquina_virtual_uuid
+		WHERE rm.reserva_id = rh.reserva_id AND rm.host_id = rh.host_id AND (m.uuid IS NOT NULL OR rm.maquina_virtual_uuid LIKE ?))
+		FROM reserva_host AS rh WHERE rh.reserva_id = ? ORDER BY rh.host_id`, prefijoLugarPendiente+"%", idReserva)
+	if err != nil {
+		log.Println("Error al consultar los hosts de la reserva:", err)
+		return hosts, 0
+	}
+	defer rows.Close()
+	usadas := 0
+	for rows.Next() {
+		var reservaHost ReservaHost
+		if err := rows.Scan(&reservaHost.Host_id, &reservaHost.Cantidad, &reservaHost.Usadas); err == nil {
+			hosts = append(hosts, reservaHost)
+			usadas += reservaHost.Usadas
+		}
+	}
+	return hosts, usadas
+}
+
+/*
+Funciòn que obtiene una reserva dado su identificador ùnico
+*/
+func getReserva(id int) (Reserva, error) {
+	reservas, err := consultReservas("id = ?", id)
+	if err != nil {
+		return Reserva{}, err
+	}
+	if len(reservas) == 0 {
+		return Reserva{}, errors.New("no se encontró la reserva")
+	}
+	return reservas[0], nil
+}
+
+/*
+Funciòn que verifica que un usuario pueda crear MV con una reserva en este momento: la reserva debe estar en curso, el
+usuario debe ser quien la hizo, un miembro de su curso ò un administrador, y deben quedar MV reservadas sin crear
+@cantidad Paràmetro que contiene la cantidad de MV que se quieren crear
+@return Retorna la reserva, ò un error si no se puede usar
+*/
+func validarUsoReserva(idReserva int, email string, cantidad int) (Reserva, error) {
+
+	reserva, err := getReserva(idReserva)
+	if err != nil {
+		return reserva, err
+	}
+	ahora := time.Now().UTC()
+	if reserva.Estado != reservaActiva || ahora.Before(reserva.Fecha_inicio) || !ahora.Before(reserva.Fecha_fin) {
+		return reserva, errors.New("la reserva no está en curso")
+	}
+	if email != reserva.Persona_email && !esAdministrador(email) && (reserva.Curso_id == 0 || rolEnCurso(reserva.Curso_id, email) == "") {
+		return reserva, errors.New("el usuario no puede usar la reserva")
+	}
+	if reserva.Usadas+cantidad > reserva.Cantidad {
+		return reserva, fmt.Errorf("la reserva solo tiene %d máquinas virtuales disponibles", reserva.Cantidad-reserva.Usadas)
+	}
+	return reserva, nil
+}
+
+/*
+Funciòn que asigna a las especificaciones de una nueva MV la plantilla, la RAM, la CPU y el host de la reserva con la que se crea.
+Se elige el host de la reserva que tiene màs MV reservadas sin crear
+@specs Paràmetro que contiene las especificaciones. Deben indicar Reserva_id y Persona_email
+*/
+func aplicarReserva(specs *Maquina_virtual) error {
+
+	reserva, err := validarUsoReserva(specs.Reserva_id, specs.Persona_email, 1)
+	if err != nil {
+		return err
+	}
+	if specs.Catalogo_id > 0 || specs.Iso_id > 0 {
+		return errors.New("las máquinas virtuales de una reserva se crean con su plantilla")
+	}
+	if specs.Plantilla_id > 0 && specs.Plantilla_id != reserva.Plantilla_id {
+		return errors.New("la reserva es de otra plantilla")
+	}
+	specs.Plantilla_id, specs.Ram, specs.Cpu = reserva.Plantilla_id, reserva.Ram, reserva.Cpu
+
+	libres := 0
+	for _, reservaHost := range reserva.Hosts {
+		if reservaHost.Cantidad-reservaHost.Usadas > libres {
+			libres = reservaHost.Cantidad - reservaHost.Usadas
+			specs.Host_id = reservaHost.Host_id
+		}
+	}
+	if libres == 0 {
+		return errors.New("la reserva no tiene máquinas virtuales disponibles")
+	}
+	return nil
+}
+
+/*
+Funciòn que aplica una reserva a las especificaciones de una nueva MV y reclama uno de sus lugares antes de crearla.
+El lugar cuenta como usado hasta que la MV se registra ò se libera, asì las creaciones simultàneas no superan la cantidad reservada
+@specs Paràmetro que contiene las especificaciones. Deben indicar Reserva_id y Persona_email
+@nombre Paràmetro que contiene el nombre ùnico de la MV que se va a crear
+*/
+func reclamarLugarReserva(specs *Maquina_virtual, nombre string) error {
+
+	muReservas.Lock()
+	defer muReservas.Unlock()
+
+	if err := aplicarReserva(specs); err != nil {
+		return err
+	}
+	_, err := db.Exec("INSERT INTO reserva_mv (reserva_id, host_id, maquina_virtual_uuid) VALUES (?, ?, ?)", specs.Reserva_id, specs.Host_id, lugarPendienteReserva(nombre))
+	if err != nil {
+		log.Println("Error al reclamar el lugar de la reserva:", err)
+		return errors.New("no se pudo reclamar un lugar de la reserva")
+	}
+	return nil
+}
+
+/*
+Funciòn que libera el lugar de una reserva reclamado para una MV que no se creò. No hace nada si la MV ya se registrò
+@nombre Paràmetro que contiene el nombre ùnico de la MV
+*/
+func liberarLugarReserva(nombre string) {
+	if _, err := db.Exec("DELETE FROM reserva_mv WHERE maquina_virtual_uuid = ?", lugarPendienteReserva(nombre)); err != nil {
+		log.Println("Error al liberar el lugar de la reserva:", err)
+	}
+}
+
+/*
+Funciòn que libera los lugares reclamados por creaciones que no terminaron porque se detuvo el servidor
+*/
+func liberarLugaresReservaPendientes() {
+	if _, err := db.Exec("DELETE FROM reserva_mv WHERE maquina_virtual_uuid LIKE ?", prefijoLugarPendiente+"%"); err != nil {
+		log.Println("Error al liberar los lugares pendientes de las reservas:", err)
+	}
+}
+
+// Obtiene el identificador del lugar reclamado para una MV. Se usa un resumen del nombre porque la columna tiene el tamaño de un uuid
+func lugarPendienteReserva(nombre string) string {
+	resumen := sha256.Sum256([]byte(nombre))
+	return prefijoLugarPendiente + hex.EncodeToString(resumen[:16])
+}
+
+/*
+Funciòn que registra una MV reciè creada como parte de una reserva, con lo que deja de retener sus recursos.
+Ocupa el lugar que se reclamò para la MV, ò uno nuevo si no se reclamò
+*/
+func registrarMVReserva(maquinaVirtual Maquina_virtual, host Host) {
+	resultado, err := db.Exec("UPDATE reserva_mv SET maquina_virtual_uuid = ?, host_id = ? WHERE maquina_virtual_uuid = ?",
+		maquinaVirtual.Uuid, host.Id, lugarPendienteReserva(maquinaVirtual.Nombre))
+	if err == nil {
+		if filas, _ := resultado.RowsAffected(); filas > 0 {
+			return
+		}
+	}
+	_, err = db.Exec("INSERT INTO reserva_mv (reserva_id, host_id, maquina_virtual_uuid) VALUES (?, ?, ?)", maquinaVirtual.Reserva_id, host.Id, maquinaVirtual.Uuid)
+	if err != nil {
+		log.Println("Error al registrar la MV de la reserva:", err)
+	}
+}
+
+/*
+Funciòn que elimina el registro de una MV eliminada en su reserva
+*/
+func eliminarMVReserva(uuidVM string) {
+	db.Exec("DELETE FROM reserva_mv WHERE maquina_virtual_uuid = ?", uuidVM)
+}
@@ -1,12 +1,15 @@
 package main
 
 import (
+	"bytes"
 	"container/list"
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"math/rand"
@@ -60,13 +63,28 @@ Estructura de datos tipo JSOn que contiene los datos de una màquina virtual
 @Ram Representa la cantidad de memoria RAM que tiene la màquina virtual
 @Cpu Representa la cantidad de unidades de procesamiento que tiene la màquina virtial
 @Ip Representa la direcciòn IP de la màquina
-@Estado Representa el estado actual de la MV. Puede ser: Encendido, Apagado ò Procesando. Este ùltimo estado indica que la màquina se està encendiendo o apagando
+@Estado Representa el estado actual de la MV. Puede ser: Creando, Apagado, Encendiendo, Encendido, Pausado, Apagando, Guardado, Eliminando ò Error. Las transiciones permitidas entre estados estàn en estados.go
 @Hostname Representa el nombre del usuario del sistema operativo
 @Persona_email Representa el email de la persona asociada a la MV.
 @Host_id Representa el identificador ùnico de la màquina host en la cual està creada la MV
 @Disco_id Representa el identificador ùnico del disco al cual està conectada la MV
 @Sistema_operativo Represneta el tipo de sistema operativo que tiene la MV. Por ejemplo: Linux o Windows
 @Distribucion_sistema_operativo Representa la distribuciòn del sistema operativo que està usando la MV. Por ejemplo: Debian ò 11 Home
+@Catalogo_id Representa la entrada del catàlogo con la que se crea la MV. Si es 0, el disco se elige por sistema operativo y distribuciòn
+@Plantilla_id Representa la plantilla con la que se crea la MV. Si es 0, se usan la RAM y CPU solicitadas sin lìmites de plantilla
+@Configuracion_inicial Representa la configuraciòn de cloud-init para el primer encendido. Se suma a la de la plantilla
+@Iso_id Representa la imagen ISO desde la cual se instala una MV vacìa. Si es 0, la MV se crea con el disco multiconexiòn
+@Tamanio_disco Representa la capacidad en mb del disco de una MV creada desde una imagen ISO
+@Discos Representa los discos de datos conectados a la MV
+@Modo_red Representa el modo del adaptador de red: bridged, nat, natnetwork ò hostonly. Si està vacìo se usa el de la plantilla ò el modo puente
+@Red Representa la red NAT ò el adaptador host-only de la MV. Si està vacìo se usa el de la configuraciòn del servidor
+@Redes_privadas Representa las redes privadas a las que se conecta una nueva MV en sus adaptadores 2 a 8. La MV se crea en el host de las redes
+@Direcciones Representa las direcciones IPv4 e IPv6 de todos los adaptadores de la MV encendida. Ip contiene la principal
+@Fecha_estado Representa el momento en el que la MV pasò a su estado actual
+@Descripcion Representa una descripciòn libre de la MV
+@Etiquetas Representa las etiquetas de la MV, con las que se pueden filtrar las MV en la consulta
+@Fecha_expiracion Representa el vencimiento de la concesiòn de la MV. Si es la fecha cero la MV no vence
+@Reserva_id Representa la reserva de capacidad con la que se crea la MV. Si es mayor a 0, la plantilla, la RAM, la CPU y el host son los de la reserva
 */
 type Maquina_virtual struct {
 	Uuid                           string
@@ -82,6 +100,21 @@ type Maquina_virtual struct {
 	Sistema_operativo              string
 	Distribucion_sistema_operativo string
 	Fecha_creacion                 time.Time
+	Catalogo_id                    int
+	Plantilla_id                   int
+	Configuracion_inicial          *ConfiguracionInicial
+	Iso_id                         int
+	Tamanio_disco                  int
+	Discos                         []DiscoDatos
+	Modo_red                       string
+	Red                            string
+	Redes_privadas                 []int
+	Direcciones                    []DireccionMV
+	Fecha_estado                   time.Time
+	Descripcion                    string
+	Etiquetas                      []string
+	Fecha_expiracion               time.Time
+	Reserva_id                     int
 }
 
 type Maquina_virtualQueue struct {
@@ -228,6 +261,98 @@ var (
 	lastQueueSize          int
 )
 
+// Tiempos màximos para las conexiones y comandos enviados por SSH
+const (
+	tiempoConexionSSH     = 10 * time.Second // Establecer la conexiòn y autenticarse
+	tiempoComandoSSH      = 3 * time.Minute  // Comandos VBoxManage y Docker habituales
+	tiempoComandoLargoSSH = 30 * time.Minute // Descarga y construcciòn de imàgenes Docker
+)
+
+// Tipos de error que puede retornar la ejecuciòn de un comando remoto
+var (
+	errConexionSSH      = errors.New("no se pudo establecer la conexiòn SSH")
+	errAutenticacionSSH = errors.New("fallò la autenticaciòn SSH")
+	errTiempoAgotadoSSH = errors.New("se agotò el tiempo de ejecuciòn del comando remoto")
+	errCanceladoSSH     = errors.New("se cancelò la ejecuciòn del comando remoto")
+)
+
+/*
+Estructura que representa una falla de la conexiòn SSH
+@tipo Representa el tipo de error: errConexionSSH, errAutenticacionSSH, errTiempoAgotadoSSH ò errCanceladoSSH
+@causa Representa el error original retornado por la librerìa SSH o la red
+*/
+type errorSSH struct {
+	tipo  error
+	causa error
+}
+
+func (e *errorSSH) Error() string {
+	return e.tipo.Error() + ": " + e.causa.Error()
+}
+
+func (e *errorSSH) Is(objetivo error) bool {
+	return objetivo == e.tipo
+}
+
+func (e *errorSSH) Unwrap() error {
+	return e.causa
+}
+
+/*
+Estructura que representa un comando remoto que terminò con un còdigo de salida diferente de cero
+@Comando Representa el comando que se ejecutò
+@CodigoSalida Representa el còdigo de salida retornado por el host
+@Stderr Representa la salida de error del comando
+*/
+type errorComandoRemoto struct {
+	Comando      string
+	CodigoSalida int
+	Stderr       string
+}
+
+func (e *errorComandoRemoto) Error() string {
+	return fmt.Sprintf("el comando remoto terminò con còdigo %d: %s", e.CodigoSalida, e.Stderr)
+}
+
+/*
+Funciòn que determina el tipo de error SSH teniendo en cuenta el estado del contexto.
+Si el contexto venciò o fue cancelado, ese es el motivo de la falla; de lo contrario se usa el tipo por defecto
+@ctx Paràmetro que contiene el contexto de la operaciòn
+@tipo Paràmetro que contiene el tipo de error a usar si el contexto sigue activo
+@causa Paràmetro que contiene el error original
+*/
+func clasificarErrorSSH(ctx context.Context, tipo error, causa error) error {
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		tipo = errTiempoAgotadoSSH
+	case context.Canceled:
+		tipo = errCanceladoSSH
+	}
+	return &errorSSH{tipo: tipo, causa: causa}
+}
+
+/*
+Funciòn que traduce un error de la ejecuciòn remota en un mensaje para el usuario
+@err Paràmetro que contiene el error retornado por enviarComandoSSH
+@return Retorna el mensaje que describe la falla
+*/
+func describirErrorSSH(err error) string {
+	var errComando *errorComandoRemoto
+	switch {
+	case errors.Is(err, errAutenticacionSSH):
+		return "Error de autenticaciòn con el host"
+	case errors.Is(err, errTiempoAgotadoSSH):
+		return "Se agotò el tiempo de espera del comando"
+	case errors.Is(err, errCanceladoSSH):
+		return "Se cancelò la ejecuciòn del comando"
+	case errors.Is(err, errConexionSSH):
+		return "Error al establecer la conexiòn SSH con el host"
+	case errors.As(err, &errComando):
+		return "El comando fallò (còdigo " + strconv.Itoa(errComando.CodigoSalida) + "): " + errComando.Stderr
+	}
+	return "Error al ejecutar el comando"
+}
+
 // Función para cargar la llave privada desde un archivo
 func publicKeyFile(file string) ssh.AuthMethod {
 	buffer, err := ioutil.ReadFile(file)
@@ -278,11 +403,12 @@ func marcapasos(rutallaveprivata string, usuario string, ip string) bool {
 	ticker := time.NewTicker(1 * time.Second)
 	defer ticker.Stop()
 
-	for range ticker.C {
+	//Realiza màximo tres intentos de heartbeat antes de considerar que el host no responde
+	for intento := 0; intento < 3; intento++ {
 		_, _, err := conn.SendRequest("heartbeat", true, nil)
 		if err != nil {
 			logger.Println("La conexión SSH está inactiva:", err)
-			// Implementar lógica de reconexión
+			<-ticker.C
 		} else {
 			logger.Println("La conexión SSH está activa.")
 			salida = true
@@ -290,20 +416,6 @@ func marcapasos(rutallaveprivata string, usuario string, ip string) bool {
 		}
 	}
 
-	session, err := conn.NewSession()
-	if err != nil {
-		logger.Println("Error al abrir sesión SSH:", err)
-		return false
-	}
-
-	defer session.Close()
-
-	command := "ls " + "C:/Discos"
-	if err := session.Run(command); err != nil {
-		logger.Println("El archivo no existe en la ruta especificada:", err)
-		return false
-	}
-
 	return salida
 }
 
@@ -320,14 +432,22 @@ func main() {
 	// Conexión a SQL
 	manageSqlConecction()
 
+	// Crea las tablas que no hacen parte del esquema original
+	crearTablasAdicionales()
+
+	//Corrige el estado de las MV que quedaron en una operaciòn sin terminar cuando se detuvo el servidor
+	recuperarEstadosMV()
+	liberarLugaresReservaPendientes()
+
 	// Configura un manejador de solicitud para la ruta "/json".
 	manageServer()
 
 	// Función que verifica la cola de especificaciones constantemente.
 	go checkMaquinasVirtualesQueueChanges()
 
-	//Funciòn que verifica el tiempo de creaciòn de una MV
-	//go checkTime()
+	//Funciòn que detiene y elimina las MV con la concesiòn vencida
+	go checkConcesiones()
+	go checkSesionesInvitado()
 
 	// Función que verifica la cola de cuentas constantemente.
 	go checkManagementQueueChanges()
@@ -336,6 +456,12 @@ func main() {
 
 	go checkContainerQueueChanges()
 
+	//Funciòn que actualiza periòdicamente las direcciones IP de las MV encendidas
+	go checkDireccionesIP()
+
+	//Funciòn que ejecuta las programaciones de encendido y apagado de las MV
+	go checkProgramaciones()
+
 	// Inicia el servidor HTTP en el puerto 8081.
 	fmt.Println("Servidor escuchando en el puerto 8081...")
 	if err := http.ListenAndServe(":8081", nil); err != nil {
@@ -344,22 +470,6 @@ func main() {
 
 }
 
-/*
-Funciòn que establece un disparador cada 10 minutos el cual invoca la funciòn checkMachineTime
-*/
-
-func checkTime() {
-
-	timeTicker := time.NewTicker(10 * time.Minute) // Se ejecuta cada diez minutos
-
-	for {
-		select {
-		case <-timeTicker.C:
-			go checkMachineTime()
-		}
-	}
-}
-
 // Funciòn que se encarga de realizar la conexiòn a la base de datos
 
 func manageSqlConecction() {
@@ -372,6 +482,59 @@ func manageSqlConecction() {
 
 }
 
+/*
+Funciòn que valida una solicitud de creaciòn de MV antes de encolarla: las especificaciones, la reserva, la plantilla, la
+cuota, la configuraciòn inicial, la imagen ISO y la red. Las mismas validaciones se repiten al crear la MV
+@payload Paràmetro que contiene la solicitud recibida, con las especificaciones en el campo specifications
+@return Retorna las especificaciones con la reserva y la plantilla aplicadas, y si no son vàlidas el estado HTTP y el error
+*/
+func validarSolicitudMV(payload map[string]interface{}) (Maquina_virtual, int, error) {
+
+	var specs Maquina_virtual
+	specsMap, ok := payload["specifications"].(map[string]interface{})
+	if !ok {
+		return specs, http.StatusBadRequest, errors.New("Se requieren las especificaciones de la máquina virtual")
+	}
+	specsJSON, _ := json.Marshal(specsMap)
+	if err := json.Unmarshal(specsJSON, &specs); err != nil {
+		return specs, http.StatusBadRequest, errors.New("Especificaciones de la máquina virtual inválidas")
+	}
+	if specs.Reserva_id > 0 {
+		if err := aplicarReserva(&specs); err != nil {
+			return specs, http.StatusConflict, err
+		}
+	}
+	if specs.Plantilla_id > 0 {
+		if _, err := aplicarPlantilla(&specs); err != nil {
+			return specs, http.StatusBadRequest, err
+		}
+	}
+	if err := validarCuotaMV(specs.Persona_email, 1, specs.Ram, specs.Cpu); err != nil {
+		return specs, http.StatusForbidden, err
+	}
+	if specs.Configuracion_inicial != nil {
+		if err := validarConfiguracionInicial(specs.Configuracion_inicial); err != nil {
+			return specs, http.StatusBadRequest, err
+		}
+	}
+	if specs.Iso_id > 0 {
+		if _, err := getImagenISO(specs.Iso_id); err != nil {
+			return specs, http.StatusBadRequest, errors.New("No se encontró la imagen ISO")
+		}
+	}
+	if specs.Modo_red != "" {
+		if err := validarModoRed(specs.Modo_red, specs.Red); err != nil {
+			return specs, http.StatusBadRequest, err
+		}
+	}
+	if len(specs.Redes_privadas) > 0 {
+		if _, err := hostRedesPrivadas(specs.Redes_privadas, specs.Persona_email); err != nil {
+			return specs, http.StatusBadRequest, err
+		}
+	}
+	return specs, http.StatusOK, nil
+}
+
 /*
 Funciòn que se encarga de configurar los endpoints, realizar las validaciones correspondientes a los JSON que llegan
 por solicitudes HTTP. Se encarga tambièn de ingresar las peticiones para gestiòn de MV a la cola.
@@ -399,6 +562,12 @@ func manageServer() {
 			return
 		}
 
+		// Verifica las especificaciones antes de encolar la solicitud. Sin especificaciones vàlidas no se encola
+		if _, estado, err := validarSolicitudMV(payload); err != nil {
+			http.Error(w, err.Error(), estado)
+			return
+		}
+
 		// Encola las especificaciones.
 		mu.Lock()
 		maquina_virtualesQueue.Queue.PushBack(payload)
@@ -450,13 +619,17 @@ func manageServer() {
 			return
 		}
 
-		//Se capturan los datos de la maquina virtual a crear
-		mv := payload["specifications"].(map[string]interface{})
+		//Se validan los datos de la maquina virtual a crear igual que en la creaciòn directa
+		specs, estado, err := validarSolicitudMV(payload)
+		if err != nil {
+			http.Error(w, err.Error(), estado)
+			return
+		}
 
 		/*En la base de datos los indices de los host empiezan desde el indice 1
 		si el valor es cero se utiliza para disparar el algoritmo aleatorio
 		*/
-		id := int(mv["Host_id"].(float64))
+		id := specs.Host_id
 		switch {
 		case id == 0:
 			//Se encola la maquina virtual a crear
@@ -473,7 +646,7 @@ func manageServer() {
 			w.WriteHeader(http.StatusOK)
 			json.NewEncoder(w).Encode(response)
 		case id > 0:
-			mihost, _ := getHost(int(mv["Host_id"].(float64)))
+			mihost, _ := getHost(id)
 			estadossh := marcapasos(*privateKeyPath, mihost.Hostname, mihost.Ip)
 			if estadossh {
 				//Se encola la maquina virtual a crear
@@ -623,19 +796,27 @@ func manageServer() {
 			return
 		}
 
-		var persona Persona
+		//Llega el email y, opcionalmente, los filtros de la consulta
+		var solicitud struct {
+			Persona
+			FiltroMaquinas
+		}
 		decoder := json.NewDecoder(r.Body)
-		if err := decoder.Decode(&persona); err != nil { //Solo llega el email
+		if err := decoder.Decode(&solicitud); err != nil {
 			http.Error(w, "Error al decodificar JSON de inicio de sesión", http.StatusBadRequest)
 			return
 		}
 
-		persona, error := getUser(persona.Email)
+		persona, error := getUser(solicitud.Email)
 		if error != nil {
 			return
 		}
 
-		machines, err := consultMachines(persona)
+		machines, err := consultMachines(persona, solicitud.FiltroMaquinas)
+		if errors.Is(err, errFiltroInvalido) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		if err != nil && err.Error() != "no Machines Found" {
 			fmt.Println(err)
 			log.Println("Error al consultar las màquinas del usuario")
@@ -737,7 +918,24 @@ func manageServer() {
 			return
 		}
 
+		nombreVM, _ := specificationsData["Nombre"].(string)
+		if err := validarNombre(nombreVM); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Verifica que el aumento de recursos no supere la cuota del propietario
+		if maquinaVirtual, err := getVM(nombreVM); err == nil {
+			ram, _ := specificationsData["Ram"].(float64)
+			cpu, _ := specificationsData["Cpu"].(float64)
+			if err := validarCuotaMV(maquinaVirtual.Persona_email, 0, int(ram)-maquinaVirtual.Ram, int(cpu)-maquinaVirtual.Cpu); err != nil {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+		}
+
 		// Encola las peticiones.
+		identificarMV(payload)
 		mu.Lock()
 		managementQueue.Queue.PushBack(payload)
 		mu.Unlock()
@@ -779,7 +977,13 @@ func manageServer() {
 			return
 		}
 
+		if err := validarNombre(nombre); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
 		// Encola las peticiones.
+		identificarMV(datos)
 		mu.Lock()
 		managementQueue.Queue.PushBack(datos)
 		mu.Unlock()
@@ -823,19 +1027,33 @@ func manageServer() {
 			return
 		}
 
+		if err := validarNombre(nombreVM); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Verifica la cuota de MV encendidas cuando la solicitud enciende la MV
+		if maquinaVirtual, err := getVM(nombreVM); err == nil && (maquinaVirtual.Estado == estadoApagado || maquinaVirtual.Estado == estadoGuardado) {
+			if err := validarCuotaEncendido(maquinaVirtual.Persona_email); err != nil {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+		}
+
 		// Encola las peticiones.
+		identificarMV(datos)
 		mu.Lock()
 		managementQueue.Queue.PushBack(datos)
 		mu.Unlock()
 
-		query := "select estado from maquina_virtual where nombre = ?"
+		query := "select estado from maquina_virtual where uuid = ? or nombre = ?"
 		var estado string
 
 		//Registra el usuario en la base de datos
-		db.QueryRow(query, nombreVM).Scan(&estado)
+		db.QueryRow(query, nombreVM, nombreVM).Scan(&estado)
 
 		mensaje := "Apagando "
-		if estado == "Apagado" {
+		if estado != estadoEncendido && estado != estadoPausado {
 			mensaje = "Encendiendo "
 		}
 
@@ -878,7 +1096,13 @@ func manageServer() {
 			return
 		}
 
+		if err := validarNombre(nombreVM); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
 		// Encola las peticiones.
+		identificarMV(datos)
 		mu.Lock()
 		managementQueue.Queue.PushBack(datos)
 		mu.Unlock()
@@ -891,33 +1115,6 @@ func manageServer() {
 
 	})
 
-	http.HandleFunc("/json/createGuestMachine", func(w http.ResponseWriter, r *http.Request) {
-		// Verifica que la solicitud sea del método POST.
-		if r.Method != http.MethodPost {
-			http.Error(w, "Se requiere una solicitud POST", http.StatusMethodNotAllowed)
-			return
-		}
-
-		var datos map[string]interface{}
-
-		decoder := json.NewDecoder(r.Body)
-		if err := decoder.Decode(&datos); err != nil {
-			http.Error(w, "Error al decodificar el JSON ", http.StatusBadRequest)
-			return
-		}
-
-		clientIP := datos["ip"].(string)
-		distribucion_SO := datos["distribucion"].(string)
-		email := createTempAccount(clientIP, distribucion_SO)
-
-		// Envía una respuesta al cliente.
-		response := map[string]string{"mensaje": email}
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(response)
-
-	})
-
 	http.HandleFunc("/json/addHost", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "Se requiere una solicitud POST", http.StatusMethodNotAllowed)
@@ -1145,9 +1342,9 @@ func manageServer() {
 
 		imagenes, err := RevisarImagenes(ip, hostname)
 
-		if err != nil && err.Error() != "Fallo en la ejecucion" {
-			fmt.Println(err)
-			log.Println("Error al enviar datos")
+		if err != nil {
+			log.Println("Error al enviar datos:", err)
+			http.Error(w, describirErrorSSH(err), http.StatusBadGateway)
 			return
 		}
 
@@ -1236,9 +1433,9 @@ func manageServer() {
 
 		contenedor, err := RevisarContenedores(ip, hostname)
 
-		if err != nil && err.Error() != "Fallo en la ejecucion" {
-			fmt.Println(err)
-			log.Println("Error al enviar datos")
+		if err != nil {
+			log.Println("Error al enviar datos:", err)
+			http.Error(w, describirErrorSSH(err), http.StatusBadGateway)
 			return
 		}
 
@@ -1249,6 +1446,66 @@ func manageServer() {
 
 	})
 
+	//Endpoints para la gestiòn de instantàneas
+	manejarSnapshots()
+
+	//Endpoints para clonar màquinas virtuales y publicarlas en el catàlogo
+	manejarClones()
+
+	//Endpoints para consultar y administrar plantillas
+	manejarPlantillas()
+
+	//Endpoints para la gestiòn de discos de datos
+	manejarDiscos()
+
+	//Endpoints para la biblioteca de imàgenes ISO y las unidades de DVD
+	manejarISOs()
+
+	//Endpoint para obtener los datos de conexiòn a la consola remota de una MV
+	manejarConsola()
+
+	//Endpoints para la consola web: puerto serie, VRDE y SSH a travès de un WebSocket
+	manejarConsolaWeb()
+
+	//Endpoints para consultar el estado de los trabajos de larga duraciòn
+	manejarTrabajos()
+
+	//Endpoints para exportar e importar màquinas virtuales como archivos OVA
+	manejarOVA()
+
+	//Endpoints para el modo de red de las MV y el reenvìo de puertos
+	manejarRed()
+
+	//Endpoints para las redes privadas de los grupos de MV
+	manejarRedesPrivadas()
+
+	//Endpoints para el apagado ACPI, el guardado del estado, la pausa y el reinicio de las MV
+	manejarEnergia()
+
+	//Endpoints para renombrar las MV y editar su descripciòn y etiquetas
+	manejarMetadatos()
+
+	//Endpoints para las programaciones de encendido y apagado de las MV
+	manejarProgramaciones()
+
+	//Endpoints para consultar y extender las concesiones de las MV
+	manejarConcesiones()
+
+	//Endpoints para los avisos de los usuarios
+	manejarAvisos()
+
+	//Endpoints para las sesiones de los usuarios invitados
+	manejarInvitados()
+
+	//Endpoints para consultar el uso de las cuotas y personalizar la cuota de un usuario
+	manejarCuotas()
+
+	//Endpoints para los cursos y sus laboratorios
+	manejarCursos()
+
+	//Endpoints para el calendario de reservas de capacidad
+	manejarReservas()
+
 }
 
 func checkMaquinasVirtualesQueueChanges() {
@@ -1361,6 +1618,7 @@ func configurarSSH(user string, privateKeyPath string) (*ssh.ClientConfig, error
 		Auth: []ssh.AuthMethod{
 			authMethod,
 		},
+		Timeout:         tiempoConexionSSH,
 		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
 	}
 	return config, nil
@@ -1381,6 +1639,7 @@ func configurarSSHContrasenia(user string) (*ssh.ClientConfig, error) {
 		Auth: []ssh.AuthMethod{
 			ssh.Password("uqcloud"),
 		},
+		Timeout:         tiempoConexionSSH,
 		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
 	}
 
@@ -1388,37 +1647,144 @@ func configurarSSHContrasenia(user string) (*ssh.ClientConfig, error) {
 }
 
 /*
-	Funciòn que se encarga de enviar los comandos a travès de la conexiòn SSH con el host
+	Funciòn que envìa un comando a travès de la conexiòn SSH con un tiempo màximo de ejecuciòn especìfico.
+	Se usa para las operaciones que pueden tardar varios minutos, como la descarga o construcciòn de imàgenes Docker
+
+@tiempo Paràmetro que contiene el tiempo màximo que puede tardar el comando
+*/
+func enviarComandoSSHConTiempo(host string, comando string, config *ssh.ClientConfig, tiempo time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), tiempo)
+	defer cancel()
+
+	return enviarComandoSSHContexto(ctx, host, comando, config, nil, nil)
+}
+
+/*
+	Funciòn que envìa un comando a travès de la conexiòn SSH entregàndole datos por la entrada estàndar.
+	Se usa para copiar archivos generados por el servidor al host, como las imàgenes de cloud-init
+
+@entrada Paràmetro que contiene los datos que recibe el comando por la entrada estàndar
+*/
+func enviarComandoSSHConEntrada(host string, comando string, config *ssh.ClientConfig, tiempo time.Duration, entrada io.Reader) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), tiempo)
+	defer cancel()
+
+	return enviarComandoSSHContexto(ctx, host, comando, config, entrada, nil)
+}
+
+/*
+	Funciòn que envìa un comando a travès de la conexiòn SSH escribiendo su salida estàndar en el destino indicado en lugar de guardarla en memoria.
+	Se usa para descargar archivos grandes del host, como las exportaciones OVA
+
+@salida Paràmetro que recibe la salida estàndar del comando
+*/
+func enviarComandoSSHConSalida(host string, comando string, config *ssh.ClientConfig, tiempo time.Duration, salida io.Writer) error {
+	ctx, cancel := context.WithTimeout(context.Background(), tiempo)
+	defer cancel()
+
+	_, err := enviarComandoSSHContexto(ctx, host, comando, config, nil, salida)
+	return err
+}
+
+/*
+	Funciòn que envìa un comando a travès de la conexiòn SSH respetando el contexto recibido.
+	Si el contexto se cancela o vence su tiempo màximo, se envìa la señal KILL a la sesiòn remota y se cierra la conexiòn.
+	Los errores retornados permiten distinguir el tipo de falla con errors.Is y errors.As:
+	errConexionSSH, errAutenticacionSSH, errTiempoAgotadoSSH, errCanceladoSSH ò *errorComandoRemoto
 
+@ctx Paràmetro que contiene el contexto que controla el tiempo de vida del comando
 @host Paràmetro que contien la direcciòn IP del host al cual le va a enviar los comandos
 @comando Paràmetro que contiene la instrucciòn que se desea ejecutar en el host
 @config Paràmetro que contiene la configuraciòn SSH
-@return Retorna la respuesta del host si la hay
+@entrada Paràmetro que contiene la entrada estàndar del comando. Puede ser nil
+@salida Paràmetro que recibe la salida estàndar del comando. Si es nil, la salida se retorna como texto
+@return Retorna la salida estàndar del comando
 */
-func enviarComandoSSH(host string, comando string, config *ssh.ClientConfig) (salida string, err error) {
+func enviarComandoSSHContexto(ctx context.Context, host string, comando string, config *ssh.ClientConfig, entrada io.Reader, salida io.Writer) (string, error) {
+
+	direccion := net.JoinHostPort(host, "22")
+
+	//Establece la conexiòn TCP respetando el contexto
+	dialer := net.Dialer{Timeout: config.Timeout}
+	netConn, err := dialer.DialContext(ctx, "tcp", direccion)
+	if err != nil {
+		log.Println("Error al establecer la conexiòn SSH: ", err)
+		return "", clasificarErrorSSH(ctx, errConexionSSH, err)
+	}
 
-	//Establece la conexiòn SSH
-	conn, err := ssh.Dial("tcp", host+":22", config)
+	//El saludo SSH (handshake y autenticaciòn) tampoco puede superar el tiempo del contexto
+	if limite, ok := ctx.Deadline(); ok {
+		netConn.SetDeadline(limite)
+	}
+	clientConn, canales, solicitudes, err := ssh.NewClientConn(netConn, direccion, config)
 	if err != nil {
+		netConn.Close()
 		log.Println("Error al establecer la conexiòn SSH: ", err)
-		return "", err
+		if strings.Contains(err.Error(), "unable to authenticate") {
+			return "", &errorSSH{tipo: errAutenticacionSSH, causa: err}
+		}
+		return "", clasificarErrorSSH(ctx, errConexionSSH, err)
 	}
+	netConn.SetDeadline(time.Time{})
+
+	conn := ssh.NewClient(clientConn, canales, solicitudes)
 	defer conn.Close()
 
 	//Crea una nueva sesiòn SSH
 	session, err := conn.NewSession()
 	if err != nil {
 		log.Println("Error al crear la sesiòn SSH: ", err)
-		return "", err
+		return "", clasificarErrorSSH(ctx, errConexionSSH, err)
 	}
 	defer session.Close()
+
+	var stdout, stderr bytes.Buffer
+	session.Stdout = &stdout
+	session.Stderr = &stderr
+	if salida != nil {
+		session.Stdout = salida
+	}
+	if entrada != nil {
+		session.Stdin = entrada
+	}
+
 	//Ejecuta el comando remoto
-	output, err := session.CombinedOutput(comando)
-	if err != nil {
-		log.Println("Error al ejecutar el comando remoto: " + string(output))
-		return "", err
+	if err := session.Start(comando); err != nil {
+		log.Println("Error al iniciar el comando remoto: ", err)
+		return "", clasificarErrorSSH(ctx, errConexionSSH, err)
+	}
+
+	fin := make(chan error, 1)
+	go func() {
+		fin <- session.Wait()
+	}()
+
+	select {
+	case <-ctx.Done():
+		//Termina el proceso remoto y cierra la conexiòn para liberar la goroutine que espera la sesiòn
+		session.Signal(ssh.SIGKILL)
+		session.Close()
+		conn.Close()
+		<-fin
+		log.Println("Se interrumpiò el comando remoto: " + comando)
+		return stdout.String(), clasificarErrorSSH(ctx, errConexionSSH, ctx.Err())
+
+	case err := <-fin:
+		if err != nil {
+			var exitErr *ssh.ExitError
+			if errors.As(err, &exitErr) {
+				log.Println("Error al ejecutar el comando remoto: " + stdout.String() + stderr.String())
+				return stdout.String(), &errorComandoRemoto{
+					Comando:      comando,
+					CodigoSalida: exitErr.ExitStatus(),
+					Stderr:       strings.TrimSpace(stderr.String()),
+				}
+			}
+			log.Println("Error al ejecutar el comando remoto: ", err)
+			return stdout.String(), clasificarErrorSSH(ctx, errConexionSSH, err)
+		}
 	}
-	return string(output), nil
+	return stdout.String(), nil
 }
 
 /*
@@ -1433,6 +1799,81 @@ func enviarComandoSSH(host string, comando string, config *ssh.ClientConfig) (sa
 */
 func crateVM(specs Maquina_virtual, clientIP string) string {
 
+	//La cuenta de un invitado se conserva hasta que termina la creaciòn de su MV
+	defer finalizarCreacionInvitado(specs.Persona_email)
+
+	if err := validarNombre(specs.Nombre); err != nil {
+		log.Println("Nombre de MV invàlido:", err)
+		return "Nombre de la MV invàlido"
+	}
+
+	nameVM, mensaje := generarNombreMV(specs.Nombre)
+	if nameVM == "" {
+		return mensaje
+	}
+
+	//Las MV de una reserva usan su plantilla, su RAM, su CPU y uno de sus hosts, que tiene los recursos retenidos.
+	//El lugar de la reserva se reclama antes de crear la MV y se libera si la creaciòn no termina
+	if specs.Reserva_id > 0 {
+		if err := reclamarLugarReserva(&specs, nameVM); err != nil {
+			log.Println("Error al aplicar la reserva:", err)
+			return err.Error()
+		}
+		defer liberarLugarReserva(nameVM)
+	}
+
+	//Asigna los valores por defecto de la plantilla y verifica sus lìmites de RAM y CPU
+	if specs.Plantilla_id > 0 {
+		if _, err := aplicarPlantilla(&specs); err != nil {
+			log.Println("Error al aplicar la plantilla:", err)
+			return err.Error()
+		}
+	}
+
+	//Vuelve a verificar la cuota del propietario, que pudo cambiar mientras la solicitud estaba en la cola, y la reserva
+	//hasta que la MV se registra para que las solicitudes simultàneas del mismo usuario no la superen
+	if err := reservarCuotaMV(nameVM, specs.Persona_email, specs.Ram, specs.Cpu); err != nil {
+		log.Println("Cuota superada:", err)
+		return err.Error()
+	}
+	defer liberarCuotaMV(nameVM)
+
+	//Vuelve a verificar el modo de red, que pudo venir de una plantilla modificada mientras la solicitud estaba en la cola
+	if specs.Modo_red != "" {
+		if err := validarModoRed(specs.Modo_red, specs.Red); err != nil {
+			log.Println("Modo de red invàlido:", err)
+			return err.Error()
+		}
+	}
+
+	//Las entradas del catàlogo publicadas desde una MV solo tienen disco en el host en el que se publicaron
+	if specs.Catalogo_id > 0 && specs.Host_id == 0 {
+		db.QueryRow("SELECT d.host_id FROM catalogo_disco cd JOIN disco d ON cd.disco_id = d.id WHERE cd.catalogo_id = ? LIMIT 1", specs.Catalogo_id).Scan(&specs.Host_id)
+	}
+
+	//Las MV vacìas se crean en el host en el que està la imagen ISO de instalaciòn
+	if specs.Iso_id > 0 {
+		imagen, err := getImagenISO(specs.Iso_id)
+		if err != nil {
+			return "No se encontrò la imagen ISO"
+		}
+		specs.Host_id = imagen.Host_id
+	}
+
+	//Las MV de una red privada se crean en el host en el que estàn las demàs MV de la red
+	if len(specs.Redes_privadas) > 0 {
+		idHost, err := hostRedesPrivadas(specs.Redes_privadas, specs.Persona_email)
+		if err != nil {
+			return err.Error()
+		}
+		if idHost > 0 {
+			if specs.Host_id > 0 && specs.Host_id != idHost {
+				return "Las redes privadas estàn en un host distinto al solicitado"
+			}
+			specs.Host_id = idHost
+		}
+	}
+
 	if specs.Host_id > 0 {
 		// Creacion de Maquina Virtual con seleccion de usuario
 		// Obtenemeos el host por medio del indice que es previamente
@@ -1446,170 +1887,30 @@ func crateVM(specs Maquina_virtual, clientIP string) string {
 		estadossh := marcapasos(*privateKeyPath, mihost.Hostname, mihost.Ip)
 		if estadossh {
 
-			caracteres := generateRandomString(4) //Genera 4 caracteres alfanumèricos para concatenarlos al nombre de la MV
-
-			nameVM := specs.Nombre + "_" + caracteres
-
-			//Consulta si existe una MV con ese nombre
-			existe, error1 := existVM(nameVM)
-			if error1 != nil {
-				if error1 != sql.ErrNoRows {
-					log.Println("Error al consultar si existe una MV con el nombre indicado: ", error1)
-					return "Error al consultar si existe una MV con el nombre indicado"
-				}
-			} else if existe {
-				fmt.Println("El nombre " + nameVM + " no està disponible, por favor ingrese otro.")
-				return "Nombre de la MV no disponible"
-			}
-
 			//Inicializamos la creacion de una variable tipo host
 			var host Host
 
 			//Obtenemos el host
 			host, _ = getHost(specs.Host_id)
 
-			//Obtenemos el disco multiconexion del host previamente obtenido
-			disco, err20 := getDisk(specs.Sistema_operativo, specs.Distribucion_sistema_operativo, host.Id)
-			if err20 != nil {
-				log.Println("Error al obtener el disco:", err20)
-
-				return "Error al obtener el disco"
-			}
-			//Configura la conexiòn SSH con el host Obtenido
-			config, err := configurarSSH(host.Hostname, *privateKeyPath)
-			if err != nil {
-				log.Println("Error al configurar SSH:", err)
-				return "Error al configurar la conexiòn SSH"
-			}
-
-			//Comando para crear una màquina virtual
-			createVM := "VBoxManage createvm --name " + "\"" + nameVM + "\"" + " --ostype " + disco.Distribucion_sistema_operativo + "_" + strconv.Itoa(disco.arquitectura) + " --register"
-			uuid, err1 := enviarComandoSSH(host.Ip, createVM, config)
-			if err1 != nil {
-				log.Println("Error al ejecutar el comando para crear y registrar la MV:", err1)
-				return "Error al crear la MV"
-			}
-
-			//Comando para asignar la memoria RAM a la MV
-			memoryCommand := "VBoxManage modifyvm " + "\"" + nameVM + "\"" + " --memory " + strconv.Itoa(specs.Ram)
-			_, err2 := enviarComandoSSH(host.Ip, memoryCommand, config)
-			if err2 != nil {
-				log.Println("Error ejecutar el comando para asignar la memoria a la MV:", err2)
-				return "Error al asignar la memoria a la MV"
-			}
-
-			//Comando para agregar el controlador de almacenamiento
-			sctlCommand := "VBoxManage storagectl " + "\"" + nameVM + "\"" + " --name hardisk --add sata"
-			_, err3 := enviarComandoSSH(host.Ip, sctlCommand, config)
-			if err3 != nil {
-				log.Println("Error al ejecutar el comando para asignar el controlador de almacenamiento a la MV:", err3)
-				return "Error al asignar el controlador de almacenamiento a la MV"
-			}
-
-			//Comando para conectar el disco multiconexiòn a la MV
-			sattachCommand := "VBoxManage storageattach " + "\"" + nameVM + "\"" + " --storagectl hardisk --port 0 --device 0 --type hdd --medium " + "\"" + disco.Ruta_ubicacion + "\""
-			_, err4 := enviarComandoSSH(host.Ip, sattachCommand, config)
-			if err4 != nil {
-				log.Println("Error al ejecutar el comando para conectar el disco a la MV: ", err4)
-				return "Error al conectar el disco a la MV"
-			}
-
-			//Comando para asignar las unidades de procesamiento
-			cpuCommand := "VBoxManage modifyvm " + "\"" + nameVM + "\"" + " --cpus " + strconv.Itoa(specs.Cpu)
-			_, err5 := enviarComandoSSH(host.Ip, cpuCommand, config)
-			if err5 != nil {
-				log.Println("Error al ejecutar el comando para asignar la cpu a la MV:", err5)
-				return "Error al asignar la cpu a la MV"
-			}
-
-			//Comando para poner el adaptador de red en modo puente (Bridge)
-			redAdapterCommand := "VBoxManage modifyvm " + "\"" + nameVM + "\"" + " --nic1 bridged --bridgeadapter1 " + "\"" + host.Adaptador_red + "\""
-			_, err6 := enviarComandoSSH(host.Ip, redAdapterCommand, config)
-			if err6 != nil {
-				log.Println("Error al ejecutar el comando para configurar el adaptador de red de la MV:", err6)
-				return "Error al configurar el adaptador de red de la MV"
-			}
-
-			//Obtiene el UUID de la màquina virtual creda
-			lines := strings.Split(string(uuid), "\n")
-			for _, line := range lines {
-				if strings.HasPrefix(line, "UUID:") {
-					uuid = strings.TrimPrefix(line, "UUID:")
-				}
-			}
-			currentTime := time.Now().UTC()
-
-			nuevaMaquinaVirtual := Maquina_virtual{
-				Uuid:              uuid,
-				Nombre:            nameVM,
-				Sistema_operativo: specs.Sistema_operativo,
-				Ram:               specs.Ram,
-				Cpu:               specs.Cpu,
-				Estado:            "Apagado",
-				Hostname:          "uqcloud",
-				Persona_email:     specs.Persona_email,
-				Fecha_creacion:    currentTime,
-			}
-
-			//Crea el registro de la nueva MV en la base de datos
-			_, err7 := db.Exec("INSERT INTO maquina_virtual (uuid, nombre,  ram, cpu, ip, estado, hostname, persona_email, host_id, disco_id, fecha_creacion) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
-				nuevaMaquinaVirtual.Uuid, nuevaMaquinaVirtual.Nombre, nuevaMaquinaVirtual.Ram, nuevaMaquinaVirtual.Cpu,
-				nuevaMaquinaVirtual.Ip, nuevaMaquinaVirtual.Estado, nuevaMaquinaVirtual.Hostname, nuevaMaquinaVirtual.Persona_email,
-				host.Id, disco.Id, nuevaMaquinaVirtual.Fecha_creacion)
-			if err7 != nil {
-				log.Println("Error al crear el registro en la base de datos:", err7)
-				return "Error al crear el registro en la base de datos"
-			}
-
-			//Calcula la CPU y RAM usada en el host
-			usedCpu := host.Cpu_usada + specs.Cpu
-			usedRam := host.Ram_usada + (specs.Ram)
-
-			//Actualiza la informaciòn de los recursos usados en el host
-			_, err8 := db.Exec("UPDATE host SET ram_usada = ?, cpu_usada = ? where id = ?", usedRam, usedCpu, host.Id)
-			if err8 != nil {
-				log.Println("Error al actualizar el host en la base de datos: ", err8)
-				return "Error al actualizar el host en la base de datos"
+			//Los recursos retenidos por las reservas en curso no se pueden usar, salvo los de la reserva de la MV
+			if !validarDisponibilidadRecursosHostReserva(specs.Cpu, specs.Ram, host, specs.Reserva_id) {
+				log.Println("El host " + host.Nombre + " no tiene recursos disponibles para crear la màquina virtual")
+				return "No hay recursos disponibles en el host para crear la màquina virtual. Intente màs tarde"
 			}
 
-			fmt.Println("Màquina virtual creada con èxito")
-			startVM(nameVM, clientIP)
-			return "Màquina virtual creada con èxito"
-
+			return crearMVEnHost(specs, nameVM, host, clientIP)
 		}
 
 	} else {
 		//Creacion de la Maquina con Algoritmo aleatorio
 		//Obtiene el usuario
-		user, error0 := getUser(specs.Persona_email)
+		_, error0 := getUser(specs.Persona_email)
 		if error0 != nil {
 			log.Println("Error al obtener el usuario")
 			return ""
 		}
 
-		if user.Rol == "Estudiante" {
-			/*if cantidad >= 5 {
-				fmt.Println("El usuario " + user.Nombre + " no puede crear màs de 5 màquinas virtuales.")
-				return "El usuario " + user.Nombre + " no puede crear màs de 5 màquinas virtuales."
-			}*/
-		}
-
-		caracteres := generateRandomString(4) //Genera 4 caracteres alfanumèricos para concatenarlos al nombre de la MV
-
-		nameVM := specs.Nombre + "_" + caracteres
-
-		//Consulta si existe una MV con ese nombre
-		existe, error1 := existVM(nameVM)
-		if error1 != nil {
-			if error1 != sql.ErrNoRows {
-				log.Println("Error al consultar si existe una MV con el nombre indicado: ", error1)
-				return "Error al consultar si existe una MV con el nombre indicado"
-			}
-		} else if existe {
-			fmt.Println("El nombre " + nameVM + " no està disponible, por favor ingrese otro.")
-			return "Nombre de la MV no disponible"
-		}
-
 		var host Host
 		availableResources := false
 		host, er := isAHostIp(clientIP) //Consulta si la ip de la peticiòn proviene de un host registrado en la BD
@@ -1631,7 +1932,7 @@ func crateVM(specs Maquina_virtual, clientIP string) string {
 		estadossh := marcapasos(*privateKeyPath, host.Hostname, host.Ip)
 		//Escoge hosts al azar en busca de alguno que tenga recursos disponibles para crear la MV
 		log.Println(estadossh)
-		for !estadossh && count > 0 {
+		for (!estadossh || !availableResources) && count > 0 {
 			//Selecciona un host al azar
 
 			host, _ = selectHost()
@@ -1647,150 +1948,337 @@ func crateVM(specs Maquina_virtual, clientIP string) string {
 
 		if !availableResources {
 			fmt.Println("No hay recursos disponibles el Desktop Cloud para crear la màquina virtual. Intente màs tarde")
+			return "No hay recursos disponibles en el Desktop Cloud para crear la màquina virtual. Intente màs tarde"
 		}
 
-		disco, err20 := getDisk(specs.Sistema_operativo, specs.Distribucion_sistema_operativo, host.Id)
-		if err20 != nil {
-			log.Println("Error al obtener el disco:", err20)
+		return crearMVEnHost(specs, nameVM, host, clientIP)
+	}
+	return "solicitud invalida"
+}
 
-			return "Error al obtener el disco"
-		}
-		//Configura la conexiòn SSH con el host
-		config, err := configurarSSH(host.Hostname, *privateKeyPath)
-		if err != nil {
-			log.Println("Error al configurar SSH:", err)
-			return "Error al configurar la conexiòn SSH"
-		}
+/*
+	Funciòn que envìa al host seleccionado los comandos VBoxManage para crear y configurar una màquina virtual,
+	crea el registro de la MV en la base de datos, actualiza los recursos usados del host y enciende la MV
 
-		//Comando para crear una màquina virtual
-		createVM := "VBoxManage createvm --name " + "\"" + nameVM + "\"" + " --ostype " + disco.Distribucion_sistema_operativo + "_" + strconv.Itoa(disco.arquitectura) + " --register"
-		uuid, err1 := enviarComandoSSH(host.Ip, createVM, config)
-		if err1 != nil {
-			log.Println("Error al ejecutar el comando para crear y registrar la MV:", err1)
-			return "Error al crear la MV"
-		}
+@specs Paràmetro que contiene la configuraciòn enviada por el usuario para crear la MV
+@nameVM Paràmetro que contiene el nombre ùnico con el que se crea la MV
+@host Paràmetro que contiene el host en el cual se crea la MV
+@clientIP Paràmetro que contiene la direcciòn IP de la màquina desde la cual se està realizando la peticiòn para crear la MV
+*/
+func crearMVEnHost(specs Maquina_virtual, nameVM string, host Host, clientIP string) string {
 
-		//Comando para asignar la memoria RAM a la MV
-		memoryCommand := "VBoxManage modifyvm " + "\"" + nameVM + "\"" + " --memory " + strconv.Itoa(specs.Ram)
-		_, err2 := enviarComandoSSH(host.Ip, memoryCommand, config)
-		if err2 != nil {
-			log.Println("Error ejecutar el comando para asignar la memoria a la MV:", err2)
-			return "Error al asignar la memoria a la MV"
+	var disco Disco
+	var err20 error
+	var imagen ImagenISO
+	if specs.Iso_id > 0 {
+		//Las MV vacìas no usan el disco multiconexiòn; el disco del sistema operativo de la imagen (o cualquier disco del host)
+		//indica la carpeta en la que se crea su disco propio
+		imagen, err20 = getImagenISO(specs.Iso_id)
+		if err20 == nil {
+			if disco, err20 = getDisk(imagen.Sistema_operativo, imagen.Distribucion_sistema_operativo, host.Id); err20 != nil {
+				disco, err20 = getPrimerDiscoHost(host.Id)
+			}
+			if imagen.Distribucion_sistema_operativo != "" && imagen.Arquitectura > 0 {
+				disco.Distribucion_sistema_operativo, disco.arquitectura = imagen.Distribucion_sistema_operativo, imagen.Arquitectura
+			}
 		}
+	} else if specs.Catalogo_id > 0 {
+		disco, err20 = getDiskCatalogo(specs.Catalogo_id, host.Id)
+	} else {
+		disco, err20 = getDisk(specs.Sistema_operativo, specs.Distribucion_sistema_operativo, host.Id)
+	}
+	if err20 != nil {
+		log.Println("Error al obtener el disco:", err20)
 
-		//Comando para agregar el controlador de almacenamiento
-		sctlCommand := "VBoxManage storagectl " + "\"" + nameVM + "\"" + " --name hardisk --add sata"
-		_, err3 := enviarComandoSSH(host.Ip, sctlCommand, config)
-		if err3 != nil {
-			log.Println("Error al ejecutar el comando para asignar el controlador de almacenamiento a la MV:", err3)
-			return "Error al asignar el controlador de almacenamiento a la MV"
-		}
+		return "Error al obtener el disco"
+	}
+	//Configura la conexiòn SSH con el host
+	config, err := configurarSSH(host.Hostname, *privateKeyPath)
+	if err != nil {
+		log.Println("Error al configurar SSH:", err)
+		return "Error al configurar la conexiòn SSH"
+	}
+
+	//Comando para crear una màquina virtual
+	uuid, err1 := ejecutarVBoxManage(host, config, "createvm", "--name", nameVM, "--ostype", disco.Distribucion_sistema_operativo+"_"+strconv.Itoa(disco.arquitectura), "--register")
+	if err1 != nil {
+		log.Println("Error al ejecutar el comando para crear y registrar la MV:", err1)
+		return "Error al crear la MV"
+	}
 
+	//Comando para asignar la memoria RAM a la MV
+	_, err2 := ejecutarVBoxManage(host, config, "modifyvm", nameVM, "--memory", strconv.Itoa(specs.Ram))
+	if err2 != nil {
+		log.Println("Error ejecutar el comando para asignar la memoria a la MV:", err2)
+		return "Error al asignar la memoria a la MV"
+	}
+
+	//Comando para agregar el controlador de almacenamiento
+	_, err3 := ejecutarVBoxManage(host, config, "storagectl", nameVM, "--name", "hardisk", "--add", "sata")
+	if err3 != nil {
+		log.Println("Error al ejecutar el comando para asignar el controlador de almacenamiento a la MV:", err3)
+		return "Error al asignar el controlador de almacenamiento a la MV"
+	}
+
+	if specs.Iso_id > 0 {
+		//Crea el disco vacìo de la MV y conecta la imagen ISO de instalaciòn
+		if specs.Tamanio_disco <= 0 {
+			specs.Tamanio_disco = tamanioDiscoISODefecto
+		}
+		if mensaje := prepararMVDesdeISO(host, config, nameVM, imagen, dialectoDeHost(host).directorioDe(disco.Ruta_ubicacion), specs.Tamanio_disco); mensaje != "" {
+			return mensaje
+		}
+	} else {
 		//Comando para conectar el disco multiconexiòn a la MV
-		sattachCommand := "VBoxManage storageattach " + "\"" + nameVM + "\"" + " --storagectl hardisk --port 0 --device 0 --type hdd --medium " + "\"" + disco.Ruta_ubicacion + "\""
-		_, err4 := enviarComandoSSH(host.Ip, sattachCommand, config)
+		_, err4 := ejecutarVBoxManage(host, config, "storageattach", nameVM, "--storagectl", "hardisk", "--port", "0", "--device", "0", "--type", "hdd", "--medium", disco.Ruta_ubicacion)
 		if err4 != nil {
 			log.Println("Error al ejecutar el comando para conectar el disco a la MV: ", err4)
 			return "Error al conectar el disco a la MV"
 		}
+	}
 
-		//Comando para asignar las unidades de procesamiento
-		cpuCommand := "VBoxManage modifyvm " + "\"" + nameVM + "\"" + " --cpus " + strconv.Itoa(specs.Cpu)
-		_, err5 := enviarComandoSSH(host.Ip, cpuCommand, config)
-		if err5 != nil {
-			log.Println("Error al ejecutar el comando para asignar la cpu a la MV:", err5)
-			return "Error al asignar la cpu a la MV"
+	//Comando para asignar las unidades de procesamiento
+	_, err5 := ejecutarVBoxManage(host, config, "modifyvm", nameVM, "--cpus", strconv.Itoa(specs.Cpu))
+	if err5 != nil {
+		log.Println("Error al ejecutar el comando para asignar la cpu a la MV:", err5)
+		return "Error al asignar la cpu a la MV"
+	}
+
+	//Obtiene el UUID de la màquina virtual creda
+	uuid = parsearUUIDCreacion(uuid)
+
+	//Configura el adaptador de red en el modo solicitado. Por defecto se usa el modo puente (Bridge)
+	if mensaje := configurarRedMV(host, config, uuid, nameVM, specs.Modo_red, specs.Red); mensaje != "" {
+		return mensaje
+	}
+
+	//Conecta las redes privadas en los adaptadores 2 en adelante
+	for i, idRed := range specs.Redes_privadas {
+		red, err := getRedPrivada(idRed)
+		if err != nil {
+			return "No se encontrò la red privada"
 		}
+		if mensaje := conectarTarjetaRedPrivada(host, config, Maquina_virtual{Uuid: uuid, Nombre: nameVM}, red, i+2); mensaje != "" {
+			return mensaje
+		}
+	}
+	currentTime := time.Now().UTC()
 
-		//Comando para poner el adaptador de red en modo puente (Bridge)
-		redAdapterCommand := "VBoxManage modifyvm " + "\"" + nameVM + "\"" + " --nic1 bridged --bridgeadapter1 " + "\"" + host.Adaptador_red + "\""
-		_, err6 := enviarComandoSSH(host.Ip, redAdapterCommand, config)
-		if err6 != nil {
-			log.Println("Error al ejecutar el comando para configurar el adaptador de red de la MV:", err6)
-			return "Error al configurar el adaptador de red de la MV"
+	nuevaMaquinaVirtual := Maquina_virtual{
+		Uuid:              uuid,
+		Nombre:            nameVM,
+		Sistema_operativo: specs.Sistema_operativo,
+		Ram:               specs.Ram,
+		Cpu:               specs.Cpu,
+		Estado:            estadoCreando,
+		Hostname:          "uqcloud",
+		Persona_email:     specs.Persona_email,
+		Fecha_creacion:    currentTime,
+		Reserva_id:        specs.Reserva_id,
+	}
+
+	//Crea el registro de la nueva MV en la base de datos y reserva sus recursos en el host. Si no se puede registrar,
+	//por ejemplo porque el propietario se eliminò mientras se creaba, la MV se elimina del host
+	if mensaje := registrarMVCreada(nuevaMaquinaVirtual, host, disco.Id); mensaje != "" {
+		descartarMVCreada(host, config, nuevaMaquinaVirtual, specs.Iso_id == 0)
+		return mensaje
+	}
+
+	//Guarda la descripciòn y las etiquetas enviadas en la solicitud de creaciòn
+	if specs.Descripcion != "" {
+		if err := guardarDescripcionMV(uuid, specs.Descripcion); err != nil {
+			log.Println("Error al guardar la descripciòn de la MV:", err)
 		}
+	}
+	if len(specs.Etiquetas) > 0 {
+		if err := guardarEtiquetasMV(uuid, specs.Etiquetas); err != nil {
+			log.Println("Error al guardar las etiquetas de la MV:", err)
+		}
+	}
 
-		//Obtiene el UUID de la màquina virtual creda
-		lines := strings.Split(string(uuid), "\n")
-		for _, line := range lines {
-			if strings.HasPrefix(line, "UUID:") {
-				uuid = strings.TrimPrefix(line, "UUID:")
-			}
+	//El disco propio de las MV vacìas se registra como el de un clon sin origen, para liberarlo al eliminar la MV
+	if specs.Iso_id > 0 {
+		if _, err := db.Exec("INSERT INTO clon (maquina_virtual_uuid, origen_uuid, modo, snapshot_id, tamanio) VALUES (?, '', 'iso', 0, ?)", uuid, specs.Tamanio_disco); err != nil {
+			log.Println("Error al registrar el disco de la MV:", err)
+		}
+		if _, err := db.Exec("UPDATE host SET almacenamiento_usado = almacenamiento_usado + ? WHERE id = ?", specs.Tamanio_disco, host.Id); err != nil {
+			log.Println("Error al actualizar el almacenamiento usado del host:", err)
 		}
-		currentTime := time.Now().UTC()
+		host.Almacenamiento_usado += specs.Tamanio_disco
+	}
 
-		nuevaMaquinaVirtual := Maquina_virtual{
-			Uuid:              uuid,
-			Nombre:            nameVM,
-			Sistema_operativo: specs.Sistema_operativo,
-			Ram:               specs.Ram,
-			Cpu:               specs.Cpu,
-			Estado:            "Apagado",
-			Hostname:          "uqcloud",
-			Persona_email:     specs.Persona_email,
-			Fecha_creacion:    currentTime,
+	//Configura el modo de red y los discos extra de la plantilla
+	var plantilla Plantilla
+	if specs.Plantilla_id > 0 {
+		plantilla, _ = getPlantilla(specs.Plantilla_id)
+		if mensaje := configurarMVPlantilla(nuevaMaquinaVirtual, host, config, disco, plantilla); mensaje != "" {
+			registrarEstadoMV(nuevaMaquinaVirtual, estadoError)
+			return mensaje
+		}
+	}
+
+	//Las MV vacìas se encienden sin esperar una direcciòn IP, ya que el sistema operativo aùn no està instalado.
+	//La instalaciòn se realiza desde la consola remota
+	if specs.Iso_id > 0 {
+		if mensaje := configurarConsola(nuevaMaquinaVirtual, host, config); mensaje != "" {
+			log.Println(mensaje)
+		}
+		registrarEstadoMV(nuevaMaquinaVirtual, estadoEncendiendo)
+		if _, err := ejecutarVBoxManage(host, config, "startvm", nameVM, "--type", "headless"); err != nil {
+			log.Println("Error al encender la MV:", err)
+			registrarEstadoMV(nuevaMaquinaVirtual, estadoApagado)
+			return "Màquina virtual creada, pero no se pudo encender"
 		}
+		registrarEstadoMV(nuevaMaquinaVirtual, estadoEncendido)
+		fmt.Println("Màquina virtual creada con èxito desde la imagen ISO")
+		return "Màquina virtual creada con èxito desde la imagen ISO"
+	}
 
-		//Crea el registro de la nueva MV en la base de datos
-		_, err7 := db.Exec("INSERT INTO maquina_virtual (uuid, nombre,  ram, cpu, ip, estado, hostname, persona_email, host_id, disco_id, fecha_creacion) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
-			nuevaMaquinaVirtual.Uuid, nuevaMaquinaVirtual.Nombre, nuevaMaquinaVirtual.Ram, nuevaMaquinaVirtual.Cpu,
-			nuevaMaquinaVirtual.Ip, nuevaMaquinaVirtual.Estado, nuevaMaquinaVirtual.Hostname, nuevaMaquinaVirtual.Persona_email,
-			host.Id, disco.Id, nuevaMaquinaVirtual.Fecha_creacion)
-		if err7 != nil {
-			log.Println("Error al crear el registro en la base de datos:", err7)
-			return "Error al crear el registro en la base de datos"
+	//Conecta la imagen de cloud-init con la configuraciòn de primer encendido de la plantilla y de la solicitud
+	var semillaCloudInit string
+	if configuracion := combinarConfiguracionInicial(plantilla.Configuracion_inicial, specs.Configuracion_inicial); configuracion != nil {
+		if err := validarConfiguracionInicial(configuracion); err != nil {
+			registrarEstadoMV(nuevaMaquinaVirtual, estadoError)
+			return err.Error()
+		}
+		var mensaje string
+		semillaCloudInit, mensaje = adjuntarSemillaCloudInit(nuevaMaquinaVirtual, host, config, disco, *configuracion)
+		if mensaje != "" {
+			registrarEstadoMV(nuevaMaquinaVirtual, estadoError)
+			return mensaje
 		}
+	}
 
-		//Calcula la CPU y RAM usada en el host
-		usedCpu := host.Cpu_usada + specs.Cpu
-		usedRam := host.Ram_usada + (specs.Ram)
+	registrarEstadoMV(nuevaMaquinaVirtual, estadoApagado)
+	fmt.Println("Màquina virtual creada con èxito")
+	startVM(nameVM, clientIP)
 
-		//Actualiza la informaciòn de los recursos usados en el host
-		_, err8 := db.Exec("UPDATE host SET ram_usada = ?, cpu_usada = ? where id = ?", usedRam, usedCpu, host.Id)
-		if err8 != nil {
-			log.Println("Error al actualizar el host en la base de datos: ", err8)
-			return "Error al actualizar el host en la base de datos"
+	//Cuando la MV obtiene direcciòn IP ò no llegò a encender, la semilla de cloud-init se retira de inmediato. Si encendiò sin
+	//reportar direcciòn IP se retira despuès de un tiempo de espera, para que el primer encendido alcance a leerla
+	if semillaCloudInit != "" {
+		if maquinaVirtual, err := getVM(nameVM); err == nil && maquinaVirtual.Ip == "" && maquinaVirtual.Estado == estadoEncendido {
+			go retirarSemillaCloudInitDespues(host, config, nameVM, semillaCloudInit)
+		} else {
+			retirarSemillaCloudInit(host, config, nameVM, semillaCloudInit)
 		}
+	}
 
-		fmt.Println("Màquina virtual creada con èxito")
-		startVM(nameVM, clientIP)
-		return "Màquina virtual creada con èxito"
+	//Ejecuta los comandos de aprovisionamiento de la plantilla una vez la MV tiene direcciòn IP
+	if len(plantilla.Aprovisionamiento) > 0 {
+		aprovisionarMV(nameVM, plantilla.Aprovisionamiento)
+	}
+	return "Màquina virtual creada con èxito"
+}
+
+/*
+Funciòn que genera un nombre ùnico para una nueva MV concatenando 4 caracteres alfanumèricos al nombre solicitado
+@nombre Paràmetro que contiene el nombre solicitado por el usuario
+@return Retorna el nombre generado, o un nombre vacìo y el mensaje de error si no està disponible
+*/
+func generarNombreMV(nombre string) (string, string) {
 
+	caracteres := generateRandomString(4) //Genera 4 caracteres alfanumèricos para concatenarlos al nombre de la MV
+
+	nameVM := nombre + "_" + caracteres
+
+	//Consulta si existe una MV con ese nombre
+	existe, error1 := existVM(nameVM)
+	if error1 != nil {
+		if error1 != sql.ErrNoRows {
+			log.Println("Error al consultar si existe una MV con el nombre indicado: ", error1)
+			return "", "Error al consultar si existe una MV con el nombre indicado"
+		}
+	} else if existe {
+		fmt.Println("El nombre " + nameVM + " no està disponible, por favor ingrese otro.")
+		return "", "Nombre de la MV no disponible"
 	}
-	return "solicitud invalida"
+	return nameVM, ""
+}
+
+/*
+Funciòn que crea el registro de una MV reciè creada en la base de datos y suma su RAM y CPU a los recursos usados del host
+@maquinaVirtual Paràmetro que contiene la MV creada
+@host Paràmetro que contiene el host en el cual se creò la MV
+@discoId Paràmetro que contiene el identificador del disco al que està conectada la MV
+@return Retorna un mensaje de error, o una cadena vacìa si el registro fue exitoso
+*/
+func registrarMVCreada(maquinaVirtual Maquina_virtual, host Host, discoId int) string {
+
+	//Crea el registro de la nueva MV en la base de datos solo si su propietario aùn existe. La cuota reservada para la MV
+	//se libera en el mismo paso para que las verificaciones simultàneas no la cuenten dos veces ni dejen de contarla
+	muCuotaMV.Lock()
+	resultado, err7 := db.Exec("INSERT INTO maquina_virtual (uuid, nombre,  ram, cpu, ip, estado, hostname, persona_email, host_id, disco_id, fecha_creacion) SELECT ?, ?, ?, ?, ?, ?, ?, email, ?, ?, ? FROM persona WHERE email = ?",
+		maquinaVirtual.Uuid, maquinaVirtual.Nombre, maquinaVirtual.Ram, maquinaVirtual.Cpu,
+		maquinaVirtual.Ip, maquinaVirtual.Estado, maquinaVirtual.Hostname,
+		host.Id, discoId, maquinaVirtual.Fecha_creacion, maquinaVirtual.Persona_email)
+	liberarCuotaMV(maquinaVirtual.Nombre)
+	muCuotaMV.Unlock()
+	if err7 != nil {
+		log.Println("Error al crear el registro en la base de datos:", err7)
+		return "Error al crear el registro en la base de datos"
+	}
+	if filas, err := resultado.RowsAffected(); err == nil && filas == 0 {
+		log.Println("El propietario " + maquinaVirtual.Persona_email + " de la MV " + maquinaVirtual.Nombre + " ya no existe")
+		return "El propietario de la MV ya no existe"
+	}
+
+	//Actualiza la informaciòn de los recursos usados en el host
+	_, err8 := db.Exec("UPDATE host SET ram_usada = ram_usada + ?, cpu_usada = cpu_usada + ? where id = ?", maquinaVirtual.Ram, maquinaVirtual.Cpu, host.Id)
+	if err8 != nil {
+		log.Println("Error al actualizar el host en la base de datos: ", err8)
+		return "Error al actualizar el host en la base de datos"
+	}
+
+	//Asigna la concesiòn de la MV segùn el rol del propietario
+	asignarConcesionMV(maquinaVirtual)
+
+	//La MV ocupa uno de los lugares de su reserva, que deja de retener sus recursos
+	if maquinaVirtual.Reserva_id > 0 {
+		registrarMVReserva(maquinaVirtual, host)
+	}
+	return ""
+}
+
+/*
+Funciòn que elimina del host una MV que se creò pero no se pudo registrar en la base de datos, junto con sus discos propios
+y los registros de red que se guardaron durante su creaciòn
+@host Paràmetro que contiene el host en el cual se creò la MV
+@config Paràmetro que contiene la configuraciòn SSH
+@maquinaVirtual Paràmetro que contiene el uuid y el nombre de la MV
+@discoCompartido Paràmetro que indica si la MV està conectada al disco multiconexiòn, que se desconecta para no eliminarlo
+*/
+func descartarMVCreada(host Host, config *ssh.ClientConfig, maquinaVirtual Maquina_virtual, discoCompartido bool) {
+
+	if discoCompartido {
+		if _, err := ejecutarVBoxManage(host, config, "storageattach", maquinaVirtual.Nombre, "--storagectl", "hardisk", "--port", "0", "--device", "0", "--medium", "none"); err != nil {
+			log.Println("Error al desconectar el disco de la MV descartada:", err)
+			return
+		}
+	}
+	if _, err := ejecutarVBoxManage(host, config, "unregistervm", maquinaVirtual.Nombre, "--delete"); err != nil {
+		log.Println("Error al eliminar la MV descartada "+maquinaVirtual.Nombre+":", err)
+	}
+	liberarRedMV(maquinaVirtual.Uuid)
+	liberarRedesPrivadasMV(host, config, maquinaVirtual.Uuid)
 }
 
 /*
 	Esta funciòn verifica si una màquina virtual està encendida
 
 @nameVM Paràmetro que contiene el nombre de la màquina virtual a verificar
-@hostIP Paràmetro que contiene la direcciòn Ip del host en el cual està la MV
+@host Paràmetro que contiene el host en el cual està la MV
 @return Retorna true si la màquina està encendida o false en caso contrario
 */
-func isRunning(nameVM string, hostIP string, config *ssh.ClientConfig) (bool, error) {
-
-	//Comando para saber el estado de una màquina virtual
-	command := "VBoxManage showvminfo " + "\"" + nameVM + "\"" + " | findstr /C:\"State:\""
-	running := false
+func isRunning(nameVM string, host Host, config *ssh.ClientConfig) (bool, error) {
 
-	salida, err := enviarComandoSSH(hostIP, command, config)
+	//Consulta la informaciòn de la màquina virtual en formato machinereadable
+	info, err := obtenerInfoMV(host, config, nameVM)
 	if err != nil {
 		log.Println("Error al ejecutar el comando para obtener el estado de la màquina:", err)
-		return running, err
+		return false, err
 	}
 
-	// Expresión regular para buscar el estado (running)
-	regex := regexp.MustCompile(`State:\s+(running|powered off)`)
-	matches := regex.FindStringSubmatch(salida)
-
-	// matches[1] contendrá "running" o "powered off" dependiendo del estado
-	if len(matches) > 1 {
-		estado := matches[1]
-		if estado == "running" {
-			running = true
-		}
-	}
-	return running, nil
+	return info.encendida(), nil
 }
 
 /* Funciòn que contiene los comandos necesarios para modificar una màquina virtual. Primero verifica
@@ -1808,6 +2296,12 @@ func modifyVM(specs Maquina_virtual) string {
 		return "Error al obtener la MV"
 	}
 
+	//Verifica que el aumento de recursos no supere la cuota del propietario
+	if err := validarCuotaMV(maquinaVirtual.Persona_email, 0, specs.Ram-maquinaVirtual.Ram, specs.Cpu-maquinaVirtual.Cpu); err != nil {
+		log.Println("Cuota superada:", err)
+		return err.Error()
+	}
+
 	//Obtiene el host en el cual està alojada la MV
 	host, err2 := getHost(maquinaVirtual.Host_id)
 	if err2 != nil {
@@ -1823,13 +2317,13 @@ func modifyVM(specs Maquina_virtual) string {
 	}
 
 	//Comando para modificar la memoria RAM a la MV
-	memoryCommand := "VBoxManage modifyvm " + "\"" + specs.Nombre + "\"" + " --memory " + strconv.Itoa(specs.Ram)
+	memoryCommand := vboxManage("modifyvm", specs.Nombre, "--memory", strconv.Itoa(specs.Ram))
 
 	//Comando para modificar las unidades de procesamiento
-	cpuCommand := "VBoxManage modifyvm " + "\"" + specs.Nombre + "\"" + " --cpus " + strconv.Itoa(specs.Cpu)
+	cpuCommand := vboxManage("modifyvm", specs.Nombre, "--cpus", strconv.Itoa(specs.Cpu))
 
 	//Variable que contiene el estado de la MV (Encendida o apagada)
-	running, err3 := isRunning(specs.Nombre, host.Ip, config)
+	running, err3 := isRunning(specs.Nombre, host, config)
 	if err3 != nil {
 		log.Println("Error al obtener el estado de la MV:", err3)
 		return "Error al obtener el estado de la MV"
@@ -1861,13 +2355,13 @@ func modifyVM(specs Maquina_virtual) string {
 				log.Println("Error al actualizar la cpu_usada del host en la base de datos: ", er)
 				return "Error al actualizar el host en la base de datos"
 			}
-			_, err11 := enviarComandoSSH(host.Ip, cpuCommand, config)
+			_, err11 := ejecutarEnHost(host, config, cpuCommand)
 			if err11 != nil {
 				log.Println("Error al realizar la actualizaciòn de la cpu", err11)
 				return "Error al realizar la actualizaciòn de la cpu"
 			}
 			//Actualiza la CPU que tiene la MV
-			_, err1 := db.Exec("UPDATE maquina_virtual set cpu = ? WHERE NOMBRE = ?", strconv.Itoa(specs.Cpu), specs.Nombre)
+			_, err1 := db.Exec("UPDATE maquina_virtual set cpu = ? WHERE uuid = ?", strconv.Itoa(specs.Cpu), maquinaVirtual.Uuid)
 			if err1 != nil {
 				log.Println("Error al realizar la actualizaciòn de la CPU", err1)
 				return "Error al realizar la actualizaciòn de la CPU"
@@ -1897,13 +2391,13 @@ func modifyVM(specs Maquina_virtual) string {
 				log.Println("Error al actualizar la ram_usada del host en la base de datos: ", er)
 				return "Error al actualizar el host en la base de datos"
 			}
-			_, err22 := enviarComandoSSH(host.Ip, memoryCommand, config)
+			_, err22 := ejecutarEnHost(host, config, memoryCommand)
 			if err22 != nil {
 				log.Println("Error al realizar la actualizaciòn de la memoria", err22)
 				return "Error al realizar la actualizaciòn de la memoria"
 			}
 			//Actualiza la RAM de la MV
-			_, err2 := db.Exec("UPDATE maquina_virtual set ram = ? WHERE NOMBRE = ?", strconv.Itoa(specs.Ram), specs.Nombre)
+			_, err2 := db.Exec("UPDATE maquina_virtual set ram = ? WHERE uuid = ?", strconv.Itoa(specs.Ram), maquinaVirtual.Uuid)
 			if err2 != nil {
 				log.Println("Error al realizar la actualizaciòn de la memoria en la base de datos", err2)
 				return "Error al realizar la actualizaciòn de la memoria en la base de datos"
@@ -1914,7 +2408,8 @@ func modifyVM(specs Maquina_virtual) string {
 	return "Modificaciones realizadas con èxito"
 }
 
-/* Funciòn que permite enviar el comando PowerOff para apagar una màquina virtual
+/* Funciòn que apaga una màquina virtual encendida con el botòn de apagado ACPI, forzando el apagado si no responde a tiempo,
+o la enciende si està apagada
 @nameVM Paràmetro que contiene el nombre de la màquina virtual a apagar
 @clientIP Paràmetro que contiene la direcciòn IP del cliente desde el cual se realiza la solicitud
 */
@@ -1940,7 +2435,7 @@ func apagarMV(nameVM string, clientIP string) string {
 		return "Error al configurar SSH"
 	}
 	//Variable que contiene el estado de la MV (Encendida o apagada)
-	running, err3 := isRunning(nameVM, host.Ip, config)
+	running, err3 := isRunning(nameVM, host, config)
 	if err3 != nil {
 		log.Println("Error al obtener el estado de la MV:", err3)
 		return "Error al obtener el estado de la MV"
@@ -1949,61 +2444,12 @@ func apagarMV(nameVM string, clientIP string) string {
 	if !running { //En caso de que la MV estè apagada, entonces se invoca el mètodo para encenderla
 		startVM(nameVM, clientIP)
 	} else {
-
-		//Comando para apagar la màquina virtual
-		powerOffCommand := "VBoxManage controlvm " + "\"" + nameVM + "\"" + " poweroff"
-
-		fmt.Println("Apagando màquina " + nameVM + "...")
-		//Actualza el estado de la MV en la base de datos
-		_, err4 := db.Exec("UPDATE maquina_virtual set estado = 'Procesando' WHERE NOMBRE = ?", nameVM)
-		if err4 != nil {
-			log.Println("Error al realizar la actualizaciòn del estado", err4)
-			return "Error al realizar la actualizaciòn del estado"
-		}
-		//Envìa el comando para apagar la MV a travès de un ACPI
-		_, err5 := enviarComandoSSH(host.Ip, powerOffCommand, config)
-		if err5 != nil {
-			log.Println("Error al enviar el comando para apagar la MV:", err5)
-			return "Error al enviar el comando para apagar la MV"
-		}
-		// Establece un temporizador de espera máximo de 5 minutos
-		maxEspera := time.Now().Add(5 * time.Minute)
-
-		// Espera hasta que la máquina esté apagada o haya pasado el tiempo máximo de espera
-		for time.Now().Before(maxEspera) {
-			status, err6 := isRunning(nameVM, host.Ip, config)
-			if err6 != nil {
-				log.Println("Error al obtener el estado de la MV:", err6)
-				return "Error al obtener el estado de la MV"
-			}
-			if !status {
-				break
-			}
-			// Espera un 1 segundo antes de volver a verificar el estado de la màquina
-			time.Sleep(1 * time.Second)
-		}
-
-		//Consulta si la MV està encendida
-		status, err7 := isRunning(nameVM, host.Ip, config)
-		if err7 != nil {
-			log.Println("Error al obtener el estado de la MV:", err7)
-			return "Error al obtener el estado de la MV"
-		}
-		if status {
-			_, err8 := enviarComandoSSH(host.Ip, powerOffCommand, config) //Envìa el comando para apagar la MV a travès de un Power Off
-			if err8 != nil {
-				log.Println("Error al enviar el comando para apagar la MV:", err8)
-				return "Error al enviar el comando para apagar la MV"
-			}
-		}
-		//Actualiza el estado de la MV en la base de datos
-		_, err9 := db.Exec("UPDATE maquina_virtual set estado = 'Apagado', ip = '' WHERE NOMBRE = ?", nameVM)
-		if err9 != nil {
-			log.Println("Error al realizar la actualizaciòn del estado", err9)
-			return "Error al realizar la actualizaciòn del estado"
+		//Presiona el botòn de apagado ACPI y, si la MV no se apaga a tiempo, fuerza el apagado
+		info, _ := obtenerInfoMV(host, config, nameVM)
+		sincronizarEstadoMV(&maquinaVirtual, info)
+		if mensaje := detenerMV(maquinaVirtual, host, config, info.Estado == "paused", tiempoApagadoACPI); mensaje != "" {
+			return mensaje
 		}
-
-		fmt.Println("Màquina apagada con èxito")
 	}
 	return ""
 }
@@ -2070,6 +2516,152 @@ func checkManagementQueueChanges() {
 				clientIP, _ := data["clientIP"].(string)
 				go apagarMV(nameVM, clientIP)
 
+			case "clone":
+				nameVM, _ := data["nombreVM"].(string)
+				modo, _ := data["modo"].(string)
+				nombre, _ := data["nombre"].(string)
+				email, _ := data["email"].(string)
+				var propietarios []string
+				if lista, ok := data["propietarios"].([]interface{}); ok {
+					for _, propietario := range lista {
+						if emailPropietario, ok := propietario.(string); ok && emailPropietario != "" {
+							propietarios = append(propietarios, emailPropietario)
+						}
+					}
+				}
+				if len(propietarios) == 0 {
+					propietarios = []string{email}
+				}
+				go clonarMV(nameVM, modo, nombre, propietarios)
+
+			case "publish":
+				nameVM, _ := data["nombreVM"].(string)
+				nombreCatalogo, _ := data["nombreCatalogo"].(string)
+				go publicarMV(nameVM, nombreCatalogo)
+
+			case "take_snapshot":
+				nameVM, _ := data["nombreVM"].(string)
+				nombreSnapshot, _ := data["nombreSnapshot"].(string)
+				descripcion, _ := data["descripcion"].(string)
+				go tomarSnapshot(nameVM, nombreSnapshot, descripcion)
+
+			case "restore_snapshot":
+				nameVM, _ := data["nombreVM"].(string)
+				nombreSnapshot, _ := data["nombreSnapshot"].(string)
+				go restaurarSnapshot(nameVM, nombreSnapshot)
+
+			case "delete_snapshot":
+				nameVM, _ := data["nombreVM"].(string)
+				nombreSnapshot, _ := data["nombreSnapshot"].(string)
+				go eliminarSnapshot(nameVM, nombreSnapshot)
+
+			case "create_disk":
+				nameVM, _ := data["nombreVM"].(string)
+				nombreDisco, _ := data["nombreDisco"].(string)
+				tamanio, _ := data["tamanio"].(float64)
+				go agregarDiscoDatos(nameVM, nombreDisco, int(tamanio))
+
+			case "resize_disk":
+				idDisco, _ := data["idDisco"].(float64)
+				tamanio, _ := data["tamanio"].(float64)
+				go redimensionarDiscoDatos(int(idDisco), int(tamanio))
+
+			case "attach_disk":
+				idDisco, _ := data["idDisco"].(float64)
+				nameVM, _ := data["nombreVM"].(string)
+				go conectarDiscoDatos(int(idDisco), nameVM)
+
+			case "detach_disk":
+				idDisco, _ := data["idDisco"].(float64)
+				go desconectarDiscoDatos(int(idDisco))
+
+			case "delete_disk":
+				idDisco, _ := data["idDisco"].(float64)
+				go eliminarDiscoDatos(int(idDisco))
+
+			case "attach_iso":
+				nameVM, _ := data["nombreVM"].(string)
+				idISO, _ := data["idISO"].(float64)
+				go conectarISO(nameVM, int(idISO))
+
+			case "eject_iso":
+				nameVM, _ := data["nombreVM"].(string)
+				go expulsarISO(nameVM)
+
+			case "boot_order":
+				nameVM, _ := data["nombreVM"].(string)
+				orden, _ := ordenArranqueSolicitud(data["orden"])
+				go cambiarOrdenArranque(nameVM, orden)
+
+			case "export":
+				trabajoId, _ := data["trabajo_id"].(int)
+				go exportarMV(trabajoId)
+
+			case "import":
+				trabajoId, _ := data["trabajo_id"].(int)
+				sistemaOperativo, _ := data["sistema_operativo"].(string)
+				distribucion, _ := data["distribucion"].(string)
+				go importarMV(trabajoId, sistemaOperativo, distribucion)
+
+			case "network_mode":
+				nameVM, _ := data["nombreVM"].(string)
+				modo, _ := data["modo"].(string)
+				red, _ := data["red"].(string)
+				go cambiarModoRed(nameVM, modo, red)
+
+			case "add_port_forward":
+				nameVM, _ := data["nombreVM"].(string)
+				nombreRegla, _ := data["nombreRegla"].(string)
+				protocolo, _ := data["protocolo"].(string)
+				puertoInvitado, _ := data["puertoInvitado"].(float64)
+				puertoHost, _ := data["puertoHost"].(float64)
+				go agregarReenvioPuerto(nameVM, nombreRegla, protocolo, int(puertoInvitado), int(puertoHost))
+
+			case "delete_port_forward":
+				nameVM, _ := data["nombreVM"].(string)
+				nombreRegla, _ := data["nombreRegla"].(string)
+				go eliminarReenvioPuerto(nameVM, nombreRegla)
+
+			case "attach_private_network":
+				nameVM, _ := data["nombreVM"].(string)
+				idRed, _ := data["idRed"].(float64)
+				go conectarRedPrivada(nameVM, int(idRed))
+
+			case "detach_private_network":
+				nameVM, _ := data["nombreVM"].(string)
+				idRed, _ := data["idRed"].(float64)
+				go desconectarRedPrivada(nameVM, int(idRed))
+
+			case "rename":
+				nameVM, _ := data["nombreVM"].(string)
+				nuevoNombre, _ := data["nuevoNombre"].(string)
+				go renombrarMV(nameVM, nuevoNombre)
+
+			case "shutdown":
+				nameVM, _ := data["nombreVM"].(string)
+				tiempoEspera, _ := data["tiempoEspera"].(float64)
+				go apagarMVACPI(nameVM, time.Duration(tiempoEspera)*time.Second)
+
+			case "poweroff":
+				nameVM, _ := data["nombreVM"].(string)
+				go forzarApagadoMV(nameVM)
+
+			case "save_state":
+				nameVM, _ := data["nombreVM"].(string)
+				go guardarEstadoMV(nameVM)
+
+			case "pause":
+				nameVM, _ := data["nombreVM"].(string)
+				go pausarMV(nameVM)
+
+			case "resume":
+				nameVM, _ := data["nombreVM"].(string)
+				go reanudarMV(nameVM)
+
+			case "reset":
+				nameVM, _ := data["nombreVM"].(string)
+				go reiniciarMV(nameVM)
+
 			default:
 				fmt.Println("Tipo de solicitud no válido:", tipoSolicitud)
 			}
@@ -2236,13 +2828,13 @@ func deleteVM(nameVM string) string {
 	}
 
 	//Comando para desconectar el disco de la MV
-	disconnectCommand := "VBoxManage storageattach " + "\"" + nameVM + "\"" + " --storagectl hardisk --port 0 --device 0 --medium none"
+	disconnectCommand := vboxManage("storageattach", nameVM, "--storagectl", "hardisk", "--port", "0", "--device", "0", "--medium", "none")
 
 	//Comando para eliminar la MV
-	deleteCommand := "VBoxManage unregistervm " + "\"" + nameVM + "\"" + " --delete"
+	deleteCommand := vboxManage("unregistervm", nameVM, "--delete")
 
 	//Variable que contiene el estado de la MV (Encendida o apagada)
-	running, err3 := isRunning(nameVM, host.Ip, config)
+	running, err3 := isRunning(nameVM, host, config)
 	if err3 != nil {
 		log.Println("Error al obtener el estado de la MV:", err3)
 		return "Error al obtener el estado de la MV"
@@ -2251,21 +2843,35 @@ func deleteVM(nameVM string) string {
 		fmt.Println("Debe apagar la màquina para eliminarla")
 		return "Debe apagar la màquina para eliminarla"
 
+	} else if contarClonesEnlazados(maquinaVirtual.Uuid) > 0 {
+		fmt.Println("Debe eliminar primero los clones enlazados de la màquina")
+		return "Debe eliminar primero los clones enlazados de la màquina"
+
 	} else {
-		//Envìa el comando para desconectar el disco de la MV
-		_, err4 := enviarComandoSSH(host.Ip, disconnectCommand, config)
-		if err4 != nil {
-			log.Println("Error al desconectar el disco de la MV:", err4)
-			return "Error al desconectar el disco de la MV"
+		if err := cambiarEstadoMV(maquinaVirtual, estadoEliminando); err != nil {
+			log.Println("Error al cambiar el estado de la MV:", err)
+			return "La màquina no se puede eliminar en su estado actual"
+		}
+		//Los clones, las MV importadas y las creadas desde una imagen ISO tienen un disco propio que se elimina junto con la MV; las demàs MV comparten el disco multiconexiòn, que se desconecta antes de eliminarlas
+		clon, esClon := getClon(maquinaVirtual.Uuid)
+		if !esClon {
+			//Envìa el comando para desconectar el disco de la MV
+			_, err4 := ejecutarEnHost(host, config, disconnectCommand)
+			if err4 != nil {
+				log.Println("Error al desconectar el disco de la MV:", err4)
+				registrarEstadoMV(maquinaVirtual, maquinaVirtual.Estado)
+				return "Error al desconectar el disco de la MV"
+			}
 		}
 		//Envìa el comando para eliminar la MV del host
-		_, err5 := enviarComandoSSH(host.Ip, deleteCommand, config)
+		_, err5 := ejecutarEnHost(host, config, deleteCommand)
 		if err5 != nil {
 			log.Println("Error al eliminar la MV:", err5)
+			registrarEstadoMV(maquinaVirtual, estadoError)
 			return "Error al eliminar la MV"
 		}
 		//Elimina la màquina virtual de la base de datos
-		err6 := db.QueryRow("DELETE FROM maquina_virtual WHERE NOMBRE = ?", nameVM)
+		err6 := db.QueryRow("DELETE FROM maquina_virtual WHERE uuid = ?", maquinaVirtual.Uuid)
 		if err6 == nil {
 			log.Println("Error al eliminar el registro de la base de datos: ", err6)
 			return "Error al eliminar el registro de la base de datos"
@@ -2279,6 +2885,25 @@ func deleteVM(nameVM string) string {
 			log.Println("Error al actualizar los recursos usados del host en la base de datos: ", err7)
 			return "Error al actualizar los recursos usados del host en la base de datos"
 		}
+		//Elimina las instantàneas de la MV y libera el almacenamiento de sus discos diferenciales
+		eliminarRegistrosSnapshots(maquinaVirtual)
+		//Libera el almacenamiento de los discos de datos, que VirtualBox elimina junto con la MV
+		eliminarRegistrosDiscosDatos(maquinaVirtual)
+		//Libera el puerto de la consola remota
+		liberarConsola(maquinaVirtual.Uuid)
+		//Libera los puertos del host reservados para las reglas de reenvìo
+		liberarRedMV(maquinaVirtual.Uuid)
+		liberarRedesPrivadasMV(host, config, maquinaVirtual.Uuid)
+		eliminarDireccionesMV(maquinaVirtual.Uuid)
+		db.Exec("DELETE FROM estado_mv WHERE maquina_virtual_uuid = ?", maquinaVirtual.Uuid)
+		eliminarMetadatosMV(maquinaVirtual.Uuid)
+		eliminarProgramacionesMV(maquinaVirtual.Uuid)
+		eliminarConcesionMV(maquinaVirtual.Uuid)
+		eliminarMVReserva(maquinaVirtual.Uuid)
+		if esClon {
+			db.Exec("DELETE FROM clon WHERE maquina_virtual_uuid = ?", maquinaVirtual.Uuid)
+			db.Exec("UPDATE host SET almacenamiento_usado = GREATEST(almacenamiento_usado - ?, 0) WHERE id = ?", clon.Tamanio, host.Id)
+		}
 	}
 	fmt.Println("Màquina eliminada correctamente")
 	return "Màquina eliminada correctamente"
@@ -2312,7 +2937,7 @@ func startVM(nameVM string, clientIP string) string {
 	}
 
 	//Variable que contiene el estado de la MV (Encendida o apagada)
-	running, err3 := isRunning(nameVM, host.Ip, config)
+	running, err3 := isRunning(nameVM, host, config)
 	if err3 != nil {
 		log.Println("Error al obtener el estado de la MV:", err3)
 		return "Error al obtener el estado de la MV"
@@ -2322,110 +2947,73 @@ func startVM(nameVM string, clientIP string) string {
 		apagarMV(nameVM, clientIP) //En caso de que la MV ya estè encendida, entonces se invoca el mètodo para apagar la MV
 		return ""
 	} else {
+		//Habilita la consola remota de las MV que aùn no tienen un puerto asignado, ya que solo se puede configurar con la MV apagada
+		var puertoConsola int
+		if err := db.QueryRow("SELECT puerto FROM consola WHERE maquina_virtual_uuid = ?", maquinaVirtual.Uuid).Scan(&puertoConsola); err != nil {
+			if mensaje := configurarConsola(maquinaVirtual, host, config); mensaje != "" {
+				log.Println(mensaje)
+			}
+		} else if mensaje := configurarPuertoSerie(maquinaVirtual, host, config); mensaje != "" {
+			//Conecta de nuevo el puerto serie para que las MV configuradas con un servidor TCP dejen de exponerlo en la red
+			log.Println(mensaje)
+		}
+
+		if concesionVencida(maquinaVirtual.Uuid) {
+			log.Println("La concesiòn de la màquina " + maquinaVirtual.Nombre + " venciò")
+			return "La concesiòn de la màquina venciò. Se debe extender para encenderla"
+		}
+		if err := validarCuotaEncendido(maquinaVirtual.Persona_email); err != nil {
+			log.Println("Cuota superada:", err)
+			return err.Error()
+		}
+		if err := cambiarEstadoMV(maquinaVirtual, estadoEncendiendo); err != nil {
+			log.Println("Error al cambiar el estado de la MV:", err)
+			return "La màquina no se puede encender en su estado actual"
+		}
 		fmt.Println("Encendiendo la màquina " + nameVM + "...")
 
 		// Comando para encender la máquina virtual en segundo planto
-		startVMHeadlessCommand := "VBoxManage startvm " + "\"" + nameVM + "\"" + " --type headless"
+		startVMHeadlessCommand := vboxManage("startvm", nameVM, "--type", "headless")
 
 		//Comnado para encender la màquina virtual con GUI
-		startVMGUICommand := "VBoxManage startvm " + "\"" + nameVM + "\""
+		startVMGUICommand := vboxManage("startvm", nameVM)
 
 		_, er := isAHostIp(clientIP) //Verifica si la solicitud se està realizando desde un host registrado en la BD
 		if er == nil {
 			//Envìa el comando para encender la MV con GUI
-			_, err4 := enviarComandoSSH(host.Ip, startVMGUICommand, config)
+			_, err4 := ejecutarEnHost(host, config, startVMGUICommand)
 			if err4 != nil {
 				log.Println("Error al enviar el comando para encender la MV:", err4)
+				registrarEstadoMV(maquinaVirtual, maquinaVirtual.Estado)
 				return "Error al enviar el comando para encender la MV"
 			}
 		} else {
 			//Envìa el comando para encender la MV en segundo plano
-			_, err4 := enviarComandoSSH(host.Ip, startVMHeadlessCommand, config)
+			_, err4 := ejecutarEnHost(host, config, startVMHeadlessCommand)
 			if err4 != nil {
 				log.Println("Error al enviar el comando para encender la MV:", err4)
+				registrarEstadoMV(maquinaVirtual, maquinaVirtual.Estado)
 				return "Error al enviar el comando para encender la MV"
 			}
 		}
 
 		fmt.Println("Obteniendo direcciòn IP de la màquina " + nameVM + "...")
-		//Actualiza el estado de la MV en la base de datos
-		_, err5 := db.Exec("UPDATE maquina_virtual set estado = 'Procesando' WHERE NOMBRE = ?", nameVM)
-		if err5 != nil {
-			log.Println("Error al realizar la actualizaciòn del estado", err5)
-			return "Error al realizar la actualizaciòn del estado"
-		}
-		// Espera 10 segundos para que la máquina virtual inicie
-		time.Sleep(10 * time.Second)
-
-		//Comando para obtener la dirección IP de la máquina virtual
-		getIpCommand := "VBoxManage guestproperty get " + "\"" + nameVM + "\"" + " /VirtualBox/GuestInfo/Net/0/V4/IP"
-		//Comando para reiniciar la MV
-		rebootCommand := "VBoxManage controlvm " + "\"" + nameVM + "\"" + " reset"
-
-		var ipAddress string
-
-		// Establece un temporizador de espera máximo de 2 minutos
-		maxEspera := time.Now().Add(2 * time.Minute)
-		restarted := false
-
-		for ipAddress == "" || ipAddress == "No value set!" || strings.HasPrefix(strings.TrimSpace(ipAddress), "169") {
-			if time.Now().Before(maxEspera) {
-				if ipAddress == "No value set!" {
-					time.Sleep(5 * time.Second) // Espera 5 segundos antes de intentar nuevamente
-					fmt.Println("Obteniendo dirección IP de la màquina " + nameVM + "...")
-				}
-				//Envìa el comando para obtener la IP
-				ipAddress, _ = enviarComandoSSH(host.Ip, getIpCommand, config)
-
-				ipAddress = strings.TrimSpace(ipAddress) //Elimina espacios en blanco al final de la cadena
-				ipParts := strings.Split(ipAddress, ":")
-				if len(ipParts) > 1 {
-					ipParts := strings.Split(ipParts[1], ".")
-					if strings.TrimSpace(ipParts[0]) == "169" {
-						ipAddress = strings.TrimSpace(ipParts[0])
-						time.Sleep(5 * time.Second) // Espera 5 segundos antes de intentar nuevamente
-						fmt.Println("Obteniendo dirección IP de la màquina " + nameVM + "...")
-					}
-				}
-
-			} else {
-				if restarted {
-					log.Println("No se logrò obtener la direcciòn IP de la màquina: " + nameVM)
-					//Actualiza el estado de la MV en la base de datos
-					_, err9 := db.Exec("UPDATE maquina_virtual set estado = 'Apagado' WHERE NOMBRE = ?", nameVM)
-					if err9 != nil {
-						log.Println("Error al realizar la actualizaciòn del estado", err9)
-						return "Error al realizar la actualizaciòn del estado"
-					}
-					return "No se logrò obtener la direcciòn IP, por favor contacte al administrador"
-				}
-				//Envìa el comando para reiniciar la MV
-				reboot, error := enviarComandoSSH(host.Ip, rebootCommand, config)
-				if error != nil {
-					log.Println("Error al reinciar la MV:", reboot)
-					return "Error al reinciar la MV"
-				}
-				fmt.Println("Reiniciando la màquina: " + nameVM)
-				maxEspera = time.Now().Add(2 * time.Minute) //Agrega dos minutos de tiempo màximo para obtener la IP cuando se reincia la MV
-				restarted = true
-			}
-		}
+		//Espera la direcciòn IP reportada por las Guest Additions o, si no la reportan, la que conoce el host.
+		//La MV queda encendida aunque no se obtenga la direcciòn; la actualizaciòn periòdica la registra cuando estè disponible
+		direcciones := esperarDireccionesMV(host, config, nameVM, tiempoEsperaIP)
+		ipAddress := direccionPrincipal(direcciones)
 
-		//Almacena solo el valor de la IP quitàndole el texto "Value:"
-		ipAddress = strings.TrimPrefix(ipAddress, "Value:")
-		ipAddress = strings.TrimSpace(ipAddress)
 		//Actualiza el estado de la MV en la base de datos
-		_, err9 := db.Exec("UPDATE maquina_virtual set estado = 'Encendido' WHERE NOMBRE = ?", nameVM)
-		if err9 != nil {
-			log.Println("Error al realizar la actualizaciòn del estado", err9)
+		if err := cambiarEstadoMV(maquinaVirtual, estadoEncendido); err != nil {
+			log.Println("Error al realizar la actualizaciòn del estado", err)
 			return "Error al realizar la actualizaciòn del estado"
 		}
-		//Actualiza la direcciòn IP de la MV en la base de datos
-		_, err10 := db.Exec("UPDATE maquina_virtual set ip = ? WHERE NOMBRE = ?", ipAddress, nameVM)
-		if err10 != nil {
-			log.Println("Error al realizar la actualizaciòn de la IP", err10)
-			return "Error al realizar la actualizaciòn de la IP"
+		if ipAddress == "" {
+			log.Println("No se logrò obtener la direcciòn IP de la màquina: " + nameVM)
+			return "Màquina encendida, aùn no se conoce su direcciòn IP"
 		}
+		//Guarda las direcciones de la MV y su direcciòn IP principal en la base de datos
+		registrarDireccionesMV(maquinaVirtual, direcciones)
 		fmt.Println("Màquina encendida, la direcciòn IP es: " + ipAddress)
 		return ipAddress
 	}
@@ -2505,15 +3093,16 @@ func getHost(idHost int) (Host, error) {
 }
 
 /*
-Funciòn que permite obtener una màquina virtual dado su nombre
-@nameVM Paràmetro que representa el nombre de la màquina virtual a buscar
+Funciòn que permite obtener una màquina virtual dado su uuid ò su nombre. Las solicitudes encoladas usan el uuid,
+que no cambia si la MV se renombra
+@nameVM Paràmetro que representa el uuid ò el nombre de la màquina virtual a buscar
 @Retorna la màquina virtual en caso de que exista en la base de datos
 */
 func getVM(nameVM string) (Maquina_virtual, error) {
 	var maquinaVirtual Maquina_virtual
 
 	var fechaCreacionStr string
-	err := db.QueryRow("SELECT * FROM maquina_virtual WHERE nombre = ?", nameVM).Scan(
+	err := db.QueryRow("SELECT * FROM maquina_virtual WHERE uuid = ? OR nombre = ? LIMIT 1", nameVM, nameVM).Scan(
 		&maquinaVirtual.Uuid, &maquinaVirtual.Nombre, &maquinaVirtual.Ram,
 		&maquinaVirtual.Cpu, &maquinaVirtual.Ip, &maquinaVirtual.Estado,
 		&maquinaVirtual.Hostname, &maquinaVirtual.Persona_email,
@@ -2558,6 +3147,66 @@ func getUser(email string) (Persona, error) {
 	return persona, nil
 }
 
+/*
+Funciòn que verifica si el usuario con el email indicado tiene el rol de administrador
+@email Paràmetro que contiene el email del usuario
+*/
+func esAdministrador(email string) bool {
+	persona, err := getUser(email)
+	return err == nil && persona.Rol == "Administrador"
+}
+
+/*
+Funciòn que permite obtener un disco dado su identificador ùnico
+@idDisco Paràmetro que representa el identificador ùnico del disco
+*/
+func getDiskById(idDisco int) (Disco, error) {
+
+	var disco Disco
+	err := db.QueryRow("Select * from disco where id = ?", idDisco).Scan(&disco.Id, &disco.Nombre, &disco.Ruta_ubicacion, &disco.Sistema_operativo, &disco.Distribucion_sistema_operativo, &disco.arquitectura, &disco.Host_id)
+	if err != nil {
+		log.Println("Error al obtener el disco con id " + strconv.Itoa(idDisco) + ": " + err.Error())
+		return disco, err
+	}
+	return disco, nil
+}
+
+/*
+Funciòn que obtiene el primer disco registrado en un host. Lo usan las MV que tienen un disco propio (importadas o creadas desde
+una imagen ISO) cuando no hay un disco de su sistema operativo en el host, ya que cada MV debe estar asociada a un disco
+@id_host Paràmetro que contiene el identificador ùnico del host
+*/
+func getPrimerDiscoHost(id_host int) (Disco, error) {
+
+	var disco Disco
+	err := db.QueryRow("Select * from disco where host_id = ? order by id limit 1", id_host).Scan(&disco.Id, &disco.Nombre, &disco.Ruta_ubicacion, &disco.Sistema_operativo, &disco.Distribucion_sistema_operativo, &disco.arquitectura, &disco.Host_id)
+	if err != nil {
+		log.Println("No se encontrò un disco en el host " + strconv.Itoa(id_host) + ": " + err.Error())
+		return disco, err
+	}
+	return disco, nil
+}
+
+/*
+Funciòn que permite obtener el disco de una entrada del catàlogo que està ubicado en un host
+@catalogoId Paràmetro que representa el identificador ùnico de la entrada del catàlogo
+@id_host Paràmetro que representa el identificador ùnico del host en el cual se està buscando el disco
+*/
+func getDiskCatalogo(catalogoId int, id_host int) (Disco, error) {
+
+	var disco Disco
+	err := db.QueryRow("SELECT d.id, d.nombre, d.ruta_ubicacion, d.sistema_operativo, d.distribucion_sistema_operativo, d.arquitectura, d.host_id FROM catalogo_disco cd JOIN disco d ON cd.disco_id = d.id WHERE cd.catalogo_id = ? AND d.host_id = ?", catalogoId, id_host).Scan(&disco.Id, &disco.Nombre, &disco.Ruta_ubicacion, &disco.Sistema_operativo, &disco.Distribucion_sistema_operativo, &disco.arquitectura, &disco.Host_id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			log.Println("No se encontrò un disco del catàlogo " + strconv.Itoa(catalogoId) + " en el host " + strconv.Itoa(id_host))
+		} else {
+			log.Println("Hubo un error al realizar la consulta: " + err.Error())
+		}
+		return disco, err
+	}
+	return disco, nil
+}
+
 /*
 Funciòn que permite obtener un disco que cumpla con los paràmetros especificados
 @sistema_operativo Paràmetro que representa el tipo de sistema operativo que debe tener el disco
@@ -2589,30 +3238,33 @@ Funciòn que permite validar si un host tiene los recursos (CPU y RAM) que se es
 @Return Retorna true en caso de que el host tenga libre los recursos solicitados, o false, en caso contrario
 */
 func validarDisponibilidadRecursosHost(cpuRequerida int, ramRequerida int, host Host) bool {
+	return validarDisponibilidadRecursosHostReserva(cpuRequerida, ramRequerida, host, 0)
+}
 
-	recursosDisponibles := false
-
-	var cpuNecesitada int
-	cpuDisponible := float64(host.Cpu_total) * 0.75 //Obtiene el 75% de la cpu total del host
+/*
+Funciòn que valida si un host tiene los recursos que se estàn solicitando sin usar los que retienen las reservas en curso.
+Deben alcanzar tanto la CPU como la RAM solicitadas; un valor de 0 indica que ese recurso no se solicita
+@reservaExcluida Paràmetro que contiene la reserva de la MV que se crea, cuyos recursos retenidos sì se pueden usar. Si es 0 no se excluye ninguna
+*/
+func validarDisponibilidadRecursosHostReserva(cpuRequerida int, ramRequerida int, host Host, reservaExcluida int) bool {
 
-	if cpuRequerida != 0 {
-		cpuNecesitada = cpuRequerida + host.Cpu_usada
+	if cpuRequerida == 0 && ramRequerida == 0 {
+		return false
 	}
 
-	var ramNecesitada int
-	ramDisponible := float64(host.Ram_total) * 0.75 //Obtiene el 75% de la ram total del host
+	cpuDisponible := int(float64(host.Cpu_total) * fraccionUsableHost) //Obtiene el 75% de la cpu total del host
+	ramDisponible := int(float64(host.Ram_total) * fraccionUsableHost) //Obtiene el 75% de la ram total del host
 
-	if ramRequerida != 0 {
-		ramNecesitada = ramRequerida + host.Ram_usada
-	}
+	//Los recursos de las MV reservadas que aùn no se han creado se cuentan como usados mientras la reserva està en curso
+	ramRetenida, cpuRetenida := recursosRetenidosHost(host.Id, reservaExcluida)
 
-	if cpuNecesitada != 0 && cpuNecesitada < int(cpuDisponible) {
-		recursosDisponibles = true
+	if cpuRequerida != 0 && cpuRequerida+host.Cpu_usada+cpuRetenida > cpuDisponible {
+		return false
 	}
-	if ramNecesitada != 0 && ramNecesitada < int(ramDisponible) {
-		recursosDisponibles = true
+	if ramRequerida != 0 && ramRequerida+host.Ram_usada+ramRetenida > ramDisponible {
+		return false
 	}
-	return recursosDisponibles
+	return true
 }
 
 /*
@@ -2681,41 +3333,6 @@ func generateRandomEmail() string {
 	return email
 }
 
-/*
-Funciòn que se encarga de crear cuentas temporales para usuarios invitados
-Cuando se crea la cuenta e ingresa a la base de datos, se encarga de invocar la funciòn para crear una màquina virtual temporal.
-
-@clientIP Paràmetro que contiene la direcciòn IP desde la cual se està realizando la solicitud de crear la cuenta temporal
-*/
-
-func createTempAccount(clientIP string, distribucion_SO string) string {
-	var persona Persona
-
-	persona.Nombre = "Usuario"
-	persona.Apellido = "Invitado"
-	persona.Email = generateRandomEmail()
-	persona.Contrasenia = "GuestUqcloud"
-	persona.Rol = "Invitado"
-
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(persona.Contrasenia), bcrypt.DefaultCost)
-	if err != nil {
-		log.Println("Error al encriptar la contraseña:", err)
-		return ""
-	}
-
-	query := "INSERT INTO persona (nombre, apellido, email, contrasenia, rol) VALUES ( ?, ?, ?, ?, ?);"
-
-	//Consulta en la base de datos si el usuario existe
-	_, err1 := db.Exec(query, persona.Nombre, persona.Apellido, persona.Email, hashedPassword, persona.Rol)
-	if err1 != nil {
-		log.Println("Hubo un error al registrar el usuario en la base de datos", err1)
-	}
-
-	createTempVM(persona.Email, clientIP, distribucion_SO)
-
-	return persona.Email
-}
-
 /*
 Funciòn que permite crear màquina virtuales temporales para los usuarios con rol "invitado"
 Esta funciòn crea las especificaciones para crear una màquina virtual con recursos mìnimos
@@ -2783,27 +3400,29 @@ func isAHostIp(ip string) (Host, error) {
 /*
 Funciòn que permite conocer las màquinas virtuales que tiene creadas un usuario ò todas las màquinas de la plataforma si es un administrador
 @persona Paràmetro que representa un usuario, al cual se le van a buscar las màquinas que le pertenece
+@filtro Paràmetro que contiene las etiquetas, el texto y el estado que deben cumplir las màquinas
 @return Retorna un arreglo con las màquinas que le pertenecen al usuario.
 */
 
-func consultMachines(persona Persona) ([]Maquina_virtual, error) {
+func consultMachines(persona Persona, filtro FiltroMaquinas) ([]Maquina_virtual, error) {
 
-	email := persona.Email
-	var query string
-	var rows *sql.Rows
-	var err error
+	var machines []Maquina_virtual
 
-	if persona.Rol == "Administrador" {
-		//Consulta todas las màquinas virtuales de la base de datos
-		query = "SELECT m.nombre, m.ram, m.cpu, m.ip, m.estado, d.sistema_operativo, d.distribucion_sistema_operativo, m.hostname FROM maquina_virtual as m INNER JOIN disco as d on m.disco_id = d.id"
-		rows, err = db.Query(query)
-	} else {
-		//Consulta las màquinas virtuales de un usuario en la base de datos
-		query = "SELECT m.nombre, m.ram, m.cpu, m.ip, m.estado, d.sistema_operativo, d.distribucion_sistema_operativo, m.hostname FROM maquina_virtual as m INNER JOIN disco as d on m.disco_id = d.id WHERE m.persona_email = ?"
-		rows, err = db.Query(query, email)
+	condiciones, argumentos, err := condicionesFiltroMaquinas(filtro)
+	if err != nil {
+		return machines, fmt.Errorf("%w: %s", errFiltroInvalido, err.Error())
+	}
+	if persona.Rol != "Administrador" {
+		//Los usuarios solo consultan sus màquinas; los administradores consultan todas las màquinas de la base de datos
+		condiciones = append([]string{"m.persona_email = ?"}, condiciones...)
+		argumentos = append([]interface{}{persona.Email}, argumentos...)
 	}
 
-	var machines []Maquina_virtual
+	query := "SELECT m.uuid, m.nombre, m.ram, m.cpu, m.ip, m.estado, d.sistema_operativo, d.distribucion_sistema_operativo, m.hostname FROM maquina_virtual as m INNER JOIN disco as d on m.disco_id = d.id"
+	if len(condiciones) > 0 {
+		query += " WHERE " + strings.Join(condiciones, " AND ")
+	}
+	rows, err := db.Query(query, argumentos...)
 
 	if err != nil {
 		log.Println("Error al realizar la consulta de màquinas en la BD", err)
@@ -2813,7 +3432,7 @@ func consultMachines(persona Persona) ([]Maquina_virtual, error) {
 
 	for rows.Next() {
 		var machine Maquina_virtual
-		if err := rows.Scan(&machine.Nombre, &machine.Ram, &machine.Cpu, &machine.Ip, &machine.Estado, &machine.Sistema_operativo, &machine.Distribucion_sistema_operativo, &machine.Hostname); err != nil {
+		if err := rows.Scan(&machine.Uuid, &machine.Nombre, &machine.Ram, &machine.Cpu, &machine.Ip, &machine.Estado, &machine.Sistema_operativo, &machine.Distribucion_sistema_operativo, &machine.Hostname); err != nil {
 			// Manejar el error al escanear la fila
 			continue
 		}
@@ -2829,6 +3448,22 @@ func consultMachines(persona Persona) ([]Maquina_virtual, error) {
 		// No se encontraron máquinas virtuales para el usuario
 		return machines, errors.New("no Machines Found")
 	}
+
+	//Agrega a cada màquina los discos de datos conectados y los demàs datos de sus tablas adicionales
+	for i := range machines {
+		if discos, err := consultDiscosDatos("WHERE maquina_virtual_uuid = ?", machines[i].Uuid); err != nil {
+			log.Println("Error al consultar los discos de datos de la màquina", err)
+		} else {
+			machines[i].Discos = discos
+		}
+		machines[i].Modo_red, machines[i].Red = getRedMV(machines[i].Uuid)
+		machines[i].Direcciones, _ = consultDireccionesMV(machines[i].Uuid)
+		machines[i].Fecha_estado = getFechaEstadoMV(machines[i].Uuid)
+		machines[i].Descripcion, machines[i].Etiquetas = getMetadatosMV(machines[i].Uuid)
+		if concesion, err := getConcesionMV(machines[i]); err == nil {
+			machines[i].Fecha_expiracion = concesion.Fecha_expiracion
+		}
+	}
 	return machines, nil
 }
 
@@ -2870,57 +3505,6 @@ func consultHosts() ([]Host, error) {
 	return hosts, nil
 }
 
-/*
-Funciòn que verifica el tiempo de creaciòn de las màquinas de los usuarios invitados con el fin de determinar si se ha pasado o no del tiempo lìmite (2.5horas)
-En caso de que una màquina se haya pasado del tiempo, se procederà a eliminarla.
-*/
-
-func checkMachineTime() {
-
-	// Obtiene todas las máquinas virtuales de la base de datos
-	maquinas, err := getGuestMachines()
-	if err != nil {
-		log.Println("Error al obtener las máquinas virtuales:", err)
-		return
-	}
-
-	// Obtiene la hora actual
-	horaActual := time.Now().UTC()
-
-	for _, maquina := range maquinas {
-		// Calcula la diferencia de tiempo entre la hora actual y la fecha de creación de la máquina
-		diferencia := horaActual.Sub(maquina.Fecha_creacion)
-
-		// Verifica si la máquina ha excedido su tiempo de duración, en este caso: 2horas 20minutos
-		if diferencia > (2*time.Hour + 20*time.Minute) {
-
-			//Obtiene el host en el cual està alojada la MV
-			host, err1 := getHost(maquina.Host_id)
-			if err1 != nil {
-				log.Println("Error al obtener el host:", err)
-				return
-			}
-			//Configura la conexiòn SSH con el host
-			config, err2 := configurarSSH(host.Hostname, *privateKeyPath)
-			if err2 != nil {
-				log.Println("Error al configurar SSH:", err2)
-				return
-			}
-
-			//Variable que contiene el estado de la MV (Encendida o apagada)
-			running, err3 := isRunning(maquina.Nombre, host.Ip, config)
-			if err3 != nil {
-				log.Println("Error al obtener el estado de la MV:", err3)
-				return
-			}
-			if running {
-				apagarMV(maquina.Nombre, "")
-			}
-			deleteVM(maquina.Nombre)
-		}
-	}
-}
-
 /*
 Funciòn que permite eliminar una cuenta de un usuario de la base de datos
 @email Paràmetro que contiene el email del usuario a eliminar
@@ -2928,77 +3512,17 @@ Funciòn que permite eliminar una cuenta de un usuario de la base de datos
 
 func deleteAccount(email string) {
 
-	//Elimina la cuenta de la base de datos
-	err := db.QueryRow("DELETE FROM persona WHERE email = ?", email)
-	if err == nil {
-		log.Println("Error al eliminar el registro de la base de datos: ", err)
-	}
-}
-
-/*
-Funciòn que permite obtener todas las màquinas virtuales creadas en la plataforma por los usuarios con rol invitado
-@return Retorna un arreglo con todas las màquinas encontradas
-*/
-
-func getGuestMachines() ([]Maquina_virtual, error) {
-	var maquinas []Maquina_virtual
-
-	query := "SELECT m.nombre, m.fecha_creacion, m.host_id, m.persona_email FROM maquina_virtual m JOIN persona p ON m.persona_email = p.email WHERE p.rol = ?;"
-
-	rows, err := db.Query(query, "Invitado")
+	//Elimina la cuenta de la base de datos junto con los registros de las tablas adicionales asociados a ella
+	_, err := db.Exec("DELETE FROM persona WHERE email = ?", email)
 	if err != nil {
-		log.Println("Error al consultar las máquinas de los invitados:", err)
-		return nil, err
+		log.Println("Error al eliminar el registro de la base de datos: ", err)
+		return
 	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var machine Maquina_virtual
-		var fechaCreacionStr string
-
-		if err := rows.Scan(&machine.Nombre, &fechaCreacionStr, &machine.Host_id, &machine.Persona_email); err != nil {
-			log.Println("Error al escanear la fila:", err)
-			continue
-		}
-
-		// Convierte la cadena de fecha y hora a un tipo de datos time.Time
-		fechaCreacion, err := time.Parse("2006-01-02 15:04:05", fechaCreacionStr)
-		if err != nil {
-			log.Println("Error al convertir la fecha y hora:", err)
-			continue
+	for _, tabla := range []string{"sesion_invitado", "aviso", "programacion", "cuota_persona", "curso_miembro"} {
+		if _, err := db.Exec("DELETE FROM "+tabla+" WHERE persona_email = ?", email); err != nil {
+			log.Println("Error al eliminar los registros de "+tabla+" de la cuenta:", err)
 		}
-
-		// Asigna la fecha y hora convertida a la estructura Maquina_virtual
-		machine.Fecha_creacion = fechaCreacion
-
-		maquinas = append(maquinas, machine)
 	}
-
-	if err := rows.Err(); err != nil {
-		log.Println("Error al iterar sobre las filas:", err)
-		return nil, err
-	}
-
-	return maquinas, nil
-}
-
-/*
-Funciòn que permite conocer el total de màquianas virtuales que tiene creadas un usuario
-@email Paràmetro que contiene el email del usuario al cual se le va a contar las mpaquinas que tiene creadas
-@return retorna un entero con el nùmero de màquinas creadas
-*/
-
-func countUserMachinesCreated(email string) (int, error) {
-
-	//Obtiene la cantidad total de hosts que hay en la base de datos
-	var count int
-	err := db.QueryRow("SELECT COUNT(*) FROM maquina_virtual where persona_email = ?", email).Scan(&count)
-	if err != nil {
-		log.Println("Error al contar las màquinas del usuario que hay en la base de datos: " + err.Error())
-		return 0, err
-	}
-
-	return count, nil
 }
 
 /*
@@ -3023,7 +3547,7 @@ func getMetrics() (map[string]interface{}, error) {
 
 	//Obtiene la cantidad total de màquinas virtuales encendidas que hay en la plataforma
 	var total_maquinas_encendidas int
-	err1 := db.QueryRow("SELECT COALESCE(COUNT(*),0) FROM maquina_virtual where estado = 'Encendido'").Scan(&total_maquinas_encendidas)
+	err1 := db.QueryRow("SELECT COALESCE(COUNT(*),0) FROM maquina_virtual where estado = ?", estadoEncendido).Scan(&total_maquinas_encendidas)
 	if err1 != nil {
 		log.Println("Error al contar las màquinas encendidas que hay en la plataforma: " + err1.Error())
 		return nil, err1
@@ -3104,7 +3628,10 @@ Desde aqui empieza el codigo para el funcionamiento de Docker UQ
 
 func CrearImagenDockerHub(imagen, version, ip, hostname string) string {
 
-	sctlCommand := "docker pull " + imagen + ":" + version
+	if err := validarImagenDocker(imagen + ":" + version); err != nil {
+		log.Println("Imagen invàlida:", err)
+		return "La imagen o la versiòn no son vàlidas"
+	}
 
 	fmt.Println(hostname)
 
@@ -3115,11 +3642,11 @@ func CrearImagenDockerHub(imagen, version, ip, hostname string) string {
 		return "Error al configurar la conexiòn SSH"
 	}
 
-	respuesta, err3 := enviarComandoSSH(ip, sctlCommand, config)
+	respuesta, err3 := ejecutarDocker(ip, config, tiempoComandoLargoSSH, "pull", imagen+":"+version)
 
 	if err3 != nil {
-		log.Println("Error al configurar SSH:", err)
-		return "Error al configurar la conexiòn SSH"
+		log.Println("Error al ejecutar el comando:", err3)
+		return describirErrorSSH(err3)
 	}
 
 	return respuesta
@@ -3127,7 +3654,10 @@ func CrearImagenDockerHub(imagen, version, ip, hostname string) string {
 
 func CrearImagenArchivoTar(nombreArchivo, ip, hostname string) string {
 
-	sctlCommand := "docker load < " + nombreArchivo
+	if err := validarArchivo(nombreArchivo); err != nil {
+		log.Println("Archivo invàlido:", err)
+		return "El nombre del archivo no es vàlido"
+	}
 
 	config, err := configurarSSHContrasenia(hostname)
 
@@ -3136,11 +3666,11 @@ func CrearImagenArchivoTar(nombreArchivo, ip, hostname string) string {
 		return "Error al configurar la conexiòn SSH"
 	}
 
-	_, err3 := enviarComandoSSH(ip, sctlCommand, config)
+	_, err3 := ejecutarDocker(ip, config, tiempoComandoLargoSSH, "load", "-i", nombreArchivo)
 
 	if err3 != nil {
-		log.Println("Error al configurar SSH:", err)
-		return "Error al configurar la conexiòn SSH"
+		log.Println("Error al ejecutar el comando:", err3)
+		return describirErrorSSH(err3)
 	}
 
 	return "Comando Envidado con exito"
@@ -3148,7 +3678,21 @@ func CrearImagenArchivoTar(nombreArchivo, ip, hostname string) string {
 
 func CrearImagenDockerFile(nombreArchivo, nombreImagen, ip, hostname string) string {
 
-	sctlCommand := "mkdir /home/" + hostname + "/" + nombreImagen + "&&" + " unzip " + nombreArchivo + " -d /home/" + hostname + "/" + nombreImagen
+	if err := validarArchivo(nombreArchivo); err != nil {
+		log.Println("Archivo invàlido:", err)
+		return "El nombre del archivo no es vàlido"
+	}
+	if err := validarNombre(nombreImagen); err != nil {
+		log.Println("Nombre de imagen invàlido:", err)
+		return "El nombre de la imagen no es vàlido"
+	}
+	if err := validarNombre(hostname); err != nil {
+		log.Println("Usuario invàlido:", err)
+		return "El usuario no es vàlido"
+	}
+
+	dialecto := dialectoDeMaquina(ip)
+	directorio := dialecto.unirRuta(dialecto.directorioPersonal(hostname), nombreImagen)
 
 	fmt.Println(hostname)
 
@@ -3159,31 +3703,29 @@ func CrearImagenDockerFile(nombreArchivo, nombreImagen, ip, hostname string) str
 		return "Error al configurar la conexiòn SSH"
 	}
 
-	_, err3 := enviarComandoSSH(ip, sctlCommand, config)
+	_, err3 := dialecto.ejecutar(ip, dialecto.crearDirectorio(directorio), config, tiempoComandoSSH)
 
 	if err3 != nil {
-		log.Println("Error al configurar SSH:", err)
-		return "Error al configurar la conexiòn SSH"
+		log.Println("Error al ejecutar el comando:", err3)
+		return describirErrorSSH(err3)
 	}
 
-	fmt.Println("dockerFile")
-
-	fmt.Println(nombreArchivo)
+	_, err3 = dialecto.ejecutar(ip, dialecto.descomprimir(nombreArchivo, directorio), config, tiempoComandoLargoSSH)
 
-	sctlCommand = "cd /home/" + hostname + "/" + nombreImagen + "&&" + " docker build -t " + nombreImagen + " ."
+	if err3 != nil {
+		log.Println("Error al ejecutar el comando:", err3)
+		return describirErrorSSH(err3)
+	}
 
-	fmt.Println(hostname)
+	fmt.Println("dockerFile")
 
-	if err != nil {
-		log.Println("Error al configurar SSH:", err)
-		return "Error al configurar la conexiòn SSH"
-	}
+	fmt.Println(nombreArchivo)
 
-	respuesta, err3 := enviarComandoSSH(ip, sctlCommand, config)
+	respuesta, err3 := ejecutarDocker(ip, config, tiempoComandoLargoSSH, "build", "-t", nombreImagen, directorio)
 
 	if err3 != nil {
-		log.Println("Error al configurar SSH:", err)
-		return "Error al configurar la conexiòn SSH"
+		log.Println("Error al ejecutar el comando:", err3)
+		return describirErrorSSH(err3)
 	}
 
 	return respuesta
@@ -3193,8 +3735,6 @@ func RevisarImagenes(ip, hostname string) ([]Imagen, error) {
 
 	fmt.Println("Revisar Imagenes:", ip, hostname)
 
-	sctlCommand := "docker images --format " + "{{.Repository}},{{.Tag}},{{.ID}},{{.CreatedAt}},{{.Size}}"
-
 	config, err := configurarSSHContrasenia(hostname)
 
 	fmt.Println("hostname:", hostname)
@@ -3204,13 +3744,13 @@ func RevisarImagenes(ip, hostname string) ([]Imagen, error) {
 		return nil, err
 	}
 
-	lista, err3 := enviarComandoSSH(ip, sctlCommand, config)
+	lista, err3 := ejecutarDocker(ip, config, tiempoComandoSSH, "images", "--format", "{{.Repository}},{{.Tag}},{{.ID}},{{.CreatedAt}},{{.Size}}")
 
 	fmt.Println("Ip:", ip)
 
 	if err3 != nil {
-		log.Println("Fallo en la ejecucion", err)
-		return nil, err
+		log.Println("Fallo en la ejecucion", err3)
+		return nil, err3
 	}
 
 	res := splitWord(lista)
@@ -3256,7 +3796,10 @@ func eliminarImagen(imagen, ip, hostname string) string {
 
 	fmt.Println("Eliminar Imagen: ", imagen)
 
-	sctlCommand := "docker rmi " + imagen
+	if err := validarImagenDocker(imagen); err != nil {
+		log.Println("Imagen invàlida:", err)
+		return "Imagen invàlida"
+	}
 
 	config, err := configurarSSHContrasenia(hostname)
 
@@ -3265,11 +3808,11 @@ func eliminarImagen(imagen, ip, hostname string) string {
 		return "Error al configurar la conexiòn SSH"
 	}
 
-	_, err3 := enviarComandoSSH(ip, sctlCommand, config)
+	_, err3 := ejecutarDocker(ip, config, tiempoComandoSSH, "rmi", imagen)
 
 	if err3 != nil {
-		log.Println("Error al configurar SSH:", err)
-		return "Error al configurar la conexiòn SSH"
+		log.Println("Error al ejecutar el comando:", err3)
+		return describirErrorSSH(err3)
 	}
 
 	return "Comando"
@@ -3277,8 +3820,6 @@ func eliminarImagen(imagen, ip, hostname string) string {
 
 func eliminarTodasImagenes(ip, hostname string) string {
 
-	sctlCommand := "docker rmi $(docker images -a -q)"
-
 	config, err := configurarSSHContrasenia(hostname)
 
 	if err != nil {
@@ -3286,23 +3827,51 @@ func eliminarTodasImagenes(ip, hostname string) string {
 		return "Error al configurar la conexiòn SSH"
 	}
 
-	_, err3 := enviarComandoSSH(ip, sctlCommand, config)
+	ids, err3 := ejecutarDocker(ip, config, tiempoComandoSSH, "images", "-a", "-q")
 
 	if err3 != nil {
-		log.Println("Error al configurar SSH:", err)
-		return "Error al configurar la conexiòn SSH"
+		log.Println("Error al ejecutar el comando:", err3)
+		return describirErrorSSH(err3)
 	}
 
-	return "Comando"
+	argumentos := append([]string{"rmi"}, strings.Fields(ids)...)
+	if len(argumentos) == 1 {
+		return "No hay elementos para eliminar"
+	}
+
+	_, err3 = ejecutarDocker(ip, config, tiempoComandoSSH, argumentos...)
+
+	if err3 != nil {
+		log.Println("Error al ejecutar el comando:", err3)
+		return describirErrorSSH(err3)
+	}
+	return "Comando Enviado con Exito"
 }
 
 //Funciones para la gestion de los contenedores
 
+/*
+Funciòn que crea un contenedor a partir de una imagen.
+El comando recibido debe ser "docker run" ò "docker create" con sus opciones, las cuales se envìan como argumentos citados
+y nunca son interpretadas por el shell de la màquina
+@imagen Paràmetro que contiene la imagen a partir de la cual se crea el contenedor
+@comando Paràmetro que contiene el comando de creaciòn con sus opciones. Por ejemplo: docker run -d -p 8080:80
+*/
 func crearContenedor(imagen, comando, ip, hostname string) string {
 
-	sctlCommand := comando + " " + imagen
+	if err := validarImagenDocker(imagen); err != nil {
+		log.Println("Imagen invàlida:", err)
+		return "Imagen invàlida"
+	}
 
-	fmt.Println("\n" + sctlCommand)
+	argumentos := strings.Fields(comando)
+	if len(argumentos) < 2 || argumentos[0] != "docker" || (argumentos[1] != "run" && argumentos[1] != "create") {
+		log.Println("Comando de creaciòn de contenedor no permitido:", comando)
+		return "El comando debe ser docker run o docker create"
+	}
+	argumentos = append(argumentos[1:], imagen)
+
+	fmt.Println("\n" + comando + " " + imagen)
 
 	config, err := configurarSSHContrasenia(hostname)
 
@@ -3311,11 +3880,11 @@ func crearContenedor(imagen, comando, ip, hostname string) string {
 		return "Error al configurar la conexiòn SSH"
 	}
 
-	_, err3 := enviarComandoSSH(ip, sctlCommand, config)
+	_, err3 := ejecutarDocker(ip, config, tiempoComandoLargoSSH, argumentos...)
 
 	if err3 != nil {
-		log.Println("Error al configurar SSH:", err)
-		return "Error al configurar la conexiòn SSH"
+		log.Println("Error al ejecutar el comando:", err3)
+		return describirErrorSSH(err3)
 	}
 
 	return "Comando Enviado con Exito"
@@ -3326,9 +3895,10 @@ func correrContenedor(contenedor, ip, hostname string) string {
 
 	fmt.Println("Correr Contenedor")
 
-	sctlCommand := "docker start " + contenedor
-
-	fmt.Println("\n" + sctlCommand)
+	if err := validarNombre(contenedor); err != nil {
+		log.Println("Contenedor invàlido:", err)
+		return "Contenedor invàlido"
+	}
 
 	config, err := configurarSSHContrasenia(hostname)
 
@@ -3337,11 +3907,11 @@ func correrContenedor(contenedor, ip, hostname string) string {
 		return "Error al configurar la conexiòn SSH"
 	}
 
-	_, err3 := enviarComandoSSH(ip, sctlCommand, config)
+	_, err3 := ejecutarDocker(ip, config, tiempoComandoSSH, "start", contenedor)
 
 	if err3 != nil {
-		log.Println("Error al configurar SSH:", err)
-		return "Error al configurar la conexiòn SSH"
+		log.Println("Error al ejecutar el comando:", err3)
+		return describirErrorSSH(err3)
 	}
 
 	return "Comando Enviado con Exito"
@@ -3351,9 +3921,10 @@ func detenerContenedor(contenedor, ip, hostname string) string {
 
 	fmt.Println("Detener Contenedor")
 
-	sctlCommand := "docker stop " + contenedor
-
-	fmt.Println("\n" + sctlCommand)
+	if err := validarNombre(contenedor); err != nil {
+		log.Println("Contenedor invàlido:", err)
+		return "Contenedor invàlido"
+	}
 
 	config, err := configurarSSHContrasenia(hostname)
 
@@ -3362,11 +3933,11 @@ func detenerContenedor(contenedor, ip, hostname string) string {
 		return "Error al configurar la conexiòn SSH"
 	}
 
-	_, err3 := enviarComandoSSH(ip, sctlCommand, config)
+	_, err3 := ejecutarDocker(ip, config, tiempoComandoSSH, "stop", contenedor)
 
 	if err3 != nil {
-		log.Println("Error al configurar SSH:", err)
-		return "Error al configurar la conexiòn SSH"
+		log.Println("Error al ejecutar el comando:", err3)
+		return describirErrorSSH(err3)
 	}
 
 	return "Comando Enviado con Exito"
@@ -3376,9 +3947,10 @@ func reiniciarContenedor(contenedor, ip, hostname string) string {
 
 	fmt.Println("Reiniciar Contenedor")
 
-	sctlCommand := "docker restart " + contenedor
-
-	fmt.Println("\n" + sctlCommand)
+	if err := validarNombre(contenedor); err != nil {
+		log.Println("Contenedor invàlido:", err)
+		return "Contenedor invàlido"
+	}
 
 	config, err := configurarSSHContrasenia(hostname)
 
@@ -3387,11 +3959,11 @@ func reiniciarContenedor(contenedor, ip, hostname string) string {
 		return "Error al configurar la conexiòn SSH"
 	}
 
-	_, err3 := enviarComandoSSH(ip, sctlCommand, config)
+	_, err3 := ejecutarDocker(ip, config, tiempoComandoSSH, "restart", contenedor)
 
 	if err3 != nil {
-		log.Println("Error al configurar SSH:", err)
-		return "Error al configurar la conexiòn SSH"
+		log.Println("Error al ejecutar el comando:", err3)
+		return describirErrorSSH(err3)
 	}
 
 	return "Comando Enviado con Exito"
@@ -3401,9 +3973,10 @@ func eliminarContenedor(contenedor, ip, hostname string) string {
 
 	fmt.Println("Eliminar Contenedor")
 
-	sctlCommand := "docker rm " + contenedor
-
-	fmt.Println("\n" + sctlCommand)
+	if err := validarNombre(contenedor); err != nil {
+		log.Println("Contenedor invàlido:", err)
+		return "Contenedor invàlido"
+	}
 
 	config, err := configurarSSHContrasenia(hostname)
 
@@ -3412,11 +3985,11 @@ func eliminarContenedor(contenedor, ip, hostname string) string {
 		return "Error al configurar la conexiòn SSH"
 	}
 
-	_, err3 := enviarComandoSSH(ip, sctlCommand, config)
+	_, err3 := ejecutarDocker(ip, config, tiempoComandoSSH, "rm", contenedor)
 
 	if err3 != nil {
-		log.Println("Error al configurar SSH:", err)
-		return "Error al configurar la conexiòn SSH"
+		log.Println("Error al ejecutar el comando:", err3)
+		return describirErrorSSH(err3)
 	}
 
 	return "Comando Enviado con Exito"
@@ -3424,8 +3997,6 @@ func eliminarContenedor(contenedor, ip, hostname string) string {
 
 func eliminarTodosContenedores(ip, hostname string) string {
 
-	sctlCommand := "docker rm $(docker ps -a -q)"
-
 	config, err := configurarSSHContrasenia(hostname)
 
 	if err != nil {
@@ -3433,11 +4004,23 @@ func eliminarTodosContenedores(ip, hostname string) string {
 		return "Error al configurar la conexiòn SSH"
 	}
 
-	_, err3 := enviarComandoSSH(ip, sctlCommand, config)
+	ids, err3 := ejecutarDocker(ip, config, tiempoComandoSSH, "ps", "-a", "-q")
 
 	if err3 != nil {
-		log.Println("Error al configurar SSH:", err)
-		return "Error al configurar la conexiòn SSH"
+		log.Println("Error al ejecutar el comando:", err3)
+		return describirErrorSSH(err3)
+	}
+
+	argumentos := append([]string{"rm"}, strings.Fields(ids)...)
+	if len(argumentos) == 1 {
+		return "No hay elementos para eliminar"
+	}
+
+	_, err3 = ejecutarDocker(ip, config, tiempoComandoSSH, argumentos...)
+
+	if err3 != nil {
+		log.Println("Error al ejecutar el comando:", err3)
+		return describirErrorSSH(err3)
 	}
 	return "Comando Enviado con Exito"
 }
@@ -3446,8 +4029,6 @@ func RevisarContenedores(ip, hostname string) ([]Conetendor, error) {
 
 	fmt.Println("Revisar Contenedores")
 
-	sctlCommand := "docker ps -a --format  '{{.ID}},{{.Image}},{{.Command}},{{.CreatedAt}},{{.Status}},{{if .Ports}}{{.Ports}}{{else}}No ports exposed{{end}},{{.Names}}'"
-
 	config, err := configurarSSHContrasenia(hostname)
 
 	if err != nil {
@@ -3455,11 +4036,11 @@ func RevisarContenedores(ip, hostname string) ([]Conetendor, error) {
 		return nil, err
 	}
 
-	lista, err3 := enviarComandoSSH(ip, sctlCommand, config)
+	lista, err3 := ejecutarDocker(ip, config, tiempoComandoSSH, "ps", "-a", "--format", "{{.ID}},{{.Image}},{{.Command}},{{.CreatedAt}},{{.Status}},{{if .Ports}}{{.Ports}}{{else}}No ports exposed{{end}},{{.Names}}")
 
 	if err3 != nil {
-		log.Println("Error al configurar SSH:", err)
-		return nil, err
+		log.Println("Fallo en la ejecucion", err3)
+		return nil, err3
 	}
 
 	res := splitWord(lista)
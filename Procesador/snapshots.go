@@ -0,0 +1,476 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+/*
+Estructura de datos tipo JSON que representa una instantànea (snapshot) de una màquina virtual
+@Id Representa el identificador ùnico de la instantànea en la base de datos
+@Uuid Representa el identificador ùnico de la instantànea en VirtualBox
+@Nombre Representa el nombre de la instantànea. Es ùnico para cada MV
+@Descripcion Representa la descripciòn ingresada por el usuario
+@Maquina_virtual_uuid Representa el uuid de la MV a la que pertenece la instantànea
+@Tamanio Representa el espacio en mb que ocupa en el host el disco diferencial de la instantànea
+@Base Indica si la instantànea se tomò como base de clones enlazados. No cuenta en la cuota de instantàneas del propietario
+@Fecha_creacion Representa el momento en el que se tomò la instantànea
+*/
+type Snapshot struct {
+	Id                   int
+	Uuid                 string
+	Nombre               string
+	Descripcion          string
+	Maquina_virtual_uuid string
+	Tamanio              int
+	Base                 bool
+	Fecha_creacion       time.Time
+}
+
+/*
+Funciòn que configura los endpoints para la gestiòn de instantàneas de màquinas virtuales.
+Las solicitudes para tomar, restaurar y eliminar instantàneas se encolan en la cola de gestiòn
+*/
+func manejarSnapshots() {
+
+	//Endpoints para tomar, restaurar y eliminar instantàneas
+	encolarSolicitudSnapshot := func(tipoEsperado string, mensaje string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				http.Error(w, "Se requiere una solicitud POST", http.StatusMethodNotAllowed)
+				return
+			}
+
+			var datos map[string]interface{}
+			decoder := json.NewDecoder(r.Body)
+			if err := decoder.Decode(&datos); err != nil {
+				http.Error(w, "Error al decodificar JSON de la solicitud", http.StatusBadRequest)
+				return
+			}
+
+			tipoSolicitud, _ := datos["tipo_solicitud"].(string)
+			if tipoSolicitud != tipoEsperado {
+				http.Error(w, "El campo 'tipo_solicitud' debe ser '"+tipoEsperado+"'", http.StatusBadRequest)
+				return
+			}
+
+			nombreVM, _ := datos["nombreVM"].(string)
+			nombreSnapshot, _ := datos["nombreSnapshot"].(string)
+			if nombreVM == "" || nombreSnapshot == "" {
+				http.Error(w, "El nombre de la máquina virtual y el de la instantánea son obligatorios", http.StatusBadRequest)
+				return
+			}
+			if err := validarNombre(nombreVM); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := validarNombre(nombreSnapshot); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			if tipoSolicitud == "take_snapshot" {
+				maquinaVirtual, err := getVM(nombreVM)
+				if err != nil {
+					http.Error(w, "No se encontró la máquina virtual", http.StatusNotFound)
+					return
+				}
+				if err := validarLimiteSnapshots(maquinaVirtual); err != nil {
+					http.Error(w, err.Error(), http.StatusForbidden)
+					return
+				}
+			}
+
+			//La base de clones enlazados no se puede eliminar mientras existan los clones
+			if tipoSolicitud == "delete_snapshot" {
+				if maquinaVirtual, err := getVM(nombreVM); err == nil {
+					if snapshot, err := getSnapshot(maquinaVirtual.Uuid, nombreSnapshot); err == nil {
+						if err := validarSnapshotSinClones(snapshot); err != nil {
+							http.Error(w, err.Error(), http.StatusConflict)
+							return
+						}
+					}
+				}
+			}
+
+			// Encola las peticiones.
+			identificarMV(datos)
+			mu.Lock()
+			managementQueue.Queue.PushBack(datos)
+			mu.Unlock()
+
+			// Envía una respuesta al cliente.
+			response := map[string]string{"mensaje": mensaje}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(response)
+		}
+	}
+
+	http.HandleFunc("/json/takeSnapshot", encolarSolicitudSnapshot("take_snapshot", "Mensaje JSON para tomar la instantánea recibido correctamente"))
+	http.HandleFunc("/json/restoreSnapshot", encolarSolicitudSnapshot("restore_snapshot", "Mensaje JSON para restaurar la instantánea recibido correctamente"))
+	http.HandleFunc("/json/deleteSnapshot", encolarSolicitudSnapshot("delete_snapshot", "Mensaje JSON para eliminar la instantánea recibido correctamente"))
+
+	//Endpoint para consultar las instantàneas de una màquina virtual
+	http.HandleFunc("/json/consultSnapshots", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Se requiere una solicitud POST", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var datos map[string]interface{}
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&datos); err != nil {
+			http.Error(w, "Error al decodificar JSON de la solicitud", http.StatusBadRequest)
+			return
+		}
+
+		nombreVM, _ := datos["nombreVM"].(string)
+		maquinaVirtual, err := getVM(nombreVM)
+		if err != nil {
+			http.Error(w, "No se encontró la máquina virtual", http.StatusNotFound)
+			return
+		}
+
+		snapshots, err := consultSnapshots(maquinaVirtual.Uuid)
+		if err != nil {
+			log.Println("Error al consultar las instantáneas:", err)
+			http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(snapshots)
+	})
+}
+
+/*
+Funciòn que verifica que la MV no haya alcanzado el nùmero màximo de instantàneas de la cuota de su propietario
+@maquinaVirtual Paràmetro que contiene la màquina virtual
+*/
+func validarLimiteSnapshots(maquinaVirtual Maquina_virtual) error {
+	propietario, err := getUser(maquinaVirtual.Persona_email)
+	if err != nil {
+		return errors.New("no se pudo obtener el propietario de la màquina virtual")
+	}
+
+	var cantidad int
+	if err := db.QueryRow("SELECT COUNT(*) FROM snapshot WHERE maquina_virtual_uuid = ? AND base = FALSE", maquinaVirtual.Uuid).Scan(&cantidad); err != nil {
+		return errors.New("no se pudo consultar la cantidad de instantàneas de la màquina virtual")
+	}
+
+	cuota, _ := getCuota(propietario)
+	if superaCuota(cuota.Snapshots, cantidad+1) {
+		return fmt.Errorf("la màquina virtual alcanzò la cuota de %d instantàneas de su propietario", cuota.Snapshots)
+	}
+	return nil
+}
+
+/*
+Funciòn que consulta las instantàneas registradas para una màquina virtual, de la màs antigua a la màs reciente
+@uuidVM Paràmetro que contiene el uuid de la màquina virtual
+*/
+func consultSnapshots(uuidVM string) ([]Snapshot, error) {
+	rows, err := db.Query("SELECT id, uuid, nombre, descripcion, maquina_virtual_uuid, tamanio, base, fecha_creacion FROM snapshot WHERE maquina_virtual_uuid = ? ORDER BY fecha_creacion", uuidVM)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snapshots []Snapshot
+	for rows.Next() {
+		var snapshot Snapshot
+		var fechaCreacionStr string
+		if err := rows.Scan(&snapshot.Id, &snapshot.Uuid, &snapshot.Nombre, &snapshot.Descripcion, &snapshot.Maquina_virtual_uuid, &snapshot.Tamanio, &snapshot.Base, &fechaCreacionStr); err != nil {
+			return nil, err
+		}
+		snapshot.Fecha_creacion, _ = time.Parse("2006-01-02 15:04:05", fechaCreacionStr)
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots, rows.Err()
+}
+
+/*
+Funciòn que toma una instantànea de una màquina virtual.
+El disco diferencial que estaba en uso queda asociado a la instantànea, por lo que su tamaño se suma al almacenamiento usado del host
+@nameVM Paràmetro que contiene el nombre de la màquina virtual
+@nombreSnapshot Paràmetro que contiene el nombre de la instantànea
+@descripcion Paràmetro que contiene la descripciòn de la instantànea
+*/
+func tomarSnapshot(nameVM string, nombreSnapshot string, descripcion string) string {
+
+	maquinaVirtual, err := getVM(nameVM)
+	if err != nil {
+		log.Println("Error al obtener la MV:", err)
+		return "Error al obtener la MV"
+	}
+
+	if err := validarLimiteSnapshots(maquinaVirtual); err != nil {
+		log.Println(err)
+		return err.Error()
+	}
+
+	var existe int
+	db.QueryRow("SELECT COUNT(*) FROM snapshot WHERE maquina_virtual_uuid = ? AND nombre = ?", maquinaVirtual.Uuid, nombreSnapshot).Scan(&existe)
+	if existe > 0 {
+		return "Ya existe una instantànea con ese nombre"
+	}
+
+	host, err := getHost(maquinaVirtual.Host_id)
+	if err != nil {
+		log.Println("Error al obtener el host:", err)
+		return "Error al obtener el host"
+	}
+
+	config, err := configurarSSH(host.Hostname, *privateKeyPath)
+	if err != nil {
+		log.Println("Error al configurar SSH:", err)
+		return "Error al configurar SSH"
+	}
+
+	if _, mensaje := registrarSnapshot(maquinaVirtual, host, config, nombreSnapshot, descripcion, false); mensaje != "" {
+		return mensaje
+	}
+
+	fmt.Println("Instantànea tomada correctamente")
+	return "Instantànea tomada correctamente"
+}
+
+/*
+Funciòn que envìa al host el comando para tomar la instantànea y la registra en la base de datos, sin verificar el lìmite del rol.
+Tambièn la usan los clones enlazados, que necesitan una instantànea de la MV de origen
+@base Paràmetro que indica si la instantànea es la base de clones enlazados, que no cuenta en la cuota del propietario
+@return Retorna la instantànea registrada, o un mensaje de error
+*/
+func registrarSnapshot(maquinaVirtual Maquina_virtual, host Host, config *ssh.ClientConfig, nombreSnapshot string, descripcion string, base bool) (Snapshot, string) {
+
+	//Obtiene el tamaño del disco diferencial en uso, que pasarà a formar parte de la instantànea
+	tamanio := 0
+	info, err := obtenerInfoMV(host, config, maquinaVirtual.Nombre)
+	if err != nil {
+		log.Println("Error al obtener la informaciòn de la MV:", err)
+		return Snapshot{}, "Error al obtener la informaciòn de la MV"
+	}
+	if medio, conectado := info.medioEn("hardisk", 0, 0); conectado && medio.Uuid != "" {
+		disco, err := obtenerInfoMedio(host, config, medio.Uuid)
+		if err != nil {
+			log.Println("Error al obtener la informaciòn del disco de la MV:", err)
+			return Snapshot{}, "Error al obtener la informaciòn del disco de la MV"
+		}
+		if disco.diferencial() {
+			tamanio = disco.Tamanio
+		}
+	}
+
+	if host.Almacenamiento_usado+tamanio > host.Almacenamiento_total {
+		return Snapshot{}, "El host no tiene almacenamiento disponible para la instantànea"
+	}
+
+	argumentos := []string{"snapshot", maquinaVirtual.Nombre, "take", nombreSnapshot}
+	if descripcion != "" {
+		argumentos = append(argumentos, "--description", descripcion)
+	}
+	salida, err := ejecutarVBoxManage(host, config, argumentos...)
+	if err != nil {
+		log.Println("Error al tomar la instantànea:", err)
+		return Snapshot{}, "Error al tomar la instantànea: " + describirErrorSSH(err)
+	}
+
+	snapshot := Snapshot{
+		Uuid:                 parsearUUIDCreacion(salida),
+		Nombre:               nombreSnapshot,
+		Descripcion:          descripcion,
+		Maquina_virtual_uuid: maquinaVirtual.Uuid,
+		Tamanio:              tamanio,
+		Base:                 base,
+		Fecha_creacion:       time.Now().UTC(),
+	}
+	resultado, err := db.Exec("INSERT INTO snapshot (uuid, nombre, descripcion, maquina_virtual_uuid, tamanio, base, fecha_creacion) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		snapshot.Uuid, snapshot.Nombre, snapshot.Descripcion, snapshot.Maquina_virtual_uuid, snapshot.Tamanio, snapshot.Base, snapshot.Fecha_creacion.Format("2006-01-02 15:04:05"))
+	if err != nil {
+		log.Println("Error al registrar la instantànea en la base de datos:", err)
+		//Sin registro la instantànea no se contarìa en la cuota ni en el almacenamiento del host; se elimina de VirtualBox
+		if _, err := ejecutarVBoxManage(host, config, "snapshot", maquinaVirtual.Nombre, "delete", instantaneaVBox(snapshot)); err != nil {
+			log.Println("Error al eliminar la instantànea sin registro:", err)
+		}
+		return Snapshot{}, "Error al registrar la instantànea en la base de datos"
+	}
+	if id, err := resultado.LastInsertId(); err == nil {
+		snapshot.Id = int(id)
+	}
+
+	if _, err := db.Exec("UPDATE host SET almacenamiento_usado = almacenamiento_usado + ? WHERE id = ?", tamanio, host.Id); err != nil {
+		log.Println("Error al actualizar el almacenamiento usado del host:", err)
+	}
+
+	return snapshot, ""
+}
+
+/*
+Funciòn que restaura una màquina virtual al estado de una de sus instantàneas. La MV debe estar apagada
+@nameVM Paràmetro que contiene el nombre de la màquina virtual
+@nombreSnapshot Paràmetro que contiene el nombre de la instantànea
+*/
+func restaurarSnapshot(nameVM string, nombreSnapshot string) string {
+
+	maquinaVirtual, err := getVM(nameVM)
+	if err != nil {
+		log.Println("Error al obtener la MV:", err)
+		return "Error al obtener la MV"
+	}
+
+	snapshot, err := getSnapshot(maquinaVirtual.Uuid, nombreSnapshot)
+	if err != nil {
+		return "No se encontrò la instantànea"
+	}
+
+	host, err := getHost(maquinaVirtual.Host_id)
+	if err != nil {
+		log.Println("Error al obtener el host:", err)
+		return "Error al obtener el host"
+	}
+
+	config, err := configurarSSH(host.Hostname, *privateKeyPath)
+	if err != nil {
+		log.Println("Error al configurar SSH:", err)
+		return "Error al configurar SSH"
+	}
+
+	running, err := isRunning(nameVM, host, config)
+	if err != nil {
+		log.Println("Error al obtener el estado de la MV:", err)
+		return "Error al obtener el estado de la MV"
+	}
+	if running {
+		return "Debe apagar la màquina para restaurar la instantànea"
+	}
+
+	if _, err := ejecutarVBoxManage(host, config, "snapshot", nameVM, "restore", instantaneaVBox(snapshot)); err != nil {
+		log.Println("Error al restaurar la instantànea:", err)
+		return "Error al restaurar la instantànea: " + describirErrorSSH(err)
+	}
+
+	fmt.Println("Instantànea restaurada correctamente")
+	return "Instantànea restaurada correctamente"
+}
+
+/*
+Funciòn que elimina una instantànea de una màquina virtual. VirtualBox fusiona su disco diferencial con el siguiente,
+por lo que el espacio registrado para la instantànea se descuenta del almacenamiento usado del host
+@nameVM Paràmetro que contiene el nombre de la màquina virtual
+@nombreSnapshot Paràmetro que contiene el nombre de la instantànea
+*/
+func eliminarSnapshot(nameVM string, nombreSnapshot string) string {
+
+	maquinaVirtual, err := getVM(nameVM)
+	if err != nil {
+		log.Println("Error al obtener la MV:", err)
+		return "Error al obtener la MV"
+	}
+
+	snapshot, err := getSnapshot(maquinaVirtual.Uuid, nombreSnapshot)
+	if err != nil {
+		return "No se encontrò la instantànea"
+	}
+
+	//Los clones enlazados usan el disco diferencial de la instantànea como base
+	if err := validarSnapshotSinClones(snapshot); err != nil {
+		return err.Error()
+	}
+
+	host, err := getHost(maquinaVirtual.Host_id)
+	if err != nil {
+		log.Println("Error al obtener el host:", err)
+		return "Error al obtener el host"
+	}
+
+	config, err := configurarSSH(host.Hostname, *privateKeyPath)
+	if err != nil {
+		log.Println("Error al configurar SSH:", err)
+		return "Error al configurar SSH"
+	}
+
+	if _, err := ejecutarVBoxManage(host, config, "snapshot", nameVM, "delete", instantaneaVBox(snapshot)); err != nil {
+		log.Println("Error al eliminar la instantànea:", err)
+		return "Error al eliminar la instantànea: " + describirErrorSSH(err)
+	}
+
+	if _, err := db.Exec("DELETE FROM snapshot WHERE id = ?", snapshot.Id); err != nil {
+		log.Println("Error al eliminar la instantànea de la base de datos:", err)
+		return "Error al eliminar la instantànea de la base de datos"
+	}
+
+	if _, err := db.Exec("UPDATE host SET almacenamiento_usado = GREATEST(almacenamiento_usado - ?, 0) WHERE id = ?", snapshot.Tamanio, host.Id); err != nil {
+		log.Println("Error al actualizar el almacenamiento usado del host:", err)
+	}
+
+	fmt.Println("Instantànea eliminada correctamente")
+	return "Instantànea eliminada correctamente"
+}
+
+/*
+Funciòn que verifica que una instantànea no sea la base de clones enlazados que aùn existen, por lo que se puede eliminar
+@snapshot Paràmetro que contiene la instantànea
+*/
+func validarSnapshotSinClones(snapshot Snapshot) error {
+	var clones int
+	if err := db.QueryRow("SELECT COUNT(*) FROM clon WHERE snapshot_id = ?", snapshot.Id).Scan(&clones); err != nil {
+		log.Println("Error al consultar los clones de la instantànea:", err)
+		return errors.New("no se pudo verificar si la instantànea es la base de clones enlazados")
+	}
+	if clones > 0 {
+		return errors.New("la instantànea es la base de clones enlazados. Debe eliminar primero los clones")
+	}
+	return nil
+}
+
+/*
+Funciòn que elimina los registros de las instantàneas de una MV eliminada y libera su almacenamiento en el host.
+Los discos diferenciales los elimina VirtualBox junto con la MV (unregistervm --delete)
+@maquinaVirtual Paràmetro que contiene la màquina virtual eliminada
+*/
+func eliminarRegistrosSnapshots(maquinaVirtual Maquina_virtual) {
+	var tamanio int
+	db.QueryRow("SELECT COALESCE(SUM(tamanio), 0) FROM snapshot WHERE maquina_virtual_uuid = ?", maquinaVirtual.Uuid).Scan(&tamanio)
+
+	if _, err := db.Exec("DELETE FROM snapshot WHERE maquina_virtual_uuid = ?", maquinaVirtual.Uuid); err != nil {
+		log.Println("Error al eliminar las instantàneas de la base de datos:", err)
+		return
+	}
+
+	if tamanio > 0 {
+		if _, err := db.Exec("UPDATE host SET almacenamiento_usado = GREATEST(almacenamiento_usado - ?, 0) WHERE id = ?", tamanio, maquinaVirtual.Host_id); err != nil {
+			log.Println("Error al actualizar el almacenamiento usado del host:", err)
+		}
+	}
+}
+
+/*
+Funciòn que obtiene una instantànea dado el uuid de la MV y el nombre de la instantànea
+*/
+func getSnapshot(uuidVM string, nombreSnapshot string) (Snapshot, error) {
+	var snapshot Snapshot
+	var fechaCreacionStr string
+	err := db.QueryRow("SELECT id, uuid, nombre, descripcion, maquina_virtual_uuid, tamanio, base, fecha_creacion FROM snapshot WHERE maquina_virtual_uuid = ? AND nombre = ?", uuidVM, nombreSnapshot).Scan(
+		&snapshot.Id, &snapshot.Uuid, &snapshot.Nombre, &snapshot.Descripcion, &snapshot.Maquina_virtual_uuid, &snapshot.Tamanio, &snapshot.Base, &fechaCreacionStr)
+	if err != nil {
+		return snapshot, err
+	}
+	snapshot.Fecha_creacion, _ = time.Parse("2006-01-02 15:04:05", fechaCreacionStr)
+	return snapshot, nil
+}
+
+// Retorna el identificador con el que se referencia la instantànea en VirtualBox. Se prefiere el UUID porque el nombre puede repetirse en el àrbol
+func instantaneaVBox(snapshot Snapshot) string {
+	if snapshot.Uuid != "" {
+		return snapshot.Uuid
+	}
+	return snapshot.Nombre
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+/*
+Estructura de datos tipo JSON que representa un trabajo de larga duraciòn, como la exportaciòn o importaciòn de una MV.
+El cliente recibe el identificador del trabajo al enviar la solicitud y consulta su estado hasta que termina
+@Id Representa el identificador ùnico del trabajo
+@Tipo Representa la operaciòn que realiza el trabajo. Por ejemplo: export ò import
+@Estado Representa el estado del trabajo: Pendiente, En curso, Terminado ò Error
+@Maquina_virtual Representa el nombre de la MV sobre la que se realiza el trabajo
+@Persona_email Representa el email del usuario que solicitò el trabajo
+@Host_id Representa el host en el que se ejecuta el trabajo
+@Ruta Representa el archivo del host asociado al trabajo. Por ejemplo: el archivo OVA exportado
+@Mensaje Representa el resultado del trabajo o la descripciòn del error
+@Fecha_creacion Representa el momento en el que se creò el trabajo
+@Fecha_actualizacion Representa el ùltimo cambio de estado del trabajo
+*/
+type Trabajo struct {
+	Id                  int
+	Tipo                string
+	Estado              string
+	Maquina_virtual     string
+	Persona_email       string
+	Host_id             int
+	Ruta                string
+	Mensaje             string
+	Fecha_creacion      time.Time
+	Fecha_actualizacion time.Time
+}
+
+// Estados de los trabajos
+const (
+	trabajoPendiente = "Pendiente"
+	trabajoEnCurso   = "En curso"
+	trabajoTerminado = "Terminado"
+	trabajoError     = "Error"
+)
+
+/*
+Funciòn que configura el endpoint para consultar el estado de un trabajo. Solo lo pueden consultar quien lo solicitò y los administradores
+*/
+func manejarTrabajos() {
+
+	http.HandleFunc("/json/consultJob", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Se requiere una solicitud POST", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var datos struct {
+			Id    int
+			Email string
+		}
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&datos); err != nil {
+			http.Error(w, "Error al decodificar JSON de la solicitud", http.StatusBadRequest)
+			return
+		}
+
+		trabajo, err := getTrabajo(datos.Id)
+		if err != nil {
+			http.Error(w, "No se encontró el trabajo", http.StatusNotFound)
+			return
+		}
+		if trabajo.Persona_email != datos.Email && !esAdministrador(datos.Email) {
+			http.Error(w, "No tiene permiso para consultar el trabajo", http.StatusForbidden)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(trabajo)
+	})
+}
+
+/*
+Funciòn que registra un trabajo pendiente en la base de datos
+@return Retorna el identificador del trabajo
+*/
+func crearTrabajo(tipo string, nombreVM string, email string, hostId int) (int, error) {
+	ahora := time.Now().UTC().Format("2006-01-02 15:04:05")
+	resultado, err := db.Exec("INSERT INTO trabajo (tipo, estado, maquina_virtual, persona_email, host_id, ruta, mensaje, fecha_creacion, fecha_actualizacion) VALUES (?, ?, ?, ?, ?, '', '', ?, ?)",
+		tipo, trabajoPendiente, nombreVM, email, hostId, ahora, ahora)
+	if err != nil {
+		return 0, err
+	}
+	id, err := resultado.LastInsertId()
+	return int(id), err
+}
+
+/*
+Funciòn que actualiza el estado y el mensaje de un trabajo
+@id Paràmetro que contiene el identificador del trabajo
+@estado Paràmetro que contiene el nuevo estado
+@mensaje Paràmetro que contiene el resultado o el error del trabajo
+*/
+func actualizarTrabajo(id int, estado string, mensaje string) {
+	_, err := db.Exec("UPDATE trabajo SET estado = ?, mensaje = ?, fecha_actualizacion = ? WHERE id = ?", estado, mensaje, time.Now().UTC().Format("2006-01-02 15:04:05"), id)
+	if err != nil {
+		log.Println("Error al actualizar el trabajo:", err)
+	}
+}
+
+/*
+Funciòn que guarda la ruta del archivo del host asociado a un trabajo. Una ruta vacìa indica que el archivo ya se eliminò
+@id Paràmetro que contiene el identificador del trabajo
+@ruta Paràmetro que contiene la ruta del archivo en el host
+*/
+func asignarRutaTrabajo(id int, ruta string) {
+	if _, err := db.Exec("UPDATE trabajo SET ruta = ? WHERE id = ?", ruta, id); err != nil {
+		log.Println("Error al actualizar el trabajo:", err)
+	}
+}
+
+/*
+Funciòn que obtiene un trabajo dado su identificador ùnico
+*/
+func getTrabajo(id int) (Trabajo, error) {
+	var trabajo Trabajo
+	var fechaCreacion, fechaActualizacion string
+	err := db.QueryRow("SELECT id, tipo, estado, maquina_virtual, persona_email, host_id, ruta, mensaje, fecha_creacion, fecha_actualizacion FROM trabajo WHERE id = ?", id).Scan(
+		&trabajo.Id, &trabajo.Tipo, &trabajo.Estado, &trabajo.Maquina_virtual, &trabajo.Persona_email, &trabajo.Host_id, &trabajo.Ruta, &trabajo.Mensaje, &fechaCreacion, &fechaActualizacion)
+	if err != nil {
+		return trabajo, err
+	}
+	trabajo.Fecha_creacion, _ = time.Parse("2006-01-02 15:04:05", fechaCreacion)
+	trabajo.Fecha_actualizacion, _ = time.Parse("2006-01-02 15:04:05", fechaActualizacion)
+	return trabajo, nil
+}
@@ -0,0 +1,519 @@
+package main
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+/*
+Estructura que contiene la informaciòn de una màquina virtual obtenida con VBoxManage showvminfo --machinereadable
+@Nombre Representa el nombre de la MV en VirtualBox
+@Uuid Representa el identificador ùnico de la MV en VirtualBox
+@Estado Representa el estado de la MV segùn VirtualBox. Por ejemplo: running, poweroff, saved, paused o aborted
+@EstadoDesde Representa el momento del ùltimo cambio de estado
+@Ram Representa la memoria asignada a la MV en mb
+@Cpu Representa la cantidad de unidades de procesamiento de la MV
+@Tarjetas Representa los adaptadores de red habilitados
+@Medios Representa los discos e imàgenes conectados a los controladores de almacenamiento
+@GuestAdditions Representa la informaciòn de las Guest Additions instaladas en la MV
+@Valores Contiene todos los pares clave/valor de la salida, para los datos que no tienen un campo propio
+*/
+type infoMV struct {
+	Nombre         string
+	Uuid           string
+	Estado         string
+	EstadoDesde    time.Time
+	Ram            int
+	Cpu            int
+	Tarjetas       []tarjetaRed
+	Medios         []medioConectado
+	GuestAdditions infoGuestAdditions
+	Valores        map[string]string
+}
+
+/*
+Estructura que representa un adaptador de red de una MV
+@Numero Representa el nùmero del adaptador (1 a 8)
+@Tipo Representa el modo del adaptador: bridged, nat, natnetwork, hostonly, intnet, generic
+@Mac Representa la direcciòn MAC del adaptador
+@Red Representa el adaptador del host, la red interna o la red NAT a la que està conectado, segùn el tipo
+@Conectado Representa si el cable virtual està conectado
+*/
+type tarjetaRed struct {
+	Numero    int
+	Tipo      string
+	Mac       string
+	Red       string
+	Conectado bool
+}
+
+/*
+Estructura que representa un medio (disco o imagen) conectado a un controlador de almacenamiento
+@Controlador Representa el nombre del controlador. Por ejemplo: hardisk
+@Puerto Representa el puerto del controlador
+@Dispositivo Representa el dispositivo dentro del puerto
+@Ruta Representa la ruta del medio en el host, o "emptydrive" si es una unidad òptica vacìa
+@Uuid Representa el identificador ùnico del medio
+*/
+type medioConectado struct {
+	Controlador string
+	Puerto      int
+	Dispositivo int
+	Ruta        string
+	Uuid        string
+}
+
+/*
+Estructura que contiene la informaciòn de las Guest Additions de una MV
+@Version Representa la versiòn instalada
+@NivelEjecucion Representa el nivel de ejecuciòn reportado: 0 ninguno, 1 sistema, 2 userland, 3 escritorio
+*/
+type infoGuestAdditions struct {
+	Version        string
+	NivelEjecucion int
+}
+
+/*
+Estructura que representa una MV listada por VBoxManage list vms ò list runningvms
+*/
+type mvRegistrada struct {
+	Nombre string
+	Uuid   string
+}
+
+/*
+Estructura que representa una propiedad de invitado (guest property) de una MV
+@Nombre Representa la ruta de la propiedad. Por ejemplo: /VirtualBox/GuestInfo/Net/0/V4/IP
+@Valor Representa el valor de la propiedad
+@Fecha Representa el momento en que se asignò el valor
+@Banderas Representa las banderas de la propiedad. Por ejemplo: TRANSIENT, TRANSRESET
+*/
+type propiedadInvitado struct {
+	Nombre   string
+	Valor    string
+	Fecha    time.Time
+	Banderas string
+}
+
+var (
+	patronMVListada          = regexp.MustCompile(`^"(.*)" \{([0-9a-fA-F-]+)\}$`)
+	patronMedio              = regexp.MustCompile(`^(.+)-(\d+)-(\d+)$`)
+	patronPropiedadV6        = regexp.MustCompile(`^Name: (.*), value: (.*), timestamp: (\d+), flags: ?(.*)$`)
+	patronPropiedadV7        = regexp.MustCompile(`^(\S+)\s+= '(.*)' @ (\S+)(?: \((.*)\))?$`)
+	patronIndiceTarjeta      = regexp.MustCompile(`^nic(\d+)$`)
+	patronMemoriaImportacion = regexp.MustCompile(`Guest memory: (\d+) MB`)
+	patronCpuImportacion     = regexp.MustCompile(`Number of CPUs: (\d+)`)
+	prefijosRedTarjeta       = []string{"bridgeadapter", "hostonlyadapter", "intnet", "nat-network", "generic"}
+	estadosEncendidosMVs     = map[string]bool{"running": true, "paused": true, "gurumeditation": true}
+)
+
+/*
+Funciòn que convierte la salida --machinereadable de VBoxManage en un mapa clave/valor.
+Las lìneas tienen la forma clave="valor", clave=valor ò "clave"="valor"; las comillas y barras internas vienen escapadas
+@salida Paràmetro que contiene la salida del comando
+*/
+func parsearMachineReadable(salida string) map[string]string {
+	valores := make(map[string]string)
+	for _, linea := range strings.Split(salida, "\n") {
+		linea = strings.TrimRight(linea, "\r")
+		if linea == "" {
+			continue
+		}
+
+		var clave, resto string
+		if strings.HasPrefix(linea, "\"") {
+			fin := indiceComillaCierre(linea, 1)
+			if fin < 0 || fin+1 >= len(linea) || linea[fin+1] != '=' {
+				continue
+			}
+			clave = desescaparValor(linea[1:fin])
+			resto = linea[fin+2:]
+		} else {
+			i := strings.Index(linea, "=")
+			if i < 0 {
+				continue
+			}
+			clave = linea[:i]
+			resto = linea[i+1:]
+		}
+
+		if strings.HasPrefix(resto, "\"") && strings.HasSuffix(resto, "\"") && len(resto) >= 2 {
+			resto = desescaparValor(resto[1 : len(resto)-1])
+		}
+		valores[clave] = resto
+	}
+	return valores
+}
+
+func indiceComillaCierre(texto string, desde int) int {
+	for i := desde; i < len(texto); i++ {
+		switch texto[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+func desescaparValor(valor string) string {
+	if !strings.Contains(valor, "\\") {
+		return valor
+	}
+	return strings.NewReplacer(`\\`, `\`, `\"`, `"`).Replace(valor)
+}
+
+/*
+Funciòn que interpreta la salida de VBoxManage showvminfo --machinereadable
+@salida Paràmetro que contiene la salida del comando
+*/
+func parsearInfoMV(salida string) infoMV {
+	valores := parsearMachineReadable(salida)
+	info := infoMV{
+		Nombre:  valores["name"],
+		Uuid:    valores["UUID"],
+		Estado:  valores["VMState"],
+		Valores: valores,
+	}
+	info.Ram, _ = strconv.Atoi(valores["memory"])
+	info.Cpu, _ = strconv.Atoi(valores["cpus"])
+	//VirtualBox entrega la fecha en UTC sin zona horaria, por ejemplo 2024-03-05T14:22:31.123000000
+	if fecha, err := time.Parse(time.RFC3339Nano, valores["VMStateChangeTime"]); err == nil {
+		info.EstadoDesde = fecha
+	} else if fecha, err := time.Parse("2006-01-02T15:04:05.999999999", valores["VMStateChangeTime"]); err == nil {
+		info.EstadoDesde = fecha
+	}
+
+	//Adaptadores de red: nicN, macaddressN, cableconnectedN y la red segùn el tipo
+	for clave, tipo := range valores {
+		coincidencia := patronIndiceTarjeta.FindStringSubmatch(clave)
+		if coincidencia == nil || tipo == "none" {
+			continue
+		}
+		numero, _ := strconv.Atoi(coincidencia[1])
+		tarjeta := tarjetaRed{
+			Numero:    numero,
+			Tipo:      tipo,
+			Mac:       valores["macaddress"+coincidencia[1]],
+			Conectado: valores["cableconnected"+coincidencia[1]] == "on",
+		}
+		for _, prefijo := range prefijosRedTarjeta {
+			if red, ok := valores[prefijo+coincidencia[1]]; ok {
+				tarjeta.Red = red
+				break
+			}
+		}
+		info.Tarjetas = append(info.Tarjetas, tarjeta)
+	}
+	sort.Slice(info.Tarjetas, func(i, j int) bool { return info.Tarjetas[i].Numero < info.Tarjetas[j].Numero })
+
+	//Medios conectados: "<controlador>-<puerto>-<dispositivo>" y "<controlador>-ImageUUID-<puerto>-<dispositivo>"
+	for i := 0; ; i++ {
+		controlador, ok := valores["storagecontrollername"+strconv.Itoa(i)]
+		if !ok {
+			break
+		}
+		for clave, ruta := range valores {
+			if !strings.HasPrefix(clave, controlador+"-") || strings.HasPrefix(clave, controlador+"-ImageUUID-") || ruta == "none" {
+				continue
+			}
+			coincidencia := patronMedio.FindStringSubmatch(clave)
+			if coincidencia == nil || coincidencia[1] != controlador {
+				continue
+			}
+			puerto, _ := strconv.Atoi(coincidencia[2])
+			dispositivo, _ := strconv.Atoi(coincidencia[3])
+			info.Medios = append(info.Medios, medioConectado{
+				Controlador: controlador,
+				Puerto:      puerto,
+				Dispositivo: dispositivo,
+				Ruta:        ruta,
+				Uuid:        valores[controlador+"-ImageUUID-"+coincidencia[2]+"-"+coincidencia[3]],
+			})
+		}
+	}
+	sort.Slice(info.Medios, func(i, j int) bool {
+		a, b := info.Medios[i], info.Medios[j]
+		if a.Controlador != b.Controlador {
+			return a.Controlador < b.Controlador
+		}
+		if a.Puerto != b.Puerto {
+			return a.Puerto < b.Puerto
+		}
+		return a.Dispositivo < b.Dispositivo
+	})
+
+	info.GuestAdditions.Version = valores["GuestAdditionsVersion"]
+	info.GuestAdditions.NivelEjecucion, _ = strconv.Atoi(valores["GuestAdditionsRunLevel"])
+
+	return info
+}
+
+/*
+Funciòn que indica si la MV se encuentra encendida (en ejecuciòn o pausada) segùn VirtualBox
+*/
+func (i infoMV) encendida() bool {
+	return estadosEncendidosMVs[i.Estado]
+}
+
+/*
+Funciòn que obtiene el medio conectado en una posiciòn de un controlador, si lo hay
+@controlador Paràmetro que contiene el nombre del controlador
+@puerto Paràmetro que contiene el puerto
+@dispositivo Paràmetro que contiene el dispositivo
+*/
+func (i infoMV) medioEn(controlador string, puerto int, dispositivo int) (medioConectado, bool) {
+	for _, medio := range i.Medios {
+		if medio.Controlador == controlador && medio.Puerto == puerto && medio.Dispositivo == dispositivo {
+			return medio, true
+		}
+	}
+	return medioConectado{}, false
+}
+
+/*
+Funciòn que obtiene los discos duros conectados a la MV, descartando las unidades òpticas
+*/
+func (i infoMV) discosDuros() []medioConectado {
+	var discos []medioConectado
+	for _, medio := range i.Medios {
+		ruta := strings.ToLower(medio.Ruta)
+		if medio.Uuid == "" || ruta == "emptydrive" || strings.HasSuffix(ruta, ".iso") {
+			continue
+		}
+		discos = append(discos, medio)
+	}
+	return discos
+}
+
+/*
+Funciòn que interpreta la salida de VBoxManage import --dry-run para conocer los recursos que pedirà la MV importada.
+Por ejemplo: " 4: Number of CPUs: 2" y " 5: Guest memory: 2048 MB"
+@salida Paràmetro que contiene la salida del comando
+@return Retorna la memoria en mb y la cantidad de CPU del primer sistema virtual del archivo
+*/
+func parsearAnalisisImportacion(salida string) (int, int) {
+	ram, cpu := 0, 0
+	if coincidencia := patronMemoriaImportacion.FindStringSubmatch(salida); coincidencia != nil {
+		ram, _ = strconv.Atoi(coincidencia[1])
+	}
+	if coincidencia := patronCpuImportacion.FindStringSubmatch(salida); coincidencia != nil {
+		cpu, _ = strconv.Atoi(coincidencia[1])
+	}
+	return ram, cpu
+}
+
+/*
+Funciòn que interpreta la salida de VBoxManage list vms ò list runningvms. Cada lìnea tiene la forma "nombre" {uuid}
+@salida Paràmetro que contiene la salida del comando
+*/
+func parsearListaMV(salida string) []mvRegistrada {
+	var maquinas []mvRegistrada
+	for _, linea := range strings.Split(salida, "\n") {
+		coincidencia := patronMVListada.FindStringSubmatch(strings.TrimSpace(linea))
+		if coincidencia == nil {
+			continue
+		}
+		maquinas = append(maquinas, mvRegistrada{Nombre: coincidencia[1], Uuid: coincidencia[2]})
+	}
+	return maquinas
+}
+
+/*
+Funciòn que interpreta la salida de VBoxManage guestproperty enumerate.
+Soporta el formato de VirtualBox 6 (Name: ..., value: ..., timestamp: ..., flags: ...)
+y el de VirtualBox 7 (/ruta = 'valor' @ fecha (banderas)), en el que los nombres se alinean con espacios
+@salida Paràmetro que contiene la salida del comando
+*/
+func parsearPropiedadesInvitado(salida string) []propiedadInvitado {
+	var propiedades []propiedadInvitado
+	for _, linea := range strings.Split(salida, "\n") {
+		linea = strings.TrimSpace(linea)
+
+		if coincidencia := patronPropiedadV6.FindStringSubmatch(linea); coincidencia != nil {
+			propiedad := propiedadInvitado{Nombre: coincidencia[1], Valor: coincidencia[2], Banderas: strings.TrimSpace(coincidencia[4])}
+			if nanosegundos, err := strconv.ParseInt(coincidencia[3], 10, 64); err == nil {
+				propiedad.Fecha = time.Unix(0, nanosegundos).UTC()
+			}
+			propiedades = append(propiedades, propiedad)
+			continue
+		}
+
+		if coincidencia := patronPropiedadV7.FindStringSubmatch(linea); coincidencia != nil {
+			propiedad := propiedadInvitado{Nombre: coincidencia[1], Valor: coincidencia[2], Banderas: coincidencia[4]}
+			if fecha, err := time.Parse(time.RFC3339Nano, coincidencia[3]); err == nil {
+				propiedad.Fecha = fecha
+			}
+			propiedades = append(propiedades, propiedad)
+		}
+	}
+	return propiedades
+}
+
+/*
+Funciòn que interpreta la salida de VBoxManage guestproperty get
+@salida Paràmetro que contiene la salida del comando: "Value: <valor>" ò "No value set!"
+@return Retorna el valor y true si la propiedad tiene un valor asignado
+*/
+func parsearValorPropiedad(salida string) (string, bool) {
+	for _, linea := range strings.Split(salida, "\n") {
+		linea = strings.TrimSpace(linea)
+		if strings.HasPrefix(linea, "Value:") {
+			return strings.TrimSpace(strings.TrimPrefix(linea, "Value:")), true
+		}
+	}
+	return "", false
+}
+
+/*
+Funciòn que obtiene el UUID de la salida de VBoxManage createvm, clonevm ò snapshot take.
+Por ejemplo: "UUID: ..." ò "Snapshot taken. UUID: ..."
+@salida Paràmetro que contiene la salida del comando
+*/
+func parsearUUIDCreacion(salida string) string {
+	for _, linea := range strings.Split(salida, "\n") {
+		if i := strings.Index(linea, "UUID:"); i >= 0 {
+			return strings.TrimSpace(linea[i+len("UUID:"):])
+		}
+	}
+	return ""
+}
+
+/*
+Estructura que contiene la informaciòn de un disco obtenida con VBoxManage showmediuminfo
+@Uuid Representa el identificador ùnico del medio
+@Padre Representa el UUID del disco del cual deriva un disco diferencial, o "base" si no es diferencial
+@Capacidad Representa el tamaño màximo del disco en mb
+@Tamanio Representa el espacio que ocupa el archivo del disco en el host en mb
+*/
+type infoMedio struct {
+	Uuid      string
+	Padre     string
+	Capacidad int
+	Tamanio   int
+}
+
+// Indica si el medio es un disco diferencial, como los que crea VirtualBox al tomar una instantànea
+func (i infoMedio) diferencial() bool {
+	return i.Padre != "" && i.Padre != "base"
+}
+
+/*
+Funciòn que interpreta la salida de VBoxManage showmediuminfo
+@salida Paràmetro que contiene la salida del comando. Por ejemplo: "Size on disk:   2048 MBytes"
+*/
+func parsearInfoMedio(salida string) infoMedio {
+	var info infoMedio
+	for _, linea := range strings.Split(salida, "\n") {
+		clave, valor, encontrado := strings.Cut(linea, ":")
+		if !encontrado {
+			continue
+		}
+		valor = strings.TrimSpace(valor)
+		switch strings.TrimSpace(clave) {
+		case "UUID":
+			info.Uuid = valor
+		case "Parent UUID":
+			info.Padre = valor
+		case "Capacity":
+			info.Capacidad = parsearMegabytes(valor)
+		case "Size on disk":
+			info.Tamanio = parsearMegabytes(valor)
+		}
+	}
+	return info
+}
+
+/*
+Funciòn que convierte un tamaño de la salida de VBoxManage a mb, redondeando hacia arriba
+@valor Paràmetro que contiene el tamaño y su unidad. Por ejemplo: 2048 MBytes ò 1.50 GBytes
+*/
+func parsearMegabytes(valor string) int {
+	campos := strings.Fields(valor)
+	if len(campos) < 2 {
+		return 0
+	}
+	cantidad, err := strconv.ParseFloat(campos[0], 64)
+	if err != nil {
+		return 0
+	}
+	switch strings.ToLower(campos[1]) {
+	case "tbytes":
+		cantidad *= 1024 * 1024
+	case "gbytes":
+		cantidad *= 1024
+	case "kbytes":
+		cantidad /= 1024
+	case "bytes":
+		cantidad /= 1024 * 1024
+	}
+	return int(math.Ceil(cantidad))
+}
+
+/*
+Funciòn que consulta en el host la informaciòn de una màquina virtual
+@host Paràmetro que contiene el host en el cual està la MV
+@config Paràmetro que contiene la configuraciòn SSH
+@nameVM Paràmetro que contiene el nombre o UUID de la MV
+*/
+func obtenerInfoMV(host Host, config *ssh.ClientConfig, nameVM string) (infoMV, error) {
+	salida, err := ejecutarVBoxManage(host, config, "showvminfo", nameVM, "--machinereadable")
+	if err != nil {
+		return infoMV{}, err
+	}
+	return parsearInfoMV(salida), nil
+}
+
+/*
+Funciòn que lista las màquinas virtuales registradas en el host
+@soloEncendidas Paràmetro que indica si solo se listan las MV en ejecuciòn
+*/
+func listarMVsHost(host Host, config *ssh.ClientConfig, soloEncendidas bool) ([]mvRegistrada, error) {
+	lista := "vms"
+	if soloEncendidas {
+		lista = "runningvms"
+	}
+	salida, err := ejecutarVBoxManage(host, config, "list", lista)
+	if err != nil {
+		return nil, err
+	}
+	return parsearListaMV(salida), nil
+}
+
+/*
+Funciòn que obtiene las propiedades de invitado de una MV
+@prefijo Paràmetro que contiene el prefijo de las propiedades a obtener. Por ejemplo: /VirtualBox/GuestInfo/Net/
+*/
+func enumerarPropiedadesInvitado(host Host, config *ssh.ClientConfig, nameVM string, prefijo string) ([]propiedadInvitado, error) {
+	salida, err := ejecutarVBoxManage(host, config, "guestproperty", "enumerate", nameVM)
+	if err != nil {
+		return nil, err
+	}
+
+	var propiedades []propiedadInvitado
+	for _, propiedad := range parsearPropiedadesInvitado(salida) {
+		if strings.HasPrefix(propiedad.Nombre, prefijo) {
+			propiedades = append(propiedades, propiedad)
+		}
+	}
+	return propiedades, nil
+}
+
+/*
+Funciòn que consulta la informaciòn de un disco registrado en el host
+@medio Paràmetro que contiene el UUID o la ruta del medio
+*/
+func obtenerInfoMedio(host Host, config *ssh.ClientConfig, medio string) (infoMedio, error) {
+	salida, err := ejecutarVBoxManage(host, config, "showmediuminfo", "disk", medio)
+	if err != nil {
+		return infoMedio{}, err
+	}
+	return parsearInfoMedio(salida), nil
+}
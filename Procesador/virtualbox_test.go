@@ -0,0 +1,255 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// leerSalida lee una salida real de VBoxManage guardada en testdata/virtualbox
+func leerSalida(t *testing.T, archivo string) string {
+	t.Helper()
+	datos, err := os.ReadFile(filepath.Join("testdata", "virtualbox", archivo))
+	if err != nil {
+		t.Fatalf("no se pudo leer %s: %v", archivo, err)
+	}
+	return string(datos)
+}
+
+func TestParsearInfoMV(t *testing.T) {
+	casos := []struct {
+		archivo   string
+		esperado  infoMV
+		encendida bool
+		discos    int
+		valores   map[string]string
+	}{
+		{
+			archivo: "showvminfo_v7.txt",
+			esperado: infoMV{
+				Nombre:      "lab-ubuntu-01",
+				Uuid:        "6f1c2b2e-3c1d-4b8a-9a0e-2f5d7c9e1a10",
+				Estado:      "running",
+				EstadoDesde: time.Date(2024, 3, 5, 14, 22, 31, 123000000, time.UTC),
+				Ram:         2048,
+				Cpu:         2,
+				Tarjetas: []tarjetaRed{
+					{Numero: 1, Tipo: "nat", Mac: "080027A1B2C3", Conectado: true},
+					{Numero: 2, Tipo: "bridged", Mac: "080027D4E5F6", Red: "enp3s0"},
+				},
+				Medios: []medioConectado{
+					{Controlador: "IDE", Puerto: 1, Dispositivo: 0, Ruta: "emptydrive"},
+					{Controlador: "IDE", Puerto: 1, Dispositivo: 1, Ruta: "/home/uqcloud/discos/cloudinit/lab-ubuntu-01-seed.iso", Uuid: "c4d5e6f7-0a1b-4c2d-9e3f-4a5b6c7d8e9f"},
+					{Controlador: "SATA", Puerto: 0, Dispositivo: 0, Ruta: "/home/uqcloud/discos/ubuntu-22.04.vdi", Uuid: "3a8f5c2d-7e41-4b9a-8c11-0d2e6f7a9b30"},
+					{Controlador: "SATA", Puerto: 1, Dispositivo: 0, Ruta: "/home/uqcloud/discos/datos/lab-ubuntu-01-datos.vdi", Uuid: "9b2d1e0f-5a6c-4d7e-8f90-1a2b3c4d5e6f"},
+				},
+				GuestAdditions: infoGuestAdditions{Version: "7.0.14 r161095", NivelEjecucion: 2},
+			},
+			encendida: true,
+			discos:    2,
+			valores: map[string]string{
+				"description":      `Laboratorio de redes "grupo 2" en C:\labs`,
+				"BIOS NVRAM File":  "/home/uqcloud/VirtualBox VMs/lab-ubuntu-01/lab-ubuntu-01.nvram",
+				"vrdeport":         "5003",
+				"Forwarding(0)":    "ssh,tcp,,2222,,22",
+				"SATA-discard-0-0": "off",
+			},
+		},
+		{
+			archivo: "showvminfo_windows.txt",
+			esperado: infoMV{
+				Nombre:      "win10-lab",
+				Uuid:        "0d9e8f7a-6b5c-4d3e-a2f1-0e9d8c7b6a54",
+				Estado:      "poweroff",
+				EstadoDesde: time.Date(2024, 1, 15, 8, 0, 0, 0, time.UTC),
+				Ram:         4096,
+				Cpu:         4,
+				Tarjetas: []tarjetaRed{
+					{Numero: 1, Tipo: "hostonly", Mac: "0800271A2B3C", Red: "VirtualBox Host-Only Ethernet Adapter", Conectado: true},
+				},
+				Medios: []medioConectado{
+					{Controlador: "SATA Controller", Puerto: 0, Dispositivo: 0, Ruta: `C:\Users\uqcloud\discos\win10.vdi`, Uuid: "1f2e3d4c-5b6a-4978-8a9b-0c1d2e3f4a5b"},
+				},
+			},
+			discos: 1,
+		},
+	}
+
+	for _, caso := range casos {
+		t.Run(caso.archivo, func(t *testing.T) {
+			info := parsearInfoMV(leerSalida(t, caso.archivo))
+			for clave, esperado := range caso.valores {
+				if info.Valores[clave] != esperado {
+					t.Errorf("Valores[%q] = %q, se esperaba %q", clave, info.Valores[clave], esperado)
+				}
+			}
+			if info.encendida() != caso.encendida {
+				t.Errorf("encendida() = %v, se esperaba %v", info.encendida(), caso.encendida)
+			}
+			if discos := info.discosDuros(); len(discos) != caso.discos {
+				t.Errorf("discosDuros() = %+v, se esperaban %d discos", discos, caso.discos)
+			}
+			info.Valores = nil
+			if !reflect.DeepEqual(info, caso.esperado) {
+				t.Errorf("parsearInfoMV() =\n%+v\nse esperaba\n%+v", info, caso.esperado)
+			}
+		})
+	}
+}
+
+func TestParsearMachineReadable(t *testing.T) {
+	casos := []struct {
+		nombre   string
+		salida   string
+		esperado map[string]string
+	}{
+		{"valor con comillas", `name="mv"`, map[string]string{"name": "mv"}},
+		{"valor sin comillas", "memory=1024", map[string]string{"memory": "1024"}},
+		{"clave con comillas", `"SATA-0-0"="/discos/a.vdi"`, map[string]string{"SATA-0-0": "/discos/a.vdi"}},
+		{"clave con comilla escapada", `"a\"b"="c"`, map[string]string{`a"b`: "c"}},
+		{"valor escapado", `description="dice \"hola\" \\ fin"`, map[string]string{"description": `dice "hola" \ fin`}},
+		{"igual dentro del valor", `vrdeproperty[TCP/Ports]="a=b"`, map[string]string{"vrdeproperty[TCP/Ports]": "a=b"}},
+		{"lìneas invàlidas y CRLF", "sin separador\r\n\"abierta=1\r\ncpus=2\r\n", map[string]string{"cpus": "2"}},
+	}
+	for _, caso := range casos {
+		t.Run(caso.nombre, func(t *testing.T) {
+			if valores := parsearMachineReadable(caso.salida); !reflect.DeepEqual(valores, caso.esperado) {
+				t.Errorf("parsearMachineReadable() = %v, se esperaba %v", valores, caso.esperado)
+			}
+		})
+	}
+}
+
+func TestParsearListaMV(t *testing.T) {
+	casos := []struct {
+		archivo  string
+		esperado []mvRegistrada
+	}{
+		{"list_vms.txt", []mvRegistrada{
+			{Nombre: "lab-ubuntu-01", Uuid: "6f1c2b2e-3c1d-4b8a-9a0e-2f5d7c9e1a10"},
+			{Nombre: "win10-lab", Uuid: "0d9e8f7a-6b5c-4d3e-a2f1-0e9d8c7b6a54"},
+			{Nombre: `Clon de "base" 2`, Uuid: "b7c8d9e0-f1a2-4b3c-8d4e-5f6a7b8c9d0e"},
+			{Nombre: "<inaccessible>", Uuid: "e1f2a3b4-c5d6-4e7f-8091-a2b3c4d5e6f7"},
+		}},
+		{"list_runningvms.txt", []mvRegistrada{
+			{Nombre: "lab-ubuntu-01", Uuid: "6f1c2b2e-3c1d-4b8a-9a0e-2f5d7c9e1a10"},
+		}},
+	}
+	for _, caso := range casos {
+		t.Run(caso.archivo, func(t *testing.T) {
+			if maquinas := parsearListaMV(leerSalida(t, caso.archivo)); !reflect.DeepEqual(maquinas, caso.esperado) {
+				t.Errorf("parsearListaMV() = %+v, se esperaba %+v", maquinas, caso.esperado)
+			}
+		})
+	}
+
+	if maquinas := parsearListaMV(""); maquinas != nil {
+		t.Errorf("parsearListaMV(\"\") = %+v, se esperaba nil", maquinas)
+	}
+}
+
+func TestParsearPropiedadesInvitado(t *testing.T) {
+	red := time.Date(2024, 3, 5, 14, 22, 55, 0, time.UTC)
+	casos := []struct {
+		archivo  string
+		esperado []propiedadInvitado
+	}{
+		{"guestproperty_v6.txt", []propiedadInvitado{
+			{Nombre: "/VirtualBox/GuestInfo/OS/Product", Valor: "Linux", Fecha: time.Unix(0, 1709648560123456000).UTC()},
+			{Nombre: "/VirtualBox/GuestInfo/Net/0/V4/IP", Valor: "10.0.2.15", Fecha: time.Unix(0, 1709648575000000000).UTC()},
+			{Nombre: "/VirtualBox/GuestInfo/Net/1/V4/IP", Valor: "192.168.20.47", Fecha: time.Unix(0, 1709648575000000000).UTC()},
+			{Nombre: "/VirtualBox/GuestInfo/Net/1/MAC", Valor: "080027D4E5F6", Fecha: time.Unix(0, 1709648575000000000).UTC()},
+			{Nombre: "/VirtualBox/GuestInfo/Net/Count", Valor: "2", Fecha: time.Unix(0, 1709648575000000000).UTC()},
+			{Nombre: "/VirtualBox/HostInfo/VBoxVer", Valor: "6.1.50", Fecha: time.Unix(0, 1709648550000000000).UTC(), Banderas: "TRANSIENT, RDONLYGUEST"},
+		}},
+		{"guestproperty_v7.txt", []propiedadInvitado{
+			{Nombre: "/VirtualBox/GuestInfo/OS/Product", Valor: "Linux", Fecha: time.Date(2024, 3, 5, 14, 22, 40, 123456000, time.UTC)},
+			{Nombre: "/VirtualBox/GuestInfo/Net/0/V4/IP", Valor: "10.0.2.15", Fecha: red},
+			{Nombre: "/VirtualBox/GuestInfo/Net/1/V4/IP", Valor: "192.168.20.47", Fecha: red},
+			{Nombre: "/VirtualBox/GuestInfo/Net/1/MAC", Valor: "080027D4E5F6", Fecha: red},
+			{Nombre: "/VirtualBox/GuestInfo/Net/Count", Valor: "2", Fecha: red},
+			{Nombre: "/VirtualBox/HostInfo/VBoxVer", Valor: "7.0.14", Fecha: time.Date(2024, 3, 5, 14, 22, 30, 0, time.UTC), Banderas: "TRANSIENT, RDONLYGUEST"},
+		}},
+	}
+	for _, caso := range casos {
+		t.Run(caso.archivo, func(t *testing.T) {
+			propiedades := parsearPropiedadesInvitado(leerSalida(t, caso.archivo))
+			if len(propiedades) != len(caso.esperado) {
+				t.Fatalf("parsearPropiedadesInvitado() entregò %d propiedades, se esperaban %d: %+v", len(propiedades), len(caso.esperado), propiedades)
+			}
+			for i, esperada := range caso.esperado {
+				propiedad := propiedades[i]
+				if propiedad.Nombre != esperada.Nombre || propiedad.Valor != esperada.Valor || propiedad.Banderas != esperada.Banderas || !propiedad.Fecha.Equal(esperada.Fecha) {
+					t.Errorf("propiedad %d = %+v, se esperaba %+v", i, propiedad, esperada)
+				}
+			}
+		})
+	}
+}
+
+func TestParsearInfoMedio(t *testing.T) {
+	casos := []struct {
+		archivo     string
+		esperado    infoMedio
+		diferencial bool
+	}{
+		{"showmediuminfo_base.txt", infoMedio{Uuid: "3a8f5c2d-7e41-4b9a-8c11-0d2e6f7a9b30", Padre: "base", Capacidad: 20480, Tamanio: 6123}, false},
+		{"showmediuminfo_diferencial.txt", infoMedio{Uuid: "5c6d7e8f-9a0b-4c1d-8e2f-3a4b5c6d7e8f", Padre: "3a8f5c2d-7e41-4b9a-8c11-0d2e6f7a9b30", Capacidad: 20480, Tamanio: 1536}, true},
+	}
+	for _, caso := range casos {
+		t.Run(caso.archivo, func(t *testing.T) {
+			info := parsearInfoMedio(leerSalida(t, caso.archivo))
+			if info != caso.esperado {
+				t.Errorf("parsearInfoMedio() = %+v, se esperaba %+v", info, caso.esperado)
+			}
+			if info.diferencial() != caso.diferencial {
+				t.Errorf("diferencial() = %v, se esperaba %v", info.diferencial(), caso.diferencial)
+			}
+		})
+	}
+}
+
+func TestParsearMegabytes(t *testing.T) {
+	casos := map[string]int{
+		"2048 MBytes":   2048,
+		"1.50 GBytes":   1536,
+		"2 TBytes":      2097152,
+		"1536 KBytes":   2,
+		"1048577 Bytes": 2,
+		"0 MBytes":      0,
+		"MBytes":        0,
+		"n/a MBytes":    0,
+	}
+	for valor, esperado := range casos {
+		if megabytes := parsearMegabytes(valor); megabytes != esperado {
+			t.Errorf("parsearMegabytes(%q) = %d, se esperaba %d", valor, megabytes, esperado)
+		}
+	}
+}
+
+func TestParsearUUIDCreacion(t *testing.T) {
+	casos := []struct {
+		salida   string
+		esperado string
+	}{
+		{leerSalida(t, "createvm.txt"), "6f1c2b2e-3c1d-4b8a-9a0e-2f5d7c9e1a10"},
+		{leerSalida(t, "snapshot_take.txt"), "2b3c4d5e-6f7a-4b8c-9d0e-1f2a3b4c5d6e"},
+		{"VBoxManage: error: Machine settings file already exists", ""},
+	}
+	for _, caso := range casos {
+		if uuid := parsearUUIDCreacion(caso.salida); uuid != caso.esperado {
+			t.Errorf("parsearUUIDCreacion(%q) = %q, se esperaba %q", caso.salida, uuid, caso.esperado)
+		}
+	}
+}
+
+func TestParsearValorPropiedad(t *testing.T) {
+	if valor, ok := parsearValorPropiedad("Value: 10.0.2.15\n"); !ok || valor != "10.0.2.15" {
+		t.Errorf("parsearValorPropiedad() = %q, %v", valor, ok)
+	}
+	if valor, ok := parsearValorPropiedad("No value set!\n"); ok || valor != "" {
+		t.Errorf("parsearValorPropiedad() = %q, %v, se esperaba que no hubiera valor", valor, ok)
+	}
+}
@@ -4,10 +4,10 @@ go 1.19
 
 require (
 	github.com/go-sql-driver/mysql v1.7.1
+	github.com/gorilla/websocket v1.5.0
 	golang.org/x/crypto v0.13.0
 )
 
 require (
-	github.com/gorilla/websocket v1.5.0 // indirect
 	golang.org/x/sys v0.12.0 // indirect
 )